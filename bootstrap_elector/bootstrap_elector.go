@@ -0,0 +1,263 @@
+package bootstrap_elector
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/pkg/errors"
+
+	"github.com/cloudfoundry/galera-init/config"
+	"github.com/cloudfoundry/galera-init/grastate"
+	"github.com/cloudfoundry/galera-init/os_helper"
+	"github.com/cloudfoundry/galera-init/upgrade_coordinator"
+)
+
+type Result string
+
+const (
+	Elected     Result = "ELECTED"
+	NotElected  Result = "NOT_ELECTED"
+	NoLocalData Result = "NO_LOCAL_DATA"
+	// Undecided means the position of a peer was still unknown when
+	// PeerPollingAttempts ran out or ctx was cancelled
+	Undecided Result = "UNDECIDED"
+)
+
+var MakeRequest = func(url string, client http.Client) (*http.Response, error) {
+	return client.Get(url)
+}
+
+//go:generate go run github.com/maxbrunsfeld/counterfeiter/v6 . BootstrapElector
+type BootstrapElector interface {
+	Elect(ctx context.Context) Result
+}
+
+// Phases a node reports on /state once it has decided how to start mysqld.
+// Galera sets the seqno in grastate.dat to -1 while mysqld runs, so peers
+// in these phases report the seqno they had before starting it.
+const (
+	PhaseBootstrapping = "bootstrapping"
+	PhaseJoining       = "joining"
+)
+
+// PeerState is the subset of a peer's galera-init /state response used for the election
+type PeerState struct {
+	NodeID string `json:"node_id"`
+	UUID   string `json:"uuid"`
+	Seqno  int64  `json:"seqno"`
+	Phase  string `json:"phase"`
+}
+
+type httpBootstrapElector struct {
+	nodeID   string
+	config   config.StartManager
+	osHelper os_helper.OsHelper
+	logger   lager.Logger
+}
+
+func NewBootstrapElector(
+	nodeID string,
+	config config.StartManager,
+	osHelper os_helper.OsHelper,
+	logger lager.Logger,
+) BootstrapElector {
+	return httpBootstrapElector{
+		nodeID:   nodeID,
+		config:   config,
+		osHelper: osHelper,
+		logger:   logger,
+	}
+}
+
+// Elect compares the local grastate.dat with the state every peer reports and
+// only returns Elected when this node holds the highest seqno of the cluster.
+// Ties are broken by the order of ClusterIps. Peers are polled until the
+// position of each is known. A peer that is bootstrapping or running is never
+// competed with. When a position is still unknown after PeerPollingAttempts,
+// or ctx is cancelled, the election is Undecided.
+func (e httpBootstrapElector) Elect(ctx context.Context) Result {
+	local, err := e.readLocalGrastate()
+	if err != nil {
+		e.logger.Error("bootstrap-election-read-grastate-failed", err)
+		return NotElected
+	}
+
+	if !local.HasData() {
+		e.logger.Info("bootstrap-election-no-local-data")
+		return NoLocalData
+	}
+
+	if !local.HasKnownPosition() {
+		e.logger.Info("bootstrap-election-local-seqno-unknown", lager.Data{
+			"uuid": local.UUID,
+		})
+		return NotElected
+	}
+
+	_, port, err := net.SplitHostPort(e.config.GaleraInitStatusServerAddress)
+	if err != nil {
+		e.logger.Error("bootstrap-election-invalid-status-server-address", err)
+		return NotElected
+	}
+
+	for attempt := 1; ; attempt++ {
+		candidates, result, err := e.collectCandidates(port, local)
+		if result != "" {
+			return result
+		}
+		if err == nil {
+			return e.decide(local, candidates)
+		}
+
+		if attempt >= e.config.PeerPollingAttempts {
+			e.logger.Error("bootstrap-election-timeout", err, lager.Data{
+				"attempts": attempt,
+			})
+			return Undecided
+		}
+
+		e.logger.Info("bootstrap-election-waiting-for-peers", lager.Data{
+			"attempt": attempt,
+			"error":   err.Error(),
+		})
+		if err := e.osHelper.Sleep(ctx, time.Duration(e.config.PeerPollingDelay)*time.Second); err != nil {
+			e.logger.Info("bootstrap-election-cancelled", lager.Data{
+				"attempt": attempt,
+			})
+			return Undecided
+		}
+	}
+}
+
+func (e httpBootstrapElector) readLocalGrastate() (grastate.Grastate, error) {
+	if !e.osHelper.FileExists(e.config.GrastateFileLocation) {
+		return grastate.Grastate{Seqno: grastate.UnknownSeqno}, nil
+	}
+
+	contents, err := e.osHelper.ReadFile(e.config.GrastateFileLocation)
+	if err != nil {
+		return grastate.Grastate{}, err
+	}
+
+	return grastate.Parse(contents)
+}
+
+// candidate is a peer whose position takes part in the election
+type candidate struct {
+	ip     string
+	nodeID string
+	seqno  int64
+}
+
+// collectCandidates asks every peer for its state once. An error names a
+// peer whose position is not known yet, e.g. because it does not answer or
+// is still recovering its position. A result ends the election at once.
+func (e httpBootstrapElector) collectCandidates(port string, local grastate.Grastate) ([]candidate, Result, error) {
+	var candidates []candidate
+	var waitFor error
+
+	for _, ip := range e.config.ClusterIps {
+		peer, err := e.fetchPeerState(ip, port)
+		if err != nil {
+			if waitFor == nil {
+				waitFor = err
+			}
+			continue
+		}
+
+		peerGrastate := grastate.Grastate{UUID: peer.UUID, Seqno: peer.Seqno}
+		if !peerGrastate.HasData() {
+			continue
+		}
+
+		if peer.UUID != local.UUID {
+			e.logger.Info("bootstrap-election-cluster-uuid-mismatch", lager.Data{
+				"peer":      ip,
+				"localUUID": local.UUID,
+				"peerUUID":  peer.UUID,
+			})
+			return nil, NotElected, nil
+		}
+
+		switch peer.Phase {
+		case PhaseBootstrapping:
+			e.logger.Info("bootstrap-election-peer-bootstrapping", lager.Data{
+				"peer": ip,
+			})
+			return nil, NotElected, nil
+		case upgrade_coordinator.PhaseRunning:
+			e.logger.Info("bootstrap-election-peer-running", lager.Data{
+				"peer": ip,
+			})
+			return nil, NotElected, nil
+		}
+
+		if !peerGrastate.HasKnownPosition() {
+			if waitFor == nil {
+				waitFor = errors.Errorf("peer %s does not know its seqno yet", ip)
+			}
+			continue
+		}
+
+		candidates = append(candidates, candidate{ip: ip, nodeID: peer.NodeID, seqno: peer.Seqno})
+	}
+
+	return candidates, "", waitFor
+}
+
+func (e httpBootstrapElector) fetchPeerState(ip, port string) (*PeerState, error) {
+	client := http.Client{
+		Timeout: time.Duration(e.config.ClusterProbeTimeout) * time.Second,
+	}
+
+	resp, err := MakeRequest("http://"+net.JoinHostPort(ip, port)+"/state", client)
+	if err != nil {
+		return nil, errors.Wrapf(err, "peer %s did not report its state", ip)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("peer %s responded with status %d", ip, resp.StatusCode)
+	}
+
+	var peer PeerState
+	if err := json.NewDecoder(resp.Body).Decode(&peer); err != nil {
+		return nil, errors.Wrapf(err, "peer %s reported an invalid state", ip)
+	}
+
+	return &peer, nil
+}
+
+// decide elects the candidate with the highest seqno, the first in
+// ClusterIps on a tie
+func (e httpBootstrapElector) decide(local grastate.Grastate, candidates []candidate) Result {
+	winner := -1
+	for i, c := range candidates {
+		if winner == -1 || c.seqno > candidates[winner].seqno {
+			winner = i
+		}
+	}
+
+	peers := map[string]int64{}
+	for _, c := range candidates {
+		peers[c.ip] = c.seqno
+	}
+
+	if winner == -1 || candidates[winner].nodeID != e.nodeID {
+		e.logger.Info("bootstrap-election-lost", lager.Data{
+			"localSeqno": local.Seqno,
+			"peers":      peers,
+		})
+		return NotElected
+	}
+
+	e.logger.Info("bootstrap-election-won", lager.Data{
+		"localSeqno": local.Seqno,
+		"peers":      peers,
+	})
+	return Elected
+}
@@ -0,0 +1,13 @@
+package bootstrap_elector_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestBootstrapElector(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "BootstrapElector Suite")
+}
@@ -0,0 +1,205 @@
+package bootstrap_elector_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/lager/lagertest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/cloudfoundry/galera-init/bootstrap_elector"
+	"github.com/cloudfoundry/galera-init/config"
+	"github.com/cloudfoundry/galera-init/os_helper/os_helperfakes"
+)
+
+var _ = Describe("BootstrapElector", func() {
+	const clusterUUID = "8bd3bf94-3b65-11ea-a4ea-8bd1cbb0c6b8"
+
+	var (
+		elector     BootstrapElector
+		fakeOs      *os_helperfakes.FakeOsHelper
+		testLogger  *lagertest.TestLogger
+		peerStates  map[string]string
+		requestURLs []string
+	)
+
+	peerResponse := func(nodeID, uuid string, seqno int) string {
+		return fmt.Sprintf(`{"node_id":%q,"uuid":%q,"seqno":%d}`, nodeID, uuid, seqno)
+	}
+
+	peerResponseInPhase := func(nodeID, uuid string, seqno int, phase string) string {
+		return fmt.Sprintf(`{"node_id":%q,"uuid":%q,"seqno":%d,"phase":%q}`, nodeID, uuid, seqno, phase)
+	}
+
+	BeforeEach(func() {
+		fakeOs = new(os_helperfakes.FakeOsHelper)
+		testLogger = lagertest.NewTestLogger("bootstrap_elector")
+
+		fakeOs.FileExistsReturns(true)
+		fakeOs.ReadFileReturns(fmt.Sprintf("uuid: %s\nseqno: 20\n", clusterUUID), nil)
+
+		requestURLs = []string{}
+		peerStates = map[string]string{
+			"10.0.0.1": peerResponse("other-node-1", clusterUUID, 10),
+			"10.0.0.2": peerResponse("this-node", clusterUUID, 20),
+			"10.0.0.3": peerResponse("other-node-3", clusterUUID, 15),
+		}
+		MakeRequest = func(url string, client http.Client) (*http.Response, error) {
+			requestURLs = append(requestURLs, url)
+			for ip, body := range peerStates {
+				if strings.Contains(url, ip) {
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Body:       ioutil.NopCloser(strings.NewReader(body)),
+					}, nil
+				}
+			}
+			return nil, errors.New("connection refused")
+		}
+
+		elector = NewBootstrapElector(
+			"this-node",
+			config.StartManager{
+				GrastateFileLocation:          "/some/grastate.dat",
+				ClusterIps:                    []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"},
+				ClusterProbeTimeout:           10,
+				GaleraInitStatusServerAddress: "0.0.0.0:8114",
+				PeerPollingAttempts:           3,
+				PeerPollingDelay:              5,
+			},
+			fakeOs,
+			testLogger,
+		)
+	})
+
+	It("asks every peer's galera-init status server for its state", func() {
+		elector.Elect(context.TODO())
+		Expect(requestURLs).To(Equal([]string{
+			"http://10.0.0.1:8114/state",
+			"http://10.0.0.2:8114/state",
+			"http://10.0.0.3:8114/state",
+		}))
+		Expect(fakeOs.ReadFileArgsForCall(0)).To(Equal("/some/grastate.dat"))
+	})
+
+	It("elects this node when it holds the highest seqno", func() {
+		Expect(elector.Elect(context.TODO())).To(Equal(Elected))
+	})
+
+	It("does not elect this node when a peer holds a higher seqno", func() {
+		peerStates["10.0.0.3"] = peerResponse("other-node-3", clusterUUID, 21)
+		Expect(elector.Elect(context.TODO())).To(Equal(NotElected))
+	})
+
+	It("breaks ties in favour of the first node in ClusterIps", func() {
+		peerStates["10.0.0.1"] = peerResponse("other-node-1", clusterUUID, 20)
+		Expect(elector.Elect(context.TODO())).To(Equal(NotElected))
+	})
+
+	It("ignores peers that have never joined a cluster", func() {
+		peerStates["10.0.0.1"] = peerResponse("other-node-1", "", -1)
+		Expect(elector.Elect(context.TODO())).To(Equal(Elected))
+	})
+
+	It("does not elect this node when a peer belongs to another cluster", func() {
+		peerStates["10.0.0.3"] = peerResponse("other-node-3", "some-other-uuid", 1)
+		Expect(elector.Elect(context.TODO())).To(Equal(NotElected))
+	})
+
+	Context("when a peer does not know its seqno yet", func() {
+		BeforeEach(func() {
+			peerStates["10.0.0.3"] = peerResponseInPhase("other-node-3", clusterUUID, -1, "starting-mysqld")
+		})
+
+		It("retries before giving up undecided", func() {
+			Expect(elector.Elect(context.TODO())).To(Equal(Undecided))
+			Expect(fakeOs.SleepCallCount()).To(Equal(2))
+		})
+
+		It("elects this node once the peer recovered a lower seqno", func() {
+			fakeOs.SleepStub = func(context.Context, time.Duration) error {
+				peerStates["10.0.0.3"] = peerResponse("other-node-3", clusterUUID, 15)
+				return nil
+			}
+
+			Expect(elector.Elect(context.TODO())).To(Equal(Elected))
+			Expect(fakeOs.SleepCallCount()).To(Equal(1))
+		})
+	})
+
+	It("does not elect this node when a peer is already running", func() {
+		peerStates["10.0.0.3"] = peerResponseInPhase("other-node-3", clusterUUID, -1, "running")
+		Expect(elector.Elect(context.TODO())).To(Equal(NotElected))
+		Expect(fakeOs.SleepCallCount()).To(Equal(0))
+	})
+
+	It("compares with the seqno a joining peer had before starting mysqld", func() {
+		peerStates["10.0.0.3"] = peerResponseInPhase("other-node-3", clusterUUID, 30, PhaseJoining)
+		Expect(elector.Elect(context.TODO())).To(Equal(NotElected))
+	})
+
+	It("elects this node over a joining peer with a lower seqno", func() {
+		peerStates["10.0.0.3"] = peerResponseInPhase("other-node-3", clusterUUID, 15, PhaseJoining)
+		Expect(elector.Elect(context.TODO())).To(Equal(Elected))
+	})
+
+	It("does not elect this node when a peer is already bootstrapping", func() {
+		peerStates["10.0.0.1"] = peerResponseInPhase("other-node-1", clusterUUID, -1, PhaseBootstrapping)
+		Expect(elector.Elect(context.TODO())).To(Equal(NotElected))
+		Expect(fakeOs.SleepCallCount()).To(Equal(0))
+	})
+
+	Context("when a peer does not respond", func() {
+		BeforeEach(func() {
+			delete(peerStates, "10.0.0.3")
+		})
+
+		It("retries before giving up undecided", func() {
+			Expect(elector.Elect(context.TODO())).To(Equal(Undecided))
+			Expect(fakeOs.SleepCallCount()).To(Equal(2))
+			_, delay := fakeOs.SleepArgsForCall(0)
+			Expect(delay).To(Equal(5 * time.Second))
+		})
+	})
+
+	Context("when the context is cancelled while waiting for peers", func() {
+		BeforeEach(func() {
+			MakeRequest = func(url string, client http.Client) (*http.Response, error) {
+				return nil, errors.New("connection refused")
+			}
+			fakeOs.SleepReturns(context.Canceled)
+		})
+
+		It("stops waiting undecided", func() {
+			Expect(elector.Elect(context.TODO())).To(Equal(Undecided))
+			Expect(fakeOs.SleepCallCount()).To(Equal(1))
+		})
+	})
+
+	Context("when the local seqno is unknown", func() {
+		BeforeEach(func() {
+			fakeOs.ReadFileReturns(fmt.Sprintf("uuid: %s\nseqno: -1\n", clusterUUID), nil)
+		})
+
+		It("is not elected and does not ask the peers", func() {
+			Expect(elector.Elect(context.TODO())).To(Equal(NotElected))
+			Expect(requestURLs).To(BeEmpty())
+		})
+	})
+
+	Context("when there is no local grastate", func() {
+		BeforeEach(func() {
+			fakeOs.FileExistsReturns(false)
+		})
+
+		It("reports that there is no local data", func() {
+			Expect(elector.Elect(context.TODO())).To(Equal(NoLocalData))
+		})
+	})
+})
@@ -0,0 +1,111 @@
+// Code generated by counterfeiter. DO NOT EDIT.
+package bootstrap_electorfakes
+
+import (
+	"context"
+	"sync"
+
+	"github.com/cloudfoundry/galera-init/bootstrap_elector"
+)
+
+type FakeBootstrapElector struct {
+	ElectStub        func(context.Context) bootstrap_elector.Result
+	electMutex       sync.RWMutex
+	electArgsForCall []struct {
+		arg1 context.Context
+	}
+	electReturns struct {
+		result1 bootstrap_elector.Result
+	}
+	electReturnsOnCall map[int]struct {
+		result1 bootstrap_elector.Result
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *FakeBootstrapElector) Elect(arg1 context.Context) bootstrap_elector.Result {
+	fake.electMutex.Lock()
+	ret, specificReturn := fake.electReturnsOnCall[len(fake.electArgsForCall)]
+	fake.electArgsForCall = append(fake.electArgsForCall, struct {
+		arg1 context.Context
+	}{arg1})
+	fake.recordInvocation("Elect", []interface{}{arg1})
+	fake.electMutex.Unlock()
+	if fake.ElectStub != nil {
+		return fake.ElectStub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	fakeReturns := fake.electReturns
+	return fakeReturns.result1
+}
+
+func (fake *FakeBootstrapElector) ElectCallCount() int {
+	fake.electMutex.RLock()
+	defer fake.electMutex.RUnlock()
+	return len(fake.electArgsForCall)
+}
+
+func (fake *FakeBootstrapElector) ElectCalls(stub func(context.Context) bootstrap_elector.Result) {
+	fake.electMutex.Lock()
+	defer fake.electMutex.Unlock()
+	fake.ElectStub = stub
+}
+
+func (fake *FakeBootstrapElector) ElectArgsForCall(i int) context.Context {
+	fake.electMutex.RLock()
+	defer fake.electMutex.RUnlock()
+	argsForCall := fake.electArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeBootstrapElector) ElectReturns(result1 bootstrap_elector.Result) {
+	fake.electMutex.Lock()
+	defer fake.electMutex.Unlock()
+	fake.ElectStub = nil
+	fake.electReturns = struct {
+		result1 bootstrap_elector.Result
+	}{result1}
+}
+
+func (fake *FakeBootstrapElector) ElectReturnsOnCall(i int, result1 bootstrap_elector.Result) {
+	fake.electMutex.Lock()
+	defer fake.electMutex.Unlock()
+	fake.ElectStub = nil
+	if fake.electReturnsOnCall == nil {
+		fake.electReturnsOnCall = make(map[int]struct {
+			result1 bootstrap_elector.Result
+		})
+	}
+	fake.electReturnsOnCall[i] = struct {
+		result1 bootstrap_elector.Result
+	}{result1}
+}
+
+func (fake *FakeBootstrapElector) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.electMutex.RLock()
+	defer fake.electMutex.RUnlock()
+	copiedInvocations := map[string][][]interface{}{}
+	for key, value := range fake.invocations {
+		copiedInvocations[key] = value
+	}
+	return copiedInvocations
+}
+
+func (fake *FakeBootstrapElector) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ bootstrap_elector.BootstrapElector = new(FakeBootstrapElector)
@@ -0,0 +1,51 @@
+// hash-password prints the hash of the password on stdin for use as
+// PasswordHash in galera-init's config, so the config need not carry the
+// password itself
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/cloudfoundry/galera-init/db_helper/auth"
+)
+
+func main() {
+	plugin := flag.String("plugin", auth.PluginNativePassword,
+		fmt.Sprintf("authentication plugin to hash the password for, one of %s", strings.Join(auth.Plugins, ", ")))
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [-plugin plugin] < password-file\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() > 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	input, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		fail(err)
+	}
+
+	password := strings.TrimSuffix(strings.TrimSuffix(string(input), "\n"), "\r")
+	if password == "" {
+		fail(fmt.Errorf("no password given on stdin"))
+	}
+
+	hash, err := auth.Hash(*plugin, password)
+	if err != nil {
+		fail(err)
+	}
+
+	fmt.Println(hash)
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "hash-password: %s\n", err)
+	os.Exit(1)
+}
@@ -0,0 +1,26 @@
+package main_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gexec"
+)
+
+var hashPasswordPath string
+
+func TestHashPassword(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Hash Password Executable Suite")
+}
+
+var _ = BeforeSuite(func() {
+	var err error
+	hashPasswordPath, err = gexec.Build("github.com/cloudfoundry/galera-init/cmd/hash-password")
+	Expect(err).NotTo(HaveOccurred())
+})
+
+var _ = AfterSuite(func() {
+	gexec.CleanupBuildArtifacts()
+})
@@ -0,0 +1,54 @@
+package main_test
+
+import (
+	"os/exec"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/gexec"
+
+	"github.com/cloudfoundry/galera-init/db_helper/auth"
+)
+
+var _ = Describe("hash-password", func() {
+	run := func(stdin string, args ...string) *gexec.Session {
+		command := exec.Command(hashPasswordPath, args...)
+		command.Stdin = strings.NewReader(stdin)
+
+		session, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(session).Should(gexec.Exit())
+		return session
+	}
+
+	It("prints the mysql_native_password hash of the password on stdin", func() {
+		session := run("password\n")
+
+		Expect(session.ExitCode()).To(Equal(0))
+		Expect(session.Out).To(gbytes.Say(`^\*2470C0C06DEE42FD1618BB99005ADCA2EC9D1E19\n$`))
+	})
+
+	It("prints a caching_sha2_password hash", func() {
+		session := run("password", "-plugin", "caching_sha2_password")
+
+		Expect(session.ExitCode()).To(Equal(0))
+		hash := strings.TrimSuffix(string(session.Out.Contents()), "\n")
+		Expect(auth.ValidateHash("caching_sha2_password", hash)).To(Succeed())
+	})
+
+	It("fails for an unknown plugin", func() {
+		session := run("password", "-plugin", "sha256_password")
+
+		Expect(session.ExitCode()).To(Equal(1))
+		Expect(session.Err).To(gbytes.Say(`"sha256_password" must be one of mysql_native_password, caching_sha2_password`))
+	})
+
+	It("fails without a password", func() {
+		session := run("\n")
+
+		Expect(session.ExitCode()).To(Equal(1))
+		Expect(session.Err).To(gbytes.Say("no password given on stdin"))
+	})
+})
@@ -8,7 +8,9 @@ import (
 	"syscall"
 
 	"code.cloudfoundry.org/lager"
+	"github.com/google/uuid"
 
+	"github.com/cloudfoundry/galera-init/bootstrap_elector"
 	"github.com/cloudfoundry/galera-init/cluster_health_checker"
 	"github.com/cloudfoundry/galera-init/config"
 	"github.com/cloudfoundry/galera-init/db_helper"
@@ -16,10 +18,15 @@ import (
 	"github.com/cloudfoundry/galera-init/os_helper"
 	"github.com/cloudfoundry/galera-init/start_manager"
 	"github.com/cloudfoundry/galera-init/start_manager/node_starter"
+	"github.com/cloudfoundry/galera-init/upgrade_coordinator"
 	"github.com/cloudfoundry/galera-init/upgrader"
+	"github.com/cloudfoundry/galera-init/upgrader/snapshot"
 	"net"
 )
 
+// version is set at build time with -ldflags "-X main.version=..."
+var version = "dev"
+
 func main() {
 
 	cfg, err := config.NewConfig(os.Args)
@@ -68,9 +75,15 @@ func main() {
 func managerSetup(cfg *config.Config) (start_manager.StartManager, error) {
 	OsHelper := os_helper.NewImpl()
 
+	Flavor, err := db_helper.NewFlavor(cfg.Db.Flavor)
+	if err != nil {
+		return nil, err
+	}
+
 	DBHelper := db_helper.NewDBHelper(
 		OsHelper,
 		&cfg.Db,
+		Flavor,
 		cfg.LogFileLocation,
 		cfg.Logger,
 	)
@@ -80,6 +93,7 @@ func managerSetup(cfg *config.Config) (start_manager.StartManager, error) {
 		cfg.Upgrader,
 		cfg.Logger,
 		DBHelper,
+		snapshot.NewSnapshotter(OsHelper, cfg.Upgrader.Snapshot, cfg.Logger),
 	)
 
 	ClusterHealthChecker := cluster_health_checker.NewClusterHealthChecker(
@@ -88,12 +102,21 @@ func managerSetup(cfg *config.Config) (start_manager.StartManager, error) {
 		cfg.Logger,
 	)
 
-	NodeStarter := node_starter.NewStarter(
-		DBHelper,
+	nodeID := uuid.New().String()
+
+	BootstrapElector := bootstrap_elector.NewBootstrapElector(
+		nodeID,
+		cfg.Manager,
 		OsHelper,
+		cfg.Logger,
+	)
+
+	UpgradeCoordinator := upgrade_coordinator.NewUpgradeCoordinator(
+		nodeID,
 		cfg.Manager,
+		cfg.Upgrader,
+		OsHelper,
 		cfg.Logger,
-		ClusterHealthChecker,
 	)
 
 	listener, err := net.Listen("tcp", cfg.Manager.GaleraInitStatusServerAddress)
@@ -101,17 +124,36 @@ func managerSetup(cfg *config.Config) (start_manager.StartManager, error) {
 		return nil, err
 	}
 
-	galeraInitStatusServer := galera_init_status_server.NewGaleraInitStatusServer(listener)
+	galeraInitStatusServer := galera_init_status_server.NewGaleraInitStatusServer(
+		listener,
+		OsHelper,
+		nodeID,
+		cfg.Manager,
+		cfg.Upgrader,
+	)
+	galeraInitStatusServer.Serve()
+
+	NodeStarter := node_starter.NewStarter(
+		DBHelper,
+		OsHelper,
+		cfg.Manager,
+		cfg.Logger,
+		ClusterHealthChecker,
+		BootstrapElector,
+		galeraInitStatusServer,
+	)
 
 	NodeStartManager := start_manager.New(
 		OsHelper,
 		cfg.Manager,
 		DBHelper,
 		Upgrader,
+		UpgradeCoordinator,
 		NodeStarter,
 		cfg.Logger,
 		ClusterHealthChecker,
 		galeraInitStatusServer,
+		version,
 	)
 
 	return NodeStartManager, nil
@@ -120,11 +162,11 @@ func managerSetup(cfg *config.Config) (start_manager.StartManager, error) {
 func setupSignals(shutdownMySQL func(), log lager.Logger) {
 	sigCh := make(chan os.Signal, 1)
 
-	signal.Notify(sigCh, syscall.SIGTERM)
+	signal.Notify(sigCh, syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT)
 
 	go func() {
 		for sig := range sigCh {
-			log.Info("sigterm-received", lager.Data{
+			log.Info("shutdown-signal-received", lager.Data{
 				"signal": sig,
 			})
 			shutdownMySQL()
@@ -4,13 +4,79 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
 
 	"code.cloudfoundry.org/lager"
 	"code.cloudfoundry.org/lager/lagerflags"
 	"github.com/pivotal-cf-experimental/service-config"
 	"gopkg.in/validator.v2"
+
+	"github.com/cloudfoundry/galera-init/db_helper/auth"
+	"github.com/cloudfoundry/galera-init/db_helper/sql_builder"
+)
+
+const (
+	FlavorPXC     = "pxc"
+	FlavorMariaDB = "mariadb"
+
+	UpgradeStrategyMysqlUpgrade = "mysql_upgrade"
+	UpgradeStrategyServer       = "server"
+
+	ServerUpgradeModeAuto  = "AUTO"
+	ServerUpgradeModeForce = "FORCE"
+
+	SnapshotMethodReflink = "reflink"
+	SnapshotMethodCommand = "command"
+
+	StaleAccountPolicyKeep = "keep"
+	StaleAccountPolicyLock = "lock"
+	StaleAccountPolicyDrop = "drop"
+
+	RoleAdmin       = "admin"
+	RoleMinimal     = "minimal"
+	RoleMonitoring  = "monitoring"
+	RoleBackup      = "backup"
+	RoleReplication = "replication"
+	RoleReadOnly    = "read-only"
 )
 
+// Binaries names the programs a flavor ships, looked up on PATH
+type Binaries struct {
+	Mysqld     string
+	Mysqladmin string
+	Upgrade    string
+}
+
+// FlavorBinaries are what Db.MysqldPath, Db.MysqladminPath and Db.UpgradePath
+// default to for each flavor
+var FlavorBinaries = map[string]Binaries{
+	FlavorPXC: {
+		Mysqld:     "mysqld",
+		Mysqladmin: "mysqladmin",
+		Upgrade:    "mysql_upgrade",
+	},
+	FlavorMariaDB: {
+		Mysqld:     "mariadbd",
+		Mysqladmin: "mariadb-admin",
+		Upgrade:    "mariadb-upgrade",
+	},
+}
+
+// BuiltinRoles can be given as a SeededUser's Role without defining them in Roles
+var BuiltinRoles = []string{
+	RoleAdmin,
+	RoleMinimal,
+	RoleMonitoring,
+	RoleBackup,
+	RoleReplication,
+	RoleReadOnly,
+}
+
 type Config struct {
 	LogFileLocation string       `yaml:"LogFileLocation" validate:"nonzero"`
 	Db              DBHelper     `yaml:"Db"`
@@ -20,12 +86,24 @@ type Config struct {
 }
 
 type DBHelper struct {
+	BootstrapExtraArgs []string            `yaml:"BootstrapExtraArgs"`
+	Flavor             string              `yaml:"Flavor"`
+	JoinExtraArgs      []string            `yaml:"JoinExtraArgs"`
+	MyCnfPath          string              `yaml:"MyCnfPath" validate:"nonzero"`
+	MyLoginCnfPath     string              `yaml:"MyLoginCnfPath" validate:"nonzero"`
+	MysqladminPath     string              `yaml:"MysqladminPath" validate:"nonzero"`
+	MysqldPath         string              `yaml:"MysqldPath" validate:"nonzero"`
 	Password           string              `yaml:"Password"`
+	PasswordFile       string              `yaml:"PasswordFile"`
+	PasswordEnv        string              `yaml:"PasswordEnv"`
 	PostStartSQLFiles  []string            `yaml:"PostStartSQLFiles"`
 	PreseededDatabases []PreseededDatabase `yaml:"PreseededDatabases"`
+	Roles              []Role              `yaml:"Roles"`
 	SeededUsers        []SeededUser        `yaml:"SeededUsers"`
 	SkipBinlog         bool                `yaml:"SkipBinlog"`
+	StaleAccountPolicy string              `yaml:"StaleAccountPolicy"`
 	Socket             string              `yaml:"Socket"`
+	UpgradeExtraArgs   []string            `yaml:"UpgradeExtraArgs"`
 	UpgradePath        string              `yaml:"UpgradePath" validate:"nonzero"`
 	User               string              `yaml:"User" validate:"nonzero"`
 }
@@ -37,24 +115,254 @@ type StartManager struct {
 	BootstrapNode                 bool     `yaml:"BootstrapNode"`
 	ClusterProbeTimeout           int      `yaml:"ClusterProbeTimeout" validate:"nonzero"`
 	GaleraInitStatusServerAddress string   `yaml:"GaleraInitStatusServerAddress" validate:"nonzero"`
+	SeqnoAwareBootstrap           bool     `yaml:"SeqnoAwareBootstrap"`
+	PeerPollingAttempts           int      `yaml:"PeerPollingAttempts" validate:"nonzero"`
+	PeerPollingDelay              int      `yaml:"PeerPollingDelay" validate:"nonzero"`
+	Supervise                     bool     `yaml:"Supervise"`
+	SupervisorMaxCrashes          int      `yaml:"SupervisorMaxCrashes"`
+	SupervisorInitialBackoff      int      `yaml:"SupervisorInitialBackoff"`
+	SupervisorMaxBackoff          int      `yaml:"SupervisorMaxBackoff"`
+	StartupPollInterval           int      `yaml:"StartupPollInterval"`
+	StartupTimeout                int      `yaml:"StartupTimeout"`
+	StartupSSTGracePeriod         int      `yaml:"StartupSSTGracePeriod"`
+	ShutdownGracePeriod           int      `yaml:"ShutdownGracePeriod"`
 }
 
 type Upgrader struct {
-	PackageVersionFile      string `yaml:"PackageVersionFile" validate:"nonzero"`
-	LastUpgradedVersionFile string `yaml:"LastUpgradedVersionFile" validate:"nonzero"`
+	PackageVersionFile         string          `yaml:"PackageVersionFile" validate:"nonzero"`
+	LastUpgradedVersionFile    string          `yaml:"LastUpgradedVersionFile" validate:"nonzero"`
+	Strategy                   string          `yaml:"Strategy"`
+	ServerUpgradeMode          string          `yaml:"ServerUpgradeMode"`
+	Snapshot                   UpgradeSnapshot `yaml:"Snapshot"`
+	AllowDowngrade             bool            `yaml:"AllowDowngrade"`
+	MajorUpgradeCheckCommand   []string        `yaml:"MajorUpgradeCheckCommand"`
+	ToleratedUpgradeErrors     []string        `yaml:"ToleratedUpgradeErrors"`
+	FatalUpgradeErrors         []string        `yaml:"FatalUpgradeErrors"`
+	CoordinateWithPeers        bool            `yaml:"CoordinateWithPeers"`
+	CoordinationPollInterval   int             `yaml:"CoordinationPollInterval"`
+	CoordinationTimeout        int             `yaml:"CoordinationTimeout"`
+	DBReachablePollingAttempts int             `yaml:"DBReachablePollingAttempts" validate:"nonzero"`
+	DBReachablePollingDelay    int             `yaml:"DBReachablePollingDelay" validate:"nonzero"`
+	UpgradeTimeout             int             `yaml:"UpgradeTimeout"`
+	StopMysqldTimeout          int             `yaml:"StopMysqldTimeout"`
 }
 
+// DefaultToleratedUpgradeErrors are mysql_upgrade errors that do not stop
+// galera-init from starting mysqld
+var DefaultToleratedUpgradeErrors = []string{
+	"already upgraded",
+	"Unknown command",
+	"WSREP has not yet prepared node",
+}
+
+// UpgradeSnapshot configures the copy of the data directory taken before an
+// upgrade and restored when the upgrade fails
+type UpgradeSnapshot struct {
+	Enabled        bool     `yaml:"Enabled"`
+	DataDirectory  string   `yaml:"DataDirectory"`
+	Directory      string   `yaml:"Directory"`
+	Method         string   `yaml:"Method"`
+	BackupCommand  []string `yaml:"BackupCommand"`
+	RestoreCommand []string `yaml:"RestoreCommand"`
+	Retain         int      `yaml:"Retain"`
+}
+
+// PreseededDatabase is created along with its user. Further users, e.g.
+// read-only reporting accounts, are listed in Users with their own privileges.
 type PreseededDatabase struct {
-	DBName   string `yaml:"DBName" validate:"nonzero"`
-	User     string `yaml:"User" validate:"nonzero"`
-	Password string `yaml:"Password"`
+	DBName       string                  `yaml:"DBName" validate:"nonzero"`
+	User         string                  `yaml:"User" validate:"nonzero"`
+	Password     string                  `yaml:"Password"`
+	PasswordFile string                  `yaml:"PasswordFile"`
+	PasswordEnv  string                  `yaml:"PasswordEnv"`
+	AuthPlugin   string                  `yaml:"AuthPlugin"`
+	PasswordHash string                  `yaml:"PasswordHash"`
+	Hosts        []string                `yaml:"Hosts"`
+	Privileges   []string                `yaml:"Privileges"`
+	ReadOnly     bool                    `yaml:"ReadOnly"`
+	Users        []PreseededDatabaseUser `yaml:"Users"`
+}
+
+// PreseededDatabaseUser is granted privileges on a preseeded database from
+// each of Hosts, '%' when none are given. Without Privileges the user gets
+// every privilege but LOCK TABLES; ReadOnly grants SELECT and SHOW VIEW.
+// AuthPlugin and PasswordHash work as for SeededUser.
+type PreseededDatabaseUser struct {
+	User         string   `yaml:"User" validate:"nonzero"`
+	Password     string   `yaml:"Password"`
+	PasswordFile string   `yaml:"PasswordFile"`
+	PasswordEnv  string   `yaml:"PasswordEnv"`
+	AuthPlugin   string   `yaml:"AuthPlugin"`
+	PasswordHash string   `yaml:"PasswordHash"`
+	Hosts        []string `yaml:"Hosts"`
+	Privileges   []string `yaml:"Privileges"`
+	ReadOnly     bool     `yaml:"ReadOnly"`
+}
+
+// DatabaseUsers returns the database's own user followed by Users
+func (d PreseededDatabase) DatabaseUsers() []PreseededDatabaseUser {
+	return append([]PreseededDatabaseUser{{
+		User:         d.User,
+		Password:     d.Password,
+		PasswordFile: d.PasswordFile,
+		PasswordEnv:  d.PasswordEnv,
+		AuthPlugin:   d.AuthPlugin,
+		PasswordHash: d.PasswordHash,
+		Hosts:        d.Hosts,
+		Privileges:   d.Privileges,
+		ReadOnly:     d.ReadOnly,
+	}}, d.Users...)
+}
+
+// AccountHosts returns the host part of each of the user's accounts,
+// without duplicates, or % when no host is given. See AccountHost for the
+// hosts that can be given.
+func (u PreseededDatabaseUser) AccountHosts() ([]string, error) {
+	if len(u.Hosts) == 0 {
+		return []string{"%"}, nil
+	}
+	return accountHosts(u.Hosts)
 }
 
+// Role is a set of grants SeededUsers can be given in addition to the
+// BuiltinRoles. A user given the role loses every privilege it does not grant.
+type Role struct {
+	Name   string      `yaml:"Name" validate:"nonzero"`
+	Grants []RoleGrant `yaml:"Grants" validate:"nonzero"`
+}
+
+// RoleGrant grants Privileges on On, which is *.*, db.* or db.table
+type RoleGrant struct {
+	Privileges      []string `yaml:"Privileges" validate:"nonzero"`
+	On              string   `yaml:"On" validate:"nonzero"`
+	WithGrantOption bool     `yaml:"WithGrantOption"`
+}
+
+// SeededUser is created from Host and each of Hosts, as a separate account
+// per host with the same password and role. See AccountHost for the hosts
+// that can be given.
+//
+// AuthPlugin picks the authentication plugin instead of the server's
+// default. With AuthPlugin, PasswordHash can replace Password, so the
+// password appears neither in config nor in the statements galera-init runs.
 type SeededUser struct {
-	User     string `yaml:"User" validate:"nonzero"`
-	Password string `yaml:"Password" validate:"nonzero"`
-	Host     string `yaml:"Host" validate:"nonzero"`
-	Role     string `yaml:"Role" validate:"nonzero"`
+	User         string   `yaml:"User" validate:"nonzero"`
+	Password     string   `yaml:"Password"`
+	PasswordFile string   `yaml:"PasswordFile"`
+	PasswordEnv  string   `yaml:"PasswordEnv"`
+	AuthPlugin   string   `yaml:"AuthPlugin"`
+	PasswordHash string   `yaml:"PasswordHash"`
+	Host         string   `yaml:"Host"`
+	Hosts        []string `yaml:"Hosts"`
+	Role         string   `yaml:"Role" validate:"nonzero"`
+}
+
+// AccountHosts returns the host part of each of the user's accounts,
+// without duplicates
+func (u SeededUser) AccountHosts() ([]string, error) {
+	hosts := u.Hosts
+	if u.Host != "" {
+		hosts = append([]string{u.Host}, hosts...)
+	}
+	return accountHosts(hosts)
+}
+
+func accountHosts(hosts []string) ([]string, error) {
+	var accountHosts []string
+	seen := map[string]bool{}
+	for _, host := range hosts {
+		accountHost, err := AccountHost(host)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[accountHost] {
+			seen[accountHost] = true
+			accountHosts = append(accountHosts, accountHost)
+		}
+	}
+
+	return accountHosts, nil
+}
+
+// maxHostLength is the longest host MySQL keeps for an account
+const maxHostLength = 255
+
+// hostPattern matches host names, IP addresses and wildcard patterns of
+// them, where % matches any characters and _ a single one
+var hostPattern = regexp.MustCompile(`^[A-Za-z0-9.:%_-]+$`)
+
+var hostAliases = map[string]string{
+	"localhost": "localhost",
+	"loopback":  "127.0.0.1",
+	"any":       "%",
+}
+
+// AccountHost returns the host part of a seeded account. host is localhost,
+// loopback for 127.0.0.1, any for %, a host name or IP address, a wildcard
+// pattern such as 10.0.% or an IPv4 network such as 10.0.0.0/16 or
+// 10.0.0.0/255.255.0.0. Networks are returned with a netmask, which every
+// MySQL and MariaDB version understands.
+func AccountHost(host string) (string, error) {
+	if alias, ok := hostAliases[host]; ok {
+		return alias, nil
+	}
+
+	invalid := func(reason string) (string, error) {
+		return "", fmt.Errorf("Invalid host %q: %s", host, reason)
+	}
+
+	if host == "" {
+		return invalid("must not be blank")
+	}
+	if len(host) > maxHostLength {
+		return invalid(fmt.Sprintf("must not be longer than %d characters", maxHostLength))
+	}
+
+	if strings.Contains(host, "/") {
+		network, reason := accountNetwork(host)
+		if reason != "" {
+			return invalid(reason)
+		}
+		return network, nil
+	}
+
+	if !hostPattern.MatchString(host) {
+		return invalid("may only contain letters, digits and . : - % _")
+	}
+
+	return host, nil
+}
+
+func accountNetwork(host string) (string, string) {
+	parts := strings.SplitN(host, "/", 2)
+
+	ip := net.ParseIP(parts[0]).To4()
+	if ip == nil {
+		return "", "a network must start with an IPv4 address"
+	}
+
+	var mask net.IPMask
+	if prefix, err := strconv.Atoi(parts[1]); err == nil {
+		if prefix < 0 || prefix > 32 {
+			return "", "the prefix length must be between 0 and 32"
+		}
+		mask = net.CIDRMask(prefix, 32)
+	} else {
+		netmask := net.ParseIP(parts[1]).To4()
+		if netmask == nil {
+			return "", "a network must end in a prefix length or an IPv4 netmask"
+		}
+		mask = net.IPMask(netmask)
+		if _, bits := mask.Size(); bits == 0 {
+			return "", "the netmask must be contiguous"
+		}
+	}
+
+	if !ip.Mask(mask).Equal(ip) {
+		return "", "the address must be the first of its network"
+	}
+
+	return ip.String() + "/" + net.IP(mask).String(), ""
 }
 
 func NewConfig(osArgs []string) (*Config, error) {
@@ -71,21 +379,173 @@ func NewConfig(osArgs []string) (*Config, error) {
 	serviceConfig.AddFlags(flags)
 	serviceConfig.AddDefaults(Config{
 		Db: DBHelper{
-			User: "root",
+			Flavor:             FlavorPXC,
+			MyCnfPath:          "/var/vcap/jobs/pxc-mysql/config/my.cnf",
+			MyLoginCnfPath:     "/var/vcap/jobs/pxc-mysql/config/mylogin.cnf",
+			User:               "root",
+			StaleAccountPolicy: StaleAccountPolicyKeep,
+		},
+		Upgrader: Upgrader{
+			Strategy:                   UpgradeStrategyMysqlUpgrade,
+			ServerUpgradeMode:          ServerUpgradeModeAuto,
+			ToleratedUpgradeErrors:     DefaultToleratedUpgradeErrors,
+			CoordinationPollInterval:   10,
+			CoordinationTimeout:        3600,
+			DBReachablePollingAttempts: 30,
+			DBReachablePollingDelay:    10,
+			Snapshot: UpgradeSnapshot{
+				Method: SnapshotMethodReflink,
+				Retain: 1,
+			},
 		},
 		Manager: StartManager{
-			GrastateFileLocation: "/var/vcap/store/pxc-mysql/grastate.dat",
+			GrastateFileLocation:     "/var/vcap/store/pxc-mysql/grastate.dat",
+			PeerPollingAttempts:      12,
+			PeerPollingDelay:         5,
+			SupervisorMaxCrashes:     5,
+			SupervisorInitialBackoff: 5,
+			SupervisorMaxBackoff:     300,
+			StartupPollInterval:      5,
+			StartupTimeout:           0,
+			StartupSSTGracePeriod:    7200,
+			ShutdownGracePeriod:      60,
 		},
 	})
 	flags.Parse(configurationOptions)
 
 	err := serviceConfig.Read(&c)
+	if err == nil {
+		c.Db.applyFlavorBinaries()
+		err = c.Db.checkPasswordSources()
+	}
+	if err == nil {
+		err = c.Db.ReadPasswords()
+	}
 
 	c.Logger, _ = lagerflags.NewFromConfig(binaryName, lagerflags.ConfigFromFlags())
 
 	return &c, err
 }
 
+// applyFlavorBinaries fills in the paths that are not set with the binaries
+// of the configured flavor
+func (d *DBHelper) applyFlavorBinaries() {
+	binaries, ok := FlavorBinaries[d.Flavor]
+	if !ok {
+		return
+	}
+
+	if d.MysqldPath == "" {
+		d.MysqldPath = binaries.Mysqld
+	}
+	if d.MysqladminPath == "" {
+		d.MysqladminPath = binaries.Mysqladmin
+	}
+	if d.UpgradePath == "" {
+		d.UpgradePath = binaries.Upgrade
+	}
+}
+
+// passwordSource is a password in config along with the file or environment
+// variable it is read from instead
+type passwordSource struct {
+	prefix   string
+	password *string
+	file     string
+	env      string
+}
+
+func (p passwordSource) read() (string, error) {
+	if p.file != "" {
+		contents, err := ioutil.ReadFile(p.file)
+		if err != nil {
+			return "", fmt.Errorf("%sPasswordFile : %s", p.prefix, err)
+		}
+		return strings.TrimSuffix(strings.TrimSuffix(string(contents), "\n"), "\r"), nil
+	}
+
+	password, ok := os.LookupEnv(p.env)
+	if !ok {
+		return "", fmt.Errorf("%sPasswordEnv : %s is not set", p.prefix, p.env)
+	}
+	return password, nil
+}
+
+func (d *DBHelper) passwordSources() []passwordSource {
+	sources := []passwordSource{{"Db.", &d.Password, d.PasswordFile, d.PasswordEnv}}
+
+	for i := range d.PreseededDatabases {
+		db := &d.PreseededDatabases[i]
+		prefix := fmt.Sprintf("Db.PreseededDatabases[%d].", i)
+		sources = append(sources, passwordSource{prefix, &db.Password, db.PasswordFile, db.PasswordEnv})
+
+		for j := range db.Users {
+			user := &db.Users[j]
+			sources = append(sources, passwordSource{fmt.Sprintf("%sUsers[%d].", prefix, j), &user.Password, user.PasswordFile, user.PasswordEnv})
+		}
+	}
+
+	for i := range d.SeededUsers {
+		user := &d.SeededUsers[i]
+		sources = append(sources, passwordSource{fmt.Sprintf("Db.SeededUsers[%d].", i), &user.Password, user.PasswordFile, user.PasswordEnv})
+	}
+
+	return sources
+}
+
+// checkPasswordSources rejects passwords given in more than one way. It can
+// only run before ReadPasswords fills in the passwords.
+func (d *DBHelper) checkPasswordSources() error {
+	var errString string
+
+	for _, source := range d.passwordSources() {
+		if source.file != "" && source.env != "" {
+			errString += source.prefix + "PasswordEnv : must be blank when PasswordFile is set\n"
+		}
+		if *source.password != "" && (source.file != "" || source.env != "") {
+			errString += source.prefix + "Password : must be blank when PasswordFile or PasswordEnv is set\n"
+		}
+	}
+
+	if len(errString) > 0 {
+		return errors.New(fmt.Sprintf("Validation errors: %s\n", errString))
+	}
+
+	return nil
+}
+
+// ReadPasswords sets the passwords given as PasswordFile or PasswordEnv,
+// without a trailing newline. A missing file or unset variable is an error,
+// and no password is changed then. Every call reads the sources again, so a
+// rotated secret is used from the next start of mysqld on.
+func (d *DBHelper) ReadPasswords() error {
+	var errString string
+	passwords := map[*string]string{}
+
+	for _, source := range d.passwordSources() {
+		if source.file == "" && source.env == "" {
+			continue
+		}
+
+		password, err := source.read()
+		if err != nil {
+			errString += err.Error() + "\n"
+			continue
+		}
+		passwords[source.password] = password
+	}
+
+	if len(errString) > 0 {
+		return errors.New(fmt.Sprintf("Error reading passwords: %s\n", errString))
+	}
+
+	for field, password := range passwords {
+		*field = password
+	}
+
+	return nil
+}
+
 func (c Config) Validate() error {
 	errString := ""
 	err := validator.Validate(c)
@@ -94,6 +554,53 @@ func (c Config) Validate() error {
 		errString += formatErrorString(err, "")
 	}
 
+	switch c.Db.Flavor {
+	case "", FlavorPXC, FlavorMariaDB:
+	default:
+		errString += fmt.Sprintf("Db.Flavor : must be %q or %q\n", FlavorPXC, FlavorMariaDB)
+	}
+
+	switch c.Db.StaleAccountPolicy {
+	case "", StaleAccountPolicyKeep, StaleAccountPolicyLock, StaleAccountPolicyDrop:
+	default:
+		errString += fmt.Sprintf("Db.StaleAccountPolicy : must be %q, %q or %q\n", StaleAccountPolicyKeep, StaleAccountPolicyLock, StaleAccountPolicyDrop)
+	}
+
+	switch c.Upgrader.Strategy {
+	case "", UpgradeStrategyMysqlUpgrade:
+	case UpgradeStrategyServer:
+		if c.Db.Flavor == FlavorMariaDB {
+			errString += fmt.Sprintf("Upgrader.Strategy : %q is not supported by MariaDB\n", UpgradeStrategyServer)
+		}
+	default:
+		errString += fmt.Sprintf("Upgrader.Strategy : must be %q or %q\n", UpgradeStrategyMysqlUpgrade, UpgradeStrategyServer)
+	}
+
+	switch c.Upgrader.ServerUpgradeMode {
+	case "", ServerUpgradeModeAuto, ServerUpgradeModeForce:
+	default:
+		errString += fmt.Sprintf("Upgrader.ServerUpgradeMode : must be %q or %q\n", ServerUpgradeModeAuto, ServerUpgradeModeForce)
+	}
+
+	errString += validatePatterns("Upgrader.ToleratedUpgradeErrors", c.Upgrader.ToleratedUpgradeErrors)
+	errString += validatePatterns("Upgrader.FatalUpgradeErrors", c.Upgrader.FatalUpgradeErrors)
+
+	if c.Upgrader.Snapshot.Enabled {
+		errString += c.Upgrader.Snapshot.validate()
+	}
+
+	if c.Manager.StartupPollInterval <= 0 {
+		errString += "Manager.StartupPollInterval : must be greater than 0\n"
+	}
+
+	if c.Manager.SeqnoAwareBootstrap {
+		errString += c.Manager.validatePeerAddress("Manager.SeqnoAwareBootstrap")
+	}
+
+	if c.Upgrader.CoordinateWithPeers {
+		errString += c.Manager.validatePeerAddress("Upgrader.CoordinateWithPeers")
+	}
+
 	for i, db := range c.Db.PreseededDatabases {
 		dbErr := validator.Validate(db)
 		if dbErr != nil {
@@ -102,8 +609,22 @@ func (c Config) Validate() error {
 				fmt.Sprintf("Db.PreseededDatabases[%d].", i),
 			)
 		}
+
+		for j, user := range db.DatabaseUsers() {
+			prefix := fmt.Sprintf("Db.PreseededDatabases[%d].", i)
+			if j > 0 {
+				prefix += fmt.Sprintf("Users[%d].", j-1)
+			}
+			errString += user.validate(prefix, c.Db.Flavor)
+		}
 	}
 
+	for i, user := range c.Db.SeededUsers {
+		errString += user.validate(fmt.Sprintf("Db.SeededUsers[%d].", i), c.Db.Flavor)
+	}
+
+	errString += c.Db.validateRoles()
+
 	if len(errString) > 0 {
 		return errors.New(fmt.Sprintf("Validation errors: %s\n", errString))
 	}
@@ -119,3 +640,181 @@ func formatErrorString(err error, keyPrefix string) string {
 	}
 	return errsString
 }
+
+// validatePeerAddress checks that peers can reach the status server, as
+// setting makes them ask it for this node's state
+func (m StartManager) validatePeerAddress(setting string) string {
+	host, _, err := net.SplitHostPort(m.GaleraInitStatusServerAddress)
+	if err != nil {
+		return fmt.Sprintf("Manager.GaleraInitStatusServerAddress : %s\n", err)
+	}
+
+	if ip := net.ParseIP(host); host == "localhost" || (ip != nil && ip.IsLoopback()) {
+		return fmt.Sprintf("Manager.GaleraInitStatusServerAddress : must not be a loopback address when %s is set, as peers cannot reach it\n", setting)
+	}
+
+	return ""
+}
+
+func (s UpgradeSnapshot) validate() string {
+	var errString string
+
+	if s.DataDirectory == "" {
+		errString += "Upgrader.Snapshot.DataDirectory : zero value\n"
+	}
+	if s.Directory == "" {
+		errString += "Upgrader.Snapshot.Directory : zero value\n"
+	}
+	if s.Retain < 0 {
+		errString += "Upgrader.Snapshot.Retain : must not be negative\n"
+	}
+
+	switch s.Method {
+	case "", SnapshotMethodReflink:
+	case SnapshotMethodCommand:
+		if len(s.BackupCommand) == 0 {
+			errString += "Upgrader.Snapshot.BackupCommand : zero value\n"
+		}
+		if len(s.RestoreCommand) == 0 {
+			errString += "Upgrader.Snapshot.RestoreCommand : zero value\n"
+		}
+	default:
+		errString += fmt.Sprintf("Upgrader.Snapshot.Method : must be %q or %q\n", SnapshotMethodReflink, SnapshotMethodCommand)
+	}
+
+	return errString
+}
+
+func (u PreseededDatabaseUser) validate(prefix, flavor string) string {
+	errString := validateAuthentication(prefix, flavor, u.AuthPlugin, u.Password, u.PasswordHash)
+
+	for i, host := range u.Hosts {
+		if _, err := AccountHost(host); err != nil {
+			errString += fmt.Sprintf("%sHosts[%d] : %s\n", prefix, i, err)
+		}
+	}
+
+	if u.ReadOnly && len(u.Privileges) > 0 {
+		errString += prefix + "Privileges : must be blank when ReadOnly is set\n"
+	}
+
+	for _, privilege := range u.Privileges {
+		if !sql_builder.IsDatabasePrivilege(privilege) {
+			errString += fmt.Sprintf("%sPrivileges : %q is not a database privilege\n", prefix, privilege)
+		}
+	}
+
+	return errString
+}
+
+func (u SeededUser) validate(prefix, flavor string) string {
+	errString := validateAuthentication(prefix, flavor, u.AuthPlugin, u.Password, u.PasswordHash)
+
+	if u.Password == "" && u.PasswordHash == "" {
+		errString += prefix + "Password : Password or PasswordHash must be given\n"
+	}
+
+	if u.Host == "" && len(u.Hosts) == 0 {
+		errString += prefix + "Host : Host or Hosts must be given\n"
+	}
+
+	if u.Host != "" {
+		if _, err := AccountHost(u.Host); err != nil {
+			errString += fmt.Sprintf("%sHost : %s\n", prefix, err)
+		}
+	}
+	for i, host := range u.Hosts {
+		if _, err := AccountHost(host); err != nil {
+			errString += fmt.Sprintf("%sHosts[%d] : %s\n", prefix, i, err)
+		}
+	}
+
+	return errString
+}
+
+// validateAuthentication checks that a hash comes with its plugin and
+// instead of a password, and that MariaDB can apply the plugin: it knows no
+// caching_sha2_password and only takes a plugin along with a hash
+func validateAuthentication(prefix, flavor, plugin, password, hash string) string {
+	var errString string
+
+	if plugin != "" {
+		if _, err := sql_builder.OneOf(plugin, auth.Plugins...).SQL(); err != nil {
+			return fmt.Sprintf("%sAuthPlugin : %s\n", prefix, err)
+		}
+	}
+
+	if hash == "" {
+		if plugin != "" && flavor == FlavorMariaDB {
+			errString += prefix + "PasswordHash : must be given with AuthPlugin on MariaDB\n"
+		}
+	} else {
+		if plugin == "" {
+			errString += prefix + "PasswordHash : requires AuthPlugin\n"
+		} else if err := auth.ValidateHash(plugin, hash); err != nil {
+			errString += fmt.Sprintf("%sPasswordHash : %s\n", prefix, err)
+		}
+		if password != "" {
+			errString += prefix + "Password : must be blank when PasswordHash is set\n"
+		}
+	}
+
+	if plugin == auth.PluginCachingSHA2Password && flavor == FlavorMariaDB {
+		errString += fmt.Sprintf("%sAuthPlugin : %q is not supported by MariaDB\n", prefix, plugin)
+	}
+
+	return errString
+}
+
+func (d DBHelper) validateRoles() string {
+	var errString string
+
+	defined := map[string]bool{}
+	for _, role := range BuiltinRoles {
+		defined[role] = true
+	}
+
+	for i, role := range d.Roles {
+		prefix := fmt.Sprintf("Db.Roles[%d].", i)
+
+		if defined[role.Name] {
+			errString += fmt.Sprintf("%sName : %q is already defined\n", prefix, role.Name)
+		}
+		defined[role.Name] = true
+
+		for j, grant := range role.Grants {
+			grantPrefix := fmt.Sprintf("%sGrants[%d].", prefix, j)
+
+			if len(grant.Privileges) > 0 {
+				if _, err := sql_builder.PrivilegeKeywords(grant.Privileges).SQL(); err != nil {
+					errString += fmt.Sprintf("%sPrivileges : %s\n", grantPrefix, err)
+				}
+			}
+			if grant.On != "" {
+				if _, err := sql_builder.GrantTarget(grant.On).SQL(); err != nil {
+					errString += fmt.Sprintf("%sOn : %s\n", grantPrefix, err)
+				}
+			}
+		}
+	}
+
+	for i, user := range d.SeededUsers {
+		if user.Role != "" && !defined[user.Role] {
+			errString += fmt.Sprintf("Db.SeededUsers[%d].Role : %q is neither a built-in role nor defined in Db.Roles\n", i, user.Role)
+		}
+	}
+
+	return errString
+}
+
+func validatePatterns(field string, patterns []string) string {
+	var errString string
+
+	for i, pattern := range patterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			errString += fmt.Sprintf("%s[%d] : %s\n", field, i, err)
+		}
+	}
+
+	return errString
+}
@@ -4,6 +4,9 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 
@@ -16,6 +19,183 @@ import (
 
 var _ = Describe("Config", func() {
 
+	Describe("AccountHost", func() {
+		It("resolves the host aliases", func() {
+			Expect(config.AccountHost("any")).To(Equal("%"))
+			Expect(config.AccountHost("loopback")).To(Equal("127.0.0.1"))
+			Expect(config.AccountHost("localhost")).To(Equal("localhost"))
+		})
+
+		It("keeps host names, addresses and wildcard patterns", func() {
+			Expect(config.AccountHost("10.0.%")).To(Equal("10.0.%"))
+			Expect(config.AccountHost("proxy.internal")).To(Equal("proxy.internal"))
+		})
+
+		It("gives networks a netmask", func() {
+			Expect(config.AccountHost("10.0.0.0/16")).To(Equal("10.0.0.0/255.255.0.0"))
+			Expect(config.AccountHost("10.0.0.0/255.255.0.0")).To(Equal("10.0.0.0/255.255.0.0"))
+		})
+	})
+
+	Describe("PreseededDatabaseUser", func() {
+		It("returns the hosts of Hosts without duplicates", func() {
+			user := config.PreseededDatabaseUser{Hosts: []string{"any", "10.0.0.0/8", "%", "10.0.0.0/255.0.0.0"}}
+			Expect(user.AccountHosts()).To(Equal([]string{"%", "10.0.0.0/255.0.0.0"}))
+		})
+
+		It("returns % when Hosts is blank", func() {
+			Expect(config.PreseededDatabaseUser{}.AccountHosts()).To(Equal([]string{"%"}))
+		})
+	})
+
+	Describe("SeededUser", func() {
+		It("returns the hosts of Host and Hosts without duplicates", func() {
+			user := config.SeededUser{Host: "loopback", Hosts: []string{"10.0.0.0/8", "127.0.0.1", "10.0.0.0/255.0.0.0"}}
+			Expect(user.AccountHosts()).To(Equal([]string{"127.0.0.1", "10.0.0.0/255.0.0.0"}))
+		})
+	})
+
+	Describe("ReadPasswords", func() {
+		var (
+			dir      string
+			dbHelper config.DBHelper
+		)
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "passwords")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(ioutil.WriteFile(filepath.Join(dir, "root"), []byte("root-password\n"), 0600)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(dir, "app"), []byte("app-password\r\n"), 0600)).To(Succeed())
+			os.Setenv("CONFIG_TEST_REPORTING_PASSWORD", "reporting-password")
+			os.Setenv("CONFIG_TEST_ADMIN_PASSWORD", "")
+
+			dbHelper = config.DBHelper{
+				PasswordFile: filepath.Join(dir, "root"),
+				PreseededDatabases: []config.PreseededDatabase{{
+					DBName:       "app",
+					User:         "app",
+					PasswordFile: filepath.Join(dir, "app"),
+					Users: []config.PreseededDatabaseUser{{
+						User:        "reporting",
+						PasswordEnv: "CONFIG_TEST_REPORTING_PASSWORD",
+					}},
+				}},
+				SeededUsers: []config.SeededUser{
+					{User: "admin", PasswordEnv: "CONFIG_TEST_ADMIN_PASSWORD"},
+					{User: "monitor", Password: "inline-password"},
+				},
+			}
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+			os.Unsetenv("CONFIG_TEST_REPORTING_PASSWORD")
+			os.Unsetenv("CONFIG_TEST_ADMIN_PASSWORD")
+		})
+
+		It("reads passwords from files without the trailing newline and from the environment", func() {
+			Expect(dbHelper.ReadPasswords()).To(Succeed())
+
+			Expect(dbHelper.Password).To(Equal("root-password"))
+			Expect(dbHelper.PreseededDatabases[0].Password).To(Equal("app-password"))
+			Expect(dbHelper.PreseededDatabases[0].Users[0].Password).To(Equal("reporting-password"))
+			Expect(dbHelper.SeededUsers[0].Password).To(BeEmpty())
+			Expect(dbHelper.SeededUsers[1].Password).To(Equal("inline-password"))
+		})
+
+		It("reads the files again on every call", func() {
+			Expect(dbHelper.ReadPasswords()).To(Succeed())
+
+			Expect(ioutil.WriteFile(filepath.Join(dir, "root"), []byte("rotated-password"), 0600)).To(Succeed())
+			Expect(dbHelper.ReadPasswords()).To(Succeed())
+			Expect(dbHelper.Password).To(Equal("rotated-password"))
+		})
+
+		It("returns an error for a missing file or unset variable and keeps every password", func() {
+			Expect(os.Remove(filepath.Join(dir, "app"))).To(Succeed())
+			os.Unsetenv("CONFIG_TEST_REPORTING_PASSWORD")
+
+			err := dbHelper.ReadPasswords()
+			Expect(err).To(MatchError(ContainSubstring("Db.PreseededDatabases[0].PasswordFile : open " + filepath.Join(dir, "app"))))
+			Expect(err).To(MatchError(ContainSubstring("Db.PreseededDatabases[0].Users[0].PasswordEnv : CONFIG_TEST_REPORTING_PASSWORD is not set")))
+			Expect(dbHelper.Password).To(BeEmpty())
+		})
+	})
+
+	Describe("NewConfig", func() {
+		var configPath string
+
+		writeConfig := func(contents string) {
+			Expect(ioutil.WriteFile(configPath, []byte(contents), 0600)).To(Succeed())
+		}
+
+		BeforeEach(func() {
+			file, err := ioutil.TempFile("", "config")
+			Expect(err).NotTo(HaveOccurred())
+			file.Close()
+			configPath = file.Name()
+			os.Setenv("CONFIG_TEST_ROOT_PASSWORD", "root-password")
+		})
+
+		AfterEach(func() {
+			os.Remove(configPath)
+			os.Unsetenv("CONFIG_TEST_ROOT_PASSWORD")
+		})
+
+		It("reads the passwords", func() {
+			writeConfig("Db:\n  PasswordEnv: CONFIG_TEST_ROOT_PASSWORD\n")
+
+			c, err := config.NewConfig([]string{"galera-init", "-configPath=" + configPath})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(c.Db.Password).To(Equal("root-password"))
+		})
+
+		It("returns an error if a password is given in more than one way", func() {
+			writeConfig(`Db:
+  Password: inline-password
+  PasswordEnv: CONFIG_TEST_ROOT_PASSWORD
+  SeededUsers:
+  - User: admin
+    PasswordFile: /run/secrets/admin
+    PasswordEnv: CONFIG_TEST_ROOT_PASSWORD
+`)
+
+			c, err := config.NewConfig([]string{"galera-init", "-configPath=" + configPath})
+			Expect(err).To(MatchError(ContainSubstring("Db.Password : must be blank when PasswordFile or PasswordEnv is set")))
+			Expect(err).To(MatchError(ContainSubstring("Db.SeededUsers[0].PasswordEnv : must be blank when PasswordFile is set")))
+			Expect(c.Logger).NotTo(BeNil())
+		})
+
+		It("defaults the binaries to those of the flavor", func() {
+			writeConfig("Db:\n  Flavor: mariadb\n  MysqldPath: /usr/sbin/mysqld\n")
+
+			c, err := config.NewConfig([]string{"galera-init", "-configPath=" + configPath})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(c.Db.MysqldPath).To(Equal("/usr/sbin/mysqld"))
+			Expect(c.Db.MysqladminPath).To(Equal("mariadb-admin"))
+			Expect(c.Db.UpgradePath).To(Equal("mariadb-upgrade"))
+		})
+
+		It("defaults the binaries to those of PXC", func() {
+			writeConfig("Db:\n  User: root\n")
+
+			c, err := config.NewConfig([]string{"galera-init", "-configPath=" + configPath})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(c.Db.MysqldPath).To(Equal("mysqld"))
+			Expect(c.Db.MysqladminPath).To(Equal("mysqladmin"))
+			Expect(c.Db.UpgradePath).To(Equal("mysql_upgrade"))
+		})
+
+		It("returns an error if a password file is missing", func() {
+			writeConfig("Db:\n  PasswordFile: /nonexistent/password\n")
+
+			_, err := config.NewConfig([]string{"galera-init", "-configPath=" + configPath})
+			Expect(err).To(MatchError(ContainSubstring("Db.PasswordFile : open /nonexistent/password: no such file or directory")))
+		})
+	})
+
 	Describe("Validate", func() {
 		var rootConfig config.Config
 		var serviceConfig *service_config.ServiceConfig
@@ -109,19 +289,177 @@ var _ = Describe("Config", func() {
 		Describe("Upgrader", func() {
 			It("returns an error if Upgrader.PackageVersionFile is blank", isRequiredField("Upgrader.PackageVersionFile"))
 			It("returns an error if Upgrader.LastUpgradedVersionFile is blank", isRequiredField("Upgrader.LastUpgradedVersionFile"))
+			It("returns an error if Upgrader.DBReachablePollingAttempts is blank", isRequiredField("Upgrader.DBReachablePollingAttempts"))
+			It("returns an error if Upgrader.DBReachablePollingDelay is blank", isRequiredField("Upgrader.DBReachablePollingDelay"))
+			It("does not return an error if Upgrader.Strategy is blank", isOptionalField("Upgrader.Strategy"))
+			It("does not return an error if Upgrader.ServerUpgradeMode is blank", isOptionalField("Upgrader.ServerUpgradeMode"))
+			It("does not return an error if Upgrader.MajorUpgradeCheckCommand is blank", isOptionalField("Upgrader.MajorUpgradeCheckCommand"))
+			It("does not return an error if Upgrader.ToleratedUpgradeErrors is blank", isOptionalField("Upgrader.ToleratedUpgradeErrors"))
+			It("does not return an error if Upgrader.FatalUpgradeErrors is blank", isOptionalField("Upgrader.FatalUpgradeErrors"))
+			It("does not return an error if Upgrader.CoordinateWithPeers is blank", isOptionalField("Upgrader.CoordinateWithPeers"))
+			It("does not return an error if Upgrader.CoordinationTimeout is blank", isOptionalField("Upgrader.CoordinationTimeout"))
+			It("does not return an error if Upgrader.UpgradeTimeout is blank", isOptionalField("Upgrader.UpgradeTimeout"))
+			It("does not return an error if Upgrader.StopMysqldTimeout is blank", isOptionalField("Upgrader.StopMysqldTimeout"))
+
+			It("returns an error if an upgrade error pattern does not compile", func() {
+				rootConfig.Upgrader.FatalUpgradeErrors = []string{"Corrupt", "("}
+
+				err := rootConfig.Validate()
+				Expect(err).To(MatchError(ContainSubstring("Upgrader.FatalUpgradeErrors[1]")))
+			})
+
+			It("returns an error if Upgrader.Strategy is unknown", func() {
+				rootConfig.Upgrader.Strategy = "mysqlsh"
+
+				err := rootConfig.Validate()
+				Expect(err).To(MatchError(ContainSubstring("Upgrader.Strategy")))
+			})
+
+			It("returns an error if the server strategy is used with MariaDB", func() {
+				rootConfig.Upgrader.Strategy = config.UpgradeStrategyServer
+				rootConfig.Db.Flavor = config.FlavorMariaDB
+
+				err := rootConfig.Validate()
+				Expect(err).To(MatchError(ContainSubstring("not supported by MariaDB")))
+			})
+
+			Describe("Snapshot", func() {
+				BeforeEach(func() {
+					rootConfig.Upgrader.Snapshot = config.UpgradeSnapshot{
+						Enabled:       true,
+						DataDirectory: "/var/vcap/store/pxc-mysql",
+						Directory:     "/var/vcap/store/pxc-mysql-snapshots",
+						Method:        config.SnapshotMethodReflink,
+						Retain:        1,
+					}
+				})
+
+				It("accepts a reflink snapshot", func() {
+					Expect(rootConfig.Validate()).To(Succeed())
+				})
+
+				It("does not validate a disabled snapshot", func() {
+					rootConfig.Upgrader.Snapshot = config.UpgradeSnapshot{Method: "zfs"}
+					Expect(rootConfig.Validate()).To(Succeed())
+				})
+
+				It("returns an error if Upgrader.Snapshot.DataDirectory is blank", func() {
+					rootConfig.Upgrader.Snapshot.DataDirectory = ""
+					Expect(rootConfig.Validate()).To(MatchError(ContainSubstring("Upgrader.Snapshot.DataDirectory")))
+				})
+
+				It("returns an error if Upgrader.Snapshot.Directory is blank", func() {
+					rootConfig.Upgrader.Snapshot.Directory = ""
+					Expect(rootConfig.Validate()).To(MatchError(ContainSubstring("Upgrader.Snapshot.Directory")))
+				})
+
+				It("returns an error if Upgrader.Snapshot.Retain is negative", func() {
+					rootConfig.Upgrader.Snapshot.Retain = -1
+					Expect(rootConfig.Validate()).To(MatchError(ContainSubstring("Upgrader.Snapshot.Retain")))
+				})
+
+				It("returns an error if Upgrader.Snapshot.Method is unknown", func() {
+					rootConfig.Upgrader.Snapshot.Method = "hardlink"
+					Expect(rootConfig.Validate()).To(MatchError(ContainSubstring("Upgrader.Snapshot.Method")))
+				})
+
+				It("requires backup and restore commands for the command method", func() {
+					rootConfig.Upgrader.Snapshot.Method = config.SnapshotMethodCommand
+
+					err := rootConfig.Validate()
+					Expect(err).To(MatchError(ContainSubstring("Upgrader.Snapshot.BackupCommand")))
+					Expect(err).To(MatchError(ContainSubstring("Upgrader.Snapshot.RestoreCommand")))
+				})
+			})
+
+			It("returns an error if Upgrader.ServerUpgradeMode is unknown", func() {
+				rootConfig.Upgrader.ServerUpgradeMode = "MINIMAL"
+
+				err := rootConfig.Validate()
+				Expect(err).To(MatchError(ContainSubstring("Upgrader.ServerUpgradeMode")))
+			})
 		})
 
 		Describe("StartManager", func() {
 			It("returns an error if Manager.StateFileLocation is blank", isRequiredField("Manager.StateFileLocation"))
 			It("returns an error if Manager.ClusterIps is blank", isRequiredField("Manager.ClusterIps"))
 			It("returns an error if Manager.ClusterProbeTimeout is blank", isRequiredField("Manager.ClusterProbeTimeout"))
+			It("returns an error if Manager.PeerPollingAttempts is blank", isRequiredField("Manager.PeerPollingAttempts"))
+			It("returns an error if Manager.PeerPollingDelay is blank", isRequiredField("Manager.PeerPollingDelay"))
+
+			It("returns an error if Manager.StartupPollInterval is not positive", func() {
+				rootConfig.Manager.StartupPollInterval = 0
+
+				err := rootConfig.Validate()
+				Expect(err).To(MatchError(ContainSubstring("Manager.StartupPollInterval : must be greater than 0")))
+			})
+
+			Context("when SeqnoAwareBootstrap is set", func() {
+				BeforeEach(func() {
+					rootConfig.Manager.SeqnoAwareBootstrap = true
+				})
+
+				It("returns an error if the status server is bound to a loopback address", func() {
+					rootConfig.Manager.GaleraInitStatusServerAddress = "127.0.0.1:8999"
+
+					err := rootConfig.Validate()
+					Expect(err).To(MatchError(ContainSubstring("Manager.GaleraInitStatusServerAddress : must not be a loopback address when Manager.SeqnoAwareBootstrap is set")))
+
+					rootConfig.Manager.GaleraInitStatusServerAddress = "localhost:8999"
+					Expect(rootConfig.Validate()).To(MatchError(ContainSubstring("Manager.GaleraInitStatusServerAddress")))
+				})
+
+				It("accepts the status server bound to every address", func() {
+					rootConfig.Manager.GaleraInitStatusServerAddress = "0.0.0.0:8999"
+					Expect(rootConfig.Validate()).To(Succeed())
+				})
+			})
+
+			Context("when CoordinateWithPeers is set", func() {
+				BeforeEach(func() {
+					rootConfig.Upgrader.CoordinateWithPeers = true
+				})
+
+				It("returns an error if the status server is bound to a loopback address", func() {
+					rootConfig.Manager.GaleraInitStatusServerAddress = "127.0.0.1:8999"
+
+					err := rootConfig.Validate()
+					Expect(err).To(MatchError(ContainSubstring("Manager.GaleraInitStatusServerAddress : must not be a loopback address when Upgrader.CoordinateWithPeers is set")))
+				})
+
+				It("accepts the status server bound to every address", func() {
+					rootConfig.Manager.GaleraInitStatusServerAddress = "0.0.0.0:8999"
+					Expect(rootConfig.Validate()).To(Succeed())
+				})
+			})
 		})
 
 		Describe("DBHelper", func() {
 			It("returns an error if Db.UpgradePath is blank", isRequiredField("Db.UpgradePath"))
 			It("returns an error if Db.User is blank", isRequiredField("Db.User"))
+			It("returns an error if Db.MysqldPath is blank", isRequiredField("Db.MysqldPath"))
+			It("returns an error if Db.MysqladminPath is blank", isRequiredField("Db.MysqladminPath"))
+			It("returns an error if Db.MyCnfPath is blank", isRequiredField("Db.MyCnfPath"))
+			It("returns an error if Db.MyLoginCnfPath is blank", isRequiredField("Db.MyLoginCnfPath"))
+			It("does not return an error if Db.JoinExtraArgs is blank", isOptionalField("Db.JoinExtraArgs"))
+			It("does not return an error if Db.Flavor is blank", isOptionalField("Db.Flavor"))
+
+			It("returns an error if Db.Flavor is unknown", func() {
+				rootConfig.Db.Flavor = "mysql-cluster"
+
+				err := rootConfig.Validate()
+				Expect(err).To(MatchError(ContainSubstring("Db.Flavor")))
+			})
 
 			It("does not return an error if Db.Password is blank", isOptionalField("Db.Password"))
+			It("does not return an error if Db.StaleAccountPolicy is blank", isOptionalField("Db.StaleAccountPolicy"))
+
+			It("returns an error if Db.StaleAccountPolicy is unknown", func() {
+				rootConfig.Db.StaleAccountPolicy = "disable"
+
+				err := rootConfig.Validate()
+				Expect(err).To(MatchError(ContainSubstring(`Db.StaleAccountPolicy : must be "keep", "lock" or "drop"`)))
+			})
 			It("does not return an error if Db.PreseededDatabases is blank", isOptionalField("Db.PreseededDatabases"))
 
 			Describe("PreseededDatabase", func() {
@@ -129,6 +467,245 @@ var _ = Describe("Config", func() {
 				It("returns an error if Db.PreseededDatabases.User is blank", isRequiredField("Db.PreseededDatabases.User"))
 
 				It("does not an error if Db.PreseededDatabases.Password is blank", isOptionalField("Db.PreseededDatabases.Password"))
+				It("does not return an error if Db.PreseededDatabases.Hosts is blank", isOptionalField("Db.PreseededDatabases.Hosts"))
+				It("does not return an error if Db.PreseededDatabases.Privileges is blank", isOptionalField("Db.PreseededDatabases.Privileges"))
+				It("does not return an error if Db.PreseededDatabases.Users is blank", isOptionalField("Db.PreseededDatabases.Users"))
+				It("returns an error if Db.PreseededDatabases.Users.User is blank", isRequiredField("Db.PreseededDatabases.Users.User"))
+
+				It("accepts database privileges in any case", func() {
+					rootConfig.Db.PreseededDatabases[0].Privileges = []string{"select", "Show View", "ALL PRIVILEGES"}
+					Expect(rootConfig.Validate()).To(Succeed())
+				})
+
+				It("returns an error if a privilege is not a database privilege", func() {
+					rootConfig.Db.PreseededDatabases[0].Users[0].ReadOnly = false
+					rootConfig.Db.PreseededDatabases[0].Users[0].Privileges = []string{"SELECT", "SUPER"}
+
+					err := rootConfig.Validate()
+					Expect(err).To(MatchError(ContainSubstring(`Db.PreseededDatabases[0].Users[0].Privileges : "SUPER" is not a database privilege`)))
+				})
+
+				It("returns an error if privileges are given for a read-only user", func() {
+					rootConfig.Db.PreseededDatabases[0].Users[0].Privileges = []string{"SELECT"}
+
+					err := rootConfig.Validate()
+					Expect(err).To(MatchError(ContainSubstring("Db.PreseededDatabases[0].Users[0].Privileges : must be blank when ReadOnly is set")))
+				})
+
+				It("does not return an error if Db.PreseededDatabases.AuthPlugin is blank", isOptionalField("Db.PreseededDatabases.AuthPlugin"))
+				It("does not return an error if Db.PreseededDatabases.PasswordHash is blank", isOptionalField("Db.PreseededDatabases.PasswordHash"))
+
+				It("validates the password hash of each user", func() {
+					rootConfig.Db.PreseededDatabases[0].AuthPlugin = "mysql_native_password"
+					rootConfig.Db.PreseededDatabases[0].PasswordHash = "*2470C0C06DEE42FD1618BB99005ADCA2EC9D1E19"
+					rootConfig.Db.PreseededDatabases[0].Users[0].PasswordHash = "*2470C0C06DEE42FD1618BB99005ADCA2EC9D1E19"
+
+					err := rootConfig.Validate()
+					Expect(err).To(MatchError(ContainSubstring("Db.PreseededDatabases[0].Users[0].PasswordHash : requires AuthPlugin")))
+					Expect(err.Error()).NotTo(ContainSubstring("Db.PreseededDatabases[0].PasswordHash"))
+				})
+
+				It("returns an error if a host is blank", func() {
+					rootConfig.Db.PreseededDatabases[0].Hosts = []string{"10.0.16.%", " "}
+
+					err := rootConfig.Validate()
+					Expect(err).To(MatchError(ContainSubstring(`Db.PreseededDatabases[0].Hosts[1] : Invalid host " "`)))
+				})
+
+				It("checks hosts like those of seeded users", func() {
+					rootConfig.Db.PreseededDatabases[0].Hosts = []string{"any", "10.0.0.1/24"}
+					rootConfig.Db.PreseededDatabases[0].Users[0].Hosts = []string{"app`@`%"}
+
+					err := rootConfig.Validate()
+					Expect(err).To(MatchError(SatisfyAll(
+						ContainSubstring(`Db.PreseededDatabases[0].Hosts[1] : Invalid host "10.0.0.1/24": the address must be the first of its network`),
+						ContainSubstring(`Db.PreseededDatabases[0].Users[0].Hosts[0] : Invalid host "app`+"`@`"+`%"`),
+					)))
+					Expect(err.Error()).NotTo(ContainSubstring("Db.PreseededDatabases[0].Hosts[0]"))
+				})
+			})
+
+			It("does not return an error if Db.Roles is blank", func() {
+				rootConfig.Db.SeededUsers[1].Role = config.RoleAdmin
+				Expect(setFieldToEmpty("Db.Roles")).To(Succeed())
+				Expect(rootConfig.Validate()).To(Succeed())
+			})
+
+			Describe("Role", func() {
+				It("returns an error if Db.Roles.Name is blank", isRequiredField("Db.Roles.Name"))
+				It("returns an error if Db.Roles.Grants is blank", isRequiredField("Db.Roles.Grants"))
+				It("returns an error if Db.Roles.Grants.Privileges is blank", isRequiredField("Db.Roles.Grants.Privileges"))
+				It("returns an error if Db.Roles.Grants.On is blank", isRequiredField("Db.Roles.Grants.On"))
+				It("does not return an error if Db.Roles.Grants.WithGrantOption is blank", isOptionalField("Db.Roles.Grants.WithGrantOption"))
+
+				It("returns an error if a role redefines a built-in role", func() {
+					rootConfig.Db.Roles[0].Name = config.RoleBackup
+
+					err := rootConfig.Validate()
+					Expect(err).To(MatchError(ContainSubstring(`Db.Roles[0].Name : "backup" is already defined`)))
+				})
+
+				It("returns an error if a role is defined twice", func() {
+					rootConfig.Db.Roles = append(rootConfig.Db.Roles, rootConfig.Db.Roles[0])
+
+					err := rootConfig.Validate()
+					Expect(err).To(MatchError(ContainSubstring(`Db.Roles[1].Name : "schema-migrator" is already defined`)))
+				})
+
+				It("returns an error if a privilege is not a privilege name", func() {
+					rootConfig.Db.Roles[0].Grants[0].Privileges = []string{"SELECT", "SELECT ON mysql TO root"}
+
+					err := rootConfig.Validate()
+					Expect(err).To(MatchError(ContainSubstring(`Db.Roles[0].Grants[0].Privileges : "SELECT ON mysql TO root" is not a privilege name`)))
+				})
+
+				It("returns an error if a grant target is invalid", func() {
+					rootConfig.Db.Roles[0].Grants[0].On = "users"
+
+					err := rootConfig.Validate()
+					Expect(err).To(MatchError(ContainSubstring(`Db.Roles[0].Grants[0].On : invalid grant target "users": must be *.*, db.* or db.table`)))
+				})
+			})
+
+			Describe("SeededUser", func() {
+				It("accepts built-in roles", func() {
+					for _, role := range config.BuiltinRoles {
+						rootConfig.Db.SeededUsers[0].Role = role
+						Expect(rootConfig.Validate()).To(Succeed())
+					}
+				})
+
+				It("returns an error if Db.SeededUsers.User is blank", isRequiredField("Db.SeededUsers.User"))
+				It("returns an error if Db.SeededUsers.Password is blank", isRequiredField("Db.SeededUsers.Password"))
+				It("returns an error if Db.SeededUsers.Role is blank", isRequiredField("Db.SeededUsers.Role"))
+				It("does not return an error if Db.SeededUsers.Host is blank", isOptionalField("Db.SeededUsers.Host"))
+				It("does not return an error if Db.SeededUsers.Hosts is blank", isOptionalField("Db.SeededUsers.Hosts"))
+
+				It("returns an error if both Host and Hosts are blank", func() {
+					rootConfig.Db.SeededUsers[0].Host = ""
+					rootConfig.Db.SeededUsers[0].Hosts = nil
+
+					err := rootConfig.Validate()
+					Expect(err).To(MatchError(ContainSubstring("Db.SeededUsers[0].Host : Host or Hosts must be given")))
+				})
+
+				It("accepts aliases, host names, addresses, wildcard patterns and networks", func() {
+					rootConfig.Db.SeededUsers[0].Hosts = []string{
+						"any", "loopback", "localhost",
+						"proxy-1.internal", "10.0.16.4", "::1",
+						"10.0.%", "app_.example.com",
+						"10.0.0.0/16", "192.168.1.0/255.255.255.0", "0.0.0.0/0",
+					}
+					Expect(rootConfig.Validate()).To(Succeed())
+				})
+
+				It("returns an error for each malformed host", func() {
+					rootConfig.Db.SeededUsers[0].Host = "bad host"
+					rootConfig.Db.SeededUsers[0].Hosts = []string{
+						"10.0.%",
+						"",
+						"10.0.0.0/33",
+						"10.0.0.1/24",
+						"10.0.0.0/255.0.255.0",
+						"10.0.0.0/abc",
+						"fe80::/64",
+						"app`@`%",
+						strings.Repeat("a", 256),
+					}
+
+					err := rootConfig.Validate()
+					Expect(err).To(MatchError(SatisfyAll(
+						ContainSubstring(`Db.SeededUsers[0].Host : Invalid host "bad host": may only contain letters, digits and . : - % _`),
+						ContainSubstring(`Db.SeededUsers[0].Hosts[1] : Invalid host "": must not be blank`),
+						ContainSubstring(`Db.SeededUsers[0].Hosts[2] : Invalid host "10.0.0.0/33": the prefix length must be between 0 and 32`),
+						ContainSubstring(`Db.SeededUsers[0].Hosts[3] : Invalid host "10.0.0.1/24": the address must be the first of its network`),
+						ContainSubstring(`Db.SeededUsers[0].Hosts[4] : Invalid host "10.0.0.0/255.0.255.0": the netmask must be contiguous`),
+						ContainSubstring(`Db.SeededUsers[0].Hosts[5] : Invalid host "10.0.0.0/abc": a network must end in a prefix length or an IPv4 netmask`),
+						ContainSubstring(`Db.SeededUsers[0].Hosts[6] : Invalid host "fe80::/64": a network must start with an IPv4 address`),
+						ContainSubstring(`Db.SeededUsers[0].Hosts[7] : Invalid host "app`+"`@`"+`%": may only contain letters, digits and . : - % _`),
+						ContainSubstring(`Db.SeededUsers[0].Hosts[8] : Invalid host "aaaa`),
+						ContainSubstring(`must not be longer than 255 characters`),
+					)))
+					Expect(err.Error()).NotTo(ContainSubstring("Hosts[0]"))
+				})
+
+				It("returns an error if both Password and PasswordHash are blank", func() {
+					rootConfig.Db.SeededUsers[0].Password = ""
+
+					err := rootConfig.Validate()
+					Expect(err).To(MatchError(ContainSubstring("Db.SeededUsers[0].Password : Password or PasswordHash must be given")))
+				})
+
+				It("accepts a password hash along with its plugin", func() {
+					rootConfig.Db.SeededUsers[0].Password = ""
+					rootConfig.Db.SeededUsers[0].AuthPlugin = "mysql_native_password"
+					rootConfig.Db.SeededUsers[0].PasswordHash = "*2470C0C06DEE42FD1618BB99005ADCA2EC9D1E19"
+					Expect(rootConfig.Validate()).To(Succeed())
+				})
+
+				It("accepts a plugin along with a password", func() {
+					rootConfig.Db.SeededUsers[0].AuthPlugin = "caching_sha2_password"
+					Expect(rootConfig.Validate()).To(Succeed())
+				})
+
+				It("returns an error if the plugin is unknown", func() {
+					rootConfig.Db.SeededUsers[0].AuthPlugin = "sha256_password"
+
+					err := rootConfig.Validate()
+					Expect(err).To(MatchError(ContainSubstring(`Db.SeededUsers[0].AuthPlugin : "sha256_password" must be one of mysql_native_password, caching_sha2_password`)))
+				})
+
+				It("returns an error if a password hash is given without a plugin", func() {
+					rootConfig.Db.SeededUsers[0].Password = ""
+					rootConfig.Db.SeededUsers[0].PasswordHash = "*2470C0C06DEE42FD1618BB99005ADCA2EC9D1E19"
+
+					err := rootConfig.Validate()
+					Expect(err).To(MatchError(ContainSubstring("Db.SeededUsers[0].PasswordHash : requires AuthPlugin")))
+				})
+
+				It("returns an error if both a password and a password hash are given", func() {
+					rootConfig.Db.SeededUsers[0].AuthPlugin = "mysql_native_password"
+					rootConfig.Db.SeededUsers[0].PasswordHash = "*2470C0C06DEE42FD1618BB99005ADCA2EC9D1E19"
+
+					err := rootConfig.Validate()
+					Expect(err).To(MatchError(ContainSubstring("Db.SeededUsers[0].Password : must be blank when PasswordHash is set")))
+				})
+
+				It("returns an error if the password hash does not suit the plugin", func() {
+					rootConfig.Db.SeededUsers[0].Password = ""
+					rootConfig.Db.SeededUsers[0].AuthPlugin = "caching_sha2_password"
+					rootConfig.Db.SeededUsers[0].PasswordHash = "*2470C0C06DEE42FD1618BB99005ADCA2EC9D1E19"
+
+					err := rootConfig.Validate()
+					Expect(err).To(MatchError(ContainSubstring("Db.SeededUsers[0].PasswordHash : caching_sha2_password hashes must be 0x followed by the 70 bytes of the hash in hex")))
+				})
+
+				Context("on MariaDB", func() {
+					BeforeEach(func() {
+						rootConfig.Db.Flavor = config.FlavorMariaDB
+					})
+
+					It("returns an error for caching_sha2_password", func() {
+						rootConfig.Db.SeededUsers[0].AuthPlugin = "caching_sha2_password"
+
+						err := rootConfig.Validate()
+						Expect(err).To(MatchError(ContainSubstring(`Db.SeededUsers[0].AuthPlugin : "caching_sha2_password" is not supported by MariaDB`)))
+					})
+
+					It("returns an error if a plugin is given without a password hash", func() {
+						rootConfig.Db.SeededUsers[0].AuthPlugin = "mysql_native_password"
+
+						err := rootConfig.Validate()
+						Expect(err).To(MatchError(ContainSubstring("Db.SeededUsers[0].PasswordHash : must be given with AuthPlugin on MariaDB")))
+					})
+				})
+
+				It("returns an error if the role is not defined", func() {
+					rootConfig.Db.SeededUsers[0].Role = "auditor"
+
+					err := rootConfig.Validate()
+					Expect(err).To(MatchError(ContainSubstring(`Db.SeededUsers[0].Role : "auditor" is neither a built-in role nor defined in Db.Roles`)))
+				})
 			})
 		})
 	})
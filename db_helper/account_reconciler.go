@@ -0,0 +1,229 @@
+package db_helper
+
+import (
+	"database/sql"
+	"sort"
+
+	"code.cloudfoundry.org/lager"
+
+	"github.com/cloudfoundry/galera-init/config"
+	"github.com/cloudfoundry/galera-init/db_helper/sql_builder"
+)
+
+// ManagedAccountsTable records every account galera-init seeded, so
+// accounts removed from config can be found again
+const ManagedAccountsTable = "`galera_init`.`managed_accounts`"
+
+// Account is a MySQL account, user@host
+type Account struct {
+	User string
+	Host string
+}
+
+//go:generate go run github.com/maxbrunsfeld/counterfeiter/v6 . AccountReconciler
+type AccountReconciler interface {
+	Reconcile(desired []Account) error
+}
+
+type accountReconciler struct {
+	db            *sql.DB
+	policy        string
+	protectedUser string
+	logger        lager.Logger
+}
+
+// NewAccountReconciler never touches accounts of protectedUser, the user
+// galera-init connects as
+func NewAccountReconciler(db *sql.DB, policy string, protectedUser string, logger lager.Logger) AccountReconciler {
+	if policy == "" {
+		policy = config.StaleAccountPolicyKeep
+	}
+
+	return &accountReconciler{
+		db:            db,
+		policy:        policy,
+		protectedUser: protectedUser,
+		logger:        logger,
+	}
+}
+
+type managedAccount struct {
+	Account
+	locked bool
+}
+
+// Reconcile records the desired accounts as managed and applies the policy
+// to managed accounts that are no longer desired. Desired accounts that were
+// locked as stale before are unlocked. The keep policy retires nothing, so it
+// never creates the managed accounts table and only keeps one up to date that
+// lock or drop created before.
+func (r accountReconciler) Reconcile(desired []Account) error {
+	if r.policy == config.StaleAccountPolicyKeep {
+		if len(desired) == 0 {
+			return nil
+		}
+
+		exists, err := r.managedAccountsTableExists()
+		if err != nil {
+			r.logger.Error("Error looking up managed accounts table", err)
+			return err
+		}
+		if !exists {
+			return nil
+		}
+	} else if err := r.createManagedAccountsTable(); err != nil {
+		r.logger.Error("Error creating managed accounts table", err)
+		return err
+	}
+
+	managed, err := r.managedAccounts()
+	if err != nil {
+		r.logger.Error("Error reading managed accounts", err)
+		return err
+	}
+
+	wanted := map[Account]bool{}
+	for _, account := range desired {
+		wanted[account] = true
+
+		if err := r.manage(account, managed[account]); err != nil {
+			return err
+		}
+	}
+
+	var stale []*managedAccount
+	for account, state := range managed {
+		if wanted[account] {
+			continue
+		}
+		if account.User == r.protectedUser {
+			r.logger.Info("stale-account-protected", lager.Data{"user": account.User, "host": account.Host})
+			continue
+		}
+		stale = append(stale, state)
+	}
+	sort.Slice(stale, func(i, j int) bool {
+		if stale[i].User != stale[j].User {
+			return stale[i].User < stale[j].User
+		}
+		return stale[i].Host < stale[j].Host
+	})
+
+	for _, state := range stale {
+		if err := r.retire(state); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r accountReconciler) createManagedAccountsTable() error {
+	if _, err := r.db.Exec("CREATE DATABASE IF NOT EXISTS `galera_init`"); err != nil {
+		return err
+	}
+
+	_, err := r.db.Exec(`CREATE TABLE IF NOT EXISTS ` + ManagedAccountsTable + ` (
+  user VARCHAR(80) NOT NULL,
+  host VARCHAR(255) NOT NULL,
+  locked BOOLEAN NOT NULL DEFAULT FALSE,
+  PRIMARY KEY (user, host)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin`)
+	return err
+}
+
+func (r accountReconciler) managedAccountsTableExists() (bool, error) {
+	var count int
+	err := r.db.QueryRow("SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = 'galera_init' AND table_name = 'managed_accounts'").Scan(&count)
+	return count > 0, err
+}
+
+func (r accountReconciler) managedAccounts() (map[Account]*managedAccount, error) {
+	rows, err := r.db.Query("SELECT user, host, locked FROM " + ManagedAccountsTable)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	accounts := map[Account]*managedAccount{}
+	for rows.Next() {
+		var account managedAccount
+		if err := rows.Scan(&account.User, &account.Host, &account.locked); err != nil {
+			return nil, err
+		}
+		accounts[account.Account] = &account
+	}
+
+	return accounts, rows.Err()
+}
+
+func (r accountReconciler) manage(account Account, state *managedAccount) error {
+	data := lager.Data{"user": account.User, "host": account.Host}
+
+	if state == nil {
+		_, err := r.db.Exec("INSERT IGNORE INTO "+ManagedAccountsTable+" (user, host) VALUES (?, ?)", account.User, account.Host)
+		if err != nil {
+			r.logger.Error("Error recording managed account", err, data)
+			return err
+		}
+		return nil
+	}
+
+	if !state.locked {
+		return nil
+	}
+
+	r.logger.Info("unlocking-account", data)
+	if err := sql_builder.Exec(r.db, "ALTER USER %s ACCOUNT UNLOCK", sql_builder.Account(account.User, account.Host)); err != nil {
+		r.logger.Error("Error unlocking account", err, data)
+		return err
+	}
+
+	return r.setLocked(account, false)
+}
+
+func (r accountReconciler) retire(state *managedAccount) error {
+	account := state.Account
+	data := lager.Data{"user": account.User, "host": account.Host, "policy": r.policy}
+
+	switch r.policy {
+	case config.StaleAccountPolicyLock:
+		if state.locked {
+			return nil
+		}
+
+		r.logger.Info("locking-stale-account", data)
+		if err := sql_builder.Exec(r.db, "ALTER USER IF EXISTS %s ACCOUNT LOCK", sql_builder.Account(account.User, account.Host)); err != nil {
+			r.logger.Error("Error locking stale account", err, data)
+			return err
+		}
+		return r.setLocked(account, true)
+
+	case config.StaleAccountPolicyDrop:
+		r.logger.Info("dropping-stale-account", data)
+		if err := sql_builder.Exec(r.db, "DROP USER IF EXISTS %s", sql_builder.Account(account.User, account.Host)); err != nil {
+			r.logger.Error("Error dropping stale account", err, data)
+			return err
+		}
+
+		_, err := r.db.Exec("DELETE FROM "+ManagedAccountsTable+" WHERE user = ? AND host = ?", account.User, account.Host)
+		if err != nil {
+			r.logger.Error("Error forgetting dropped account", err, data)
+			return err
+		}
+		return nil
+
+	default:
+		r.logger.Info("keeping-stale-account", data)
+		return nil
+	}
+}
+
+func (r accountReconciler) setLocked(account Account, locked bool) error {
+	_, err := r.db.Exec("UPDATE "+ManagedAccountsTable+" SET locked = ? WHERE user = ? AND host = ?", locked, account.User, account.Host)
+	if err != nil {
+		r.logger.Error("Error recording account lock", err, lager.Data{"user": account.User, "host": account.Host})
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package db_helper_test
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"regexp"
+
+	"code.cloudfoundry.org/lager/lagertest"
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/cloudfoundry/galera-init/config"
+	"github.com/cloudfoundry/galera-init/db_helper"
+)
+
+var _ = Describe("AccountReconciler", func() {
+	var (
+		reconciler db_helper.AccountReconciler
+		policy     string
+		testLogger *lagertest.TestLogger
+		fakeDB     *sql.DB
+		mock       sqlmock.Sqlmock
+		managed    sqlmock.Rows
+		desired    []db_helper.Account
+	)
+
+	expectExec := func(query string, args ...driver.Value) {
+		expectation := mock.ExpectExec(regexp.QuoteMeta(query))
+		if len(args) > 0 {
+			expectation = expectation.WithArgs(args...)
+		}
+		expectation.WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+
+	expectManagedAccounts := func() {
+		expectExec("CREATE DATABASE IF NOT EXISTS `galera_init`")
+		expectExec("CREATE TABLE IF NOT EXISTS `galera_init`.`managed_accounts`")
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT user, host, locked FROM `galera_init`.`managed_accounts`")).
+			WillReturnRows(managed)
+	}
+
+	BeforeEach(func() {
+		var err error
+		testLogger = lagertest.NewTestLogger("db_helper")
+
+		fakeDB, mock, err = sqlmock.New()
+		Expect(err).ToNot(HaveOccurred())
+
+		policy = config.StaleAccountPolicyLock
+		managed = sqlmock.NewRows([]string{"user", "host", "locked"})
+		desired = []db_helper.Account{{User: "app", Host: "%"}}
+	})
+
+	JustBeforeEach(func() {
+		reconciler = db_helper.NewAccountReconciler(fakeDB, policy, "admin", testLogger)
+	})
+
+	AfterEach(func() {
+		Expect(mock.ExpectationsWereMet()).To(Succeed())
+	})
+
+	Context("when nothing is desired and stale accounts are kept", func() {
+		BeforeEach(func() {
+			policy = config.StaleAccountPolicyKeep
+			desired = nil
+		})
+
+		It("does not touch the database", func() {
+			Expect(reconciler.Reconcile(desired)).To(Succeed())
+		})
+	})
+
+	It("records desired accounts it has not managed before", func() {
+		managed.AddRow("app", "%", false)
+		desired = append(desired, db_helper.Account{User: "reporting", Host: "10.0.0.%"})
+
+		expectManagedAccounts()
+		expectExec("INSERT IGNORE INTO `galera_init`.`managed_accounts` (user, host) VALUES (?, ?)", "reporting", "10.0.0.%")
+
+		Expect(reconciler.Reconcile(desired)).To(Succeed())
+	})
+
+	It("unlocks desired accounts that were locked as stale", func() {
+		managed.AddRow("app", "%", true)
+
+		expectManagedAccounts()
+		expectExec("ALTER USER `app`@`%` ACCOUNT UNLOCK")
+		expectExec("UPDATE `galera_init`.`managed_accounts` SET locked = ? WHERE user = ? AND host = ?", false, "app", "%")
+
+		Expect(reconciler.Reconcile(desired)).To(Succeed())
+	})
+
+	It("returns an error when the managed accounts table cannot be created", func() {
+		mock.ExpectExec(regexp.QuoteMeta("CREATE DATABASE IF NOT EXISTS `galera_init`")).
+			WillReturnError(errors.New("access denied"))
+
+		Expect(reconciler.Reconcile(desired)).To(MatchError("access denied"))
+	})
+
+	Context("when the policy is keep", func() {
+		var tableCount sqlmock.Rows
+
+		BeforeEach(func() {
+			policy = config.StaleAccountPolicyKeep
+			tableCount = sqlmock.NewRows([]string{"count"}).AddRow(1)
+		})
+
+		expectTableLookup := func() {
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = 'galera_init' AND table_name = 'managed_accounts'")).
+				WillReturnRows(tableCount)
+		}
+
+		It("leaves stale accounts alone", func() {
+			managed.AddRow("app", "%", false).AddRow("old-app", "%", false)
+
+			expectTableLookup()
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT user, host, locked FROM `galera_init`.`managed_accounts`")).
+				WillReturnRows(managed)
+
+			Expect(reconciler.Reconcile(desired)).To(Succeed())
+			Expect(testLogger.LogMessages()).To(ContainElement("db_helper.keeping-stale-account"))
+		})
+
+		Context("when no other policy created the managed accounts table", func() {
+			BeforeEach(func() {
+				tableCount = sqlmock.NewRows([]string{"count"}).AddRow(0)
+			})
+
+			It("does not create it", func() {
+				expectTableLookup()
+
+				Expect(reconciler.Reconcile(desired)).To(Succeed())
+			})
+		})
+	})
+
+	Context("when the policy is lock", func() {
+		BeforeEach(func() {
+			policy = config.StaleAccountPolicyLock
+		})
+
+		It("locks stale accounts in order", func() {
+			managed.
+				AddRow("app", "%", false).
+				AddRow("old-b", "%", false).
+				AddRow("old-a", "localhost", false).
+				AddRow("old-a", "%", false)
+
+			expectManagedAccounts()
+			expectExec("ALTER USER IF EXISTS `old-a`@`%` ACCOUNT LOCK")
+			expectExec("UPDATE `galera_init`.`managed_accounts` SET locked = ? WHERE user = ? AND host = ?", true, "old-a", "%")
+			expectExec("ALTER USER IF EXISTS `old-a`@`localhost` ACCOUNT LOCK")
+			expectExec("UPDATE `galera_init`.`managed_accounts` SET locked = ? WHERE user = ? AND host = ?", true, "old-a", "localhost")
+			expectExec("ALTER USER IF EXISTS `old-b`@`%` ACCOUNT LOCK")
+			expectExec("UPDATE `galera_init`.`managed_accounts` SET locked = ? WHERE user = ? AND host = ?", true, "old-b", "%")
+
+			Expect(reconciler.Reconcile(desired)).To(Succeed())
+		})
+
+		It("does not lock accounts again", func() {
+			managed.AddRow("old-app", "%", true)
+
+			expectManagedAccounts()
+
+			Expect(reconciler.Reconcile(desired[:0])).To(Succeed())
+		})
+
+		It("returns an error when locking fails", func() {
+			managed.AddRow("old-app", "%", false)
+
+			expectManagedAccounts()
+			mock.ExpectExec(regexp.QuoteMeta("ALTER USER IF EXISTS `old-app`@`%` ACCOUNT LOCK")).
+				WillReturnError(errors.New("lock failed"))
+
+			Expect(reconciler.Reconcile(desired[:0])).To(MatchError("lock failed"))
+		})
+	})
+
+	Context("when the policy is drop", func() {
+		BeforeEach(func() {
+			policy = config.StaleAccountPolicyDrop
+		})
+
+		It("drops stale accounts and forgets them", func() {
+			managed.AddRow("app", "%", false).AddRow("old-app", "%", true)
+
+			expectManagedAccounts()
+			expectExec("DROP USER IF EXISTS `old-app`@`%`")
+			expectExec("DELETE FROM `galera_init`.`managed_accounts` WHERE user = ? AND host = ?", "old-app", "%")
+
+			Expect(reconciler.Reconcile(desired)).To(Succeed())
+		})
+
+		It("never drops accounts of the user galera-init connects as", func() {
+			managed.AddRow("admin", "%", false)
+
+			expectManagedAccounts()
+
+			Expect(reconciler.Reconcile(desired[:0])).To(Succeed())
+			Expect(testLogger.LogMessages()).To(ContainElement("db_helper.stale-account-protected"))
+		})
+	})
+})
@@ -0,0 +1,241 @@
+// Package auth builds the IDENTIFIED clause of seeded accounts and computes
+// the password hashes config can carry instead of passwords.
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/cloudfoundry/galera-init/db_helper/sql_builder"
+)
+
+const (
+	PluginNativePassword      = "mysql_native_password"
+	PluginCachingSHA2Password = "caching_sha2_password"
+)
+
+// Plugins are the authentication plugins seeded accounts can use
+var Plugins = []string{PluginNativePassword, PluginCachingSHA2Password}
+
+const (
+	// cachingSHA2SaltLength and cachingSHA2Rounds are what MySQL uses for
+	// caching_sha2_password with the default digest rounds
+	cachingSHA2SaltLength = 20
+	cachingSHA2Rounds     = 5000
+
+	// cachingSHA2HashLength is $A$, the rounds in thousands as three hex
+	// digits, $, the salt and 43 characters of digest
+	cachingSHA2HashLength = 7 + cachingSHA2SaltLength + 43
+)
+
+var (
+	nativePasswordHash      = regexp.MustCompile(`^\*[0-9A-F]{40}$`)
+	cachingSHA2PasswordHash = regexp.MustCompile(`^\$A\$[0-9A-F]{3}\$[^$]{20}[./0-9A-Za-z]{43}$`)
+)
+
+// Identified returns the IDENTIFIED clause of CREATE USER and ALTER USER.
+// Without a plugin the server's default plugin hashes the password. Given a
+// hash, the account gets the hash as is and password is not used.
+func Identified(plugin, password, hash string) sql_builder.Fragment {
+	if plugin == "" {
+		return sql_builder.Compose("IDENTIFIED BY %s", sql_builder.Password(password))
+	}
+
+	pluginName := sql_builder.OneOf(plugin, Plugins...)
+	if hash == "" {
+		return sql_builder.Compose("IDENTIFIED WITH %s BY %s", pluginName, sql_builder.Password(password))
+	}
+
+	return sql_builder.Compose("IDENTIFIED WITH %s AS %s", pluginName, authString(plugin, hash))
+}
+
+// authString writes caching_sha2_password hashes as hexadecimal literals,
+// as their salt may contain any character
+func authString(plugin, hash string) sql_builder.Fragment {
+	if err := ValidateHash(plugin, hash); err != nil {
+		return sql_builder.Invalid(err)
+	}
+
+	if plugin == PluginCachingSHA2Password {
+		decoded, _ := hex.DecodeString(hash[2:])
+		return sql_builder.Hex(decoded)
+	}
+
+	return sql_builder.String(hash)
+}
+
+// ValidateHash checks that hash is what Hash returns for plugin:
+// mysql_native_password hashes are * and 40 upper-case hex digits and
+// caching_sha2_password hashes are hexadecimal literals, 0x..., as printed
+// by SHOW CREATE USER with print_identified_with_as_hex set
+func ValidateHash(plugin, hash string) error {
+	switch plugin {
+	case PluginNativePassword:
+		if !nativePasswordHash.MatchString(hash) {
+			return fmt.Errorf("%s hashes must be * followed by 40 upper-case hex digits", plugin)
+		}
+	case PluginCachingSHA2Password:
+		invalid := fmt.Errorf("%s hashes must be 0x followed by the %d bytes of the hash in hex", plugin, cachingSHA2HashLength)
+		if !strings.HasPrefix(hash, "0x") && !strings.HasPrefix(hash, "0X") {
+			return invalid
+		}
+		decoded, err := hex.DecodeString(hash[2:])
+		if err != nil || len(decoded) != cachingSHA2HashLength || !cachingSHA2PasswordHash.Match(decoded) {
+			return invalid
+		}
+	default:
+		return fmt.Errorf("%q must be one of %s", plugin, strings.Join(Plugins, ", "))
+	}
+
+	return nil
+}
+
+// Hash computes the hash of password that plugin stores. caching_sha2_password
+// hashes get a random salt.
+func Hash(plugin, password string) (string, error) {
+	switch plugin {
+	case PluginNativePassword:
+		return NativePasswordHash(password), nil
+	case PluginCachingSHA2Password:
+		salt, err := newSalt(cachingSHA2SaltLength)
+		if err != nil {
+			return "", err
+		}
+		return CachingSHA2PasswordHash(password, salt), nil
+	default:
+		return "", fmt.Errorf("%q must be one of %s", plugin, strings.Join(Plugins, ", "))
+	}
+}
+
+// NativePasswordHash is what PASSWORD() returns, SHA1 applied twice
+func NativePasswordHash(password string) string {
+	first := sha1.Sum([]byte(password))
+	second := sha1.Sum(first[:])
+	return "*" + strings.ToUpper(hex.EncodeToString(second[:]))
+}
+
+// CachingSHA2PasswordHash is the hash caching_sha2_password stores, as a
+// hexadecimal literal. salt must not contain $.
+func CachingSHA2PasswordHash(password string, salt []byte) string {
+	digest := SHA256Crypt([]byte(password), salt, cachingSHA2Rounds)
+	hash := fmt.Sprintf("$A$%03X$%s%s", cachingSHA2Rounds/1000, salt, digest)
+	return "0x" + strings.ToUpper(hex.EncodeToString([]byte(hash)))
+}
+
+// cryptAlphabet is the alphabet crypt(3) encodes digests with
+const cryptAlphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+func newSalt(length int) ([]byte, error) {
+	random := make([]byte, length)
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, length)
+	for i, b := range random {
+		salt[i] = cryptAlphabet[int(b)%len(cryptAlphabet)]
+	}
+	return salt, nil
+}
+
+// SHA256Crypt returns the digest of SHA-crypt with SHA-256, as in crypt(3)
+// $5$ hashes, without limiting the salt to 16 bytes as crypt(3) does
+func SHA256Crypt(password, salt []byte, rounds int) string {
+	alternate := sha256.New()
+	alternate.Write(password)
+	alternate.Write(salt)
+	alternate.Write(password)
+	alternateSum := alternate.Sum(nil)
+
+	a := sha256.New()
+	a.Write(password)
+	a.Write(salt)
+	a.Write(repeat(alternateSum, len(password)))
+	for n := len(password); n > 0; n >>= 1 {
+		if n&1 == 1 {
+			a.Write(alternateSum)
+		} else {
+			a.Write(password)
+		}
+	}
+	result := a.Sum(nil)
+
+	dp := sha256.New()
+	for i := 0; i < len(password); i++ {
+		dp.Write(password)
+	}
+	p := repeat(dp.Sum(nil), len(password))
+
+	ds := sha256.New()
+	for i := 0; i < 16+int(result[0]); i++ {
+		ds.Write(salt)
+	}
+	s := repeat(ds.Sum(nil), len(salt))
+
+	for i := 0; i < rounds; i++ {
+		c := sha256.New()
+		if i&1 == 1 {
+			c.Write(p)
+		} else {
+			c.Write(result)
+		}
+		if i%3 != 0 {
+			c.Write(s)
+		}
+		if i%7 != 0 {
+			c.Write(p)
+		}
+		if i&1 == 1 {
+			c.Write(result)
+		} else {
+			c.Write(p)
+		}
+		result = c.Sum(nil)
+	}
+
+	return encodeSHA256Crypt(result)
+}
+
+// repeat repeats sum until it is length bytes long
+func repeat(sum []byte, length int) []byte {
+	repeated := make([]byte, 0, length)
+	for len(repeated) < length {
+		remaining := length - len(repeated)
+		if remaining > len(sum) {
+			remaining = len(sum)
+		}
+		repeated = append(repeated, sum[:remaining]...)
+	}
+	return repeated
+}
+
+// sha256CryptGroups are the digest bytes crypt(3) encodes together for $5$,
+// most significant first
+var sha256CryptGroups = [][3]int{
+	{0, 10, 20}, {21, 1, 11}, {12, 22, 2}, {3, 13, 23}, {24, 4, 14},
+	{15, 25, 5}, {6, 16, 26}, {27, 7, 17}, {18, 28, 8}, {9, 19, 29},
+}
+
+func encodeSHA256Crypt(sum []byte) string {
+	var encoded strings.Builder
+
+	encode := func(b2, b1, b0 byte, n int) {
+		w := uint(b2)<<16 | uint(b1)<<8 | uint(b0)
+		for i := 0; i < n; i++ {
+			encoded.WriteByte(cryptAlphabet[w&0x3f])
+			w >>= 6
+		}
+	}
+
+	for _, group := range sha256CryptGroups {
+		encode(sum[group[0]], sum[group[1]], sum[group[2]], 4)
+	}
+	encode(0, sum[31], sum[30], 3)
+
+	return encoded.String()
+}
@@ -0,0 +1,136 @@
+package auth_test
+
+import (
+	"encoding/hex"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/cloudfoundry/galera-init/db_helper/auth"
+)
+
+var _ = Describe("Auth", func() {
+	const (
+		nativeHash = "*2470C0C06DEE42FD1618BB99005ADCA2EC9D1E19"
+		salt       = "abcdefghij0123456789"
+	)
+
+	var cachingSHA2Hash = auth.CachingSHA2PasswordHash("password", []byte(salt))
+
+	Describe("Identified", func() {
+		It("lets the server's default plugin hash the password", func() {
+			identified := auth.Identified("", `it's a \`, "")
+			Expect(identified.SQL()).To(Equal("IDENTIFIED BY ?"))
+			Expect(identified.Args()).To(Equal([]interface{}{`it's a \`}))
+		})
+
+		It("hashes the password with the given plugin", func() {
+			identified := auth.Identified("caching_sha2_password", "secret", "")
+			Expect(identified.SQL()).To(Equal("IDENTIFIED WITH caching_sha2_password BY ?"))
+			Expect(identified.Args()).To(Equal([]interface{}{"secret"}))
+		})
+
+		It("gives the account a mysql_native_password hash as a string", func() {
+			Expect(auth.Identified("mysql_native_password", "", nativeHash).SQL()).
+				To(Equal("IDENTIFIED WITH mysql_native_password AS '" + nativeHash + "'"))
+		})
+
+		It("gives the account a caching_sha2_password hash as a hexadecimal literal", func() {
+			Expect(auth.Identified("caching_sha2_password", "", cachingSHA2Hash).SQL()).
+				To(Equal("IDENTIFIED WITH caching_sha2_password AS " + cachingSHA2Hash))
+		})
+
+		It("rejects unknown plugins", func() {
+			_, err := auth.Identified("mysql_native_password AS '*00'; --", "", nativeHash).SQL()
+			Expect(err).To(MatchError(`"mysql_native_password AS '*00'; --" must be one of mysql_native_password, caching_sha2_password`))
+		})
+
+		It("rejects malformed hashes", func() {
+			_, err := auth.Identified("mysql_native_password", "", "*00' OR '1").SQL()
+			Expect(err).To(MatchError("mysql_native_password hashes must be * followed by 40 upper-case hex digits"))
+		})
+	})
+
+	Describe("ValidateHash", func() {
+		It("accepts the hashes Hash returns", func() {
+			for _, plugin := range auth.Plugins {
+				hash, err := auth.Hash(plugin, "password")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(auth.ValidateHash(plugin, hash)).To(Succeed())
+			}
+		})
+
+		It("rejects malformed mysql_native_password hashes", func() {
+			for _, hash := range []string{"", "password", strings.ToLower(nativeHash), nativeHash + "0", nativeHash[1:]} {
+				Expect(auth.ValidateHash("mysql_native_password", hash)).
+					To(MatchError("mysql_native_password hashes must be * followed by 40 upper-case hex digits"), hash)
+			}
+		})
+
+		It("rejects malformed caching_sha2_password hashes", func() {
+			raw, err := hex.DecodeString(cachingSHA2Hash[2:])
+			Expect(err).NotTo(HaveOccurred())
+
+			for _, hash := range []string{
+				"",
+				string(raw),
+				cachingSHA2Hash[2:],
+				cachingSHA2Hash + "00",
+				cachingSHA2Hash[:len(cachingSHA2Hash)-1] + "G",
+				"0x" + hex.EncodeToString([]byte(strings.Replace(string(raw), "$A$", "$5$", 1))),
+			} {
+				Expect(auth.ValidateHash("caching_sha2_password", hash)).
+					To(MatchError("caching_sha2_password hashes must be 0x followed by the 70 bytes of the hash in hex"), hash)
+			}
+		})
+
+		It("rejects unknown plugins", func() {
+			Expect(auth.ValidateHash("sha256_password", nativeHash)).
+				To(MatchError(`"sha256_password" must be one of mysql_native_password, caching_sha2_password`))
+		})
+	})
+
+	Describe("NativePasswordHash", func() {
+		It("returns what PASSWORD() returns", func() {
+			Expect(auth.NativePasswordHash("password")).To(Equal(nativeHash))
+		})
+	})
+
+	Describe("CachingSHA2PasswordHash", func() {
+		It("returns $A$, the rounds in thousands, the salt and the digest as a hexadecimal literal", func() {
+			raw, err := hex.DecodeString(cachingSHA2Hash[2:])
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(raw)).To(Equal("$A$005$" + salt + auth.SHA256Crypt([]byte("password"), []byte(salt), 5000)))
+		})
+	})
+
+	Describe("Hash", func() {
+		It("salts caching_sha2_password hashes randomly", func() {
+			first, err := auth.Hash("caching_sha2_password", "password")
+			Expect(err).NotTo(HaveOccurred())
+			second, err := auth.Hash("caching_sha2_password", "password")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(first).NotTo(Equal(second))
+		})
+
+		It("rejects unknown plugins", func() {
+			_, err := auth.Hash("sha256_password", "password")
+			Expect(err).To(MatchError(`"sha256_password" must be one of mysql_native_password, caching_sha2_password`))
+		})
+	})
+
+	Describe("SHA256Crypt", func() {
+		It("matches crypt(3) $5$ digests", func() {
+			Expect(auth.SHA256Crypt([]byte("Hello world!"), []byte("saltstring"), 5000)).
+				To(Equal("5B8vYYiY.CVt1RlTTf8KbXBH3hsxY/GNooZaBBGWEc5"))
+			Expect(auth.SHA256Crypt([]byte("Hello world!"), []byte("saltstringsaltst"), 10000)).
+				To(Equal("3xv.VbSHBb41AL9AvLeujZkZRBAwqFMz2.opqey6IcA"))
+			Expect(auth.SHA256Crypt([]byte(""), []byte("x"), 5000)).
+				To(Equal("yHbtfs4Y8t6X1xcJemNX.4JQRfUTafA2qQenWGLBee2"))
+			Expect(auth.SHA256Crypt([]byte(strings.Repeat("a", 40)), []byte("0123456789abcdef"), 5000)).
+				To(Equal("EMA4/G2RRv3DOWxAXvJKBkQm1ALOpFEBeTEouheDOdC"))
+		})
+	})
+})
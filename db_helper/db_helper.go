@@ -1,10 +1,13 @@
 package db_helper
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"io/ioutil"
 	"os/exec"
+	"path/filepath"
+	"strings"
 
 	"code.cloudfoundry.org/lager"
 	"github.com/pkg/errors"
@@ -17,15 +20,22 @@ import (
 //go:generate go run github.com/maxbrunsfeld/counterfeiter/v6 . DBHelper
 type DBHelper interface {
 	StartMysqldForUpgrade() (*exec.Cmd, error)
+	StartMysqldForServerUpgrade(mode string) (cmd *exec.Cmd, errorLog string, err error)
 	StartMysqldInJoin() (*exec.Cmd, error)
 	StartMysqldInBootstrap() (*exec.Cmd, error)
 	StopMysqld()
-	Upgrade() (output string, err error)
-	IsDatabaseReachable() bool
+	StopMysqldContext(ctx context.Context) error
+	RecoverPosition(ctx context.Context) (log string, err error)
+	Upgrade(ctx context.Context, force bool) (output string, err error)
+	IsDatabaseReachable(ctx context.Context) bool
+	GaleraState(ctx context.Context) (string, error)
 	IsProcessRunning() bool
-	Seed() error
-	SeedUsers() error
-	RunPostStartSQL() error
+	IsReceivingStateTransfer() bool
+	ReloadPasswords() error
+	Seed(ctx context.Context) error
+	SeedUsers(ctx context.Context) error
+	ReconcileAccounts(ctx context.Context) error
+	RunPostStartSQL(ctx context.Context) error
 }
 
 type GaleraDBHelper struct {
@@ -34,16 +44,19 @@ type GaleraDBHelper struct {
 	logFileLocation string
 	logger          lager.Logger
 	config          *config.DBHelper
+	flavor          Flavor
 }
 
 func NewDBHelper(
 	osHelper os_helper.OsHelper,
 	config *config.DBHelper,
+	flavor Flavor,
 	logFileLocation string,
 	logger lager.Logger) *GaleraDBHelper {
 	return &GaleraDBHelper{
 		osHelper:        osHelper,
 		config:          config,
+		flavor:          flavor,
 		logFileLocation: logFileLocation,
 		logger:          logger,
 	}
@@ -52,16 +65,21 @@ func NewDBHelper(
 var BuildSeeder = func(db *sql.DB, config config.PreseededDatabase, logger lager.Logger) s.Seeder {
 	return s.NewSeeder(db, config, logger)
 }
-var BuildUserSeeder = func(db *sql.DB, logger lager.Logger) UserSeeder {
-	return NewUserSeeder(db, logger)
+var BuildUserSeeder = func(db *sql.DB, roles RoleCatalog, logger lager.Logger) UserSeeder {
+	return NewUserSeeder(db, roles, logger)
+}
+var BuildAccountReconciler = func(db *sql.DB, config config.DBHelper, logger lager.Logger) AccountReconciler {
+	return NewAccountReconciler(db, config.StaleAccountPolicy, config.User, logger)
 }
 
+// FormatDSN interpolates parameters on the client, as MySQL cannot prepare
+// the account management statements seeding runs with a password
 func FormatDSN(config config.DBHelper) string {
-	skipBinLog := ""
+	params := "?interpolateParams=true"
 	if config.SkipBinlog {
-		skipBinLog = "?sql_log_bin=off"
+		params += "&sql_log_bin=off"
 	}
-	return fmt.Sprintf("%s:%s@unix(%s)/%s", config.User, config.Password, config.Socket, skipBinLog)
+	return fmt.Sprintf("%s:%s@unix(%s)/%s", config.User, config.Password, config.Socket, params)
 }
 
 // Overridable methods to allow mocking DB connections in tests
@@ -79,22 +97,30 @@ var CloseDBConnection = func(db *sql.DB) error {
 
 func (m GaleraDBHelper) IsProcessRunning() bool {
 	_, err := m.osHelper.RunCommand(
-		"mysqladmin",
-		"--defaults-file=/var/vcap/jobs/pxc-mysql/config/mylogin.cnf",
+		m.config.MysqladminPath,
+		m.clientDefaultsFile(),
 		"status")
 	return err == nil
 }
 
+// sstJoinerPattern matches the script mysqld runs to receive a state
+// transfer, such as wsrep_sst_xtrabackup-v2 --role 'joiner'
+const sstJoinerPattern = "wsrep_sst_.*--role.*joiner"
+
+// IsReceivingStateTransfer reports whether an SST script is receiving a
+// state transfer. mysqld does not accept connections meanwhile, so the
+// galera state cannot tell.
+func (m GaleraDBHelper) IsReceivingStateTransfer() bool {
+	_, err := m.osHelper.RunCommand("pgrep", "-f", sstJoinerPattern)
+	return err == nil
+}
+
 func (m GaleraDBHelper) StartMysqldForUpgrade() (*exec.Cmd, error) {
+	args := append([]string{m.mysqldDefaultsFile()}, m.flavor.StandaloneArgs()...)
 	cmd, err := m.osHelper.StartCommand(
 		m.logFileLocation,
-		"mysqld",
-		"--defaults-file=/var/vcap/jobs/pxc-mysql/config/my.cnf",
-		"--wsrep-on=OFF",
-		"--wsrep-desync=ON",
-		"--wsrep-OSU-method=RSU",
-		"--wsrep-provider=none",
-		"--skip-networking",
+		m.config.MysqldPath,
+		append(args, m.config.UpgradeExtraArgs...)...,
 	)
 
 	if err != nil {
@@ -104,9 +130,35 @@ func (m GaleraDBHelper) StartMysqldForUpgrade() (*exec.Cmd, error) {
 	return cmd, nil
 }
 
+// StartMysqldForServerUpgrade starts a stand-alone mysqld that upgrades the
+// data directory itself. Its error log is written to the returned file.
+func (m GaleraDBHelper) StartMysqldForServerUpgrade(mode string) (*exec.Cmd, string, error) {
+	errorLog := filepath.Join(filepath.Dir(m.logFileLocation), "server-upgrade.log")
+
+	if err := m.osHelper.WriteStringToFile(errorLog, ""); err != nil {
+		return nil, "", errors.Wrap(err, "Error truncating server upgrade log")
+	}
+
+	args := append([]string{m.mysqldDefaultsFile()}, m.flavor.StandaloneArgs()...)
+	args = append(args, "--upgrade="+mode, "--log-error="+errorLog)
+	cmd, err := m.osHelper.StartCommand(
+		m.logFileLocation,
+		m.config.MysqldPath,
+		append(args, m.config.UpgradeExtraArgs...)...,
+	)
+
+	if err != nil {
+		return nil, "", errors.Wrap(err, "Error starting mysqld for server upgrade")
+	}
+
+	return cmd, errorLog, nil
+}
+
 func (m GaleraDBHelper) StartMysqldInJoin() (*exec.Cmd, error) {
 	m.logger.Info("Starting mysqld with 'join'.")
-	cmd, err := m.startMysqldAsChildProcess("--defaults-file=/var/vcap/jobs/pxc-mysql/config/my.cnf")
+	cmd, err := m.startMysqldAsChildProcess(
+		append([]string{m.mysqldDefaultsFile()}, m.config.JoinExtraArgs...)...,
+	)
 
 	if err != nil {
 		m.logger.Info(fmt.Sprintf("Error starting mysqld: %s", err.Error()))
@@ -117,7 +169,10 @@ func (m GaleraDBHelper) StartMysqldInJoin() (*exec.Cmd, error) {
 
 func (m GaleraDBHelper) StartMysqldInBootstrap() (*exec.Cmd, error) {
 	m.logger.Info("Starting mysql with 'bootstrap'.")
-	cmd, err := m.startMysqldAsChildProcess("--defaults-file=/var/vcap/jobs/pxc-mysql/config/my.cnf", "--wsrep-new-cluster")
+	args := append([]string{m.mysqldDefaultsFile()}, m.flavor.BootstrapArgs()...)
+	cmd, err := m.startMysqldAsChildProcess(
+		append(args, m.config.BootstrapExtraArgs...)...,
+	)
 
 	if err != nil {
 		m.logger.Info(fmt.Sprintf("Error starting node with 'bootstrap': %s", err.Error()))
@@ -129,29 +184,96 @@ func (m GaleraDBHelper) StartMysqldInBootstrap() (*exec.Cmd, error) {
 func (m GaleraDBHelper) StopMysqld() {
 	m.logger.Info("Stopping node")
 	_, err := m.osHelper.RunCommand(
-		"mysqladmin",
-		"--defaults-file=/var/vcap/jobs/pxc-mysql/config/mylogin.cnf",
+		m.config.MysqladminPath,
+		m.clientDefaultsFile(),
 		"shutdown")
 	if err != nil {
 		m.logger.Fatal("Error stopping mysqld", err)
 	}
 }
 
+// StopMysqldContext shuts mysqld down like StopMysqld, but returns an error
+// instead of exiting, and gives up waiting for mysqld when ctx is done
+func (m GaleraDBHelper) StopMysqldContext(ctx context.Context) error {
+	m.logger.Info("Stopping node")
+	_, err := m.osHelper.RunCommandContext(
+		ctx,
+		m.config.MysqladminPath,
+		m.clientDefaultsFile(),
+		"shutdown")
+	return errors.Wrap(err, "Error stopping mysqld")
+}
+
+// ReloadPasswords reads the passwords given as files or environment
+// variables again, so mysqld is seeded with and connected to using the
+// current secrets
+func (m GaleraDBHelper) ReloadPasswords() error {
+	if err := m.config.ReadPasswords(); err != nil {
+		m.logger.Error("Error reloading passwords", err)
+		return err
+	}
+	return nil
+}
+
+// RecoverPosition runs mysqld --wsrep-recover and returns the log it wrote the recovered position to
+func (m GaleraDBHelper) RecoverPosition(ctx context.Context) (string, error) {
+	recoveryLog := filepath.Join(filepath.Dir(m.logFileLocation), "wsrep-recover.log")
+
+	if err := m.osHelper.WriteStringToFile(recoveryLog, ""); err != nil {
+		return "", errors.Wrap(err, "Error truncating wsrep recovery log")
+	}
+
+	output, err := m.osHelper.RunCommandContext(
+		ctx,
+		m.config.MysqldPath,
+		m.mysqldDefaultsFile(),
+		"--wsrep-recover",
+		"--log-error="+recoveryLog,
+	)
+	if err != nil {
+		return output, errors.Wrap(err, "Error running mysqld --wsrep-recover")
+	}
+
+	log, err := m.osHelper.ReadFile(recoveryLog)
+	if err != nil {
+		return output, errors.Wrap(err, "Error reading wsrep recovery log")
+	}
+
+	return output + log, nil
+}
+
 func (m GaleraDBHelper) startMysqldAsChildProcess(mysqlArgs ...string) (*exec.Cmd, error) {
 	return m.osHelper.StartCommand(
 		m.logFileLocation,
-		"mysqld",
+		m.config.MysqldPath,
 		mysqlArgs...)
 }
 
-func (m GaleraDBHelper) Upgrade() (output string, err error) {
-	return m.osHelper.RunCommand(
+// mysqldDefaultsFile must be the first argument mysqld is started with
+func (m GaleraDBHelper) mysqldDefaultsFile() string {
+	return "--defaults-file=" + m.config.MyCnfPath
+}
+
+func (m GaleraDBHelper) clientDefaultsFile() string {
+	return "--defaults-file=" + m.config.MyLoginCnfPath
+}
+
+// Upgrade runs the upgrade script. force makes it check every table even when
+// the data directory claims to be upgraded already.
+func (m GaleraDBHelper) Upgrade(ctx context.Context, force bool) (output string, err error) {
+	args := []string{m.clientDefaultsFile()}
+	if force {
+		args = append(args, "--force")
+	}
+
+	return m.osHelper.RunCommandContext(
+		ctx,
 		m.config.UpgradePath,
-		"--defaults-file=/var/vcap/jobs/pxc-mysql/config/mylogin.cnf",
+		args...,
 	)
 }
 
-func (m GaleraDBHelper) IsDatabaseReachable() bool {
+func (m GaleraDBHelper) IsDatabaseReachable(ctx context.Context) bool {
 	m.logger.Info(fmt.Sprintf("Determining if database is reachable"))
 
 	db, err := OpenDBConnection(m.config)
@@ -166,7 +288,7 @@ func (m GaleraDBHelper) IsDatabaseReachable() bool {
 		value  string
 	)
 
-	err = db.QueryRow(`SHOW GLOBAL VARIABLES LIKE 'wsrep\_provider'`).Scan(&unused, &value)
+	err = db.QueryRowContext(ctx, `SHOW GLOBAL VARIABLES LIKE 'wsrep\_provider'`).Scan(&unused, &value)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			m.logger.Info(fmt.Sprintf("Database is reachable, Galera is off"))
@@ -181,17 +303,56 @@ func (m GaleraDBHelper) IsDatabaseReachable() bool {
 		return true
 	}
 
-	err = db.QueryRow(`SHOW GLOBAL STATUS LIKE 'wsrep\_local\_state\_comment'`).Scan(&unused, &value)
+	err = db.QueryRowContext(ctx, `SHOW GLOBAL STATUS LIKE 'wsrep\_local\_state\_comment'`).Scan(&unused, &value)
 	if err != nil {
 		m.logger.Debug(fmt.Sprintf("Galera state not Synced, received: %v", err))
 		return false
 	}
 
 	m.logger.Info(fmt.Sprintf("Galera Database state is %s", value))
-	return value == "Synced"
+	if value != "Synced" {
+		return false
+	}
+
+	readyVariable := m.flavor.ReadyStatusVariable()
+	if readyVariable == "" {
+		return true
+	}
+
+	query := fmt.Sprintf(`SHOW GLOBAL STATUS LIKE '%s'`, strings.Replace(readyVariable, "_", `\_`, -1))
+	err = db.QueryRowContext(ctx, query).Scan(&unused, &value)
+	if err != nil {
+		m.logger.Debug(fmt.Sprintf("Could not read %s, received: %v", readyVariable, err))
+		return false
+	}
+
+	m.logger.Info(fmt.Sprintf("Galera Database %s is %s", readyVariable, value))
+	return value == "ON"
+}
+
+// GaleraState returns wsrep_local_state_comment, e.g. Joining or Synced. It
+// fails when the database cannot be queried.
+func (m GaleraDBHelper) GaleraState(ctx context.Context) (string, error) {
+	db, err := OpenDBConnection(m.config)
+	if err != nil {
+		return "", errors.Wrap(err, "database not reachable")
+	}
+	defer CloseDBConnection(db)
+
+	var (
+		unused string
+		value  string
+	)
+
+	err = db.QueryRowContext(ctx, `SHOW GLOBAL STATUS LIKE 'wsrep\_local\_state\_comment'`).Scan(&unused, &value)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to query galera state")
+	}
+
+	return value, nil
 }
 
-func (m GaleraDBHelper) Seed() error {
+func (m GaleraDBHelper) Seed(ctx context.Context) error {
 	if m.config.PreseededDatabases == nil || len(m.config.PreseededDatabases) == 0 {
 		m.logger.Info("No preseeded databases specified, skipping seeding.")
 		return nil
@@ -207,40 +368,56 @@ func (m GaleraDBHelper) Seed() error {
 	defer CloseDBConnection(db)
 
 	for _, dbToCreate := range m.config.PreseededDatabases {
-		seeder := BuildSeeder(db, dbToCreate, m.logger)
-
-		if err := seeder.CreateDBIfNeeded(); err != nil {
+		if err := ctx.Err(); err != nil {
 			return err
 		}
 
-		userAlreadyExists, err := seeder.IsExistingUser()
-		if err != nil {
+		seeder := BuildSeeder(db, dbToCreate, m.logger)
+
+		if err := seeder.CreateDBIfNeeded(); err != nil {
 			return err
 		}
 
-		if userAlreadyExists == false {
-			if err := seeder.CreateUser(); err != nil {
+		for _, user := range dbToCreate.DatabaseUsers() {
+			hosts, err := user.AccountHosts()
+			if err != nil {
 				return err
 			}
-		} else {
-			if err := seeder.UpdateUser(); err != nil {
-				return err
+			for _, host := range hosts {
+				if err := seedDatabaseUser(seeder, user, host); err != nil {
+					return err
+				}
 			}
 		}
-
-		if err := seeder.GrantUserPrivileges(); err != nil {
-			return err
-		}
 	}
 
-	if err := m.flushPrivileges(db); err != nil {
+	if err := m.flushPrivileges(ctx, db); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func (m GaleraDBHelper) SeedUsers() error {
+func seedDatabaseUser(seeder s.Seeder, user config.PreseededDatabaseUser, host string) error {
+	userAlreadyExists, err := seeder.IsExistingUser(user.User, host)
+	if err != nil {
+		return err
+	}
+
+	if userAlreadyExists == false {
+		if err := seeder.CreateUser(user, host); err != nil {
+			return err
+		}
+	} else {
+		if err := seeder.UpdateUser(user, host); err != nil {
+			return err
+		}
+	}
+
+	return seeder.GrantUserPrivileges(user, host)
+}
+
+func (m GaleraDBHelper) SeedUsers(ctx context.Context) error {
 	if m.config.SeededUsers == nil || len(m.config.SeededUsers) == 0 {
 		m.logger.Info("No seeded users specified, skipping seeding.")
 		return nil
@@ -255,26 +432,103 @@ func (m GaleraDBHelper) SeedUsers() error {
 	}
 	defer CloseDBConnection(db)
 
+	var serverVersion string
+	if err := db.QueryRowContext(ctx, "SELECT VERSION()").Scan(&serverVersion); err != nil {
+		m.logger.Error("Error reading server version", err)
+		return err
+	}
+
+	roles := NewRoleCatalog(m.flavor, serverVersion, m.config.Roles)
+
 	for _, userToCreate := range m.config.SeededUsers {
-		seeder := BuildUserSeeder(db, m.logger)
-
-		err = seeder.SeedUser(
-			userToCreate.User,
-			userToCreate.Password,
-			userToCreate.Host,
-			userToCreate.Role,
-		)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		seeder := BuildUserSeeder(db, roles, m.logger)
+
+		hosts, err := userToCreate.AccountHosts()
 		if err != nil {
+			m.logger.Error("Invalid host", err, lager.Data{
+				"user": userToCreate.User,
+			})
 			return err
 		}
 
+		for _, host := range hosts {
+			if err := seeder.SeedUser(userToCreate, host); err != nil {
+				return err
+			}
+		}
 	}
 
 	return nil
 }
 
-func (m GaleraDBHelper) flushPrivileges(db *sql.DB) error {
-	if _, err := db.Exec("FLUSH PRIVILEGES"); err != nil {
+// ReconcileAccounts applies StaleAccountPolicy to the accounts galera-init
+// seeded before that are no longer in PreseededDatabases or SeededUsers
+func (m GaleraDBHelper) ReconcileAccounts(ctx context.Context) error {
+	desired, err := m.seededAccounts()
+	if err != nil {
+		return err
+	}
+
+	db, err := OpenDBConnection(m.config)
+	if err != nil {
+		m.logger.Error("database not reachable", err)
+		return err
+	}
+	defer CloseDBConnection(db)
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := BuildAccountReconciler(db, *m.config, m.logger).Reconcile(desired); err != nil {
+		return err
+	}
+
+	return m.flushPrivileges(ctx, db)
+}
+
+// seededAccounts lists every account Seed and SeedUsers create, without duplicates
+func (m GaleraDBHelper) seededAccounts() ([]Account, error) {
+	var accounts []Account
+	seen := map[Account]bool{}
+	add := func(account Account) {
+		if !seen[account] {
+			seen[account] = true
+			accounts = append(accounts, account)
+		}
+	}
+
+	for _, db := range m.config.PreseededDatabases {
+		for _, user := range db.DatabaseUsers() {
+			hosts, err := user.AccountHosts()
+			if err != nil {
+				return nil, err
+			}
+			for _, host := range hosts {
+				add(Account{User: user.User, Host: host})
+			}
+		}
+	}
+
+	for _, user := range m.config.SeededUsers {
+		hosts, err := user.AccountHosts()
+		if err != nil {
+			return nil, err
+		}
+		for _, host := range hosts {
+			add(Account{User: user.User, Host: host})
+		}
+	}
+
+	return accounts, nil
+}
+
+func (m GaleraDBHelper) flushPrivileges(ctx context.Context, db *sql.DB) error {
+	if _, err := db.ExecContext(ctx, "FLUSH PRIVILEGES"); err != nil {
 		m.logger.Error("Error flushing privileges", err)
 		return err
 	}
@@ -282,7 +536,7 @@ func (m GaleraDBHelper) flushPrivileges(db *sql.DB) error {
 	return nil
 }
 
-func (m GaleraDBHelper) RunPostStartSQL() error {
+func (m GaleraDBHelper) RunPostStartSQL(ctx context.Context) error {
 	m.logger.Info("Running Post Start SQL Queries")
 
 	db, err := OpenDBConnection(m.config)
@@ -299,7 +553,7 @@ func (m GaleraDBHelper) RunPostStartSQL() error {
 				"filePath": file,
 			})
 		} else {
-			if _, err := db.Exec(string(sqlString)); err != nil {
+			if _, err := db.ExecContext(ctx, string(sqlString)); err != nil {
 				return err
 			}
 
@@ -1,12 +1,14 @@
 package db_helper_test
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
 
 	"code.cloudfoundry.org/lager"
 	"code.cloudfoundry.org/lager/lagertest"
@@ -33,15 +35,18 @@ var _ = Describe("GaleraDBHelper", func() {
 	)
 
 	var (
-		helper         *db_helper.GaleraDBHelper
-		fakeOs         *os_helperfakes.FakeOsHelper
-		fakeSeeder     *seederfakes.FakeSeeder
-		fakeUserSeeder *db_helperfakes.FakeUserSeeder
-		testLogger     lagertest.TestLogger
-		logFile        string
-		dbConfig       *config.DBHelper
-		fakeDB         *sql.DB
-		mock           sqlmock.Sqlmock
+		helper          *db_helper.GaleraDBHelper
+		fakeOs          *os_helperfakes.FakeOsHelper
+		fakeSeeder      *seederfakes.FakeSeeder
+		fakeUserSeeder  *db_helperfakes.FakeUserSeeder
+		userSeederRoles db_helper.RoleCatalog
+		fakeReconciler  *db_helperfakes.FakeAccountReconciler
+		testLogger      lagertest.TestLogger
+		logFile         string
+		dbConfig        *config.DBHelper
+		flavor          db_helper.Flavor
+		fakeDB          *sql.DB
+		mock            sqlmock.Sqlmock
 	)
 
 	BeforeEach(func() {
@@ -49,6 +54,7 @@ var _ = Describe("GaleraDBHelper", func() {
 		fakeOs = new(os_helperfakes.FakeOsHelper)
 		fakeSeeder = new(seederfakes.FakeSeeder)
 		fakeUserSeeder = new(db_helperfakes.FakeUserSeeder)
+		fakeReconciler = new(db_helperfakes.FakeAccountReconciler)
 		testLogger = *lagertest.NewTestLogger("db_helper")
 
 		fakeDB, mock, err = sqlmock.New()
@@ -64,11 +70,16 @@ var _ = Describe("GaleraDBHelper", func() {
 		db_helper.BuildSeeder = func(db *sql.DB, config config.PreseededDatabase, logger lager.Logger) seeder.Seeder {
 			return fakeSeeder
 		}
-		db_helper.BuildUserSeeder = func(db *sql.DB, logger lager.Logger) db_helper.UserSeeder {
+		db_helper.BuildUserSeeder = func(db *sql.DB, roles db_helper.RoleCatalog, logger lager.Logger) db_helper.UserSeeder {
+			userSeederRoles = roles
 			return fakeUserSeeder
 		}
+		db_helper.BuildAccountReconciler = func(db *sql.DB, config config.DBHelper, logger lager.Logger) db_helper.AccountReconciler {
+			return fakeReconciler
+		}
 
 		logFile = "/log-file.log"
+		flavor = db_helper.PXCFlavor{}
 
 		sqlFile1, _ := ioutil.TempFile(os.TempDir(), "fake_sql_file")
 		defer sqlFile1.Close()
@@ -79,9 +90,13 @@ var _ = Describe("GaleraDBHelper", func() {
 		ioutil.WriteFile(sqlFile2.Name(), []byte(fakeSupplementalQuery2), 755)
 
 		dbConfig = &config.DBHelper{
-			UpgradePath: "/mysql_upgrade",
-			User:        "user",
-			Password:    "password",
+			MysqldPath:     "mysqld",
+			MysqladminPath: "mysqladmin",
+			MyCnfPath:      "/var/vcap/jobs/pxc-mysql/config/my.cnf",
+			MyLoginCnfPath: "/var/vcap/jobs/pxc-mysql/config/mylogin.cnf",
+			UpgradePath:    "/mysql_upgrade",
+			User:           "user",
+			Password:       "password",
 			PreseededDatabases: []config.PreseededDatabase{
 				config.PreseededDatabase{
 					DBName:   "DB1",
@@ -116,6 +131,7 @@ var _ = Describe("GaleraDBHelper", func() {
 		helper = db_helper.NewDBHelper(
 			fakeOs,
 			dbConfig,
+			flavor,
 			logFile,
 			testLogger,
 		)
@@ -165,6 +181,210 @@ var _ = Describe("GaleraDBHelper", func() {
 				Expect(err).To(MatchError(`Error starting mysqld in stand-alone: starting somehow failed`))
 			})
 		})
+
+		Context("when extra upgrade arguments are configured", func() {
+			BeforeEach(func() {
+				dbConfig.UpgradeExtraArgs = []string{"--innodb-buffer-pool-size=1G"}
+			})
+
+			It("appends them to the mysqld arguments", func() {
+				_, err := helper.StartMysqldForUpgrade()
+				Expect(err).NotTo(HaveOccurred())
+
+				_, _, args := fakeOs.StartCommandArgsForCall(0)
+				Expect(args[0]).To(Equal("--defaults-file=/var/vcap/jobs/pxc-mysql/config/my.cnf"))
+				Expect(args[len(args)-1]).To(Equal("--innodb-buffer-pool-size=1G"))
+			})
+		})
+	})
+
+	Describe("StartMysqldForServerUpgrade", func() {
+		BeforeEach(func() {
+			fakeOs.StartCommandStub = func(logFile string, executable string, args ...string) (cmd *exec.Cmd, e error) {
+				return exec.Command("stub"), nil
+			}
+		})
+
+		It("starts a stand-alone mysqld that upgrades itself into its own error log", func() {
+			cmd, errorLog, err := helper.StartMysqldForServerUpgrade("AUTO")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cmd).NotTo(BeNil())
+			Expect(errorLog).To(Equal(filepath.Join(filepath.Dir(logFile), "server-upgrade.log")))
+
+			Expect(fakeOs.WriteStringToFileCallCount()).To(Equal(1))
+			truncated, contents := fakeOs.WriteStringToFileArgsForCall(0)
+			Expect(truncated).To(Equal(errorLog))
+			Expect(contents).To(BeEmpty())
+
+			_, executable, args := fakeOs.StartCommandArgsForCall(0)
+			Expect(executable).To(Equal("mysqld"))
+			Expect(args).To(Equal([]string{
+				"--defaults-file=/var/vcap/jobs/pxc-mysql/config/my.cnf",
+				"--wsrep-on=OFF",
+				"--wsrep-desync=ON",
+				"--wsrep-OSU-method=RSU",
+				"--wsrep-provider=none",
+				"--skip-networking",
+				"--upgrade=AUTO",
+				"--log-error=" + errorLog,
+			}))
+		})
+
+		Context("when an error occurs while starting mysqld", func() {
+			It("should return an error", func() {
+				fakeOs.StartCommandReturns(nil, errors.New("starting somehow failed"))
+
+				_, _, err := helper.StartMysqldForServerUpgrade("FORCE")
+				Expect(err).To(MatchError(`Error starting mysqld for server upgrade: starting somehow failed`))
+			})
+		})
+	})
+
+	Describe("NewFlavor", func() {
+		It("defaults to PXC", func() {
+			Expect(db_helper.NewFlavor("")).To(Equal(db_helper.PXCFlavor{}))
+		})
+
+		It("returns the MariaDB flavor", func() {
+			Expect(db_helper.NewFlavor("mariadb")).To(Equal(db_helper.MariaDBFlavor{}))
+		})
+
+		It("rejects unknown flavors", func() {
+			_, err := db_helper.NewFlavor("mysql-cluster")
+			Expect(err).To(MatchError(`unsupported flavor "mysql-cluster"`))
+		})
+
+		It("names the binaries of each flavor", func() {
+			Expect(db_helper.PXCFlavor{}.Binaries().Upgrade).To(Equal("mysql_upgrade"))
+			Expect(db_helper.MariaDBFlavor{}.Binaries()).To(Equal(config.Binaries{
+				Mysqld:     "mariadbd",
+				Mysqladmin: "mariadb-admin",
+				Upgrade:    "mariadb-upgrade",
+			}))
+		})
+	})
+
+	Context("with the MariaDB flavor", func() {
+		BeforeEach(func() {
+			flavor = db_helper.MariaDBFlavor{}
+		})
+
+		It("starts mysqld for upgrade without PXC specific options", func() {
+			_, err := helper.StartMysqldForUpgrade()
+			Expect(err).NotTo(HaveOccurred())
+
+			_, _, args := fakeOs.StartCommandArgsForCall(0)
+			Expect(args).To(Equal([]string{
+				"--defaults-file=/var/vcap/jobs/pxc-mysql/config/my.cnf",
+				"--wsrep-on=OFF",
+				"--wsrep-provider=none",
+				"--skip-networking",
+				"--skip-slave-start",
+			}))
+		})
+
+		It("bootstraps a new cluster", func() {
+			_, err := helper.StartMysqldInBootstrap()
+			Expect(err).NotTo(HaveOccurred())
+
+			_, _, args := fakeOs.StartCommandArgsForCall(0)
+			Expect(args).To(Equal([]string{
+				"--defaults-file=/var/vcap/jobs/pxc-mysql/config/my.cnf",
+				"--wsrep-new-cluster",
+			}))
+		})
+
+		Describe("IsDatabaseReachable", func() {
+			BeforeEach(func() {
+				mock.ExpectQuery(`SHOW GLOBAL VARIABLES LIKE 'wsrep\\_provider'`).
+					WillReturnRows(sqlmock.NewRows([]string{"Variable_name", "Value"}).
+						AddRow("wsrep_provider", "/usr/lib/galera/libgalera_smm.so"))
+				mock.ExpectQuery(`SHOW GLOBAL STATUS LIKE 'wsrep\\_local\\_state\\_comment'`).
+					WillReturnRows(sqlmock.NewRows([]string{"Variable_name", "Value"}).
+						AddRow("wsrep_local_state_comment", "Synced"))
+			})
+
+			It("returns true once wsrep_ready is ON", func() {
+				mock.ExpectQuery(`SHOW GLOBAL STATUS LIKE 'wsrep\\_ready'`).
+					WillReturnRows(sqlmock.NewRows([]string{"Variable_name", "Value"}).
+						AddRow("wsrep_ready", "ON"))
+
+				Expect(helper.IsDatabaseReachable(context.TODO())).To(BeTrue())
+			})
+
+			It("returns false while wsrep_ready is OFF", func() {
+				mock.ExpectQuery(`SHOW GLOBAL STATUS LIKE 'wsrep\\_ready'`).
+					WillReturnRows(sqlmock.NewRows([]string{"Variable_name", "Value"}).
+						AddRow("wsrep_ready", "OFF"))
+
+				Expect(helper.IsDatabaseReachable(context.TODO())).To(BeFalse())
+			})
+		})
+	})
+
+	Describe("StartMysqldInJoin", func() {
+		It("starts mysqld with the configured option file", func() {
+			_, err := helper.StartMysqldInJoin()
+			Expect(err).NotTo(HaveOccurred())
+
+			logFile, executable, args := fakeOs.StartCommandArgsForCall(0)
+			Expect(logFile).To(Equal("/log-file.log"))
+			Expect(executable).To(Equal("mysqld"))
+			Expect(args).To(Equal([]string{"--defaults-file=/var/vcap/jobs/pxc-mysql/config/my.cnf"}))
+		})
+
+		Context("when a custom layout and extra join arguments are configured", func() {
+			BeforeEach(func() {
+				dbConfig.MysqldPath = "/usr/sbin/mysqld"
+				dbConfig.MyCnfPath = "/etc/mysql/my.cnf"
+				dbConfig.JoinExtraArgs = []string{"--wsrep-sst-donor=node0"}
+				dbConfig.BootstrapExtraArgs = []string{"--unused"}
+			})
+
+			It("uses them", func() {
+				_, err := helper.StartMysqldInJoin()
+				Expect(err).NotTo(HaveOccurred())
+
+				_, executable, args := fakeOs.StartCommandArgsForCall(0)
+				Expect(executable).To(Equal("/usr/sbin/mysqld"))
+				Expect(args).To(Equal([]string{
+					"--defaults-file=/etc/mysql/my.cnf",
+					"--wsrep-sst-donor=node0",
+				}))
+			})
+		})
+	})
+
+	Describe("StartMysqldInBootstrap", func() {
+		It("starts mysqld with a new cluster", func() {
+			_, err := helper.StartMysqldInBootstrap()
+			Expect(err).NotTo(HaveOccurred())
+
+			_, executable, args := fakeOs.StartCommandArgsForCall(0)
+			Expect(executable).To(Equal("mysqld"))
+			Expect(args).To(Equal([]string{
+				"--defaults-file=/var/vcap/jobs/pxc-mysql/config/my.cnf",
+				"--wsrep-new-cluster",
+			}))
+		})
+
+		Context("when extra bootstrap arguments are configured", func() {
+			BeforeEach(func() {
+				dbConfig.BootstrapExtraArgs = []string{"--wsrep-provider-options=pc.bootstrap=1"}
+			})
+
+			It("appends them to the mysqld arguments", func() {
+				_, err := helper.StartMysqldInBootstrap()
+				Expect(err).NotTo(HaveOccurred())
+
+				_, _, args := fakeOs.StartCommandArgsForCall(0)
+				Expect(args).To(Equal([]string{
+					"--defaults-file=/var/vcap/jobs/pxc-mysql/config/my.cnf",
+					"--wsrep-new-cluster",
+					"--wsrep-provider-options=pc.bootstrap=1",
+				}))
+			})
+		})
 	})
 
 	Describe("StopMysqld", func() {
@@ -178,6 +398,17 @@ var _ = Describe("GaleraDBHelper", func() {
 			Expect(args).To(Equal([]string{"--defaults-file=/var/vcap/jobs/pxc-mysql/config/mylogin.cnf", "shutdown"}))
 		})
 
+		It("uses the configured mysqladmin and client option file", func() {
+			dbConfig.MysqladminPath = "/usr/bin/mysqladmin"
+			dbConfig.MyLoginCnfPath = "/etc/mysql/debian.cnf"
+
+			helper.StopMysqld()
+
+			executable, args := fakeOs.RunCommandArgsForCall(0)
+			Expect(executable).To(Equal("/usr/bin/mysqladmin"))
+			Expect(args).To(Equal([]string{"--defaults-file=/etc/mysql/debian.cnf", "shutdown"}))
+		})
+
 		Context("when an error occurs", func() {
 
 			It("panics with the error", func() {
@@ -190,6 +421,112 @@ var _ = Describe("GaleraDBHelper", func() {
 		})
 	})
 
+	Describe("StopMysqldContext", func() {
+		It("calls the mysql daemon with the stop command", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			Expect(helper.StopMysqldContext(ctx)).To(Succeed())
+
+			Expect(fakeOs.RunCommandContextCallCount()).To(Equal(1))
+			actualCtx, executable, args := fakeOs.RunCommandContextArgsForCall(0)
+			Expect(actualCtx).To(Equal(ctx))
+			Expect(executable).To(Equal("mysqladmin"))
+			Expect(args).To(Equal([]string{"--defaults-file=/var/vcap/jobs/pxc-mysql/config/mylogin.cnf", "shutdown"}))
+		})
+
+		Context("when an error occurs", func() {
+			BeforeEach(func() {
+				fakeOs.RunCommandContextReturns("", errors.New("stopping somehow failed"))
+			})
+
+			It("returns the error", func() {
+				err := helper.StopMysqldContext(context.TODO())
+				Expect(err).To(MatchError("Error stopping mysqld: stopping somehow failed"))
+			})
+		})
+	})
+
+	Describe("ReloadPasswords", func() {
+		var passwordFile string
+
+		BeforeEach(func() {
+			file, err := ioutil.TempFile(os.TempDir(), "password")
+			Expect(err).NotTo(HaveOccurred())
+			file.Close()
+			passwordFile = file.Name()
+
+			dbConfig.Password = ""
+			dbConfig.PasswordFile = passwordFile
+		})
+
+		AfterEach(func() {
+			os.Remove(passwordFile)
+		})
+
+		It("reads the password file again on every call", func() {
+			Expect(ioutil.WriteFile(passwordFile, []byte("old-password\n"), 0600)).To(Succeed())
+			Expect(helper.ReloadPasswords()).To(Succeed())
+			Expect(dbConfig.Password).To(Equal("old-password"))
+
+			Expect(ioutil.WriteFile(passwordFile, []byte("new-password\n"), 0600)).To(Succeed())
+			Expect(helper.ReloadPasswords()).To(Succeed())
+			Expect(dbConfig.Password).To(Equal("new-password"))
+			Expect(db_helper.FormatDSN(*dbConfig)).To(HavePrefix("user:new-password@"))
+		})
+
+		Context("when the password file is missing", func() {
+			BeforeEach(func() {
+				os.Remove(passwordFile)
+			})
+
+			It("returns and logs the error", func() {
+				err := helper.ReloadPasswords()
+				Expect(err).To(MatchError(ContainSubstring("Db.PasswordFile : open " + passwordFile)))
+				Expect(testLogger.Buffer()).To(Say("Error reloading passwords"))
+			})
+		})
+	})
+
+	Describe("RecoverPosition", func() {
+		BeforeEach(func() {
+			fakeOs.RunCommandContextReturns("some output\n", nil)
+			fakeOs.ReadFileReturns("WSREP: Recovered position: some-uuid:42\n", nil)
+		})
+
+		It("runs mysqld --wsrep-recover and returns its log", func() {
+			log, err := helper.RecoverPosition(context.TODO())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(log).To(Equal("some output\nWSREP: Recovered position: some-uuid:42\n"))
+
+			Expect(fakeOs.WriteStringToFileCallCount()).To(Equal(1))
+			recoveryLog, contents := fakeOs.WriteStringToFileArgsForCall(0)
+			Expect(recoveryLog).To(Equal("/wsrep-recover.log"))
+			Expect(contents).To(BeEmpty())
+
+			ctx, executable, args := fakeOs.RunCommandContextArgsForCall(0)
+			Expect(ctx).To(Equal(context.TODO()))
+			Expect(executable).To(Equal("mysqld"))
+			Expect(args).To(Equal([]string{
+				"--defaults-file=/var/vcap/jobs/pxc-mysql/config/my.cnf",
+				"--wsrep-recover",
+				"--log-error=/wsrep-recover.log",
+			}))
+			Expect(fakeOs.ReadFileArgsForCall(0)).To(Equal("/wsrep-recover.log"))
+		})
+
+		Context("when mysqld fails", func() {
+			BeforeEach(func() {
+				fakeOs.RunCommandContextReturns("some output", errors.New("exit status 1"))
+			})
+
+			It("returns the error", func() {
+				_, err := helper.RecoverPosition(context.TODO())
+				Expect(err).To(MatchError("Error running mysqld --wsrep-recover: exit status 1"))
+			})
+		})
+	})
+
 	Describe("IsProcessRunning", func() {
 		It("returns true if `mysql.server status` exits zero", func() {
 			fakeOs.RunCommandReturns("", nil)
@@ -216,20 +553,45 @@ var _ = Describe("GaleraDBHelper", func() {
 		})
 	})
 
+	Describe("IsReceivingStateTransfer", func() {
+		It("returns true if an SST script runs as joiner", func() {
+			fakeOs.RunCommandReturns("1234\n", nil)
+
+			Expect(helper.IsReceivingStateTransfer()).To(BeTrue())
+
+			executable, args := fakeOs.RunCommandArgsForCall(0)
+			Expect(executable).To(Equal("pgrep"))
+			Expect(args).To(Equal([]string{"-f", "wsrep_sst_.*--role.*joiner"}))
+		})
+
+		It("returns false if no SST script runs", func() {
+			fakeOs.RunCommandReturns("", errors.New("exit status 1"))
+
+			Expect(helper.IsReceivingStateTransfer()).To(BeFalse())
+		})
+	})
+
 	Describe("Upgrade", func() {
 		It("calls the mysql upgrade script", func() {
-			helper.Upgrade()
-			Expect(fakeOs.RunCommandCallCount()).To(Equal(1))
+			helper.Upgrade(context.TODO(), false)
+			Expect(fakeOs.RunCommandContextCallCount()).To(Equal(1))
 
-			executable, args := fakeOs.RunCommandArgsForCall(0)
+			_, executable, args := fakeOs.RunCommandContextArgsForCall(0)
 			Expect(executable).To(Equal(dbConfig.UpgradePath))
 			Expect(args).To(Equal([]string{"--defaults-file=/var/vcap/jobs/pxc-mysql/config/mylogin.cnf"}))
 		})
 
+		It("forces the upgrade script to check every table", func() {
+			helper.Upgrade(context.TODO(), true)
+
+			_, _, args := fakeOs.RunCommandContextArgsForCall(0)
+			Expect(args).To(Equal([]string{"--defaults-file=/var/vcap/jobs/pxc-mysql/config/mylogin.cnf", "--force"}))
+		})
+
 		It("returns the output and error", func() {
-			fakeOs.RunCommandReturns("some output", errors.New("some error"))
+			fakeOs.RunCommandContextReturns("some output", errors.New("some error"))
 
-			output, err := helper.Upgrade()
+			output, err := helper.Upgrade(context.TODO(), false)
 			Expect(output).To(Equal("some output"))
 			Expect(err.Error()).To(Equal("some error"))
 		})
@@ -247,7 +609,7 @@ var _ = Describe("GaleraDBHelper", func() {
 			})
 
 			It("returns false", func() {
-				Expect(helper.IsDatabaseReachable()).To(BeFalse())
+				Expect(helper.IsDatabaseReachable(context.TODO())).To(BeFalse())
 			})
 		})
 
@@ -267,7 +629,7 @@ var _ = Describe("GaleraDBHelper", func() {
 				})
 
 				It("returns true", func() {
-					Expect(helper.IsDatabaseReachable()).To(BeTrue())
+					Expect(helper.IsDatabaseReachable(context.TODO())).To(BeTrue())
 				})
 			})
 
@@ -279,7 +641,7 @@ var _ = Describe("GaleraDBHelper", func() {
 				})
 
 				It("returns false", func() {
-					Expect(helper.IsDatabaseReachable()).To(BeFalse())
+					Expect(helper.IsDatabaseReachable(context.TODO())).To(BeFalse())
 				})
 			})
 		})
@@ -291,7 +653,7 @@ var _ = Describe("GaleraDBHelper", func() {
 					mock.ExpectQuery(wsrepProviderQuery).
 						WillReturnError(sql.ErrNoRows)
 
-					Expect(helper.IsDatabaseReachable()).To(BeTrue())
+					Expect(helper.IsDatabaseReachable(context.TODO())).To(BeTrue())
 				})
 			})
 
@@ -299,7 +661,7 @@ var _ = Describe("GaleraDBHelper", func() {
 				mock.ExpectQuery(wsrepProviderQuery).
 					WillReturnRows(sqlmock.NewRows([]string{"Variable_name", "Value"}).
 						AddRow("wsrep_provider", "none"))
-				Expect(helper.IsDatabaseReachable()).To(BeTrue())
+				Expect(helper.IsDatabaseReachable(context.TODO())).To(BeTrue())
 			})
 		})
 
@@ -311,12 +673,47 @@ var _ = Describe("GaleraDBHelper", func() {
 			})
 
 			It("returns false", func() {
-				Expect(helper.IsDatabaseReachable()).To(BeFalse())
+				Expect(helper.IsDatabaseReachable(context.TODO())).To(BeFalse())
 			})
 		})
 
 	})
 
+	Describe("GaleraState", func() {
+		galeraStateQuery := `SHOW GLOBAL STATUS LIKE 'wsrep\\_local\\_state\\_comment'`
+
+		It("returns the galera state", func() {
+			mock.ExpectQuery(galeraStateQuery).
+				WillReturnRows(sqlmock.NewRows([]string{"Variable_name", "Value"}).
+					AddRow("wsrep_local_state_comment", "Joining: receiving State Transfer"))
+
+			state, err := helper.GaleraState(context.TODO())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(state).To(Equal("Joining: receiving State Transfer"))
+		})
+
+		It("returns an error when the query fails", func() {
+			mock.ExpectQuery(galeraStateQuery).
+				WillReturnError(fmt.Errorf("some error"))
+
+			_, err := helper.GaleraState(context.TODO())
+			Expect(err).To(MatchError("failed to query galera state: some error"))
+		})
+
+		Context("when db connection can't be opened", func() {
+			BeforeEach(func() {
+				db_helper.OpenDBConnection = func(*config.DBHelper) (*sql.DB, error) {
+					return nil, fmt.Errorf("whoops")
+				}
+			})
+
+			It("returns an error", func() {
+				_, err := helper.GaleraState(context.TODO())
+				Expect(err).To(MatchError("database not reachable: whoops"))
+			})
+		})
+	})
+
 	Describe("Seed", func() {
 		Context("when there are pre-seeded databases", func() {
 			Context("if the users already exist", func() {
@@ -329,7 +726,7 @@ var _ = Describe("GaleraDBHelper", func() {
 				})
 
 				It("creates the specified databases if they don't exist and updates the users", func() {
-					helper.Seed()
+					helper.Seed(context.TODO())
 
 					Expect(fakeSeeder.CreateDBIfNeededCallCount()).To(Equal(2))
 					Expect(fakeSeeder.IsExistingUserCallCount()).To(Equal(2))
@@ -349,7 +746,7 @@ var _ = Describe("GaleraDBHelper", func() {
 				})
 
 				It("creates the specified databases if they don't exist and creates users", func() {
-					helper.Seed()
+					helper.Seed(context.TODO())
 
 					Expect(fakeSeeder.CreateDBIfNeededCallCount()).To(Equal(2))
 					Expect(fakeSeeder.IsExistingUserCallCount()).To(Equal(2))
@@ -358,26 +755,87 @@ var _ = Describe("GaleraDBHelper", func() {
 				})
 			})
 
+			Context("when a database has further users and hosts", func() {
+				BeforeEach(func() {
+					dbConfig.PreseededDatabases = []config.PreseededDatabase{
+						{
+							DBName:   "DB1",
+							User:     "app",
+							Password: "app-password",
+							Hosts:    []string{"10.0.16.%", "10.0.17.%"},
+							Users: []config.PreseededDatabaseUser{
+								{
+									User:     "reporting",
+									Password: "reporting-password",
+									ReadOnly: true,
+								},
+							},
+						},
+					}
+					fakeSeeder.IsExistingUserReturns(false, nil)
+
+					mock.ExpectExec("FLUSH PRIVILEGES").
+						WithArgs().
+						WillReturnResult(sqlmock.NewResult(lastInsertId, rowsAffected))
+				})
+
+				It("creates an account for every user and host", func() {
+					Expect(helper.Seed(context.TODO())).To(Succeed())
+
+					Expect(fakeSeeder.CreateDBIfNeededCallCount()).To(Equal(1))
+					Expect(fakeSeeder.CreateUserCallCount()).To(Equal(3))
+					Expect(fakeSeeder.GrantUserPrivilegesCallCount()).To(Equal(3))
+
+					user, host := fakeSeeder.GrantUserPrivilegesArgsForCall(0)
+					Expect(user.User).To(Equal("app"))
+					Expect(host).To(Equal("10.0.16.%"))
+
+					user, host = fakeSeeder.GrantUserPrivilegesArgsForCall(1)
+					Expect(user.User).To(Equal("app"))
+					Expect(host).To(Equal("10.0.17.%"))
+
+					user, host = fakeSeeder.GrantUserPrivilegesArgsForCall(2)
+					Expect(user).To(Equal(config.PreseededDatabaseUser{
+						User:     "reporting",
+						Password: "reporting-password",
+						ReadOnly: true,
+					}))
+					Expect(host).To(Equal("%"))
+				})
+
+				It("creates the accounts of aliases and networks with their account hosts", func() {
+					dbConfig.PreseededDatabases[0].Hosts = []string{"loopback", "10.0.0.0/16", "127.0.0.1"}
+
+					Expect(helper.Seed(context.TODO())).To(Succeed())
+
+					Expect(fakeSeeder.CreateUserCallCount()).To(Equal(3))
+					_, host := fakeSeeder.CreateUserArgsForCall(0)
+					Expect(host).To(Equal("127.0.0.1"))
+					_, host = fakeSeeder.CreateUserArgsForCall(1)
+					Expect(host).To(Equal("10.0.0.0/255.255.0.0"))
+				})
+			})
+
 			Context("when a seeder function call returns an error", func() {
 				It("returns the error back", func() {
 					fakeSeeder.CreateDBIfNeededReturns(errors.New("Error"))
-					err := helper.Seed()
+					err := helper.Seed(context.TODO())
 					Expect(err).To(HaveOccurred())
 
 					fakeSeeder.IsExistingUserReturns(false, errors.New("Error"))
-					err = helper.Seed()
+					err = helper.Seed(context.TODO())
 					Expect(err).To(HaveOccurred())
 
 					fakeSeeder.CreateUserReturns(errors.New("Error"))
-					err = helper.Seed()
+					err = helper.Seed(context.TODO())
 					Expect(err).To(HaveOccurred())
 
 					fakeSeeder.GrantUserPrivilegesReturns(errors.New("Error"))
-					err = helper.Seed()
+					err = helper.Seed(context.TODO())
 					Expect(err).To(HaveOccurred())
 
 					fakeSeeder.UpdateUserReturns(errors.New("Error"))
-					err = helper.Seed()
+					err = helper.Seed(context.TODO())
 					Expect(err).To(HaveOccurred())
 				})
 			})
@@ -390,7 +848,7 @@ var _ = Describe("GaleraDBHelper", func() {
 			})
 
 			It("does not make any queries", func() {
-				err := helper.Seed()
+				err := helper.Seed(context.TODO())
 				Expect(err).NotTo(HaveOccurred())
 				Expect(testLogger.Buffer()).To(Say("No preseeded databases specified, skipping seeding."))
 				Expect(fakeSeeder.CreateDBIfNeededCallCount()).To(Equal(0))
@@ -402,41 +860,155 @@ var _ = Describe("GaleraDBHelper", func() {
 	})
 
 	Describe("SeedUsers", func() {
+		var serverVersion string
+
+		BeforeEach(func() {
+			serverVersion = "8.0.20-11"
+		})
+
+		JustBeforeEach(func() {
+			mock.ExpectQuery(`SELECT VERSION\(\)`).
+				WillReturnRows(sqlmock.NewRows([]string{"VERSION()"}).AddRow(serverVersion))
+		})
+
 		It("seeds the users", func() {
-			helper.SeedUsers()
+			helper.SeedUsers(context.TODO())
 			Expect(fakeUserSeeder.SeedUserCallCount()).To(Equal(2))
-			call0user, call0password, call0host, call0role := fakeUserSeeder.SeedUserArgsForCall(0)
-			Expect(call0user).To(Equal("user1"))
-			Expect(call0password).To(Equal("password1"))
+			call0user, call0host := fakeUserSeeder.SeedUserArgsForCall(0)
+			Expect(call0user).To(Equal(dbConfig.SeededUsers[0]))
 			Expect(call0host).To(Equal("host1"))
-			Expect(call0role).To(Equal("role1"))
-			call1user, call1password, call1host, call1role := fakeUserSeeder.SeedUserArgsForCall(1)
-			Expect(call1user).To(Equal("user2"))
-			Expect(call1password).To(Equal("password2"))
+			call1user, call1host := fakeUserSeeder.SeedUserArgsForCall(1)
+			Expect(call1user).To(Equal(dbConfig.SeededUsers[1]))
 			Expect(call1host).To(Equal("host2"))
-			Expect(call1role).To(Equal("role2"))
+		})
+
+		It("gives the seeder the built-in roles and the roles from config", func() {
+			dbConfig.Roles = []config.Role{{
+				Name:   "role1",
+				Grants: []config.RoleGrant{{Privileges: []string{"SELECT"}, On: "app.*"}},
+			}}
+
+			Expect(helper.SeedUsers(context.TODO())).To(Succeed())
+			Expect(userSeederRoles).To(HaveKey(config.RoleAdmin))
+			Expect(userSeederRoles).To(HaveKey(config.RoleBackup))
+			Expect(userSeederRoles).To(HaveKeyWithValue("role1", db_helper.Role{
+				Revoke: "REVOKE ALL PRIVILEGES, GRANT OPTION FROM %s",
+				Grants: []config.RoleGrant{{Privileges: []string{"SELECT"}, On: "app.*"}},
+			}))
+		})
+
+		It("grants BACKUP_ADMIN to the backup role on PXC 8.0", func() {
+			Expect(helper.SeedUsers(context.TODO())).To(Succeed())
+			Expect(userSeederRoles[config.RoleBackup].Grants[0].Privileges).To(ContainElement("BACKUP_ADMIN"))
+		})
+
+		Context("when the server runs PXC 5.7", func() {
+			BeforeEach(func() {
+				serverVersion = "5.7.28-31-57-log"
+			})
+
+			It("leaves BACKUP_ADMIN out of the backup role", func() {
+				Expect(helper.SeedUsers(context.TODO())).To(Succeed())
+				Expect(userSeederRoles[config.RoleBackup].Grants[0].Privileges).To(Equal([]string{"RELOAD", "LOCK TABLES", "PROCESS", "REPLICATION CLIENT"}))
+			})
+		})
+
+		It("seeds an account for each host of a user", func() {
+			dbConfig.SeededUsers = []config.SeededUser{
+				{User: "app", Password: "secret", Host: "loopback", Hosts: []string{"10.0.%", "127.0.0.1"}, Role: "read-only"},
+			}
+
+			Expect(helper.SeedUsers(context.TODO())).To(Succeed())
+			Expect(fakeUserSeeder.SeedUserCallCount()).To(Equal(2))
+			_, host0 := fakeUserSeeder.SeedUserArgsForCall(0)
+			Expect(host0).To(Equal("127.0.0.1"))
+			user1, host1 := fakeUserSeeder.SeedUserArgsForCall(1)
+			Expect(user1).To(Equal(dbConfig.SeededUsers[0]))
+			Expect(host1).To(Equal("10.0.%"))
+		})
+
+		It("does not seed a user with an invalid host", func() {
+			dbConfig.SeededUsers[1].Hosts = []string{"10.0.0.1/24"}
+
+			Expect(helper.SeedUsers(context.TODO())).To(MatchError(`Invalid host "10.0.0.1/24": the address must be the first of its network`))
+			Expect(fakeUserSeeder.SeedUserCallCount()).To(Equal(1))
 		})
 
 		Context("when a seeder function call returns an error", func() {
 			It("returns the error back", func() {
 				fakeUserSeeder.SeedUserReturns(errors.New("Error"))
-				err := helper.SeedUsers()
+				err := helper.SeedUsers(context.TODO())
 				Expect(err).To(HaveOccurred())
 			})
 		})
 	})
 
+	Describe("ReconcileAccounts", func() {
+		BeforeEach(func() {
+			dbConfig.PreseededDatabases[0].Hosts = []string{"10.0.16.%", "10.0.17.%"}
+			dbConfig.PreseededDatabases[1].Users = []config.PreseededDatabaseUser{{User: "reporting"}}
+			dbConfig.SeededUsers = []config.SeededUser{
+				{User: "admin", Host: "loopback", Role: "admin"},
+				{User: "user1", Host: "any", Role: "minimal"},
+			}
+		})
+
+		It("reconciles every seeded account once and flushes privileges", func() {
+			mock.ExpectExec("FLUSH PRIVILEGES").WillReturnResult(sqlmock.NewResult(lastInsertId, rowsAffected))
+
+			Expect(helper.ReconcileAccounts(context.TODO())).To(Succeed())
+
+			Expect(fakeReconciler.ReconcileCallCount()).To(Equal(1))
+			Expect(fakeReconciler.ReconcileArgsForCall(0)).To(Equal([]db_helper.Account{
+				{User: "user1", Host: "10.0.16.%"},
+				{User: "user1", Host: "10.0.17.%"},
+				{User: "user2", Host: "%"},
+				{User: "reporting", Host: "%"},
+				{User: "admin", Host: "127.0.0.1"},
+				{User: "user1", Host: "%"},
+			}))
+		})
+
+		It("returns an error when reconciling fails", func() {
+			fakeReconciler.ReconcileReturns(errors.New("some error"))
+
+			Expect(helper.ReconcileAccounts(context.TODO())).To(MatchError("some error"))
+		})
+
+		It("reconciles each host of a seeded user as an account", func() {
+			dbConfig.PreseededDatabases = nil
+			dbConfig.SeededUsers = []config.SeededUser{
+				{User: "app", Host: "10.0.%", Hosts: []string{"10.1.0.0/16", "proxy.internal", "10.0.%"}, Role: "read-only"},
+			}
+			mock.ExpectExec("FLUSH PRIVILEGES").WillReturnResult(sqlmock.NewResult(lastInsertId, rowsAffected))
+
+			Expect(helper.ReconcileAccounts(context.TODO())).To(Succeed())
+			Expect(fakeReconciler.ReconcileArgsForCall(0)).To(Equal([]db_helper.Account{
+				{User: "app", Host: "10.0.%"},
+				{User: "app", Host: "10.1.0.0/255.255.0.0"},
+				{User: "app", Host: "proxy.internal"},
+			}))
+		})
+
+		It("returns an error when a seeded user has an invalid host", func() {
+			dbConfig.SeededUsers[0].Host = "bad host"
+
+			Expect(helper.ReconcileAccounts(context.TODO())).To(MatchError(`Invalid host "bad host": may only contain letters, digits and . : - % _`))
+			Expect(fakeReconciler.ReconcileCallCount()).To(Equal(0))
+		})
+	})
+
 	Describe("RunPostStartSQL", func() {
 		It("runs the contents of the specified files", func() {
 			mock.ExpectExec(fakeSupplementalQuery1).WillReturnResult(sqlmock.NewResult(lastInsertId, rowsAffected))
 			mock.ExpectExec(fakeSupplementalQuery2).WillReturnResult(sqlmock.NewResult(lastInsertId, rowsAffected))
 
-			err := helper.RunPostStartSQL()
+			err := helper.RunPostStartSQL(context.TODO())
 			Expect(err).NotTo(HaveOccurred())
 		})
 
 		It("returns an error when the database failes to execute a query", func() {
-			err := helper.RunPostStartSQL()
+			err := helper.RunPostStartSQL(context.TODO())
 			Expect(err).To(HaveOccurred())
 		})
 	})
@@ -451,7 +1023,7 @@ var _ = Describe("GaleraDBHelper", func() {
 					User:       "some-user",
 				}
 				format.TruncatedDiff = false
-				Expect(db_helper.FormatDSN(config)).To(Equal(`some-user:some-password@unix(/some/socket/path.sock)/?sql_log_bin=off`))
+				Expect(db_helper.FormatDSN(config)).To(Equal(`some-user:some-password@unix(/some/socket/path.sock)/?interpolateParams=true&sql_log_bin=off`))
 			})
 		})
 
@@ -463,7 +1035,7 @@ var _ = Describe("GaleraDBHelper", func() {
 					User:     "some-user",
 				}
 				format.TruncatedDiff = false
-				Expect(db_helper.FormatDSN(config)).To(Equal(`some-user:some-password@unix(/some/socket/path.sock)/`))
+				Expect(db_helper.FormatDSN(config)).To(Equal(`some-user:some-password@unix(/some/socket/path.sock)/?interpolateParams=true`))
 			})
 		})
 	})
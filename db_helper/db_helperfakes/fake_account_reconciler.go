@@ -0,0 +1,115 @@
+// Code generated by counterfeiter. DO NOT EDIT.
+package db_helperfakes
+
+import (
+	"sync"
+
+	"github.com/cloudfoundry/galera-init/db_helper"
+)
+
+type FakeAccountReconciler struct {
+	ReconcileStub        func([]db_helper.Account) error
+	reconcileMutex       sync.RWMutex
+	reconcileArgsForCall []struct {
+		arg1 []db_helper.Account
+	}
+	reconcileReturns struct {
+		result1 error
+	}
+	reconcileReturnsOnCall map[int]struct {
+		result1 error
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *FakeAccountReconciler) Reconcile(arg1 []db_helper.Account) error {
+	var arg1Copy []db_helper.Account
+	if arg1 != nil {
+		arg1Copy = make([]db_helper.Account, len(arg1))
+		copy(arg1Copy, arg1)
+	}
+	fake.reconcileMutex.Lock()
+	ret, specificReturn := fake.reconcileReturnsOnCall[len(fake.reconcileArgsForCall)]
+	fake.reconcileArgsForCall = append(fake.reconcileArgsForCall, struct {
+		arg1 []db_helper.Account
+	}{arg1Copy})
+	fake.recordInvocation("Reconcile", []interface{}{arg1Copy})
+	fake.reconcileMutex.Unlock()
+	if fake.ReconcileStub != nil {
+		return fake.ReconcileStub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	fakeReturns := fake.reconcileReturns
+	return fakeReturns.result1
+}
+
+func (fake *FakeAccountReconciler) ReconcileCallCount() int {
+	fake.reconcileMutex.RLock()
+	defer fake.reconcileMutex.RUnlock()
+	return len(fake.reconcileArgsForCall)
+}
+
+func (fake *FakeAccountReconciler) ReconcileCalls(stub func([]db_helper.Account) error) {
+	fake.reconcileMutex.Lock()
+	defer fake.reconcileMutex.Unlock()
+	fake.ReconcileStub = stub
+}
+
+func (fake *FakeAccountReconciler) ReconcileArgsForCall(i int) []db_helper.Account {
+	fake.reconcileMutex.RLock()
+	defer fake.reconcileMutex.RUnlock()
+	argsForCall := fake.reconcileArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeAccountReconciler) ReconcileReturns(result1 error) {
+	fake.reconcileMutex.Lock()
+	defer fake.reconcileMutex.Unlock()
+	fake.ReconcileStub = nil
+	fake.reconcileReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeAccountReconciler) ReconcileReturnsOnCall(i int, result1 error) {
+	fake.reconcileMutex.Lock()
+	defer fake.reconcileMutex.Unlock()
+	fake.ReconcileStub = nil
+	if fake.reconcileReturnsOnCall == nil {
+		fake.reconcileReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.reconcileReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeAccountReconciler) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.reconcileMutex.RLock()
+	defer fake.reconcileMutex.RUnlock()
+	copiedInvocations := map[string][][]interface{}{}
+	for key, value := range fake.invocations {
+		copiedInvocations[key] = value
+	}
+	return copiedInvocations
+}
+
+func (fake *FakeAccountReconciler) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ db_helper.AccountReconciler = new(FakeAccountReconciler)
@@ -2,6 +2,7 @@
 package db_helperfakes
 
 import (
+	"context"
 	"os/exec"
 	"sync"
 
@@ -9,9 +10,23 @@ import (
 )
 
 type FakeDBHelper struct {
-	IsDatabaseReachableStub        func() bool
+	GaleraStateStub        func(context.Context) (string, error)
+	galeraStateMutex       sync.RWMutex
+	galeraStateArgsForCall []struct {
+		arg1 context.Context
+	}
+	galeraStateReturns struct {
+		result1 string
+		result2 error
+	}
+	galeraStateReturnsOnCall map[int]struct {
+		result1 string
+		result2 error
+	}
+	IsDatabaseReachableStub        func(context.Context) bool
 	isDatabaseReachableMutex       sync.RWMutex
 	isDatabaseReachableArgsForCall []struct {
+		arg1 context.Context
 	}
 	isDatabaseReachableReturns struct {
 		result1 bool
@@ -29,9 +44,54 @@ type FakeDBHelper struct {
 	isProcessRunningReturnsOnCall map[int]struct {
 		result1 bool
 	}
-	RunPostStartSQLStub        func() error
+	IsReceivingStateTransferStub        func() bool
+	isReceivingStateTransferMutex       sync.RWMutex
+	isReceivingStateTransferArgsForCall []struct {
+	}
+	isReceivingStateTransferReturns struct {
+		result1 bool
+	}
+	isReceivingStateTransferReturnsOnCall map[int]struct {
+		result1 bool
+	}
+	ReconcileAccountsStub        func(context.Context) error
+	reconcileAccountsMutex       sync.RWMutex
+	reconcileAccountsArgsForCall []struct {
+		arg1 context.Context
+	}
+	reconcileAccountsReturns struct {
+		result1 error
+	}
+	reconcileAccountsReturnsOnCall map[int]struct {
+		result1 error
+	}
+	RecoverPositionStub        func(context.Context) (string, error)
+	recoverPositionMutex       sync.RWMutex
+	recoverPositionArgsForCall []struct {
+		arg1 context.Context
+	}
+	recoverPositionReturns struct {
+		result1 string
+		result2 error
+	}
+	recoverPositionReturnsOnCall map[int]struct {
+		result1 string
+		result2 error
+	}
+	ReloadPasswordsStub        func() error
+	reloadPasswordsMutex       sync.RWMutex
+	reloadPasswordsArgsForCall []struct {
+	}
+	reloadPasswordsReturns struct {
+		result1 error
+	}
+	reloadPasswordsReturnsOnCall map[int]struct {
+		result1 error
+	}
+	RunPostStartSQLStub        func(context.Context) error
 	runPostStartSQLMutex       sync.RWMutex
 	runPostStartSQLArgsForCall []struct {
+		arg1 context.Context
 	}
 	runPostStartSQLReturns struct {
 		result1 error
@@ -39,9 +99,10 @@ type FakeDBHelper struct {
 	runPostStartSQLReturnsOnCall map[int]struct {
 		result1 error
 	}
-	SeedStub        func() error
+	SeedStub        func(context.Context) error
 	seedMutex       sync.RWMutex
 	seedArgsForCall []struct {
+		arg1 context.Context
 	}
 	seedReturns struct {
 		result1 error
@@ -49,9 +110,10 @@ type FakeDBHelper struct {
 	seedReturnsOnCall map[int]struct {
 		result1 error
 	}
-	SeedUsersStub        func() error
+	SeedUsersStub        func(context.Context) error
 	seedUsersMutex       sync.RWMutex
 	seedUsersArgsForCall []struct {
+		arg1 context.Context
 	}
 	seedUsersReturns struct {
 		result1 error
@@ -59,6 +121,21 @@ type FakeDBHelper struct {
 	seedUsersReturnsOnCall map[int]struct {
 		result1 error
 	}
+	StartMysqldForServerUpgradeStub        func(string) (*exec.Cmd, string, error)
+	startMysqldForServerUpgradeMutex       sync.RWMutex
+	startMysqldForServerUpgradeArgsForCall []struct {
+		arg1 string
+	}
+	startMysqldForServerUpgradeReturns struct {
+		result1 *exec.Cmd
+		result2 string
+		result3 error
+	}
+	startMysqldForServerUpgradeReturnsOnCall map[int]struct {
+		result1 *exec.Cmd
+		result2 string
+		result3 error
+	}
 	StartMysqldForUpgradeStub        func() (*exec.Cmd, error)
 	startMysqldForUpgradeMutex       sync.RWMutex
 	startMysqldForUpgradeArgsForCall []struct {
@@ -99,9 +176,22 @@ type FakeDBHelper struct {
 	stopMysqldMutex       sync.RWMutex
 	stopMysqldArgsForCall []struct {
 	}
-	UpgradeStub        func() (string, error)
+	StopMysqldContextStub        func(context.Context) error
+	stopMysqldContextMutex       sync.RWMutex
+	stopMysqldContextArgsForCall []struct {
+		arg1 context.Context
+	}
+	stopMysqldContextReturns struct {
+		result1 error
+	}
+	stopMysqldContextReturnsOnCall map[int]struct {
+		result1 error
+	}
+	UpgradeStub        func(context.Context, bool) (string, error)
 	upgradeMutex       sync.RWMutex
 	upgradeArgsForCall []struct {
+		arg1 context.Context
+		arg2 bool
 	}
 	upgradeReturns struct {
 		result1 string
@@ -115,15 +205,79 @@ type FakeDBHelper struct {
 	invocationsMutex sync.RWMutex
 }
 
-func (fake *FakeDBHelper) IsDatabaseReachable() bool {
+func (fake *FakeDBHelper) GaleraState(arg1 context.Context) (string, error) {
+	fake.galeraStateMutex.Lock()
+	ret, specificReturn := fake.galeraStateReturnsOnCall[len(fake.galeraStateArgsForCall)]
+	fake.galeraStateArgsForCall = append(fake.galeraStateArgsForCall, struct {
+		arg1 context.Context
+	}{arg1})
+	fake.recordInvocation("GaleraState", []interface{}{arg1})
+	fake.galeraStateMutex.Unlock()
+	if fake.GaleraStateStub != nil {
+		return fake.GaleraStateStub(arg1)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	fakeReturns := fake.galeraStateReturns
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeDBHelper) GaleraStateCallCount() int {
+	fake.galeraStateMutex.RLock()
+	defer fake.galeraStateMutex.RUnlock()
+	return len(fake.galeraStateArgsForCall)
+}
+
+func (fake *FakeDBHelper) GaleraStateCalls(stub func(context.Context) (string, error)) {
+	fake.galeraStateMutex.Lock()
+	defer fake.galeraStateMutex.Unlock()
+	fake.GaleraStateStub = stub
+}
+
+func (fake *FakeDBHelper) GaleraStateArgsForCall(i int) context.Context {
+	fake.galeraStateMutex.RLock()
+	defer fake.galeraStateMutex.RUnlock()
+	argsForCall := fake.galeraStateArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeDBHelper) GaleraStateReturns(result1 string, result2 error) {
+	fake.galeraStateMutex.Lock()
+	defer fake.galeraStateMutex.Unlock()
+	fake.GaleraStateStub = nil
+	fake.galeraStateReturns = struct {
+		result1 string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeDBHelper) GaleraStateReturnsOnCall(i int, result1 string, result2 error) {
+	fake.galeraStateMutex.Lock()
+	defer fake.galeraStateMutex.Unlock()
+	fake.GaleraStateStub = nil
+	if fake.galeraStateReturnsOnCall == nil {
+		fake.galeraStateReturnsOnCall = make(map[int]struct {
+			result1 string
+			result2 error
+		})
+	}
+	fake.galeraStateReturnsOnCall[i] = struct {
+		result1 string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeDBHelper) IsDatabaseReachable(arg1 context.Context) bool {
 	fake.isDatabaseReachableMutex.Lock()
 	ret, specificReturn := fake.isDatabaseReachableReturnsOnCall[len(fake.isDatabaseReachableArgsForCall)]
 	fake.isDatabaseReachableArgsForCall = append(fake.isDatabaseReachableArgsForCall, struct {
-	}{})
-	fake.recordInvocation("IsDatabaseReachable", []interface{}{})
+		arg1 context.Context
+	}{arg1})
+	fake.recordInvocation("IsDatabaseReachable", []interface{}{arg1})
 	fake.isDatabaseReachableMutex.Unlock()
 	if fake.IsDatabaseReachableStub != nil {
-		return fake.IsDatabaseReachableStub()
+		return fake.IsDatabaseReachableStub(arg1)
 	}
 	if specificReturn {
 		return ret.result1
@@ -138,12 +292,19 @@ func (fake *FakeDBHelper) IsDatabaseReachableCallCount() int {
 	return len(fake.isDatabaseReachableArgsForCall)
 }
 
-func (fake *FakeDBHelper) IsDatabaseReachableCalls(stub func() bool) {
+func (fake *FakeDBHelper) IsDatabaseReachableCalls(stub func(context.Context) bool) {
 	fake.isDatabaseReachableMutex.Lock()
 	defer fake.isDatabaseReachableMutex.Unlock()
 	fake.IsDatabaseReachableStub = stub
 }
 
+func (fake *FakeDBHelper) IsDatabaseReachableArgsForCall(i int) context.Context {
+	fake.isDatabaseReachableMutex.RLock()
+	defer fake.isDatabaseReachableMutex.RUnlock()
+	argsForCall := fake.isDatabaseReachableArgsForCall[i]
+	return argsForCall.arg1
+}
+
 func (fake *FakeDBHelper) IsDatabaseReachableReturns(result1 bool) {
 	fake.isDatabaseReachableMutex.Lock()
 	defer fake.isDatabaseReachableMutex.Unlock()
@@ -219,15 +380,243 @@ func (fake *FakeDBHelper) IsProcessRunningReturnsOnCall(i int, result1 bool) {
 	}{result1}
 }
 
-func (fake *FakeDBHelper) RunPostStartSQL() error {
+func (fake *FakeDBHelper) IsReceivingStateTransfer() bool {
+	fake.isReceivingStateTransferMutex.Lock()
+	ret, specificReturn := fake.isReceivingStateTransferReturnsOnCall[len(fake.isReceivingStateTransferArgsForCall)]
+	fake.isReceivingStateTransferArgsForCall = append(fake.isReceivingStateTransferArgsForCall, struct {
+	}{})
+	fake.recordInvocation("IsReceivingStateTransfer", []interface{}{})
+	fake.isReceivingStateTransferMutex.Unlock()
+	if fake.IsReceivingStateTransferStub != nil {
+		return fake.IsReceivingStateTransferStub()
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	fakeReturns := fake.isReceivingStateTransferReturns
+	return fakeReturns.result1
+}
+
+func (fake *FakeDBHelper) IsReceivingStateTransferCallCount() int {
+	fake.isReceivingStateTransferMutex.RLock()
+	defer fake.isReceivingStateTransferMutex.RUnlock()
+	return len(fake.isReceivingStateTransferArgsForCall)
+}
+
+func (fake *FakeDBHelper) IsReceivingStateTransferCalls(stub func() bool) {
+	fake.isReceivingStateTransferMutex.Lock()
+	defer fake.isReceivingStateTransferMutex.Unlock()
+	fake.IsReceivingStateTransferStub = stub
+}
+
+func (fake *FakeDBHelper) IsReceivingStateTransferReturns(result1 bool) {
+	fake.isReceivingStateTransferMutex.Lock()
+	defer fake.isReceivingStateTransferMutex.Unlock()
+	fake.IsReceivingStateTransferStub = nil
+	fake.isReceivingStateTransferReturns = struct {
+		result1 bool
+	}{result1}
+}
+
+func (fake *FakeDBHelper) IsReceivingStateTransferReturnsOnCall(i int, result1 bool) {
+	fake.isReceivingStateTransferMutex.Lock()
+	defer fake.isReceivingStateTransferMutex.Unlock()
+	fake.IsReceivingStateTransferStub = nil
+	if fake.isReceivingStateTransferReturnsOnCall == nil {
+		fake.isReceivingStateTransferReturnsOnCall = make(map[int]struct {
+			result1 bool
+		})
+	}
+	fake.isReceivingStateTransferReturnsOnCall[i] = struct {
+		result1 bool
+	}{result1}
+}
+
+func (fake *FakeDBHelper) ReconcileAccounts(arg1 context.Context) error {
+	fake.reconcileAccountsMutex.Lock()
+	ret, specificReturn := fake.reconcileAccountsReturnsOnCall[len(fake.reconcileAccountsArgsForCall)]
+	fake.reconcileAccountsArgsForCall = append(fake.reconcileAccountsArgsForCall, struct {
+		arg1 context.Context
+	}{arg1})
+	fake.recordInvocation("ReconcileAccounts", []interface{}{arg1})
+	fake.reconcileAccountsMutex.Unlock()
+	if fake.ReconcileAccountsStub != nil {
+		return fake.ReconcileAccountsStub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	fakeReturns := fake.reconcileAccountsReturns
+	return fakeReturns.result1
+}
+
+func (fake *FakeDBHelper) ReconcileAccountsCallCount() int {
+	fake.reconcileAccountsMutex.RLock()
+	defer fake.reconcileAccountsMutex.RUnlock()
+	return len(fake.reconcileAccountsArgsForCall)
+}
+
+func (fake *FakeDBHelper) ReconcileAccountsCalls(stub func(context.Context) error) {
+	fake.reconcileAccountsMutex.Lock()
+	defer fake.reconcileAccountsMutex.Unlock()
+	fake.ReconcileAccountsStub = stub
+}
+
+func (fake *FakeDBHelper) ReconcileAccountsArgsForCall(i int) context.Context {
+	fake.reconcileAccountsMutex.RLock()
+	defer fake.reconcileAccountsMutex.RUnlock()
+	argsForCall := fake.reconcileAccountsArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeDBHelper) ReconcileAccountsReturns(result1 error) {
+	fake.reconcileAccountsMutex.Lock()
+	defer fake.reconcileAccountsMutex.Unlock()
+	fake.ReconcileAccountsStub = nil
+	fake.reconcileAccountsReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeDBHelper) ReconcileAccountsReturnsOnCall(i int, result1 error) {
+	fake.reconcileAccountsMutex.Lock()
+	defer fake.reconcileAccountsMutex.Unlock()
+	fake.ReconcileAccountsStub = nil
+	if fake.reconcileAccountsReturnsOnCall == nil {
+		fake.reconcileAccountsReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.reconcileAccountsReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeDBHelper) RecoverPosition(arg1 context.Context) (string, error) {
+	fake.recoverPositionMutex.Lock()
+	ret, specificReturn := fake.recoverPositionReturnsOnCall[len(fake.recoverPositionArgsForCall)]
+	fake.recoverPositionArgsForCall = append(fake.recoverPositionArgsForCall, struct {
+		arg1 context.Context
+	}{arg1})
+	fake.recordInvocation("RecoverPosition", []interface{}{arg1})
+	fake.recoverPositionMutex.Unlock()
+	if fake.RecoverPositionStub != nil {
+		return fake.RecoverPositionStub(arg1)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	fakeReturns := fake.recoverPositionReturns
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeDBHelper) RecoverPositionCallCount() int {
+	fake.recoverPositionMutex.RLock()
+	defer fake.recoverPositionMutex.RUnlock()
+	return len(fake.recoverPositionArgsForCall)
+}
+
+func (fake *FakeDBHelper) RecoverPositionCalls(stub func(context.Context) (string, error)) {
+	fake.recoverPositionMutex.Lock()
+	defer fake.recoverPositionMutex.Unlock()
+	fake.RecoverPositionStub = stub
+}
+
+func (fake *FakeDBHelper) RecoverPositionArgsForCall(i int) context.Context {
+	fake.recoverPositionMutex.RLock()
+	defer fake.recoverPositionMutex.RUnlock()
+	argsForCall := fake.recoverPositionArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeDBHelper) RecoverPositionReturns(result1 string, result2 error) {
+	fake.recoverPositionMutex.Lock()
+	defer fake.recoverPositionMutex.Unlock()
+	fake.RecoverPositionStub = nil
+	fake.recoverPositionReturns = struct {
+		result1 string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeDBHelper) RecoverPositionReturnsOnCall(i int, result1 string, result2 error) {
+	fake.recoverPositionMutex.Lock()
+	defer fake.recoverPositionMutex.Unlock()
+	fake.RecoverPositionStub = nil
+	if fake.recoverPositionReturnsOnCall == nil {
+		fake.recoverPositionReturnsOnCall = make(map[int]struct {
+			result1 string
+			result2 error
+		})
+	}
+	fake.recoverPositionReturnsOnCall[i] = struct {
+		result1 string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeDBHelper) ReloadPasswords() error {
+	fake.reloadPasswordsMutex.Lock()
+	ret, specificReturn := fake.reloadPasswordsReturnsOnCall[len(fake.reloadPasswordsArgsForCall)]
+	fake.reloadPasswordsArgsForCall = append(fake.reloadPasswordsArgsForCall, struct {
+	}{})
+	fake.recordInvocation("ReloadPasswords", []interface{}{})
+	fake.reloadPasswordsMutex.Unlock()
+	if fake.ReloadPasswordsStub != nil {
+		return fake.ReloadPasswordsStub()
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	fakeReturns := fake.reloadPasswordsReturns
+	return fakeReturns.result1
+}
+
+func (fake *FakeDBHelper) ReloadPasswordsCallCount() int {
+	fake.reloadPasswordsMutex.RLock()
+	defer fake.reloadPasswordsMutex.RUnlock()
+	return len(fake.reloadPasswordsArgsForCall)
+}
+
+func (fake *FakeDBHelper) ReloadPasswordsCalls(stub func() error) {
+	fake.reloadPasswordsMutex.Lock()
+	defer fake.reloadPasswordsMutex.Unlock()
+	fake.ReloadPasswordsStub = stub
+}
+
+func (fake *FakeDBHelper) ReloadPasswordsReturns(result1 error) {
+	fake.reloadPasswordsMutex.Lock()
+	defer fake.reloadPasswordsMutex.Unlock()
+	fake.ReloadPasswordsStub = nil
+	fake.reloadPasswordsReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeDBHelper) ReloadPasswordsReturnsOnCall(i int, result1 error) {
+	fake.reloadPasswordsMutex.Lock()
+	defer fake.reloadPasswordsMutex.Unlock()
+	fake.ReloadPasswordsStub = nil
+	if fake.reloadPasswordsReturnsOnCall == nil {
+		fake.reloadPasswordsReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.reloadPasswordsReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeDBHelper) RunPostStartSQL(arg1 context.Context) error {
 	fake.runPostStartSQLMutex.Lock()
 	ret, specificReturn := fake.runPostStartSQLReturnsOnCall[len(fake.runPostStartSQLArgsForCall)]
 	fake.runPostStartSQLArgsForCall = append(fake.runPostStartSQLArgsForCall, struct {
-	}{})
-	fake.recordInvocation("RunPostStartSQL", []interface{}{})
+		arg1 context.Context
+	}{arg1})
+	fake.recordInvocation("RunPostStartSQL", []interface{}{arg1})
 	fake.runPostStartSQLMutex.Unlock()
 	if fake.RunPostStartSQLStub != nil {
-		return fake.RunPostStartSQLStub()
+		return fake.RunPostStartSQLStub(arg1)
 	}
 	if specificReturn {
 		return ret.result1
@@ -242,12 +631,19 @@ func (fake *FakeDBHelper) RunPostStartSQLCallCount() int {
 	return len(fake.runPostStartSQLArgsForCall)
 }
 
-func (fake *FakeDBHelper) RunPostStartSQLCalls(stub func() error) {
+func (fake *FakeDBHelper) RunPostStartSQLCalls(stub func(context.Context) error) {
 	fake.runPostStartSQLMutex.Lock()
 	defer fake.runPostStartSQLMutex.Unlock()
 	fake.RunPostStartSQLStub = stub
 }
 
+func (fake *FakeDBHelper) RunPostStartSQLArgsForCall(i int) context.Context {
+	fake.runPostStartSQLMutex.RLock()
+	defer fake.runPostStartSQLMutex.RUnlock()
+	argsForCall := fake.runPostStartSQLArgsForCall[i]
+	return argsForCall.arg1
+}
+
 func (fake *FakeDBHelper) RunPostStartSQLReturns(result1 error) {
 	fake.runPostStartSQLMutex.Lock()
 	defer fake.runPostStartSQLMutex.Unlock()
@@ -271,15 +667,16 @@ func (fake *FakeDBHelper) RunPostStartSQLReturnsOnCall(i int, result1 error) {
 	}{result1}
 }
 
-func (fake *FakeDBHelper) Seed() error {
+func (fake *FakeDBHelper) Seed(arg1 context.Context) error {
 	fake.seedMutex.Lock()
 	ret, specificReturn := fake.seedReturnsOnCall[len(fake.seedArgsForCall)]
 	fake.seedArgsForCall = append(fake.seedArgsForCall, struct {
-	}{})
-	fake.recordInvocation("Seed", []interface{}{})
+		arg1 context.Context
+	}{arg1})
+	fake.recordInvocation("Seed", []interface{}{arg1})
 	fake.seedMutex.Unlock()
 	if fake.SeedStub != nil {
-		return fake.SeedStub()
+		return fake.SeedStub(arg1)
 	}
 	if specificReturn {
 		return ret.result1
@@ -294,12 +691,19 @@ func (fake *FakeDBHelper) SeedCallCount() int {
 	return len(fake.seedArgsForCall)
 }
 
-func (fake *FakeDBHelper) SeedCalls(stub func() error) {
+func (fake *FakeDBHelper) SeedCalls(stub func(context.Context) error) {
 	fake.seedMutex.Lock()
 	defer fake.seedMutex.Unlock()
 	fake.SeedStub = stub
 }
 
+func (fake *FakeDBHelper) SeedArgsForCall(i int) context.Context {
+	fake.seedMutex.RLock()
+	defer fake.seedMutex.RUnlock()
+	argsForCall := fake.seedArgsForCall[i]
+	return argsForCall.arg1
+}
+
 func (fake *FakeDBHelper) SeedReturns(result1 error) {
 	fake.seedMutex.Lock()
 	defer fake.seedMutex.Unlock()
@@ -323,15 +727,16 @@ func (fake *FakeDBHelper) SeedReturnsOnCall(i int, result1 error) {
 	}{result1}
 }
 
-func (fake *FakeDBHelper) SeedUsers() error {
+func (fake *FakeDBHelper) SeedUsers(arg1 context.Context) error {
 	fake.seedUsersMutex.Lock()
 	ret, specificReturn := fake.seedUsersReturnsOnCall[len(fake.seedUsersArgsForCall)]
 	fake.seedUsersArgsForCall = append(fake.seedUsersArgsForCall, struct {
-	}{})
-	fake.recordInvocation("SeedUsers", []interface{}{})
+		arg1 context.Context
+	}{arg1})
+	fake.recordInvocation("SeedUsers", []interface{}{arg1})
 	fake.seedUsersMutex.Unlock()
 	if fake.SeedUsersStub != nil {
-		return fake.SeedUsersStub()
+		return fake.SeedUsersStub(arg1)
 	}
 	if specificReturn {
 		return ret.result1
@@ -346,12 +751,19 @@ func (fake *FakeDBHelper) SeedUsersCallCount() int {
 	return len(fake.seedUsersArgsForCall)
 }
 
-func (fake *FakeDBHelper) SeedUsersCalls(stub func() error) {
+func (fake *FakeDBHelper) SeedUsersCalls(stub func(context.Context) error) {
 	fake.seedUsersMutex.Lock()
 	defer fake.seedUsersMutex.Unlock()
 	fake.SeedUsersStub = stub
 }
 
+func (fake *FakeDBHelper) SeedUsersArgsForCall(i int) context.Context {
+	fake.seedUsersMutex.RLock()
+	defer fake.seedUsersMutex.RUnlock()
+	argsForCall := fake.seedUsersArgsForCall[i]
+	return argsForCall.arg1
+}
+
 func (fake *FakeDBHelper) SeedUsersReturns(result1 error) {
 	fake.seedUsersMutex.Lock()
 	defer fake.seedUsersMutex.Unlock()
@@ -375,6 +787,72 @@ func (fake *FakeDBHelper) SeedUsersReturnsOnCall(i int, result1 error) {
 	}{result1}
 }
 
+func (fake *FakeDBHelper) StartMysqldForServerUpgrade(arg1 string) (*exec.Cmd, string, error) {
+	fake.startMysqldForServerUpgradeMutex.Lock()
+	ret, specificReturn := fake.startMysqldForServerUpgradeReturnsOnCall[len(fake.startMysqldForServerUpgradeArgsForCall)]
+	fake.startMysqldForServerUpgradeArgsForCall = append(fake.startMysqldForServerUpgradeArgsForCall, struct {
+		arg1 string
+	}{arg1})
+	fake.recordInvocation("StartMysqldForServerUpgrade", []interface{}{arg1})
+	fake.startMysqldForServerUpgradeMutex.Unlock()
+	if fake.StartMysqldForServerUpgradeStub != nil {
+		return fake.StartMysqldForServerUpgradeStub(arg1)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2, ret.result3
+	}
+	fakeReturns := fake.startMysqldForServerUpgradeReturns
+	return fakeReturns.result1, fakeReturns.result2, fakeReturns.result3
+}
+
+func (fake *FakeDBHelper) StartMysqldForServerUpgradeCallCount() int {
+	fake.startMysqldForServerUpgradeMutex.RLock()
+	defer fake.startMysqldForServerUpgradeMutex.RUnlock()
+	return len(fake.startMysqldForServerUpgradeArgsForCall)
+}
+
+func (fake *FakeDBHelper) StartMysqldForServerUpgradeCalls(stub func(string) (*exec.Cmd, string, error)) {
+	fake.startMysqldForServerUpgradeMutex.Lock()
+	defer fake.startMysqldForServerUpgradeMutex.Unlock()
+	fake.StartMysqldForServerUpgradeStub = stub
+}
+
+func (fake *FakeDBHelper) StartMysqldForServerUpgradeArgsForCall(i int) string {
+	fake.startMysqldForServerUpgradeMutex.RLock()
+	defer fake.startMysqldForServerUpgradeMutex.RUnlock()
+	argsForCall := fake.startMysqldForServerUpgradeArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeDBHelper) StartMysqldForServerUpgradeReturns(result1 *exec.Cmd, result2 string, result3 error) {
+	fake.startMysqldForServerUpgradeMutex.Lock()
+	defer fake.startMysqldForServerUpgradeMutex.Unlock()
+	fake.StartMysqldForServerUpgradeStub = nil
+	fake.startMysqldForServerUpgradeReturns = struct {
+		result1 *exec.Cmd
+		result2 string
+		result3 error
+	}{result1, result2, result3}
+}
+
+func (fake *FakeDBHelper) StartMysqldForServerUpgradeReturnsOnCall(i int, result1 *exec.Cmd, result2 string, result3 error) {
+	fake.startMysqldForServerUpgradeMutex.Lock()
+	defer fake.startMysqldForServerUpgradeMutex.Unlock()
+	fake.StartMysqldForServerUpgradeStub = nil
+	if fake.startMysqldForServerUpgradeReturnsOnCall == nil {
+		fake.startMysqldForServerUpgradeReturnsOnCall = make(map[int]struct {
+			result1 *exec.Cmd
+			result2 string
+			result3 error
+		})
+	}
+	fake.startMysqldForServerUpgradeReturnsOnCall[i] = struct {
+		result1 *exec.Cmd
+		result2 string
+		result3 error
+	}{result1, result2, result3}
+}
+
 func (fake *FakeDBHelper) StartMysqldForUpgrade() (*exec.Cmd, error) {
 	fake.startMysqldForUpgradeMutex.Lock()
 	ret, specificReturn := fake.startMysqldForUpgradeReturnsOnCall[len(fake.startMysqldForUpgradeArgsForCall)]
@@ -563,15 +1041,77 @@ func (fake *FakeDBHelper) StopMysqldCalls(stub func()) {
 	fake.StopMysqldStub = stub
 }
 
-func (fake *FakeDBHelper) Upgrade() (string, error) {
+func (fake *FakeDBHelper) StopMysqldContext(arg1 context.Context) error {
+	fake.stopMysqldContextMutex.Lock()
+	ret, specificReturn := fake.stopMysqldContextReturnsOnCall[len(fake.stopMysqldContextArgsForCall)]
+	fake.stopMysqldContextArgsForCall = append(fake.stopMysqldContextArgsForCall, struct {
+		arg1 context.Context
+	}{arg1})
+	fake.recordInvocation("StopMysqldContext", []interface{}{arg1})
+	fake.stopMysqldContextMutex.Unlock()
+	if fake.StopMysqldContextStub != nil {
+		return fake.StopMysqldContextStub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	fakeReturns := fake.stopMysqldContextReturns
+	return fakeReturns.result1
+}
+
+func (fake *FakeDBHelper) StopMysqldContextCallCount() int {
+	fake.stopMysqldContextMutex.RLock()
+	defer fake.stopMysqldContextMutex.RUnlock()
+	return len(fake.stopMysqldContextArgsForCall)
+}
+
+func (fake *FakeDBHelper) StopMysqldContextCalls(stub func(context.Context) error) {
+	fake.stopMysqldContextMutex.Lock()
+	defer fake.stopMysqldContextMutex.Unlock()
+	fake.StopMysqldContextStub = stub
+}
+
+func (fake *FakeDBHelper) StopMysqldContextArgsForCall(i int) context.Context {
+	fake.stopMysqldContextMutex.RLock()
+	defer fake.stopMysqldContextMutex.RUnlock()
+	argsForCall := fake.stopMysqldContextArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeDBHelper) StopMysqldContextReturns(result1 error) {
+	fake.stopMysqldContextMutex.Lock()
+	defer fake.stopMysqldContextMutex.Unlock()
+	fake.StopMysqldContextStub = nil
+	fake.stopMysqldContextReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeDBHelper) StopMysqldContextReturnsOnCall(i int, result1 error) {
+	fake.stopMysqldContextMutex.Lock()
+	defer fake.stopMysqldContextMutex.Unlock()
+	fake.StopMysqldContextStub = nil
+	if fake.stopMysqldContextReturnsOnCall == nil {
+		fake.stopMysqldContextReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.stopMysqldContextReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeDBHelper) Upgrade(arg1 context.Context, arg2 bool) (string, error) {
 	fake.upgradeMutex.Lock()
 	ret, specificReturn := fake.upgradeReturnsOnCall[len(fake.upgradeArgsForCall)]
 	fake.upgradeArgsForCall = append(fake.upgradeArgsForCall, struct {
-	}{})
-	fake.recordInvocation("Upgrade", []interface{}{})
+		arg1 context.Context
+		arg2 bool
+	}{arg1, arg2})
+	fake.recordInvocation("Upgrade", []interface{}{arg1, arg2})
 	fake.upgradeMutex.Unlock()
 	if fake.UpgradeStub != nil {
-		return fake.UpgradeStub()
+		return fake.UpgradeStub(arg1, arg2)
 	}
 	if specificReturn {
 		return ret.result1, ret.result2
@@ -586,12 +1126,19 @@ func (fake *FakeDBHelper) UpgradeCallCount() int {
 	return len(fake.upgradeArgsForCall)
 }
 
-func (fake *FakeDBHelper) UpgradeCalls(stub func() (string, error)) {
+func (fake *FakeDBHelper) UpgradeCalls(stub func(context.Context, bool) (string, error)) {
 	fake.upgradeMutex.Lock()
 	defer fake.upgradeMutex.Unlock()
 	fake.UpgradeStub = stub
 }
 
+func (fake *FakeDBHelper) UpgradeArgsForCall(i int) (context.Context, bool) {
+	fake.upgradeMutex.RLock()
+	defer fake.upgradeMutex.RUnlock()
+	argsForCall := fake.upgradeArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
 func (fake *FakeDBHelper) UpgradeReturns(result1 string, result2 error) {
 	fake.upgradeMutex.Lock()
 	defer fake.upgradeMutex.Unlock()
@@ -621,16 +1168,28 @@ func (fake *FakeDBHelper) UpgradeReturnsOnCall(i int, result1 string, result2 er
 func (fake *FakeDBHelper) Invocations() map[string][][]interface{} {
 	fake.invocationsMutex.RLock()
 	defer fake.invocationsMutex.RUnlock()
+	fake.galeraStateMutex.RLock()
+	defer fake.galeraStateMutex.RUnlock()
 	fake.isDatabaseReachableMutex.RLock()
 	defer fake.isDatabaseReachableMutex.RUnlock()
 	fake.isProcessRunningMutex.RLock()
 	defer fake.isProcessRunningMutex.RUnlock()
+	fake.isReceivingStateTransferMutex.RLock()
+	defer fake.isReceivingStateTransferMutex.RUnlock()
+	fake.reconcileAccountsMutex.RLock()
+	defer fake.reconcileAccountsMutex.RUnlock()
+	fake.recoverPositionMutex.RLock()
+	defer fake.recoverPositionMutex.RUnlock()
+	fake.reloadPasswordsMutex.RLock()
+	defer fake.reloadPasswordsMutex.RUnlock()
 	fake.runPostStartSQLMutex.RLock()
 	defer fake.runPostStartSQLMutex.RUnlock()
 	fake.seedMutex.RLock()
 	defer fake.seedMutex.RUnlock()
 	fake.seedUsersMutex.RLock()
 	defer fake.seedUsersMutex.RUnlock()
+	fake.startMysqldForServerUpgradeMutex.RLock()
+	defer fake.startMysqldForServerUpgradeMutex.RUnlock()
 	fake.startMysqldForUpgradeMutex.RLock()
 	defer fake.startMysqldForUpgradeMutex.RUnlock()
 	fake.startMysqldInBootstrapMutex.RLock()
@@ -639,6 +1198,8 @@ func (fake *FakeDBHelper) Invocations() map[string][][]interface{} {
 	defer fake.startMysqldInJoinMutex.RUnlock()
 	fake.stopMysqldMutex.RLock()
 	defer fake.stopMysqldMutex.RUnlock()
+	fake.stopMysqldContextMutex.RLock()
+	defer fake.stopMysqldContextMutex.RUnlock()
 	fake.upgradeMutex.RLock()
 	defer fake.upgradeMutex.RUnlock()
 	copiedInvocations := map[string][][]interface{}{}
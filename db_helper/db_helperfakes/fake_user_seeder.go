@@ -4,17 +4,16 @@ package db_helperfakes
 import (
 	"sync"
 
+	"github.com/cloudfoundry/galera-init/config"
 	"github.com/cloudfoundry/galera-init/db_helper"
 )
 
 type FakeUserSeeder struct {
-	SeedUserStub        func(string, string, string, string) error
+	SeedUserStub        func(config.SeededUser, string) error
 	seedUserMutex       sync.RWMutex
 	seedUserArgsForCall []struct {
-		arg1 string
+		arg1 config.SeededUser
 		arg2 string
-		arg3 string
-		arg4 string
 	}
 	seedUserReturns struct {
 		result1 error
@@ -26,19 +25,17 @@ type FakeUserSeeder struct {
 	invocationsMutex sync.RWMutex
 }
 
-func (fake *FakeUserSeeder) SeedUser(arg1 string, arg2 string, arg3 string, arg4 string) error {
+func (fake *FakeUserSeeder) SeedUser(arg1 config.SeededUser, arg2 string) error {
 	fake.seedUserMutex.Lock()
 	ret, specificReturn := fake.seedUserReturnsOnCall[len(fake.seedUserArgsForCall)]
 	fake.seedUserArgsForCall = append(fake.seedUserArgsForCall, struct {
-		arg1 string
+		arg1 config.SeededUser
 		arg2 string
-		arg3 string
-		arg4 string
-	}{arg1, arg2, arg3, arg4})
-	fake.recordInvocation("SeedUser", []interface{}{arg1, arg2, arg3, arg4})
+	}{arg1, arg2})
+	fake.recordInvocation("SeedUser", []interface{}{arg1, arg2})
 	fake.seedUserMutex.Unlock()
 	if fake.SeedUserStub != nil {
-		return fake.SeedUserStub(arg1, arg2, arg3, arg4)
+		return fake.SeedUserStub(arg1, arg2)
 	}
 	if specificReturn {
 		return ret.result1
@@ -53,17 +50,17 @@ func (fake *FakeUserSeeder) SeedUserCallCount() int {
 	return len(fake.seedUserArgsForCall)
 }
 
-func (fake *FakeUserSeeder) SeedUserCalls(stub func(string, string, string, string) error) {
+func (fake *FakeUserSeeder) SeedUserCalls(stub func(config.SeededUser, string) error) {
 	fake.seedUserMutex.Lock()
 	defer fake.seedUserMutex.Unlock()
 	fake.SeedUserStub = stub
 }
 
-func (fake *FakeUserSeeder) SeedUserArgsForCall(i int) (string, string, string, string) {
+func (fake *FakeUserSeeder) SeedUserArgsForCall(i int) (config.SeededUser, string) {
 	fake.seedUserMutex.RLock()
 	defer fake.seedUserMutex.RUnlock()
 	argsForCall := fake.seedUserArgsForCall[i]
-	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3, argsForCall.arg4
+	return argsForCall.arg1, argsForCall.arg2
 }
 
 func (fake *FakeUserSeeder) SeedUserReturns(result1 error) {
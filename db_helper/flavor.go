@@ -0,0 +1,128 @@
+package db_helper
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/cloudfoundry/galera-init/config"
+)
+
+// Flavor captures what differs between the Galera distributions galera-init can manage
+type Flavor interface {
+	Name() string
+	// BootstrapArgs start mysqld as the first node of a new cluster
+	BootstrapArgs() []string
+	// StandaloneArgs start mysqld without replication so the upgrade can run
+	StandaloneArgs() []string
+	// ReadyStatusVariable names a status variable that has to be ON, in
+	// addition to the node being Synced, before the node serves queries
+	ReadyStatusVariable() string
+	// BackupPrivileges are the global privileges of the built-in backup role
+	// on a server reporting serverVersion, as SELECT VERSION() returns it
+	BackupPrivileges(serverVersion string) []string
+	// Binaries are the programs the flavor ships, which Db.MysqldPath,
+	// Db.MysqladminPath and Db.UpgradePath default to
+	Binaries() config.Binaries
+}
+
+// NewFlavor returns the Flavor configured with Db.Flavor
+func NewFlavor(name string) (Flavor, error) {
+	switch name {
+	case config.FlavorPXC, "":
+		return PXCFlavor{}, nil
+	case config.FlavorMariaDB:
+		return MariaDBFlavor{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported flavor %q", name)
+	}
+}
+
+// PXCFlavor manages Percona XtraDB Cluster
+type PXCFlavor struct{}
+
+func (PXCFlavor) Name() string {
+	return config.FlavorPXC
+}
+
+func (PXCFlavor) BootstrapArgs() []string {
+	return []string{"--wsrep-new-cluster"}
+}
+
+func (PXCFlavor) StandaloneArgs() []string {
+	return []string{
+		"--wsrep-on=OFF",
+		"--wsrep-desync=ON",
+		"--wsrep-OSU-method=RSU",
+		"--wsrep-provider=none",
+		"--skip-networking",
+	}
+}
+
+func (PXCFlavor) ReadyStatusVariable() string {
+	return ""
+}
+
+// BackupPrivileges are what xtrabackup needs. BACKUP_ADMIN only exists from
+// 8.0 on, so it is left out for 5.7 and for versions that cannot be read.
+func (PXCFlavor) BackupPrivileges(serverVersion string) []string {
+	privileges := []string{"RELOAD", "LOCK TABLES", "PROCESS", "REPLICATION CLIENT"}
+	if majorVersion(serverVersion) >= 8 {
+		privileges = append(privileges, "BACKUP_ADMIN")
+	}
+	return privileges
+}
+
+func (PXCFlavor) Binaries() config.Binaries {
+	return config.FlavorBinaries[config.FlavorPXC]
+}
+
+// MariaDBFlavor manages MariaDB Galera Cluster
+type MariaDBFlavor struct{}
+
+func (MariaDBFlavor) Name() string {
+	return config.FlavorMariaDB
+}
+
+// BootstrapArgs matches what MariaDB's galera_new_cluster passes to mysqld
+func (MariaDBFlavor) BootstrapArgs() []string {
+	return []string{"--wsrep-new-cluster"}
+}
+
+// StandaloneArgs leaves out wsrep_desync and wsrep_OSU_method, which MariaDB
+// refuses to set while no provider is loaded
+func (MariaDBFlavor) StandaloneArgs() []string {
+	return []string{
+		"--wsrep-on=OFF",
+		"--wsrep-provider=none",
+		"--skip-networking",
+		"--skip-slave-start",
+	}
+}
+
+// ReadyStatusVariable is wsrep_ready, which MariaDB keeps OFF until the node
+// accepts queries even after it reports Synced
+func (MariaDBFlavor) ReadyStatusVariable() string {
+	return "wsrep_ready"
+}
+
+// BackupPrivileges are what mariabackup needs. MariaDB has no BACKUP_ADMIN.
+func (MariaDBFlavor) BackupPrivileges(string) []string {
+	return []string{"RELOAD", "LOCK TABLES", "PROCESS", "REPLICATION CLIENT"}
+}
+
+// Binaries are the mariadb names, as MariaDB 10.5 on only ships the mysql
+// ones as deprecated links
+func (MariaDBFlavor) Binaries() config.Binaries {
+	return config.FlavorBinaries[config.FlavorMariaDB]
+}
+
+// majorVersion reads the major version from a server version such as
+// 8.0.20-11 or 5.7.28-31-57-log, or returns 0 when there is none
+func majorVersion(serverVersion string) int {
+	major, err := strconv.Atoi(strings.SplitN(strings.TrimSpace(serverVersion), ".", 2)[0])
+	if err != nil {
+		return 0
+	}
+	return major
+}
@@ -0,0 +1,69 @@
+package db_helper
+
+import (
+	"github.com/cloudfoundry/galera-init/config"
+)
+
+// revokeAllPrivileges takes every privilege away from an account, so a role
+// granted afterwards is all the account can do
+const revokeAllPrivileges = "REVOKE ALL PRIVILEGES, GRANT OPTION FROM %s"
+
+// Role gives a seeded user its privileges
+type Role struct {
+	// Revoke runs before the grants, with the quoted account as its only
+	// argument. admin has none, so its grants never lapse while seeding.
+	Revoke string
+	Grants []config.RoleGrant
+}
+
+// RoleCatalog maps the names SeededUsers give as their Role to roles
+type RoleCatalog map[string]Role
+
+// NewRoleCatalog returns the built-in roles for flavor at serverVersion along
+// with the roles defined in config
+func NewRoleCatalog(flavor Flavor, serverVersion string, roles []config.Role) RoleCatalog {
+	catalog := RoleCatalog{
+		config.RoleAdmin: {
+			Grants: []config.RoleGrant{
+				{Privileges: []string{"ALL PRIVILEGES"}, On: "*.*", WithGrantOption: true},
+			},
+		},
+		config.RoleMinimal: {
+			Revoke: "REVOKE ALL PRIVILEGES ON *.* FROM %s",
+		},
+		config.RoleMonitoring: {
+			Revoke: revokeAllPrivileges,
+			Grants: []config.RoleGrant{
+				{Privileges: []string{"PROCESS", "REPLICATION CLIENT"}, On: "*.*"},
+				{Privileges: []string{"SELECT"}, On: "performance_schema.*"},
+			},
+		},
+		config.RoleBackup: {
+			Revoke: revokeAllPrivileges,
+			Grants: []config.RoleGrant{
+				{Privileges: flavor.BackupPrivileges(serverVersion), On: "*.*"},
+			},
+		},
+		config.RoleReplication: {
+			Revoke: revokeAllPrivileges,
+			Grants: []config.RoleGrant{
+				{Privileges: []string{"REPLICATION SLAVE", "REPLICATION CLIENT"}, On: "*.*"},
+			},
+		},
+		config.RoleReadOnly: {
+			Revoke: revokeAllPrivileges,
+			Grants: []config.RoleGrant{
+				{Privileges: []string{"SELECT", "SHOW VIEW"}, On: "*.*"},
+			},
+		},
+	}
+
+	for _, role := range roles {
+		catalog[role.Name] = Role{
+			Revoke: revokeAllPrivileges,
+			Grants: role.Grants,
+		}
+	}
+
+	return catalog
+}
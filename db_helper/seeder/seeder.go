@@ -1,12 +1,12 @@
 package seeder
 
 import (
-	"fmt"
-
 	"database/sql"
 
 	"code.cloudfoundry.org/lager"
 	"github.com/cloudfoundry/galera-init/config"
+	"github.com/cloudfoundry/galera-init/db_helper/auth"
+	"github.com/cloudfoundry/galera-init/db_helper/sql_builder"
 	_ "github.com/go-sql-driver/mysql"
 )
 
@@ -14,12 +14,15 @@ import (
 
 type Seeder interface {
 	CreateDBIfNeeded() error
-	IsExistingUser() (bool, error)
-	CreateUser() error
-	UpdateUser() error
-	GrantUserPrivileges() error
+	IsExistingUser(user, host string) (bool, error)
+	CreateUser(user config.PreseededDatabaseUser, host string) error
+	UpdateUser(user config.PreseededDatabaseUser, host string) error
+	GrantUserPrivileges(user config.PreseededDatabaseUser, host string) error
 }
 
+// ReadOnlyPrivileges are granted to ReadOnly users
+var ReadOnlyPrivileges = []string{"SELECT", "SHOW VIEW"}
+
 type seeder struct {
 	db     *sql.DB
 	config config.PreseededDatabase
@@ -35,7 +38,7 @@ func NewSeeder(db *sql.DB, config config.PreseededDatabase, logger lager.Logger)
 }
 
 func (s seeder) CreateDBIfNeeded() error {
-	_, err := s.db.Exec(fmt.Sprintf("CREATE DATABASE IF NOT EXISTS `%s`", s.config.DBName))
+	err := sql_builder.Exec(s.db, "CREATE DATABASE IF NOT EXISTS %s", sql_builder.Identifier(s.config.DBName))
 	if err != nil {
 		s.logger.Error("Error creating preseeded database", err, lager.Data{"dbName": s.config.DBName})
 		return err
@@ -43,74 +46,117 @@ func (s seeder) CreateDBIfNeeded() error {
 	return nil
 }
 
-func (s seeder) IsExistingUser() (bool, error) {
-	rows, err := s.db.Query(fmt.Sprintf(
-		"SELECT User FROM mysql.user WHERE User = '%s'",
-		s.config.User))
+func (s seeder) IsExistingUser(user, host string) (bool, error) {
+	rows, err := s.db.Query("SELECT User FROM mysql.user WHERE User = ? AND Host = ?", user, host)
 	if err != nil {
 		s.logger.Error("Error getting list of users", err, lager.Data{
 			"dbName": s.config.DBName,
 		})
 		return false, err
 	}
+	defer rows.Close()
 
 	return rows.Next(), nil
 }
 
-func (s seeder) CreateUser() error {
-	_, err := s.db.Exec(fmt.Sprintf(
-		"CREATE USER `%s` IDENTIFIED BY '%s'",
-		s.config.User,
-		s.config.Password))
+func (s seeder) CreateUser(user config.PreseededDatabaseUser, host string) error {
+	err := sql_builder.Exec(
+		s.db,
+		"CREATE USER %s %s",
+		sql_builder.Account(user.User, host),
+		auth.Identified(user.AuthPlugin, user.Password, user.PasswordHash))
 	if err != nil {
 		s.logger.Error("Error creating user", err, lager.Data{
-			"user": s.config.User,
+			"user": user.User,
+			"host": host,
 		})
 		return err
 	}
 	return nil
 }
 
-func (s seeder) UpdateUser() error {
-	_, err := s.db.Exec(fmt.Sprintf(
-		"SET PASSWORD FOR `%s` = '%s'",
-		s.config.User,
-		s.config.Password,
-	))
+// UpdateUser sets the user's password, or with an AuthPlugin its plugin and
+// password or hash
+func (s seeder) UpdateUser(user config.PreseededDatabaseUser, host string) error {
+	account := sql_builder.Account(user.User, host)
+
+	var err error
+	if user.AuthPlugin == "" {
+		err = sql_builder.Exec(s.db, "SET PASSWORD FOR %s = %s", account, sql_builder.Password(user.Password))
+	} else {
+		err = sql_builder.Exec(s.db, "ALTER USER %s %s", account, auth.Identified(user.AuthPlugin, user.Password, user.PasswordHash))
+	}
 	if err != nil {
 		s.logger.Error("Error updating user", err, lager.Data{
-			"user": s.config.User,
+			"user": user.User,
+			"host": host,
 		})
 		return err
 	}
 	return nil
 }
 
-func (s seeder) GrantUserPrivileges() error {
-	_, err := s.db.Exec(fmt.Sprintf(
-		"GRANT ALL ON `%s`.* TO '%s'@'%%'",
-		s.config.DBName,
-		s.config.User))
+// GrantUserPrivileges grants the user's privileges on the database and
+// revokes every other database privilege, so changes to the configured
+// privileges take effect on existing users
+func (s seeder) GrantUserPrivileges(user config.PreseededDatabaseUser, host string) error {
+	database := sql_builder.Identifier(s.config.DBName)
+	account := sql_builder.Account(user.User, host)
+	grant, revoke := databaseGrants(user)
+
+	err := sql_builder.Exec(s.db, "GRANT %s ON %s.* TO %s", sql_builder.Privileges(grant), database, account)
 	if err != nil {
 		s.logger.Error("Error granting user privileges", err, lager.Data{
-			"dbName": s.config.DBName,
-			"user":   s.config.User,
+			"dbName":     s.config.DBName,
+			"user":       user.User,
+			"host":       host,
+			"privileges": grant,
 		})
 		return err
 	}
 
-	_, err = s.db.Exec(fmt.Sprintf(
-		"REVOKE LOCK TABLES ON `%s`.* FROM '%s'@'%%'",
-		s.config.DBName,
-		s.config.User,
-	))
+	if len(revoke) == 0 {
+		return nil
+	}
+
+	err = sql_builder.Exec(s.db, "REVOKE %s ON %s.* FROM %s", sql_builder.Privileges(revoke), database, account)
 	if err != nil {
-		s.logger.Error("Error revoking LOCK TABLES privilege", err, lager.Data{
-			"dbName": s.config.DBName,
-			"user":   s.config.User,
+		s.logger.Error("Error revoking privileges", err, lager.Data{
+			"dbName":     s.config.DBName,
+			"user":       user.User,
+			"host":       host,
+			"privileges": revoke,
 		})
 		return err
 	}
 
 	return nil
 }
+
+// databaseGrants returns the privileges to grant and to revoke. Users
+// without configured privileges get ALL but LOCK TABLES, as they always have.
+func databaseGrants(user config.PreseededDatabaseUser) (grant, revoke []string) {
+	if len(user.Privileges) == 0 && !user.ReadOnly {
+		return []string{"ALL"}, []string{"LOCK TABLES"}
+	}
+
+	grant = user.Privileges
+	if user.ReadOnly {
+		grant = ReadOnlyPrivileges
+	}
+
+	granted := map[string]bool{}
+	for _, privilege := range grant {
+		granted[sql_builder.NormalizePrivilege(privilege)] = true
+	}
+
+	for _, privilege := range sql_builder.DatabasePrivileges {
+		// ALL does not include GRANT OPTION
+		if granted[privilege] || (granted["ALL"] && privilege != "GRANT OPTION") {
+			continue
+		}
+		revoke = append(revoke, privilege)
+	}
+
+	return grant, revoke
+}
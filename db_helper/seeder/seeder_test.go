@@ -3,6 +3,7 @@ package seeder_test
 import (
 	"database/sql"
 	"fmt"
+	"regexp"
 
 	"code.cloudfoundry.org/lager/lagertest"
 	"errors"
@@ -17,6 +18,7 @@ var _ = Describe("Seeder", func() {
 	var (
 		testLogger lagertest.TestLogger
 		dbConfig   config.PreseededDatabase
+		user       config.PreseededDatabaseUser
 		fakeDB     *sql.DB
 		seeder     s.Seeder
 		mock       sqlmock.Sqlmock
@@ -33,6 +35,7 @@ var _ = Describe("Seeder", func() {
 			User:     "user1",
 			Password: "password1",
 		}
+		user = dbConfig.DatabaseUsers()[0]
 	})
 
 	JustBeforeEach(func() {
@@ -84,21 +87,19 @@ var _ = Describe("Seeder", func() {
 		var selectUserQuery string
 
 		BeforeEach(func() {
-			selectUserQuery = fmt.Sprintf(
-				"SELECT User FROM mysql.user WHERE User = '%s'",
-				dbConfig.User)
+			selectUserQuery = regexp.QuoteMeta("SELECT User FROM mysql.user WHERE User = ? AND Host = ?")
 		})
 
 		Context("user exists in the database", func() {
 			It("returns true", func() {
 				expectedRow := sqlmock.NewRows([]string{"User"}).
-					AddRow(dbConfig.User)
+					AddRow(user.User)
 
 				mock.ExpectQuery(selectUserQuery).
-					WithArgs().
+					WithArgs(user.User, "%").
 					WillReturnRows(expectedRow)
 
-				result, err := seeder.IsExistingUser()
+				result, err := seeder.IsExistingUser(user.User, "%")
 				Expect(err).ToNot(HaveOccurred())
 				Expect(result).To(BeTrue())
 			})
@@ -109,10 +110,10 @@ var _ = Describe("Seeder", func() {
 				noExpectedRow := sqlmock.NewRows([]string{"User"})
 
 				mock.ExpectQuery(selectUserQuery).
-					WithArgs().
+					WithArgs(user.User, "10.0.16.%").
 					WillReturnRows(noExpectedRow)
 
-				result, err := seeder.IsExistingUser()
+				result, err := seeder.IsExistingUser(user.User, "10.0.16.%")
 				Expect(err).ToNot(HaveOccurred())
 				Expect(result).To(BeFalse())
 			})
@@ -121,10 +122,10 @@ var _ = Describe("Seeder", func() {
 		Context("determining if the user exists returns an error", func() {
 			It("returns the error", func() {
 				mock.ExpectQuery(selectUserQuery).
-					WithArgs().
+					WithArgs(user.User, "%").
 					WillReturnError(fmt.Errorf("some error"))
 
-				_, err := seeder.IsExistingUser()
+				_, err := seeder.IsExistingUser(user.User, "%")
 				Expect(err).To(HaveOccurred())
 			})
 		})
@@ -134,59 +135,131 @@ var _ = Describe("Seeder", func() {
 		var createUserExec string
 
 		BeforeEach(func() {
-			createUserExec = fmt.Sprintf(
-				"CREATE USER `%s` IDENTIFIED BY '%s'",
-				dbConfig.User,
-				dbConfig.Password,
-			)
+			createUserExec = regexp.QuoteMeta(fmt.Sprintf(
+				"CREATE USER `%s`@`%%` IDENTIFIED BY ?",
+				user.User,
+			))
 		})
 
 		It("creates the user", func() {
 			mock.ExpectExec(createUserExec).
-				WithArgs().
+				WithArgs(user.Password).
 				WillReturnResult(sqlmock.NewResult(lastInsertId, rowsAffected))
 
-			seeder.CreateUser()
+			Expect(seeder.CreateUser(user, "%")).To(Succeed())
+		})
+
+		It("creates the user for the given host", func() {
+			mock.ExpectExec(regexp.QuoteMeta("CREATE USER `user1`@`10.0.16.%` IDENTIFIED BY ?")).
+				WithArgs("password1").
+				WillReturnResult(sqlmock.NewResult(lastInsertId, rowsAffected))
+
+			Expect(seeder.CreateUser(user, "10.0.16.%")).To(Succeed())
+		})
+
+		It("creates the user with a password hash", func() {
+			user.Password = ""
+			user.AuthPlugin = "mysql_native_password"
+			user.PasswordHash = "*2470C0C06DEE42FD1618BB99005ADCA2EC9D1E19"
+
+			mock.ExpectExec(regexp.QuoteMeta("CREATE USER `user1`@`%` IDENTIFIED WITH mysql_native_password AS '*2470C0C06DEE42FD1618BB99005ADCA2EC9D1E19'")).
+				WillReturnResult(sqlmock.NewResult(lastInsertId, rowsAffected))
+
+			Expect(seeder.CreateUser(user, "%")).To(Succeed())
+		})
+
+		It("creates the user with the given plugin", func() {
+			user.AuthPlugin = "caching_sha2_password"
+
+			mock.ExpectExec(regexp.QuoteMeta("CREATE USER `user1`@`%` IDENTIFIED WITH caching_sha2_password BY ?")).
+				WithArgs("password1").
+				WillReturnResult(sqlmock.NewResult(lastInsertId, rowsAffected))
+
+			Expect(seeder.CreateUser(user, "%")).To(Succeed())
 		})
 
 		Context("when creating the user returns an error", func() {
 			It("bubbles the error up", func() {
 				mock.ExpectExec(createUserExec).
-					WithArgs().
+					WithArgs(user.Password).
 					WillReturnError(fmt.Errorf("some error"))
 
-				err := seeder.CreateUser()
+				err := seeder.CreateUser(user, "%")
 				Expect(err).To(HaveOccurred())
 			})
 		})
 	})
 
+	Describe("CreateUser with hostile input", func() {
+		BeforeEach(func() {
+			user.User = "evil`; DROP DATABASE mysql; -- "
+			user.Password = `p'; DROP USER root; -- \`
+		})
+
+		It("quotes the user name and passes the password as it is", func() {
+			mock.ExpectExec(regexp.QuoteMeta(
+				"CREATE USER `evil``; DROP DATABASE mysql; -- `@`%` IDENTIFIED BY ?",
+			)).WithArgs(`p'; DROP USER root; -- \`).
+				WillReturnResult(sqlmock.NewResult(lastInsertId, rowsAffected))
+
+			Expect(seeder.CreateUser(user, "%")).To(Succeed())
+		})
+
+		Context("when the password contains a NUL byte", func() {
+			BeforeEach(func() {
+				user.Password = "pass\x00word"
+			})
+
+			It("returns an error without running a statement or revealing the password", func() {
+				err := seeder.CreateUser(user, "%")
+				Expect(err).To(MatchError("invalid password: contains a NUL byte"))
+			})
+		})
+	})
+
 	Describe("UpdateUser", func() {
 		var updateUserExec string
 
 		BeforeEach(func() {
-			updateUserExec = fmt.Sprintf(
-				"SET PASSWORD FOR `%s` = '%s'",
-				dbConfig.User,
-				dbConfig.Password,
-			)
+			updateUserExec = regexp.QuoteMeta(fmt.Sprintf(
+				"SET PASSWORD FOR `%s`@`%%` = ?",
+				user.User,
+			))
 		})
 
 		It("updates the user with the new password", func() {
 			mock.ExpectExec(updateUserExec).
-				WithArgs().
+				WithArgs(user.Password).
 				WillReturnResult(sqlmock.NewResult(lastInsertId, rowsAffected))
 
-			seeder.UpdateUser()
+			Expect(seeder.UpdateUser(user, "%")).To(Succeed())
+		})
+
+		It("alters the plugin and hash of a user with a password hash", func() {
+			user.Password = ""
+			user.AuthPlugin = "mysql_native_password"
+			user.PasswordHash = "*2470C0C06DEE42FD1618BB99005ADCA2EC9D1E19"
+
+			mock.ExpectExec(regexp.QuoteMeta("ALTER USER `user1`@`%` IDENTIFIED WITH mysql_native_password AS '*2470C0C06DEE42FD1618BB99005ADCA2EC9D1E19'")).
+				WillReturnResult(sqlmock.NewResult(lastInsertId, rowsAffected))
+
+			Expect(seeder.UpdateUser(user, "%")).To(Succeed())
+		})
+
+		It("does not run a statement for a malformed hash", func() {
+			user.AuthPlugin = "mysql_native_password"
+			user.PasswordHash = "*00' OR '1"
+
+			Expect(seeder.UpdateUser(user, "%")).To(MatchError("mysql_native_password hashes must be * followed by 40 upper-case hex digits"))
 		})
 
 		Context("when updating the user returns an error", func() {
 			It("bubbles the error up", func() {
 				mock.ExpectExec(updateUserExec).
-					WithArgs().
+					WithArgs(user.Password).
 					WillReturnError(fmt.Errorf("some error"))
 
-				err := seeder.UpdateUser()
+				err := seeder.UpdateUser(user, "%")
 				Expect(err).To(HaveOccurred())
 				Expect(err.Error()).To(ContainSubstring("some error"))
 			})
@@ -200,15 +273,15 @@ var _ = Describe("Seeder", func() {
 		)
 
 		BeforeEach(func() {
-			grantAllExec = fmt.Sprintf("GRANT ALL ON `%s`.* TO '%s'@'%%", dbConfig.DBName, dbConfig.User)
-			revokePrivilegesExec = fmt.Sprintf("REVOKE LOCK TABLES ON `%s`.* FROM '%s'@'%%", dbConfig.DBName, dbConfig.User)
+			grantAllExec = regexp.QuoteMeta(fmt.Sprintf("GRANT ALL ON `%s`.* TO `%s`@`%%`", dbConfig.DBName, user.User))
+			revokePrivilegesExec = regexp.QuoteMeta(fmt.Sprintf("REVOKE LOCK TABLES ON `%s`.* FROM `%s`@`%%`", dbConfig.DBName, user.User))
 		})
 
 		It("grants them all privileges and then revokes LOCK TABLES", func() {
 			mock.ExpectExec(grantAllExec).WillReturnResult(sqlmock.NewResult(0, 0))
 			mock.ExpectExec(revokePrivilegesExec).WillReturnResult(sqlmock.NewResult(0, 0))
 
-			Expect(seeder.GrantUserPrivileges()).To(Succeed())
+			Expect(seeder.GrantUserPrivileges(user, "%")).To(Succeed())
 		})
 
 		It("returns an error if granting privileges errors", func() {
@@ -216,7 +289,7 @@ var _ = Describe("Seeder", func() {
 
 			mock.ExpectExec(grantAllExec).WillReturnError(err)
 
-			Expect(seeder.GrantUserPrivileges()).To(MatchError(err))
+			Expect(seeder.GrantUserPrivileges(user, "%")).To(MatchError(err))
 		})
 
 		It("returns an error if revoking LOCK TABLES privileges errors", func() {
@@ -225,7 +298,61 @@ var _ = Describe("Seeder", func() {
 			mock.ExpectExec(grantAllExec).WillReturnResult(sqlmock.NewResult(0, 0))
 			mock.ExpectExec(revokePrivilegesExec).WillReturnError(err)
 
-			Expect(seeder.GrantUserPrivileges()).To(MatchError(err))
+			Expect(seeder.GrantUserPrivileges(user, "%")).To(MatchError(err))
+		})
+
+		Context("when the user has explicit privileges", func() {
+			BeforeEach(func() {
+				user.Privileges = []string{"select", "Insert", "update", "DELETE", "show  view"}
+			})
+
+			It("grants those privileges and revokes all others", func() {
+				mock.ExpectExec(regexp.QuoteMeta("GRANT SELECT, INSERT, UPDATE, DELETE, SHOW VIEW ON `DB1`.* TO `user1`@`10.0.16.%`")).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(regexp.QuoteMeta("REVOKE ALTER, ALTER ROUTINE, CREATE, CREATE ROUTINE, CREATE TEMPORARY TABLES, CREATE VIEW, DROP, EVENT, EXECUTE, GRANT OPTION, INDEX, LOCK TABLES, REFERENCES, TRIGGER ON `DB1`.* FROM `user1`@`10.0.16.%`")).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+
+				Expect(seeder.GrantUserPrivileges(user, "10.0.16.%")).To(Succeed())
+			})
+		})
+
+		Context("when the user has ALL and GRANT OPTION", func() {
+			BeforeEach(func() {
+				user.Privileges = []string{"ALL PRIVILEGES", "GRANT OPTION"}
+			})
+
+			It("revokes nothing", func() {
+				mock.ExpectExec(regexp.QuoteMeta("GRANT ALL, GRANT OPTION ON `DB1`.* TO `user1`@`%`")).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+
+				Expect(seeder.GrantUserPrivileges(user, "%")).To(Succeed())
+			})
+		})
+
+		Context("when the user is read-only", func() {
+			BeforeEach(func() {
+				user.ReadOnly = true
+			})
+
+			It("grants SELECT and SHOW VIEW only", func() {
+				mock.ExpectExec(regexp.QuoteMeta("GRANT SELECT, SHOW VIEW ON `DB1`.* TO `user1`@`%`")).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(regexp.QuoteMeta("REVOKE ALTER, ALTER ROUTINE, CREATE, CREATE ROUTINE, CREATE TEMPORARY TABLES, CREATE VIEW, DELETE, DROP, EVENT, EXECUTE, GRANT OPTION, INDEX, INSERT, LOCK TABLES, REFERENCES, TRIGGER, UPDATE ON `DB1`.* FROM `user1`@`%`")).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+
+				Expect(seeder.GrantUserPrivileges(user, "%")).To(Succeed())
+			})
+		})
+
+		Context("when a privilege is unknown", func() {
+			BeforeEach(func() {
+				user.Privileges = []string{"SELECT", "SUPER; DROP DATABASE mysql"}
+			})
+
+			It("returns an error without running a statement", func() {
+				err := seeder.GrantUserPrivileges(user, "%")
+				Expect(err).To(MatchError(`"SUPER; DROP DATABASE mysql" is not a database privilege`))
+			})
 		})
 	})
 })
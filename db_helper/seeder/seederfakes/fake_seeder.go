@@ -4,6 +4,7 @@ package seederfakes
 import (
 	"sync"
 
+	"github.com/cloudfoundry/galera-init/config"
 	"github.com/cloudfoundry/galera-init/db_helper/seeder"
 )
 
@@ -18,9 +19,11 @@ type FakeSeeder struct {
 	createDBIfNeededReturnsOnCall map[int]struct {
 		result1 error
 	}
-	CreateUserStub        func() error
+	CreateUserStub        func(config.PreseededDatabaseUser, string) error
 	createUserMutex       sync.RWMutex
 	createUserArgsForCall []struct {
+		arg1 config.PreseededDatabaseUser
+		arg2 string
 	}
 	createUserReturns struct {
 		result1 error
@@ -28,9 +31,11 @@ type FakeSeeder struct {
 	createUserReturnsOnCall map[int]struct {
 		result1 error
 	}
-	GrantUserPrivilegesStub        func() error
+	GrantUserPrivilegesStub        func(config.PreseededDatabaseUser, string) error
 	grantUserPrivilegesMutex       sync.RWMutex
 	grantUserPrivilegesArgsForCall []struct {
+		arg1 config.PreseededDatabaseUser
+		arg2 string
 	}
 	grantUserPrivilegesReturns struct {
 		result1 error
@@ -38,9 +43,11 @@ type FakeSeeder struct {
 	grantUserPrivilegesReturnsOnCall map[int]struct {
 		result1 error
 	}
-	IsExistingUserStub        func() (bool, error)
+	IsExistingUserStub        func(string, string) (bool, error)
 	isExistingUserMutex       sync.RWMutex
 	isExistingUserArgsForCall []struct {
+		arg1 string
+		arg2 string
 	}
 	isExistingUserReturns struct {
 		result1 bool
@@ -50,9 +57,11 @@ type FakeSeeder struct {
 		result1 bool
 		result2 error
 	}
-	UpdateUserStub        func() error
+	UpdateUserStub        func(config.PreseededDatabaseUser, string) error
 	updateUserMutex       sync.RWMutex
 	updateUserArgsForCall []struct {
+		arg1 config.PreseededDatabaseUser
+		arg2 string
 	}
 	updateUserReturns struct {
 		result1 error
@@ -116,15 +125,17 @@ func (fake *FakeSeeder) CreateDBIfNeededReturnsOnCall(i int, result1 error) {
 	}{result1}
 }
 
-func (fake *FakeSeeder) CreateUser() error {
+func (fake *FakeSeeder) CreateUser(arg1 config.PreseededDatabaseUser, arg2 string) error {
 	fake.createUserMutex.Lock()
 	ret, specificReturn := fake.createUserReturnsOnCall[len(fake.createUserArgsForCall)]
 	fake.createUserArgsForCall = append(fake.createUserArgsForCall, struct {
-	}{})
-	fake.recordInvocation("CreateUser", []interface{}{})
+		arg1 config.PreseededDatabaseUser
+		arg2 string
+	}{arg1, arg2})
+	fake.recordInvocation("CreateUser", []interface{}{arg1, arg2})
 	fake.createUserMutex.Unlock()
 	if fake.CreateUserStub != nil {
-		return fake.CreateUserStub()
+		return fake.CreateUserStub(arg1, arg2)
 	}
 	if specificReturn {
 		return ret.result1
@@ -139,12 +150,19 @@ func (fake *FakeSeeder) CreateUserCallCount() int {
 	return len(fake.createUserArgsForCall)
 }
 
-func (fake *FakeSeeder) CreateUserCalls(stub func() error) {
+func (fake *FakeSeeder) CreateUserCalls(stub func(config.PreseededDatabaseUser, string) error) {
 	fake.createUserMutex.Lock()
 	defer fake.createUserMutex.Unlock()
 	fake.CreateUserStub = stub
 }
 
+func (fake *FakeSeeder) CreateUserArgsForCall(i int) (config.PreseededDatabaseUser, string) {
+	fake.createUserMutex.RLock()
+	defer fake.createUserMutex.RUnlock()
+	argsForCall := fake.createUserArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
 func (fake *FakeSeeder) CreateUserReturns(result1 error) {
 	fake.createUserMutex.Lock()
 	defer fake.createUserMutex.Unlock()
@@ -168,15 +186,17 @@ func (fake *FakeSeeder) CreateUserReturnsOnCall(i int, result1 error) {
 	}{result1}
 }
 
-func (fake *FakeSeeder) GrantUserPrivileges() error {
+func (fake *FakeSeeder) GrantUserPrivileges(arg1 config.PreseededDatabaseUser, arg2 string) error {
 	fake.grantUserPrivilegesMutex.Lock()
 	ret, specificReturn := fake.grantUserPrivilegesReturnsOnCall[len(fake.grantUserPrivilegesArgsForCall)]
 	fake.grantUserPrivilegesArgsForCall = append(fake.grantUserPrivilegesArgsForCall, struct {
-	}{})
-	fake.recordInvocation("GrantUserPrivileges", []interface{}{})
+		arg1 config.PreseededDatabaseUser
+		arg2 string
+	}{arg1, arg2})
+	fake.recordInvocation("GrantUserPrivileges", []interface{}{arg1, arg2})
 	fake.grantUserPrivilegesMutex.Unlock()
 	if fake.GrantUserPrivilegesStub != nil {
-		return fake.GrantUserPrivilegesStub()
+		return fake.GrantUserPrivilegesStub(arg1, arg2)
 	}
 	if specificReturn {
 		return ret.result1
@@ -191,12 +211,19 @@ func (fake *FakeSeeder) GrantUserPrivilegesCallCount() int {
 	return len(fake.grantUserPrivilegesArgsForCall)
 }
 
-func (fake *FakeSeeder) GrantUserPrivilegesCalls(stub func() error) {
+func (fake *FakeSeeder) GrantUserPrivilegesCalls(stub func(config.PreseededDatabaseUser, string) error) {
 	fake.grantUserPrivilegesMutex.Lock()
 	defer fake.grantUserPrivilegesMutex.Unlock()
 	fake.GrantUserPrivilegesStub = stub
 }
 
+func (fake *FakeSeeder) GrantUserPrivilegesArgsForCall(i int) (config.PreseededDatabaseUser, string) {
+	fake.grantUserPrivilegesMutex.RLock()
+	defer fake.grantUserPrivilegesMutex.RUnlock()
+	argsForCall := fake.grantUserPrivilegesArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
 func (fake *FakeSeeder) GrantUserPrivilegesReturns(result1 error) {
 	fake.grantUserPrivilegesMutex.Lock()
 	defer fake.grantUserPrivilegesMutex.Unlock()
@@ -220,15 +247,17 @@ func (fake *FakeSeeder) GrantUserPrivilegesReturnsOnCall(i int, result1 error) {
 	}{result1}
 }
 
-func (fake *FakeSeeder) IsExistingUser() (bool, error) {
+func (fake *FakeSeeder) IsExistingUser(arg1 string, arg2 string) (bool, error) {
 	fake.isExistingUserMutex.Lock()
 	ret, specificReturn := fake.isExistingUserReturnsOnCall[len(fake.isExistingUserArgsForCall)]
 	fake.isExistingUserArgsForCall = append(fake.isExistingUserArgsForCall, struct {
-	}{})
-	fake.recordInvocation("IsExistingUser", []interface{}{})
+		arg1 string
+		arg2 string
+	}{arg1, arg2})
+	fake.recordInvocation("IsExistingUser", []interface{}{arg1, arg2})
 	fake.isExistingUserMutex.Unlock()
 	if fake.IsExistingUserStub != nil {
-		return fake.IsExistingUserStub()
+		return fake.IsExistingUserStub(arg1, arg2)
 	}
 	if specificReturn {
 		return ret.result1, ret.result2
@@ -243,12 +272,19 @@ func (fake *FakeSeeder) IsExistingUserCallCount() int {
 	return len(fake.isExistingUserArgsForCall)
 }
 
-func (fake *FakeSeeder) IsExistingUserCalls(stub func() (bool, error)) {
+func (fake *FakeSeeder) IsExistingUserCalls(stub func(string, string) (bool, error)) {
 	fake.isExistingUserMutex.Lock()
 	defer fake.isExistingUserMutex.Unlock()
 	fake.IsExistingUserStub = stub
 }
 
+func (fake *FakeSeeder) IsExistingUserArgsForCall(i int) (string, string) {
+	fake.isExistingUserMutex.RLock()
+	defer fake.isExistingUserMutex.RUnlock()
+	argsForCall := fake.isExistingUserArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
 func (fake *FakeSeeder) IsExistingUserReturns(result1 bool, result2 error) {
 	fake.isExistingUserMutex.Lock()
 	defer fake.isExistingUserMutex.Unlock()
@@ -275,15 +311,17 @@ func (fake *FakeSeeder) IsExistingUserReturnsOnCall(i int, result1 bool, result2
 	}{result1, result2}
 }
 
-func (fake *FakeSeeder) UpdateUser() error {
+func (fake *FakeSeeder) UpdateUser(arg1 config.PreseededDatabaseUser, arg2 string) error {
 	fake.updateUserMutex.Lock()
 	ret, specificReturn := fake.updateUserReturnsOnCall[len(fake.updateUserArgsForCall)]
 	fake.updateUserArgsForCall = append(fake.updateUserArgsForCall, struct {
-	}{})
-	fake.recordInvocation("UpdateUser", []interface{}{})
+		arg1 config.PreseededDatabaseUser
+		arg2 string
+	}{arg1, arg2})
+	fake.recordInvocation("UpdateUser", []interface{}{arg1, arg2})
 	fake.updateUserMutex.Unlock()
 	if fake.UpdateUserStub != nil {
-		return fake.UpdateUserStub()
+		return fake.UpdateUserStub(arg1, arg2)
 	}
 	if specificReturn {
 		return ret.result1
@@ -298,12 +336,19 @@ func (fake *FakeSeeder) UpdateUserCallCount() int {
 	return len(fake.updateUserArgsForCall)
 }
 
-func (fake *FakeSeeder) UpdateUserCalls(stub func() error) {
+func (fake *FakeSeeder) UpdateUserCalls(stub func(config.PreseededDatabaseUser, string) error) {
 	fake.updateUserMutex.Lock()
 	defer fake.updateUserMutex.Unlock()
 	fake.UpdateUserStub = stub
 }
 
+func (fake *FakeSeeder) UpdateUserArgsForCall(i int) (config.PreseededDatabaseUser, string) {
+	fake.updateUserMutex.RLock()
+	defer fake.updateUserMutex.RUnlock()
+	argsForCall := fake.updateUserArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
 func (fake *FakeSeeder) UpdateUserReturns(result1 error) {
 	fake.updateUserMutex.Lock()
 	defer fake.updateUserMutex.Unlock()
@@ -0,0 +1,318 @@
+// Package sql_builder quotes values for the SQL statements galera-init runs
+// while seeding. Statements that MySQL can prepare take their values as
+// placeholders instead; account management statements such as CREATE USER
+// and GRANT cannot, so their names are quoted here. Passwords stay
+// placeholders, which the driver fills in on the client.
+package sql_builder
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Fragment is a quoted piece of SQL along with the values of its
+// placeholders, or the reason the value could not be quoted
+type Fragment struct {
+	sql  string
+	args []interface{}
+	err  error
+}
+
+// SQL returns the quoted value
+func (f Fragment) SQL() (string, error) {
+	return f.sql, f.err
+}
+
+// Args returns the values of the placeholders in SQL, in order
+func (f Fragment) Args() []interface{} {
+	return f.args
+}
+
+// Invalid is a fragment that fails the statement with err, for values
+// checked outside this package
+func Invalid(err error) Fragment {
+	return Fragment{err: err}
+}
+
+// Identifier quotes a database or table name, user name or host with backticks
+func Identifier(name string) Fragment {
+	if err := checkValue(name); err != nil {
+		return Fragment{err: fmt.Errorf("invalid identifier %q: %s", name, err)}
+	}
+	if name == "" {
+		return Fragment{err: fmt.Errorf("invalid identifier %q: must not be empty", name)}
+	}
+
+	return Fragment{sql: "`" + strings.Replace(name, "`", "``", -1) + "`"}
+}
+
+// String quotes a string literal. The error does not include the value, as
+// it is usually a password.
+//
+// Quotes are doubled and backslashes escaped, which keeps the literal intact
+// under the default SQL mode and still cannot end it early when
+// NO_BACKSLASH_ESCAPES is set. The server then keeps both backslashes, so
+// values that may contain one, such as passwords, go through Password.
+func String(value string) Fragment {
+	if err := checkValue(value); err != nil {
+		return Fragment{err: fmt.Errorf("invalid string literal: %s", err)}
+	}
+
+	escaped := strings.NewReplacer(`\`, `\\`, `'`, `''`).Replace(value)
+	return Fragment{sql: "'" + escaped + "'"}
+}
+
+// Password passes value as a placeholder. The driver fills it in knowing
+// whether the server runs with NO_BACKSLASH_ESCAPES, so the password arrives
+// as given in either SQL mode. MySQL cannot prepare account management
+// statements, so connections have to interpolate parameters on the client.
+func Password(value string) Fragment {
+	if err := checkValue(value); err != nil {
+		return Fragment{err: fmt.Errorf("invalid password: %s", err)}
+	}
+
+	return Fragment{sql: "?", args: []interface{}{value}}
+}
+
+// Hex writes value as a hexadecimal literal, which the server reads back
+// byte for byte whatever the SQL mode
+func Hex(value []byte) Fragment {
+	if len(value) == 0 {
+		return Fragment{err: fmt.Errorf("invalid hexadecimal literal: must not be empty")}
+	}
+
+	return Fragment{sql: "0x" + strings.ToUpper(hex.EncodeToString(value))}
+}
+
+// OneOf writes a keyword that cannot be quoted, such as an authentication
+// plugin name, if it is one of allowed
+func OneOf(keyword string, allowed ...string) Fragment {
+	for _, candidate := range allowed {
+		if keyword == candidate {
+			return Fragment{sql: keyword}
+		}
+	}
+
+	return Fragment{err: fmt.Errorf("%q must be one of %s", keyword, strings.Join(allowed, ", "))}
+}
+
+// DatabasePrivileges are the privileges MySQL grants on a database, db.*.
+// Privileges are keywords and cannot be quoted, so only these are accepted.
+var DatabasePrivileges = []string{
+	"ALTER",
+	"ALTER ROUTINE",
+	"CREATE",
+	"CREATE ROUTINE",
+	"CREATE TEMPORARY TABLES",
+	"CREATE VIEW",
+	"DELETE",
+	"DROP",
+	"EVENT",
+	"EXECUTE",
+	"GRANT OPTION",
+	"INDEX",
+	"INSERT",
+	"LOCK TABLES",
+	"REFERENCES",
+	"SELECT",
+	"SHOW VIEW",
+	"TRIGGER",
+	"UPDATE",
+}
+
+// NormalizePrivilege upper-cases a privilege and collapses its spaces.
+// ALL PRIVILEGES is shortened to ALL.
+func NormalizePrivilege(privilege string) string {
+	normalized := NormalizeKeyword(privilege)
+	if normalized == "ALL PRIVILEGES" {
+		return "ALL"
+	}
+	return normalized
+}
+
+// IsDatabasePrivilege reports whether privilege is ALL or one of DatabasePrivileges
+func IsDatabasePrivilege(privilege string) bool {
+	normalized := NormalizePrivilege(privilege)
+	if normalized == "ALL" {
+		return true
+	}
+	for _, known := range DatabasePrivileges {
+		if normalized == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Privileges lists database privileges for GRANT and REVOKE
+func Privileges(privileges []string) Fragment {
+	if len(privileges) == 0 {
+		return Fragment{err: fmt.Errorf("no privileges given")}
+	}
+
+	normalized := make([]string, len(privileges))
+	for i, privilege := range privileges {
+		if !IsDatabasePrivilege(privilege) {
+			return Fragment{err: fmt.Errorf("%q is not a database privilege", privilege)}
+		}
+		normalized[i] = NormalizePrivilege(privilege)
+	}
+
+	return Fragment{sql: strings.Join(normalized, ", ")}
+}
+
+// privilegeKeyword matches a privilege name such as REPLICATION CLIENT or
+// BACKUP_ADMIN, after NormalizeKeyword
+var privilegeKeyword = regexp.MustCompile(`^[A-Z_]+( [A-Z_]+)*$`)
+
+// grantClauseWords start the clauses of GRANT and never appear in a
+// privilege name
+var grantClauseWords = map[string]bool{
+	"AS":         true,
+	"FROM":       true,
+	"IDENTIFIED": true,
+	"ON":         true,
+	"REQUIRE":    true,
+	"TO":         true,
+	"WITH":       true,
+}
+
+// NormalizeKeyword upper-cases a keyword and collapses its spaces
+func NormalizeKeyword(keyword string) string {
+	return strings.Join(strings.Fields(strings.ToUpper(keyword)), " ")
+}
+
+// PrivilegeKeywords lists privileges for GRANT on any level, including
+// global and dynamic privileges. Servers differ in the privileges they know,
+// so any name made of letters, underscores and single spaces is accepted and
+// the server rejects the ones it does not know.
+func PrivilegeKeywords(privileges []string) Fragment {
+	if len(privileges) == 0 {
+		return Fragment{err: fmt.Errorf("no privileges given")}
+	}
+
+	normalized := make([]string, len(privileges))
+	for i, privilege := range privileges {
+		normalized[i] = NormalizeKeyword(privilege)
+		if !isPrivilegeKeyword(normalized[i]) {
+			return Fragment{err: fmt.Errorf("%q is not a privilege name", privilege)}
+		}
+	}
+
+	return Fragment{sql: strings.Join(normalized, ", ")}
+}
+
+func isPrivilegeKeyword(privilege string) bool {
+	if !privilegeKeyword.MatchString(privilege) {
+		return false
+	}
+	for _, word := range strings.Fields(privilege) {
+		if grantClauseWords[word] {
+			return false
+		}
+	}
+	return true
+}
+
+// GrantTarget quotes what a GRANT applies to: *.*, db.* or db.table.
+// Database names containing a dot cannot be given.
+func GrantTarget(target string) Fragment {
+	if target == "*.*" {
+		return Fragment{sql: target}
+	}
+
+	parts := strings.SplitN(target, ".", 2)
+	if len(parts) != 2 || parts[0] == "*" {
+		return Fragment{err: fmt.Errorf("invalid grant target %q: must be *.*, db.* or db.table", target)}
+	}
+
+	database, err := Identifier(parts[0]).SQL()
+	if err != nil {
+		return Fragment{err: err}
+	}
+	if parts[1] == "*" {
+		return Fragment{sql: database + ".*"}
+	}
+	table, err := Identifier(parts[1]).SQL()
+	if err != nil {
+		return Fragment{err: err}
+	}
+
+	return Fragment{sql: database + "." + table}
+}
+
+// Account quotes a MySQL account name, user@host
+func Account(user, host string) Fragment {
+	quotedUser, err := Identifier(user).SQL()
+	if err != nil {
+		return Fragment{err: err}
+	}
+	quotedHost, err := Identifier(host).SQL()
+	if err != nil {
+		return Fragment{err: err}
+	}
+
+	return Fragment{sql: quotedUser + "@" + quotedHost}
+}
+
+// Format substitutes each %s verb in format with the next fragment. format
+// itself must be a constant. The first fragment that could not be quoted
+// fails the whole statement.
+func Format(format string, fragments ...Fragment) (string, error) {
+	fragment := Compose(format, fragments...)
+	return fragment.sql, fragment.err
+}
+
+// Compose formats like Format and keeps the result as a fragment of a
+// larger statement, along with the placeholder values of fragments
+func Compose(format string, fragments ...Fragment) Fragment {
+	quoted := make([]interface{}, len(fragments))
+	var args []interface{}
+	for i, fragment := range fragments {
+		if fragment.err != nil {
+			return Fragment{err: fragment.err}
+		}
+		quoted[i] = fragment.sql
+		args = append(args, fragment.args...)
+	}
+
+	return Fragment{sql: fmt.Sprintf(format, quoted...), args: args}
+}
+
+// Execer is satisfied by *sql.DB and *sql.Tx
+type Execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// Exec formats the statement like Format and runs it
+func Exec(db Execer, format string, fragments ...Fragment) error {
+	statement := Compose(format, fragments...)
+	if statement.err != nil {
+		return statement.err
+	}
+
+	// The driver takes every ? for a placeholder, even inside quotes
+	if len(statement.args) > 0 && strings.Count(statement.sql, "?") != len(statement.args) {
+		return fmt.Errorf("names in a statement with a password must not contain ?")
+	}
+
+	_, err := db.Exec(statement.sql, statement.args...)
+	return err
+}
+
+// checkValue rejects values MySQL cannot store in a name or literal.
+// Connections use utf8mb4, and invalid UTF-8 could make the server read an
+// escape character as part of a multi-byte character.
+func checkValue(value string) error {
+	if strings.ContainsRune(value, 0) {
+		return fmt.Errorf("contains a NUL byte")
+	}
+	if !utf8.ValidString(value) {
+		return fmt.Errorf("is not valid UTF-8")
+	}
+	return nil
+}
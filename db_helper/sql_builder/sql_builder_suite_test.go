@@ -0,0 +1,13 @@
+package sql_builder_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestSqlBuilder(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "SQL Builder Suite")
+}
@@ -0,0 +1,278 @@
+package sql_builder_test
+
+import (
+	"errors"
+	"regexp"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/cloudfoundry/galera-init/db_helper/sql_builder"
+)
+
+var _ = Describe("SQL builder", func() {
+	Describe("Identifier", func() {
+		It("quotes names with backticks", func() {
+			Expect(Identifier("some_db").SQL()).To(Equal("`some_db`"))
+		})
+
+		It("doubles backticks so the name cannot end the identifier", func() {
+			Expect(Identifier("db`; DROP DATABASE mysql; -- ").SQL()).To(Equal("`db``; DROP DATABASE mysql; -- `"))
+		})
+
+		It("keeps quotes and backslashes, which have no special meaning in identifiers", func() {
+			Expect(Identifier(`it's\`).SQL()).To(Equal("`it's\\`"))
+		})
+
+		It("rejects an empty name", func() {
+			_, err := Identifier("").SQL()
+			Expect(err).To(MatchError(`invalid identifier "": must not be empty`))
+		})
+
+		It("rejects a NUL byte", func() {
+			_, err := Identifier("db\x00").SQL()
+			Expect(err).To(MatchError(`invalid identifier "db\x00": contains a NUL byte`))
+		})
+
+		It("rejects invalid UTF-8", func() {
+			_, err := Identifier("db\xbf\\").SQL()
+			Expect(err).To(MatchError(`invalid identifier "db\xbf\\": is not valid UTF-8`))
+		})
+	})
+
+	Describe("String", func() {
+		It("quotes literals with single quotes", func() {
+			Expect(String("some password").SQL()).To(Equal("'some password'"))
+		})
+
+		It("doubles single quotes and escapes backslashes", func() {
+			Expect(String(`a'b\'c\`).SQL()).To(Equal(`'a''b\\''c\\'`))
+		})
+
+		It("keeps double quotes, backticks and newlines", func() {
+			Expect(String("\"`\n").SQL()).To(Equal("'\"`\n'"))
+		})
+
+		It("rejects a NUL byte without revealing the value", func() {
+			_, err := String("secret\x00").SQL()
+			Expect(err).To(MatchError("invalid string literal: contains a NUL byte"))
+		})
+
+		It("rejects invalid UTF-8 that could hide an escape character", func() {
+			_, err := String("secret\xbf'").SQL()
+			Expect(err).To(MatchError("invalid string literal: is not valid UTF-8"))
+		})
+	})
+
+	Describe("Password", func() {
+		It("passes the value as a placeholder argument", func() {
+			password := Password(`a'b\c`)
+			Expect(password.SQL()).To(Equal("?"))
+			Expect(password.Args()).To(Equal([]interface{}{`a'b\c`}))
+		})
+
+		It("rejects a NUL byte without revealing the value", func() {
+			_, err := Password("secret\x00").SQL()
+			Expect(err).To(MatchError("invalid password: contains a NUL byte"))
+		})
+	})
+
+	Describe("Account", func() {
+		It("quotes user and host", func() {
+			Expect(Account("some-user", "%").SQL()).To(Equal("`some-user`@`%`"))
+		})
+
+		It("keeps an @ in the user name inside the quotes", func() {
+			Expect(Account("user`@`%", "localhost").SQL()).To(Equal("`user``@``%`@`localhost`"))
+		})
+
+		It("returns the error of an invalid host", func() {
+			_, err := Account("some-user", "").SQL()
+			Expect(err).To(MatchError(`invalid identifier "": must not be empty`))
+		})
+	})
+
+	Describe("Hex", func() {
+		It("writes a hexadecimal literal", func() {
+			Expect(Hex([]byte("$A$005$'\\")).SQL()).To(Equal("0x24412430303524275C"))
+		})
+
+		It("rejects an empty value", func() {
+			_, err := Hex(nil).SQL()
+			Expect(err).To(MatchError("invalid hexadecimal literal: must not be empty"))
+		})
+	})
+
+	Describe("OneOf", func() {
+		It("keeps an allowed keyword", func() {
+			Expect(OneOf("mysql_native_password", "mysql_native_password", "caching_sha2_password").SQL()).To(Equal("mysql_native_password"))
+		})
+
+		It("rejects anything else", func() {
+			_, err := OneOf("mysql_native_password AS ''", "mysql_native_password").SQL()
+			Expect(err).To(MatchError(`"mysql_native_password AS ''" must be one of mysql_native_password`))
+		})
+	})
+
+	Describe("Privileges", func() {
+		It("normalizes and lists the privileges", func() {
+			Expect(Privileges([]string{"select", " show   view ", "ALL PRIVILEGES"}).SQL()).To(Equal("SELECT, SHOW VIEW, ALL"))
+		})
+
+		It("rejects privileges that are not database privileges", func() {
+			_, err := Privileges([]string{"SELECT", "SUPER"}).SQL()
+			Expect(err).To(MatchError(`"SUPER" is not a database privilege`))
+		})
+
+		It("rejects SQL in place of a privilege", func() {
+			_, err := Privileges([]string{"SELECT ON *.* TO root; --"}).SQL()
+			Expect(err).To(MatchError(`"SELECT ON *.* TO root; --" is not a database privilege`))
+		})
+
+		It("rejects an empty list", func() {
+			_, err := Privileges(nil).SQL()
+			Expect(err).To(MatchError("no privileges given"))
+		})
+	})
+
+	Describe("PrivilegeKeywords", func() {
+		It("normalizes and lists global and dynamic privileges", func() {
+			Expect(PrivilegeKeywords([]string{"process", "replication  client", "BACKUP_ADMIN", "ALL PRIVILEGES"}).SQL()).
+				To(Equal("PROCESS, REPLICATION CLIENT, BACKUP_ADMIN, ALL PRIVILEGES"))
+		})
+
+		It("rejects SQL in place of a privilege", func() {
+			_, err := PrivilegeKeywords([]string{"SELECT ON *.* TO root; --"}).SQL()
+			Expect(err).To(MatchError(`"SELECT ON *.* TO root; --" is not a privilege name`))
+		})
+
+		It("rejects GRANT clauses made of plain words", func() {
+			_, err := PrivilegeKeywords([]string{"SELECT ON mysql TO root"}).SQL()
+			Expect(err).To(MatchError(`"SELECT ON mysql TO root" is not a privilege name`))
+		})
+
+		It("rejects an empty list", func() {
+			_, err := PrivilegeKeywords(nil).SQL()
+			Expect(err).To(MatchError("no privileges given"))
+		})
+	})
+
+	Describe("GrantTarget", func() {
+		It("keeps *.*", func() {
+			Expect(GrantTarget("*.*").SQL()).To(Equal("*.*"))
+		})
+
+		It("quotes the database of db.*", func() {
+			Expect(GrantTarget("performance_schema.*").SQL()).To(Equal("`performance_schema`.*"))
+		})
+
+		It("quotes database and table", func() {
+			Expect(GrantTarget("mysql.user`s").SQL()).To(Equal("`mysql`.`user``s`"))
+		})
+
+		It("rejects targets without a database", func() {
+			_, err := GrantTarget("users").SQL()
+			Expect(err).To(MatchError(`invalid grant target "users": must be *.*, db.* or db.table`))
+
+			_, err = GrantTarget("*.users").SQL()
+			Expect(err).To(MatchError(`invalid grant target "*.users": must be *.*, db.* or db.table`))
+		})
+
+		It("returns the error of an invalid name", func() {
+			_, err := GrantTarget(".*").SQL()
+			Expect(err).To(MatchError(`invalid identifier "": must not be empty`))
+		})
+	})
+
+	Describe("Format", func() {
+		It("substitutes the quoted fragments", func() {
+			Expect(Format("GRANT ALL ON %s.* TO %s", Identifier("some_db"), Account("some-user", "%"))).
+				To(Equal("GRANT ALL ON `some_db`.* TO `some-user`@`%`"))
+		})
+
+		It("returns the first fragment error", func() {
+			_, err := Format("CREATE USER %s IDENTIFIED BY %s", Identifier("some-user"), String("\x00"))
+			Expect(err).To(MatchError("invalid string literal: contains a NUL byte"))
+		})
+	})
+
+	Describe("Invalid", func() {
+		It("fails the statement", func() {
+			_, err := Format("CREATE USER %s", Invalid(errors.New("bad account")))
+			Expect(err).To(MatchError("bad account"))
+		})
+	})
+
+	Describe("Compose", func() {
+		It("keeps the formatted SQL as a fragment", func() {
+			clause := Compose("IDENTIFIED BY %s", String("it's"))
+			Expect(Format("CREATE USER %s %s", Account("app", "%"), clause)).To(Equal("CREATE USER `app`@`%` IDENTIFIED BY 'it''s'"))
+		})
+
+		It("keeps the placeholder arguments in order", func() {
+			clause := Compose("IDENTIFIED WITH %s BY %s", OneOf("caching_sha2_password", "caching_sha2_password"), Password("secret"))
+			statement := Compose("ALTER USER %s %s, %s %s", Account("app", "%"), clause, Account("app", "localhost"), Compose("IDENTIFIED BY %s", Password("other")))
+			Expect(statement.SQL()).To(Equal("ALTER USER `app`@`%` IDENTIFIED WITH caching_sha2_password BY ?, `app`@`localhost` IDENTIFIED BY ?"))
+			Expect(statement.Args()).To(Equal([]interface{}{"secret", "other"}))
+		})
+
+		It("keeps the first fragment error", func() {
+			clause := Compose("IDENTIFIED BY %s", String("\x00"))
+			_, err := Format("CREATE USER %s %s", Account("app", "%"), clause)
+			Expect(err).To(MatchError("invalid string literal: contains a NUL byte"))
+		})
+	})
+
+	Describe("Exec", func() {
+		It("runs the formatted statement", func() {
+			db, mock, err := sqlmock.New()
+			Expect(err).NotTo(HaveOccurred())
+
+			mock.ExpectExec(regexp.QuoteMeta("CREATE DATABASE IF NOT EXISTS `some_db`")).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+
+			Expect(Exec(db, "CREATE DATABASE IF NOT EXISTS %s", Identifier("some_db"))).To(Succeed())
+			Expect(mock.ExpectationsWereMet()).To(Succeed())
+		})
+
+		It("passes the placeholder arguments along", func() {
+			db, mock, err := sqlmock.New()
+			Expect(err).NotTo(HaveOccurred())
+
+			mock.ExpectExec(regexp.QuoteMeta("SET PASSWORD FOR `app`@`%` = ?")).
+				WithArgs(`back\slash`).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+
+			Expect(Exec(db, "SET PASSWORD FOR %s = %s", Account("app", "%"), Password(`back\slash`))).To(Succeed())
+			Expect(mock.ExpectationsWereMet()).To(Succeed())
+		})
+
+		It("does not run a statement with a password and a ? in a name", func() {
+			db, mock, err := sqlmock.New()
+			Expect(err).NotTo(HaveOccurred())
+
+			err = Exec(db, "CREATE USER %s IDENTIFIED BY %s", Account("what?", "%"), Password("secret"))
+			Expect(err).To(MatchError("names in a statement with a password must not contain ?"))
+			Expect(mock.ExpectationsWereMet()).To(Succeed())
+		})
+
+		It("does not run a statement that could not be quoted", func() {
+			db, mock, err := sqlmock.New()
+			Expect(err).NotTo(HaveOccurred())
+
+			err = Exec(db, "CREATE DATABASE IF NOT EXISTS %s", Identifier(""))
+			Expect(err).To(HaveOccurred())
+			Expect(mock.ExpectationsWereMet()).To(Succeed())
+		})
+
+		It("returns the error of the statement", func() {
+			db, mock, err := sqlmock.New()
+			Expect(err).NotTo(HaveOccurred())
+
+			mock.ExpectExec("CREATE DATABASE").WillReturnError(errors.New("some error"))
+
+			Expect(Exec(db, "CREATE DATABASE IF NOT EXISTS %s", Identifier("some_db"))).To(MatchError("some error"))
+		})
+	})
+})
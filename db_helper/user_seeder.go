@@ -6,99 +6,105 @@ import (
 	"fmt"
 
 	"code.cloudfoundry.org/lager"
+
+	"github.com/cloudfoundry/galera-init/config"
+	"github.com/cloudfoundry/galera-init/db_helper/auth"
+	"github.com/cloudfoundry/galera-init/db_helper/sql_builder"
 )
 
 //go:generate go run github.com/maxbrunsfeld/counterfeiter/v6 . UserSeeder
 type UserSeeder interface {
-	SeedUser(username string, password string, host string, role string) error
+	SeedUser(user config.SeededUser, host string) error
 }
 
 type userSeeder struct {
 	db     *sql.DB
+	roles  RoleCatalog
 	logger lager.Logger
 }
 
-func NewUserSeeder(db *sql.DB, logger lager.Logger) UserSeeder {
+func NewUserSeeder(db *sql.DB, roles RoleCatalog, logger lager.Logger) UserSeeder {
 	return &userSeeder{
 		db:     db,
+		roles:  roles,
 		logger: logger,
 	}
 }
 
-func (seeder userSeeder) SeedUser(user string, password string, host string, role string) error {
-	roleQuery, err := getRoleQuery(role)
-	if err != nil {
+// SeedUser creates or updates the user's account for host, one of the
+// user's hosts, and gives it the user's role
+func (seeder userSeeder) SeedUser(user config.SeededUser, host string) error {
+	userRole, ok := seeder.roles[user.Role]
+	if !ok {
+		err := errors.New(fmt.Sprintf("Invalid role: %s", user.Role))
 		seeder.logger.Error("Invalid role", err, lager.Data{
-			"user": user,
-			"role": role,
+			"user": user.User,
+			"role": user.Role,
 		})
 		return err
 	}
 
-	hostString, err := getHostString(host)
+	hostString, err := config.AccountHost(host)
 	if err != nil {
 		seeder.logger.Error("Invalid host", err, lager.Data{
-			"user": user,
+			"user": user.User,
 			"host": host,
 		})
 		return err
 	}
 
-	_, err = seeder.db.Exec(fmt.Sprintf(
-		"CREATE USER IF NOT EXISTS `%s`@`%s` IDENTIFIED BY '%s'",
-		user,
-		hostString,
-		password))
+	account := sql_builder.Account(user.User, hostString)
+	identified := auth.Identified(user.AuthPlugin, user.Password, user.PasswordHash)
+
+	err = sql_builder.Exec(seeder.db, "CREATE USER IF NOT EXISTS %s %s", account, identified)
 	if err != nil {
 		seeder.logger.Error("Error creating user", err, lager.Data{
-			"user": user,
+			"user": user.User,
 		})
 		return err
 	}
 
-	_, err = seeder.db.Exec(fmt.Sprintf(
-		"ALTER USER `%s`@`%s` IDENTIFIED BY '%s'",
-		user,
-		hostString,
-		password))
+	err = sql_builder.Exec(seeder.db, "ALTER USER %s %s", account, identified)
 	if err != nil {
 		seeder.logger.Error("Error updating user password", err, lager.Data{
-			"user": user,
+			"user": user.User,
 		})
 		return err
 	}
 
-	_, err = seeder.db.Exec(fmt.Sprintf(
-		roleQuery,
-		user,
-		hostString))
+	err = seeder.grantRole(account, userRole)
 	if err != nil {
 		seeder.logger.Error("Error changing grants on user", err, lager.Data{
-			"user": user,
+			"user": user.User,
+			"role": user.Role,
 		})
 		return err
 	}
 	return nil
 }
 
-func getRoleQuery(role string) (string, error) {
-	if role == "admin" {
-		return "GRANT ALL PRIVILEGES ON *.* TO `%s`@`%s` WITH GRANT OPTION", nil
-	} else if role == "minimal" {
-		return "REVOKE ALL PRIVILEGES ON *.* FROM `%s`@`%s`", nil
+func (seeder userSeeder) grantRole(account sql_builder.Fragment, role Role) error {
+	if role.Revoke != "" {
+		if err := sql_builder.Exec(seeder.db, role.Revoke, account); err != nil {
+			return err
+		}
 	}
-	return "", errors.New(fmt.Sprintf("Invalid role: %s", role))
-}
 
-func getHostString(host string) (string, error) {
-	switch host {
-	case "localhost":
-		return "localhost", nil
-	case "loopback":
-		return "127.0.0.1", nil
-	case "any":
-		return "%", nil
-	default:
-		return "", errors.New(fmt.Sprintf("Invalid host: %s", host))
+	for _, grant := range role.Grants {
+		query := "GRANT %s ON %s TO %s"
+		if grant.WithGrantOption {
+			query += " WITH GRANT OPTION"
+		}
+
+		err := sql_builder.Exec(seeder.db, query,
+			sql_builder.PrivilegeKeywords(grant.Privileges),
+			sql_builder.GrantTarget(grant.On),
+			account,
+		)
+		if err != nil {
+			return err
+		}
 	}
+
+	return nil
 }
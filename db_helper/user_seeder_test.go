@@ -2,13 +2,17 @@ package db_helper_test
 
 import (
 	"database/sql"
+	"errors"
+	"regexp"
 
 	"code.cloudfoundry.org/lager/lagertest"
 	"github.com/DATA-DOG/go-sqlmock"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
+	"github.com/cloudfoundry/galera-init/config"
 	"github.com/cloudfoundry/galera-init/db_helper"
+	"github.com/cloudfoundry/galera-init/db_helper/auth"
 )
 
 var _ = Describe("User Seeder", func() {
@@ -26,7 +30,15 @@ var _ = Describe("User Seeder", func() {
 		fakeDB, mock, err = sqlmock.New()
 		Expect(err).ToNot(HaveOccurred())
 
-		userSeeder = db_helper.NewUserSeeder(fakeDB, testLogger)
+		roles := db_helper.NewRoleCatalog(db_helper.PXCFlavor{}, "8.0.20-11", []config.Role{{
+			Name: "schema-migrator",
+			Grants: []config.RoleGrant{
+				{Privileges: []string{"alter", "create"}, On: "app.*"},
+				{Privileges: []string{"SELECT"}, On: "mysql.help_topic", WithGrantOption: true},
+			},
+		}})
+
+		userSeeder = db_helper.NewUserSeeder(fakeDB, roles, testLogger)
 	})
 
 	AfterEach(func() {
@@ -35,79 +47,247 @@ var _ = Describe("User Seeder", func() {
 
 	Describe("SeedUser", func() {
 		It("creates the user", func() {
-			mock.ExpectExec("CREATE USER IF NOT EXISTS `username`@`127.0.0.1` IDENTIFIED BY 'password'").
+			mock.ExpectExec("CREATE USER IF NOT EXISTS `username`@`127.0.0.1` IDENTIFIED BY \\?").
+				WithArgs("password").
 				WillReturnResult(sqlmock.NewResult(1, 1))
-			mock.ExpectExec("ALTER USER `username`@`127.0.0.1` IDENTIFIED BY 'password'").
+			mock.ExpectExec("ALTER USER `username`@`127.0.0.1` IDENTIFIED BY \\?").
+				WithArgs("password").
 				WillReturnResult(sqlmock.NewResult(1, 1))
 
-			userSeeder.SeedUser("username", "password", "loopback", "admin")
+			userSeeder.SeedUser(config.SeededUser{User: "username", Password: "password", Role: "admin"}, "loopback")
 		})
 
 		It("grants full access when the role is admin", func() {
-			mock.ExpectExec("CREATE USER IF NOT EXISTS `username`@`127.0.0.1` IDENTIFIED BY 'password'").
+			mock.ExpectExec("CREATE USER IF NOT EXISTS `username`@`127.0.0.1` IDENTIFIED BY \\?").
+				WithArgs("password").
 				WillReturnResult(sqlmock.NewResult(1, 1))
-			mock.ExpectExec("ALTER USER `username`@`127.0.0.1` IDENTIFIED BY 'password'").
+			mock.ExpectExec("ALTER USER `username`@`127.0.0.1` IDENTIFIED BY \\?").
+				WithArgs("password").
 				WillReturnResult(sqlmock.NewResult(1, 1))
 			mock.ExpectExec("GRANT ALL PRIVILEGES ON *.* TO `username`@`127.0.0.1` WITH GRANT OPTION").
 				WillReturnResult(sqlmock.NewResult(1, 1))
 
-			userSeeder.SeedUser("username", "password", "loopback", "admin")
+			userSeeder.SeedUser(config.SeededUser{User: "username", Password: "password", Role: "admin"}, "loopback")
 		})
 
 		It("grants no access when the role is minimal", func() {
-			mock.ExpectExec("CREATE USER IF NOT EXISTS `username`@`127.0.0.1` IDENTIFIED BY 'password'").
+			mock.ExpectExec("CREATE USER IF NOT EXISTS `username`@`127.0.0.1` IDENTIFIED BY \\?").
+				WithArgs("password").
 				WillReturnResult(sqlmock.NewResult(1, 1))
-			mock.ExpectExec("ALTER USER `username`@`127.0.0.1` IDENTIFIED BY 'password'").
+			mock.ExpectExec("ALTER USER `username`@`127.0.0.1` IDENTIFIED BY \\?").
+				WithArgs("password").
 				WillReturnResult(sqlmock.NewResult(1, 1))
 			mock.ExpectExec("REVOKE ALL PRIVILEGES ON *.* FROM `username`@`127.0.0.1`").
 				WillReturnResult(sqlmock.NewResult(1, 1))
 
-			userSeeder.SeedUser("username", "password", "loopback", "minimal")
+			userSeeder.SeedUser(config.SeededUser{User: "username", Password: "password", Role: "minimal"}, "loopback")
+		})
+
+		Describe("roles that replace every privilege", func() {
+			expectUser := func() {
+				mock.ExpectExec(regexp.QuoteMeta("CREATE USER IF NOT EXISTS `username`@`%` IDENTIFIED BY ?")).
+					WithArgs("password").
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(regexp.QuoteMeta("ALTER USER `username`@`%` IDENTIFIED BY ?")).
+					WithArgs("password").
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(regexp.QuoteMeta("REVOKE ALL PRIVILEGES, GRANT OPTION FROM `username`@`%`")).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+			}
+
+			expectGrant := func(query string) {
+				mock.ExpectExec(regexp.QuoteMeta(query)).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+			}
+
+			It("grants process and replication status and performance_schema to monitoring", func() {
+				expectUser()
+				expectGrant("GRANT PROCESS, REPLICATION CLIENT ON *.* TO `username`@`%`")
+				expectGrant("GRANT SELECT ON `performance_schema`.* TO `username`@`%`")
+
+				Expect(userSeeder.SeedUser(config.SeededUser{User: "username", Password: "password", Role: "monitoring"}, "any")).To(Succeed())
+			})
+
+			It("grants the flavor's backup privileges to backup", func() {
+				expectUser()
+				expectGrant("GRANT RELOAD, LOCK TABLES, PROCESS, REPLICATION CLIENT, BACKUP_ADMIN ON *.* TO `username`@`%`")
+
+				Expect(userSeeder.SeedUser(config.SeededUser{User: "username", Password: "password", Role: "backup"}, "any")).To(Succeed())
+			})
+
+			It("leaves BACKUP_ADMIN out of backup on PXC 5.7, which does not know it", func() {
+				roles := db_helper.NewRoleCatalog(db_helper.PXCFlavor{}, "5.7.28-31-57-log", nil)
+				userSeeder = db_helper.NewUserSeeder(fakeDB, roles, testLogger)
+
+				expectUser()
+				expectGrant("GRANT RELOAD, LOCK TABLES, PROCESS, REPLICATION CLIENT ON *.* TO `username`@`%`")
+
+				Expect(userSeeder.SeedUser(config.SeededUser{User: "username", Password: "password", Role: "backup"}, "any")).To(Succeed())
+			})
+
+			It("leaves BACKUP_ADMIN out of backup on MariaDB", func() {
+				roles := db_helper.NewRoleCatalog(db_helper.MariaDBFlavor{}, "10.5.8-MariaDB-log", nil)
+				userSeeder = db_helper.NewUserSeeder(fakeDB, roles, testLogger)
+
+				expectUser()
+				expectGrant("GRANT RELOAD, LOCK TABLES, PROCESS, REPLICATION CLIENT ON *.* TO `username`@`%`")
+
+				Expect(userSeeder.SeedUser(config.SeededUser{User: "username", Password: "password", Role: "backup"}, "any")).To(Succeed())
+			})
+
+			It("grants replication privileges to replication", func() {
+				expectUser()
+				expectGrant("GRANT REPLICATION SLAVE, REPLICATION CLIENT ON *.* TO `username`@`%`")
+
+				Expect(userSeeder.SeedUser(config.SeededUser{User: "username", Password: "password", Role: "replication"}, "any")).To(Succeed())
+			})
+
+			It("grants SELECT and SHOW VIEW on everything to read-only", func() {
+				expectUser()
+				expectGrant("GRANT SELECT, SHOW VIEW ON *.* TO `username`@`%`")
+
+				Expect(userSeeder.SeedUser(config.SeededUser{User: "username", Password: "password", Role: "read-only"}, "any")).To(Succeed())
+			})
+
+			It("grants the grants of a role from config", func() {
+				expectUser()
+				expectGrant("GRANT ALTER, CREATE ON `app`.* TO `username`@`%`")
+				expectGrant("GRANT SELECT ON `mysql`.`help_topic` TO `username`@`%` WITH GRANT OPTION")
+
+				Expect(userSeeder.SeedUser(config.SeededUser{User: "username", Password: "password", Role: "schema-migrator"}, "any")).To(Succeed())
+			})
+
+			It("stops at the first grant that fails", func() {
+				expectUser()
+				mock.ExpectExec(regexp.QuoteMeta("GRANT PROCESS, REPLICATION CLIENT ON *.* TO `username`@`%`")).
+					WillReturnError(errors.New("grant failed"))
+
+				Expect(userSeeder.SeedUser(config.SeededUser{User: "username", Password: "password", Role: "monitoring"}, "any")).To(MatchError("grant failed"))
+			})
 		})
 
 		It("errors when the role in unknown", func() {
-			err := userSeeder.SeedUser("username", "password", "loopback", "foo")
+			err := userSeeder.SeedUser(config.SeededUser{User: "username", Password: "password", Role: "foo"}, "loopback")
 			Expect(err).To(HaveOccurred())
 			Expect(err).To(MatchError("Invalid role: foo"))
 		})
 
 		It("scopes grants to 127.0.0.1 correctly", func() {
-			mock.ExpectExec("CREATE USER IF NOT EXISTS `username`@`127.0.0.1` IDENTIFIED BY 'password'").
+			mock.ExpectExec("CREATE USER IF NOT EXISTS `username`@`127.0.0.1` IDENTIFIED BY \\?").
+				WithArgs("password").
 				WillReturnResult(sqlmock.NewResult(1, 1))
-			mock.ExpectExec("ALTER USER `username`@`127.0.0.1` IDENTIFIED BY 'password'").
+			mock.ExpectExec("ALTER USER `username`@`127.0.0.1` IDENTIFIED BY \\?").
+				WithArgs("password").
 				WillReturnResult(sqlmock.NewResult(1, 1))
 			mock.ExpectExec("REVOKE ALL PRIVILEGES ON *.* FROM `username`@`127.0.0.1`").
 				WillReturnResult(sqlmock.NewResult(1, 1))
 
-			userSeeder.SeedUser("username", "password", "loopback", "minimal")
+			userSeeder.SeedUser(config.SeededUser{User: "username", Password: "password", Role: "minimal"}, "loopback")
 		})
 
 		It("scopes grants to any correctly", func() {
-			mock.ExpectExec("CREATE USER IF NOT EXISTS `username`@`%` IDENTIFIED BY 'password'").
+			mock.ExpectExec("CREATE USER IF NOT EXISTS `username`@`%` IDENTIFIED BY \\?").
+				WithArgs("password").
 				WillReturnResult(sqlmock.NewResult(1, 1))
-			mock.ExpectExec("ALTER USER `username`@`%` IDENTIFIED BY 'password'").
+			mock.ExpectExec("ALTER USER `username`@`%` IDENTIFIED BY \\?").
+				WithArgs("password").
 				WillReturnResult(sqlmock.NewResult(1, 1))
 			mock.ExpectExec("REVOKE ALL PRIVILEGES ON *.* FROM `username`@`%`").
 				WillReturnResult(sqlmock.NewResult(1, 1))
 
-			userSeeder.SeedUser("username", "password", "any", "minimal")
+			userSeeder.SeedUser(config.SeededUser{User: "username", Password: "password", Role: "minimal"}, "any")
 		})
 
 		It("scopes grants to any correctly", func() {
-			mock.ExpectExec("CREATE USER IF NOT EXISTS `username`@`localhost` IDENTIFIED BY 'password'").
+			mock.ExpectExec("CREATE USER IF NOT EXISTS `username`@`localhost` IDENTIFIED BY \\?").
+				WithArgs("password").
 				WillReturnResult(sqlmock.NewResult(1, 1))
-			mock.ExpectExec("ALTER USER `username`@`localhost` IDENTIFIED BY 'password'").
+			mock.ExpectExec("ALTER USER `username`@`localhost` IDENTIFIED BY \\?").
+				WithArgs("password").
 				WillReturnResult(sqlmock.NewResult(1, 1))
 			mock.ExpectExec("REVOKE ALL PRIVILEGES ON *.* FROM `username`@`localhost`").
 				WillReturnResult(sqlmock.NewResult(1, 1))
 
-			userSeeder.SeedUser("username", "password", "localhost", "minimal")
+			userSeeder.SeedUser(config.SeededUser{User: "username", Password: "password", Role: "minimal"}, "localhost")
 		})
 
-		It("errors when the host in unknown", func() {
-			err := userSeeder.SeedUser("username", "password", "unknown", "admin")
-			Expect(err).To(HaveOccurred())
-			Expect(err).To(MatchError("Invalid host: unknown"))
+		It("creates the account for a literal host", func() {
+			mock.ExpectExec(regexp.QuoteMeta("CREATE USER IF NOT EXISTS `username`@`proxy.internal` IDENTIFIED BY ?")).
+				WithArgs("password").
+				WillReturnResult(sqlmock.NewResult(1, 1))
+			mock.ExpectExec(regexp.QuoteMeta("ALTER USER `username`@`proxy.internal` IDENTIFIED BY ?")).
+				WithArgs("password").
+				WillReturnResult(sqlmock.NewResult(1, 1))
+			mock.ExpectExec(regexp.QuoteMeta("REVOKE ALL PRIVILEGES ON *.* FROM `username`@`proxy.internal`")).
+				WillReturnResult(sqlmock.NewResult(1, 1))
+
+			Expect(userSeeder.SeedUser(config.SeededUser{User: "username", Password: "password", Role: "minimal"}, "proxy.internal")).To(Succeed())
+		})
+
+		It("creates the account for a wildcard pattern", func() {
+			mock.ExpectExec(regexp.QuoteMeta("CREATE USER IF NOT EXISTS `username`@`10.0.%` IDENTIFIED BY ?")).
+				WithArgs("password").
+				WillReturnResult(sqlmock.NewResult(1, 1))
+			mock.ExpectExec(regexp.QuoteMeta("ALTER USER `username`@`10.0.%` IDENTIFIED BY ?")).
+				WithArgs("password").
+				WillReturnResult(sqlmock.NewResult(1, 1))
+			mock.ExpectExec(regexp.QuoteMeta("REVOKE ALL PRIVILEGES ON *.* FROM `username`@`10.0.%`")).
+				WillReturnResult(sqlmock.NewResult(1, 1))
+
+			Expect(userSeeder.SeedUser(config.SeededUser{User: "username", Password: "password", Role: "minimal"}, "10.0.%")).To(Succeed())
+		})
+
+		It("creates the account for a network with its netmask", func() {
+			mock.ExpectExec(regexp.QuoteMeta("CREATE USER IF NOT EXISTS `username`@`10.0.0.0/255.255.0.0` IDENTIFIED BY ?")).
+				WithArgs("password").
+				WillReturnResult(sqlmock.NewResult(1, 1))
+			mock.ExpectExec(regexp.QuoteMeta("ALTER USER `username`@`10.0.0.0/255.255.0.0` IDENTIFIED BY ?")).
+				WithArgs("password").
+				WillReturnResult(sqlmock.NewResult(1, 1))
+			mock.ExpectExec(regexp.QuoteMeta("REVOKE ALL PRIVILEGES ON *.* FROM `username`@`10.0.0.0/255.255.0.0`")).
+				WillReturnResult(sqlmock.NewResult(1, 1))
+
+			Expect(userSeeder.SeedUser(config.SeededUser{User: "username", Password: "password", Role: "minimal"}, "10.0.0.0/16")).To(Succeed())
+		})
+
+		It("errors when the host is malformed", func() {
+			err := userSeeder.SeedUser(config.SeededUser{User: "username", Password: "password", Role: "admin"}, "10.0.0.0/33")
+			Expect(err).To(MatchError(`Invalid host "10.0.0.0/33": the prefix length must be between 0 and 32`))
+		})
+
+		It("gives the user a password hash", func() {
+			hash := auth.CachingSHA2PasswordHash("password", []byte("abcdefghij0123456789"))
+			user := config.SeededUser{User: "username", AuthPlugin: "caching_sha2_password", PasswordHash: hash, Role: "minimal"}
+
+			mock.ExpectExec(regexp.QuoteMeta("CREATE USER IF NOT EXISTS `username`@`localhost` IDENTIFIED WITH caching_sha2_password AS " + hash)).
+				WillReturnResult(sqlmock.NewResult(1, 1))
+			mock.ExpectExec(regexp.QuoteMeta("ALTER USER `username`@`localhost` IDENTIFIED WITH caching_sha2_password AS " + hash)).
+				WillReturnResult(sqlmock.NewResult(1, 1))
+			mock.ExpectExec(regexp.QuoteMeta("REVOKE ALL PRIVILEGES ON *.* FROM `username`@`localhost`")).
+				WillReturnResult(sqlmock.NewResult(1, 1))
+
+			Expect(userSeeder.SeedUser(user, "localhost")).To(Succeed())
+		})
+
+		It("quotes hostile user names and passes passwords as they are", func() {
+			user := "admin`@`%` IDENTIFIED BY 'x'; -- "
+			password := `it's a \' trap`
+
+			mock.ExpectExec(regexp.QuoteMeta("CREATE USER IF NOT EXISTS `admin``@``%`` IDENTIFIED BY 'x'; -- `@`localhost` IDENTIFIED BY ?")).
+				WithArgs(password).
+				WillReturnResult(sqlmock.NewResult(1, 1))
+			mock.ExpectExec(regexp.QuoteMeta("ALTER USER `admin``@``%`` IDENTIFIED BY 'x'; -- `@`localhost` IDENTIFIED BY ?")).
+				WithArgs(password).
+				WillReturnResult(sqlmock.NewResult(1, 1))
+			mock.ExpectExec(regexp.QuoteMeta("REVOKE ALL PRIVILEGES ON *.* FROM `admin``@``%`` IDENTIFIED BY 'x'; -- `@`localhost`")).
+				WillReturnResult(sqlmock.NewResult(1, 1))
+
+			Expect(userSeeder.SeedUser(config.SeededUser{User: user, Password: password, Role: "minimal"}, "localhost")).To(Succeed())
+		})
+
+		It("does not run any statement when the password cannot be passed", func() {
+			err := userSeeder.SeedUser(config.SeededUser{User: "username", Password: "pass\x00word", Role: "minimal"}, "localhost")
+			Expect(err).To(MatchError("invalid password: contains a NUL byte"))
 		})
 	})
 })
@@ -1,26 +1,85 @@
 package galera_init_status_server
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
 	"net"
 	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/cloudfoundry/galera-init/config"
+	"github.com/cloudfoundry/galera-init/grastate"
+	"github.com/cloudfoundry/galera-init/os_helper"
+	"github.com/cloudfoundry/galera-init/start_manager/node_state"
+	"github.com/cloudfoundry/galera-init/upgrader"
 )
 
+const InitialPhase = "initializing"
+
 type GaleraInitStatusServer struct {
-	listener net.Listener
+	listener       net.Listener
+	osHelper       os_helper.OsHelper
+	nodeID         string
+	managerConfig  config.StartManager
+	upgraderConfig config.Upgrader
+	done           int32
+	phaseMutex     sync.Mutex
+	phase          string
+	position       grastate.Grastate
+}
+
+// NodeState is served on /state so peers and operators can coordinate bootstrapping
+type NodeState struct {
+	NodeID          string        `json:"node_id"`
+	State           string        `json:"state"`
+	UUID            string        `json:"uuid"`
+	Seqno           int64         `json:"seqno"`
+	SafeToBootstrap bool          `json:"safe_to_bootstrap"`
+	Phase           string        `json:"phase"`
+	Version         string        `json:"version"`
+	Upgrade         UpgradeStatus `json:"upgrade"`
 }
 
-func NewGaleraInitStatusServer(listener net.Listener) *GaleraInitStatusServer {
+// UpgradeStatus reports whether this node is upgrading its data directory, or
+// was interrupted while doing so
+type UpgradeStatus struct {
+	InProgress          bool   `json:"in_progress"`
+	FromVersion         string `json:"from_version,omitempty"`
+	ToVersion           string `json:"to_version,omitempty"`
+	Attempts            int    `json:"attempts,omitempty"`
+	LastUpgradedVersion string `json:"last_upgraded_version"`
+}
+
+func NewGaleraInitStatusServer(
+	listener net.Listener,
+	osHelper os_helper.OsHelper,
+	nodeID string,
+	managerConfig config.StartManager,
+	upgraderConfig config.Upgrader,
+) *GaleraInitStatusServer {
 	return &GaleraInitStatusServer{
-		listener: listener,
+		listener:       listener,
+		osHelper:       osHelper,
+		nodeID:         nodeID,
+		managerConfig:  managerConfig,
+		upgraderConfig: upgraderConfig,
+		phase:          InitialPhase,
 	}
 }
 
-func (s GaleraInitStatusServer) Start() error {
+// Serve begins answering requests in the background. Until Start is called,
+// / reports that galera-init is still in progress.
+func (s *GaleraInitStatusServer) Serve() {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.Status)
+	mux.HandleFunc("/state", s.State)
+
 	server := &http.Server{
-		Handler:        http.HandlerFunc(s.Status),
+		Handler:        mux,
 		ReadTimeout:    10 * time.Second,
 		WriteTimeout:   10 * time.Second,
 		MaxHeaderBytes: 1 << 20,
@@ -29,10 +88,150 @@ func (s GaleraInitStatusServer) Start() error {
 	go func() {
 		log.Fatal(server.Serve(s.listener))
 	}()
+}
 
+// Start marks galera-init as done
+func (s *GaleraInitStatusServer) Start() error {
+	atomic.StoreInt32(&s.done, 1)
 	return nil
 }
 
-func (s GaleraInitStatusServer) Status(w http.ResponseWriter, r *http.Request) {
+// SetPhase records the startup phase galera-init is currently in. The
+// position in grastate.dat is remembered as well, because galera replaces
+// the seqno with -1 once mysqld starts and peers still compare against it.
+func (s *GaleraInitStatusServer) SetPhase(phase string) {
+	position := s.readPosition()
+
+	s.phaseMutex.Lock()
+	defer s.phaseMutex.Unlock()
+	s.phase = phase
+	if position.HasKnownPosition() {
+		s.position = position
+	}
+}
+
+func (s *GaleraInitStatusServer) currentPhase() (string, grastate.Grastate) {
+	s.phaseMutex.Lock()
+	defer s.phaseMutex.Unlock()
+	return s.phase, s.position
+}
+
+func (s *GaleraInitStatusServer) readPosition() grastate.Grastate {
+	contents, err := s.readOptionalFile(s.managerConfig.GrastateFileLocation)
+	if err != nil {
+		return grastate.Grastate{}
+	}
+
+	g, err := grastate.Parse(contents)
+	if err != nil {
+		return grastate.Grastate{}
+	}
+	return g
+}
+
+func (s *GaleraInitStatusServer) Status(w http.ResponseWriter, r *http.Request) {
+	if atomic.LoadInt32(&s.done) == 0 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintf(w, "galera init in progress")
+		return
+	}
+
 	fmt.Fprintf(w, "galera init done")
 }
+
+func (s *GaleraInitStatusServer) State(w http.ResponseWriter, r *http.Request) {
+	phase, lastPosition := s.currentPhase()
+	state := NodeState{
+		NodeID: s.nodeID,
+		Phase:  phase,
+	}
+
+	stateFileContents, err := s.readOptionalFile(s.managerConfig.StateFileLocation)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	stateFile, err := node_state.Parse(stateFileContents)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	state.State = stateFile.State
+
+	state.Version, err = s.readOptionalFile(s.upgraderConfig.PackageVersionFile)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	state.Upgrade, err = s.upgradeStatus()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	contents, err := s.readOptionalFile(s.managerConfig.GrastateFileLocation)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	g, err := grastate.Parse(contents)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	state.UUID = g.UUID
+	state.Seqno = g.Seqno
+	if !g.HasKnownPosition() && g.UUID == lastPosition.UUID && lastPosition.HasKnownPosition() {
+		state.Seqno = lastPosition.Seqno
+	}
+	state.SafeToBootstrap = g.SafeToBootstrap
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(state)
+}
+
+func (s *GaleraInitStatusServer) upgradeStatus() (UpgradeStatus, error) {
+	var status UpgradeStatus
+
+	lastUpgradedVersion, err := s.readOptionalFile(s.upgraderConfig.LastUpgradedVersionFile)
+	if err != nil {
+		return status, err
+	}
+	// mysql_upgrade_info is NUL terminated
+	status.LastUpgradedVersion = strings.TrimRight(lastUpgradedVersion, "\x00")
+
+	markerContents, err := s.readOptionalFile(upgrader.UpgradeMarkerPath(s.upgraderConfig))
+	if err != nil {
+		return status, err
+	}
+	if markerContents == "" {
+		return status, nil
+	}
+
+	// A marker that cannot be parsed still means an upgrade is unfinished
+	status.InProgress = true
+	var marker upgrader.UpgradeMarker
+	if json.Unmarshal([]byte(markerContents), &marker) == nil {
+		status.FromVersion = marker.FromVersion
+		status.ToVersion = marker.ToVersion
+		status.Attempts = marker.Attempts
+	}
+
+	return status, nil
+}
+
+func (s *GaleraInitStatusServer) readOptionalFile(filename string) (string, error) {
+	if !s.osHelper.FileExists(filename) {
+		return "", nil
+	}
+
+	contents, err := s.osHelper.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(contents), nil
+}
@@ -1,28 +1,157 @@
 package galera_init_status_server_test
 
 import (
-	"github.com/cloudfoundry/galera-init/galera_init_status_server"
-	. "github.com/onsi/ginkgo"
-	. "github.com/onsi/gomega"
+	"encoding/json"
 	"net"
 	"net/http"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/cloudfoundry/galera-init/config"
+	"github.com/cloudfoundry/galera-init/galera_init_status_server"
+	"github.com/cloudfoundry/galera-init/os_helper/os_helperfakes"
 )
 
 var _ = Describe("GaleraInitStatusServer", func() {
 	var (
 		serviceStatusServer *galera_init_status_server.GaleraInitStatusServer
+		fakeOs              *os_helperfakes.FakeOsHelper
+		baseURL             string
+		files               map[string]string
 	)
 
 	BeforeEach(func() {
-		listener, err := net.Listen("tcp", "127.0.0.1:8999")
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
 		Expect(err).ToNot(HaveOccurred())
-		serviceStatusServer = galera_init_status_server.NewGaleraInitStatusServer(listener)
+		baseURL = "http://" + listener.Addr().String()
+
+		files = map[string]string{}
+		fakeOs = new(os_helperfakes.FakeOsHelper)
+		fakeOs.FileExistsStub = func(filename string) bool {
+			_, ok := files[filename]
+			return ok
+		}
+		fakeOs.ReadFileStub = func(filename string) (string, error) {
+			return files[filename], nil
+		}
+
+		serviceStatusServer = galera_init_status_server.NewGaleraInitStatusServer(
+			listener,
+			fakeOs,
+			"some-node-id",
+			config.StartManager{
+				StateFileLocation:    "/some/state.txt",
+				GrastateFileLocation: "/some/grastate.dat",
+			},
+			config.Upgrader{
+				PackageVersionFile:      "/some/VERSION",
+				LastUpgradedVersionFile: "/some/mysql_upgrade_info",
+			},
+		)
+		serviceStatusServer.Serve()
+	})
+
+	It("reports galera init as in progress until it is started", func() {
+		resp, err := http.Get(baseURL)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusServiceUnavailable))
 	})
 
 	It("start a service status server listen on the port configured", func() {
 		Expect(serviceStatusServer.Start()).To(Succeed())
-		resp, err := http.Get("http://127.0.0.1:8999")
+		resp, err := http.Get(baseURL)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(resp.StatusCode).To(Equal(http.StatusOK))
 	})
+
+	Describe("/state", func() {
+		getState := func() galera_init_status_server.NodeState {
+			resp, err := http.Get(baseURL + "/state")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			defer resp.Body.Close()
+
+			var state galera_init_status_server.NodeState
+			Expect(json.NewDecoder(resp.Body).Decode(&state)).To(Succeed())
+			return state
+		}
+
+		It("reports the node state, grastate position and version before galera init is done", func() {
+			files["/some/state.txt"] = "CLUSTERED\n"
+			files["/some/grastate.dat"] = "uuid: some-uuid\nseqno: 42\nsafe_to_bootstrap: 1\n"
+			files["/some/VERSION"] = "5.7.28-31.41\n"
+
+			Expect(getState()).To(Equal(galera_init_status_server.NodeState{
+				NodeID:          "some-node-id",
+				State:           "CLUSTERED",
+				UUID:            "some-uuid",
+				Seqno:           42,
+				SafeToBootstrap: true,
+				Phase:           "initializing",
+				Version:         "5.7.28-31.41",
+			}))
+		})
+
+		It("reports the version the data directory was last upgraded to", func() {
+			files["/some/mysql_upgrade_info"] = "5.7.27-31.39\x00"
+
+			Expect(getState().Upgrade).To(Equal(galera_init_status_server.UpgradeStatus{
+				LastUpgradedVersion: "5.7.27-31.39",
+			}))
+		})
+
+		It("reports an upgrade that is in progress", func() {
+			files["/some/mysql_upgrade_info"] = "5.7.27-31.39"
+			files["/some/galera-init-upgrade-in-progress.json"] = `{"from_version":"5.7.27-31.39","to_version":"5.7.28-31.41","strategy":"mysql_upgrade","attempts":2}`
+
+			Expect(getState().Upgrade).To(Equal(galera_init_status_server.UpgradeStatus{
+				InProgress:          true,
+				FromVersion:         "5.7.27-31.39",
+				ToVersion:           "5.7.28-31.41",
+				Attempts:            2,
+				LastUpgradedVersion: "5.7.27-31.39",
+			}))
+		})
+
+		It("reports an upgrade as in progress when its marker cannot be parsed", func() {
+			files["/some/galera-init-upgrade-in-progress.json"] = "garbage"
+
+			Expect(getState().Upgrade).To(Equal(galera_init_status_server.UpgradeStatus{
+				InProgress: true,
+			}))
+		})
+
+		It("reports the current startup phase", func() {
+			serviceStatusServer.SetPhase("upgrading")
+			Expect(getState().Phase).To(Equal("upgrading"))
+		})
+
+		It("keeps reporting the seqno this node had before mysqld started", func() {
+			files["/some/grastate.dat"] = "uuid: some-uuid\nseqno: 42\n"
+			serviceStatusServer.SetPhase("joining")
+			files["/some/grastate.dat"] = "uuid: some-uuid\nseqno: -1\n"
+
+			state := getState()
+			Expect(state.Phase).To(Equal("joining"))
+			Expect(state.UUID).To(Equal("some-uuid"))
+			Expect(state.Seqno).To(Equal(int64(42)))
+		})
+
+		It("does not report the seqno of a different cluster", func() {
+			files["/some/grastate.dat"] = "uuid: some-uuid\nseqno: 42\n"
+			serviceStatusServer.SetPhase("joining")
+			files["/some/grastate.dat"] = "uuid: other-uuid\nseqno: -1\n"
+
+			Expect(getState().Seqno).To(Equal(int64(-1)))
+		})
+
+		It("reports an unknown seqno when there is no grastate file", func() {
+			Expect(getState()).To(Equal(galera_init_status_server.NodeState{
+				NodeID: "some-node-id",
+				Seqno:  -1,
+				Phase:  "initializing",
+			}))
+		})
+	})
 })
@@ -0,0 +1,101 @@
+package grastate
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	UnknownSeqno = -1
+	emptyUUID    = "00000000-0000-0000-0000-000000000000"
+)
+
+var recoveredPositionPattern = regexp.MustCompile(`WSREP: Recovered position:?\s+([0-9a-fA-F-]{36}):(-?\d+)`)
+
+// Grastate holds the fields galera persists in grastate.dat
+type Grastate struct {
+	UUID            string
+	Seqno           int64
+	SafeToBootstrap bool
+}
+
+// Parse reads the contents of a grastate.dat file. Keys it does not know about are ignored.
+func Parse(contents string) (Grastate, error) {
+	state := Grastate{Seqno: UnknownSeqno}
+
+	for _, line := range strings.Split(contents, "\n") {
+		fields := strings.SplitN(line, ":", 2)
+		if len(fields) != 2 {
+			continue
+		}
+
+		key := strings.TrimSpace(fields[0])
+		value := strings.TrimSpace(fields[1])
+
+		switch key {
+		case "uuid":
+			state.UUID = value
+		case "seqno":
+			seqno, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return Grastate{}, errors.Wrapf(err, "invalid seqno %q in grastate", value)
+			}
+			state.Seqno = seqno
+		case "safe_to_bootstrap":
+			state.SafeToBootstrap = value == "1"
+		}
+	}
+
+	return state, nil
+}
+
+// HasData reports whether the node has ever been part of a cluster
+func (g Grastate) HasData() bool {
+	return g.UUID != "" && g.UUID != emptyUUID
+}
+
+// HasKnownPosition reports whether the last committed seqno is recorded
+func (g Grastate) HasKnownPosition() bool {
+	return g.HasData() && g.Seqno != UnknownSeqno
+}
+
+// RecoveredPosition finds the last position reported by mysqld --wsrep-recover in its log
+func RecoveredPosition(log string) (Grastate, bool) {
+	matches := recoveredPositionPattern.FindAllStringSubmatch(log, -1)
+	if len(matches) == 0 {
+		return Grastate{}, false
+	}
+
+	match := matches[len(matches)-1]
+	seqno, err := strconv.ParseInt(match[2], 10, 64)
+	if err != nil {
+		return Grastate{}, false
+	}
+
+	return Grastate{UUID: match[1], Seqno: seqno}, true
+}
+
+// SetPosition rewrites the uuid and seqno of grastate.dat contents, leaving every other line untouched
+func SetPosition(contents string, uuid string, seqno int64) string {
+	lines := strings.Split(contents, "\n")
+
+	for i, line := range lines {
+		fields := strings.SplitN(line, ":", 2)
+		if len(fields) != 2 {
+			continue
+		}
+
+		switch strings.TrimSpace(fields[0]) {
+		case "uuid":
+			lines[i] = "uuid:    " + uuid
+		case "seqno":
+			lines[i] = fmt.Sprintf("seqno:   %d", seqno)
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
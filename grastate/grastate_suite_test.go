@@ -0,0 +1,13 @@
+package grastate_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestGrastate(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Grastate Suite")
+}
@@ -0,0 +1,81 @@
+package grastate_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/cloudfoundry/galera-init/grastate"
+)
+
+var _ = Describe("Grastate", func() {
+	Describe("Parse", func() {
+		It("reads the uuid, seqno and safe_to_bootstrap flag", func() {
+			state, err := grastate.Parse(`# GALERA saved state
+version: 2.1
+uuid:    8bd3bf94-3b65-11ea-a4ea-8bd1cbb0c6b8
+seqno:   1234
+safe_to_bootstrap: 1
+`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(state).To(Equal(grastate.Grastate{
+				UUID:            "8bd3bf94-3b65-11ea-a4ea-8bd1cbb0c6b8",
+				Seqno:           1234,
+				SafeToBootstrap: true,
+			}))
+		})
+
+		It("defaults to an unknown seqno when the file is empty", func() {
+			state, err := grastate.Parse("")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(state.Seqno).To(BeEquivalentTo(grastate.UnknownSeqno))
+			Expect(state.HasData()).To(BeFalse())
+		})
+
+		It("returns an error when the seqno is not a number", func() {
+			_, err := grastate.Parse("seqno: garbage\n")
+			Expect(err).To(MatchError(ContainSubstring(`invalid seqno "garbage" in grastate`)))
+		})
+	})
+
+	Describe("HasKnownPosition", func() {
+		It("is false after a crash left seqno at -1", func() {
+			state := grastate.Grastate{UUID: "8bd3bf94-3b65-11ea-a4ea-8bd1cbb0c6b8", Seqno: -1}
+			Expect(state.HasData()).To(BeTrue())
+			Expect(state.HasKnownPosition()).To(BeFalse())
+		})
+
+		It("is false for a node that never joined a cluster", func() {
+			state := grastate.Grastate{UUID: "00000000-0000-0000-0000-000000000000", Seqno: 0}
+			Expect(state.HasData()).To(BeFalse())
+			Expect(state.HasKnownPosition()).To(BeFalse())
+		})
+	})
+
+	Describe("RecoveredPosition", func() {
+		It("finds the position logged by mysqld --wsrep-recover", func() {
+			state, found := grastate.RecoveredPosition(`2020-01-20T12:00:00.000000Z 0 [Note] WSREP: Recovered position: 00000000-0000-0000-0000-000000000000:-1
+2020-01-20T12:00:01.000000Z 0 [Note] WSREP: Recovered position: 8bd3bf94-3b65-11ea-a4ea-8bd1cbb0c6b8:1234
+2020-01-20T12:00:01.000000Z 0 [Note] Shutdown complete`)
+			Expect(found).To(BeTrue())
+			Expect(state).To(Equal(grastate.Grastate{
+				UUID:  "8bd3bf94-3b65-11ea-a4ea-8bd1cbb0c6b8",
+				Seqno: 1234,
+			}))
+		})
+
+		It("reports when no position was logged", func() {
+			_, found := grastate.RecoveredPosition("[ERROR] Aborting")
+			Expect(found).To(BeFalse())
+		})
+	})
+
+	Describe("SetPosition", func() {
+		It("rewrites only the uuid and seqno", func() {
+			contents := "# GALERA saved state\nversion: 2.1\nuuid:    8bd3bf94-3b65-11ea-a4ea-8bd1cbb0c6b8\nseqno:   -1\nsafe_to_bootstrap: 0\n"
+
+			Expect(grastate.SetPosition(contents, "8bd3bf94-3b65-11ea-a4ea-8bd1cbb0c6b8", 1234)).To(Equal(
+				"# GALERA saved state\nversion: 2.1\nuuid:    8bd3bf94-3b65-11ea-a4ea-8bd1cbb0c6b8\nseqno:   1234\nsafe_to_bootstrap: 0\n",
+			))
+		})
+	})
+})
@@ -1,6 +1,7 @@
 package integration_test
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"strings"
@@ -120,6 +121,7 @@ var _ = Describe("DB Helper", func() {
 			helper = db_helper.NewDBHelper(
 				fakeOs,
 				dbConfig,
+				db_helper.PXCFlavor{},
 				logFile,
 				testLogger,
 			)
@@ -142,7 +144,7 @@ var _ = Describe("DB Helper", func() {
 		Context("Seeding databases and users", func() {
 			const mysqlAccessDenied uint16 = 1044
 			var ensureSeedSucceeds = func() {
-				err := helper.Seed()
+				err := helper.Seed(context.TODO())
 				Expect(err).NotTo(HaveOccurred())
 
 				for _, preseededDB := range dbConfig.PreseededDatabases {
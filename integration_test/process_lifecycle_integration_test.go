@@ -26,6 +26,10 @@ var _ = Describe("galera-init integration", func() {
 				User:               "root",
 				PreseededDatabases: nil,
 				Socket:             "/var/lib/mysql/mysql.sock",
+				MysqldPath:         "mysqld",
+				MysqladminPath:     "mysqladmin",
+				MyCnfPath:          "/var/vcap/jobs/pxc-mysql/config/my.cnf",
+				MyLoginCnfPath:     "/var/vcap/jobs/pxc-mysql/config/mylogin.cnf",
 			},
 			Manager: config.StartManager{
 				GaleraInitStatusServerAddress: "0.0.0.0:" + galeraInitStatusPort.Port(),
@@ -38,8 +42,11 @@ var _ = Describe("galera-init integration", func() {
 				ClusterProbeTimeout: 10,
 			},
 			Upgrader: config.Upgrader{
-				PackageVersionFile:      "/tmp/VERSION",
-				LastUpgradedVersionFile: "/var/lib/mysql/mysql_upgrade_info",
+				PackageVersionFile:         "/tmp/VERSION",
+				LastUpgradedVersionFile:    "/var/lib/mysql/mysql_upgrade_info",
+				ToleratedUpgradeErrors:     config.DefaultToleratedUpgradeErrors,
+				DBReachablePollingAttempts: 30,
+				DBReachablePollingDelay:    10,
 			},
 		}
 	})
@@ -1,9 +1,12 @@
 package os_helper
 
 import (
+	"context"
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"syscall"
 	"time"
 
 	"github.com/pkg/errors"
@@ -12,12 +15,19 @@ import (
 //go:generate go run github.com/maxbrunsfeld/counterfeiter/v6 . OsHelper
 type OsHelper interface {
 	RunCommand(executable string, args ...string) (string, error)
+	RunCommandContext(ctx context.Context, executable string, args ...string) (string, error)
 	StartCommand(logFileName string, executable string, args ...string) (*exec.Cmd, error)
 	WaitForCommand(cmd *exec.Cmd) chan error
 	FileExists(filename string) bool
 	ReadFile(filename string) (string, error)
 	WriteStringToFile(filename string, contents string) error
-	Sleep(duration time.Duration)
+	RemoveFile(filename string) error
+	MkdirAll(path string, perm os.FileMode) error
+	RemoveAll(path string) error
+	ReadDir(dirname string) ([]os.FileInfo, error)
+	DirectorySize(path string) (uint64, error)
+	FreeSpace(path string) (uint64, error)
+	Sleep(ctx context.Context, duration time.Duration) error
 	KillCommand(cmd *exec.Cmd, signal os.Signal) error
 }
 
@@ -37,6 +47,16 @@ func (h OsHelperImpl) RunCommand(executable string, args ...string) (string, err
 	return string(out), nil
 }
 
+// Runs command like RunCommand, killing the process when ctx is cancelled
+func (h OsHelperImpl) RunCommandContext(ctx context.Context, executable string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, executable, args...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return string(out), err
+	}
+	return string(out), nil
+}
+
 func (h OsHelperImpl) StartCommand(logFileName string, executable string, args ...string) (*exec.Cmd, error) {
 	cmd := exec.Command(executable, args...)
 	logFile, err := os.OpenFile(logFileName, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
@@ -71,14 +91,122 @@ func (h OsHelperImpl) ReadFile(filename string) (string, error) {
 	return string(b[:]), nil
 }
 
-// Overwrite the contents, creating if necessary. Panic on err
+// Atomically overwrite the contents, creating if necessary. The new contents are
+// synced to a temporary file which is renamed over the original, so a crash
+// leaves either the old or the new contents behind. Existing permissions are kept.
 func (h OsHelperImpl) WriteStringToFile(filename string, contents string) error {
-	err := ioutil.WriteFile(filename, []byte(contents), 0644)
-	return err
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(filename); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	dir := filepath.Dir(filename)
+	tmpFile, err := ioutil.TempFile(dir, "."+filepath.Base(filename)+".tmp")
+	if err != nil {
+		return errors.Wrapf(err, "error creating temporary file for %q", filename)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if err := writeAndSync(tmpFile, contents, mode); err != nil {
+		tmpFile.Close()
+		return errors.Wrapf(err, "error writing temporary file for %q", filename)
+	}
+
+	if err := tmpFile.Close(); err != nil {
+		return errors.Wrapf(err, "error closing temporary file for %q", filename)
+	}
+
+	if err := os.Rename(tmpFile.Name(), filename); err != nil {
+		return errors.Wrapf(err, "error replacing %q", filename)
+	}
+
+	return syncDir(dir)
+}
+
+// Remove the file and sync its directory so the removal survives a crash.
+// A file that does not exist is not an error.
+func (h OsHelperImpl) RemoveFile(filename string) error {
+	if err := os.Remove(filename); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.Wrapf(err, "error removing %q", filename)
+	}
+
+	return syncDir(filepath.Dir(filename))
+}
+
+func (h OsHelperImpl) MkdirAll(path string, perm os.FileMode) error {
+	return os.MkdirAll(path, perm)
+}
+
+func (h OsHelperImpl) RemoveAll(path string) error {
+	return os.RemoveAll(path)
+}
+
+// ReadDir lists the directory sorted by name
+func (h OsHelperImpl) ReadDir(dirname string) ([]os.FileInfo, error) {
+	return ioutil.ReadDir(dirname)
+}
+
+// DirectorySize adds up the sizes of the regular files below path
+func (h OsHelperImpl) DirectorySize(path string) (uint64, error) {
+	var size uint64
+	err := filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			size += uint64(info.Size())
+		}
+		return nil
+	})
+	return size, errors.Wrapf(err, "error measuring %q", path)
+}
+
+// FreeSpace returns the bytes unprivileged users can still write to the
+// file system holding path
+func (h OsHelperImpl) FreeSpace(path string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, errors.Wrapf(err, "error reading free space of %q", path)
+	}
+	return stat.Bavail * uint64(stat.Bsize), nil
 }
 
-func (h OsHelperImpl) Sleep(duration time.Duration) {
-	time.Sleep(duration)
+func writeAndSync(file *os.File, contents string, mode os.FileMode) error {
+	if _, err := file.WriteString(contents); err != nil {
+		return err
+	}
+
+	if err := file.Chmod(mode); err != nil {
+		return err
+	}
+
+	return file.Sync()
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return errors.Wrapf(err, "error opening directory %q", dir)
+	}
+	defer d.Close()
+
+	return errors.Wrapf(d.Sync(), "error syncing directory %q", dir)
+}
+
+// Sleep waits for duration and returns ctx.Err() when ctx is cancelled first
+func (h OsHelperImpl) Sleep(ctx context.Context, duration time.Duration) error {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
 }
 
 func (h OsHelperImpl) KillCommand(cmd *exec.Cmd, signal os.Signal) error {
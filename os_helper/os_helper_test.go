@@ -1,11 +1,13 @@
 package os_helper_test
 
 import (
+	"context"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"syscall"
+	"time"
 
 	. "github.com/cloudfoundry/galera-init/os_helper"
 
@@ -88,6 +90,130 @@ var _ = Describe("OsHelper", func() {
 		})
 	})
 
+	Describe("WriteStringToFile", func() {
+		var (
+			tempDir  string
+			filename string
+		)
+
+		BeforeEach(func() {
+			var err error
+			tempDir, err = ioutil.TempDir(os.TempDir(), "write_string_to_file_")
+			Expect(err).NotTo(HaveOccurred())
+
+			filename = filepath.Join(tempDir, "state.txt")
+		})
+
+		AfterEach(func() {
+			_ = os.RemoveAll(tempDir)
+		})
+
+		It("creates the file with 0644 permissions", func() {
+			Expect(helper.WriteStringToFile(filename, "some contents")).To(Succeed())
+
+			contents, err := ioutil.ReadFile(filename)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents)).To(Equal("some contents"))
+
+			fileInfo, err := os.Stat(filename)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fileInfo.Mode().String()).To(Equal("-rw-r--r--"))
+		})
+
+		It("replaces existing contents and keeps the original permissions", func() {
+			Expect(ioutil.WriteFile(filename, []byte("some much longer original contents"), 0640)).To(Succeed())
+			Expect(os.Chmod(filename, 0640)).To(Succeed())
+
+			Expect(helper.WriteStringToFile(filename, "new contents")).To(Succeed())
+
+			contents, err := ioutil.ReadFile(filename)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents)).To(Equal("new contents"))
+
+			fileInfo, err := os.Stat(filename)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fileInfo.Mode().String()).To(Equal("-rw-r-----"))
+		})
+
+		It("does not leave temporary files behind", func() {
+			Expect(helper.WriteStringToFile(filename, "some contents")).To(Succeed())
+
+			entries, err := ioutil.ReadDir(tempDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entries).To(HaveLen(1))
+			Expect(entries[0].Name()).To(Equal("state.txt"))
+		})
+
+		It("returns an error when the directory does not exist", func() {
+			err := helper.WriteStringToFile(filepath.Join(tempDir, "missing", "state.txt"), "some contents")
+			Expect(err).To(MatchError(ContainSubstring("error creating temporary file")))
+		})
+	})
+
+	Describe("RemoveFile", func() {
+		var tempDir string
+
+		BeforeEach(func() {
+			var err error
+			tempDir, err = ioutil.TempDir(os.TempDir(), "remove_file_")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			_ = os.RemoveAll(tempDir)
+		})
+
+		It("removes the file", func() {
+			filename := filepath.Join(tempDir, "marker.json")
+			Expect(ioutil.WriteFile(filename, []byte("{}"), 0644)).To(Succeed())
+
+			Expect(helper.RemoveFile(filename)).To(Succeed())
+			Expect(filename).NotTo(BeAnExistingFile())
+		})
+
+		It("succeeds when the file does not exist", func() {
+			Expect(helper.RemoveFile(filepath.Join(tempDir, "marker.json"))).To(Succeed())
+		})
+	})
+
+	Describe("DirectorySize", func() {
+		var tempDir string
+
+		BeforeEach(func() {
+			var err error
+			tempDir, err = ioutil.TempDir(os.TempDir(), "directory_size_")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			_ = os.RemoveAll(tempDir)
+		})
+
+		It("adds up the size of every file below the directory", func() {
+			Expect(ioutil.WriteFile(filepath.Join(tempDir, "ibdata1"), make([]byte, 100), 0600)).To(Succeed())
+			Expect(os.Mkdir(filepath.Join(tempDir, "mysql"), 0700)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(tempDir, "mysql", "user.ibd"), make([]byte, 23), 0600)).To(Succeed())
+
+			Expect(helper.DirectorySize(tempDir)).To(Equal(uint64(123)))
+		})
+
+		It("returns an error when the directory does not exist", func() {
+			_, err := helper.DirectorySize(filepath.Join(tempDir, "missing"))
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("FreeSpace", func() {
+		It("returns the space available on the file system", func() {
+			Expect(helper.FreeSpace(os.TempDir())).To(BeNumerically(">", 0))
+		})
+
+		It("returns an error when the path does not exist", func() {
+			_, err := helper.FreeSpace("/does/not/exist")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
 	Describe("WaitForCommand", func() {
 
 		Context("When command is bad", func() {
@@ -113,6 +239,40 @@ var _ = Describe("OsHelper", func() {
 		})
 	})
 
+	Describe("RunCommandContext", func() {
+		It("returns the combined output of the command", func() {
+			output, err := helper.RunCommandContext(context.Background(), "sh", "-c", "echo out; echo err >&2")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output).To(Equal("out\nerr\n"))
+		})
+
+		It("kills the command when the context is cancelled", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+
+			_, err := helper.RunCommandContext(ctx, "sleep", "8")
+			Expect(err).To(MatchError("signal: killed"))
+		})
+	})
+
+	Describe("Sleep", func() {
+		It("waits for the given duration", func() {
+			start := time.Now()
+			Expect(helper.Sleep(context.Background(), 10*time.Millisecond)).To(Succeed())
+			Expect(time.Since(start)).To(BeNumerically(">=", 10*time.Millisecond))
+		})
+
+		It("returns early when the context is cancelled", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			start := time.Now()
+			err := helper.Sleep(ctx, time.Minute)
+			Expect(err).To(Equal(context.Canceled))
+			Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+		})
+	})
+
 	Describe("KillCommand", func() {
 		var helper OsHelperImpl
 
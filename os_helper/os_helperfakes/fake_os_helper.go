@@ -2,6 +2,7 @@
 package os_helperfakes
 
 import (
+	"context"
 	"os"
 	"os/exec"
 	"sync"
@@ -11,6 +12,19 @@ import (
 )
 
 type FakeOsHelper struct {
+	DirectorySizeStub        func(string) (uint64, error)
+	directorySizeMutex       sync.RWMutex
+	directorySizeArgsForCall []struct {
+		arg1 string
+	}
+	directorySizeReturns struct {
+		result1 uint64
+		result2 error
+	}
+	directorySizeReturnsOnCall map[int]struct {
+		result1 uint64
+		result2 error
+	}
 	FileExistsStub        func(string) bool
 	fileExistsMutex       sync.RWMutex
 	fileExistsArgsForCall []struct {
@@ -22,6 +36,19 @@ type FakeOsHelper struct {
 	fileExistsReturnsOnCall map[int]struct {
 		result1 bool
 	}
+	FreeSpaceStub        func(string) (uint64, error)
+	freeSpaceMutex       sync.RWMutex
+	freeSpaceArgsForCall []struct {
+		arg1 string
+	}
+	freeSpaceReturns struct {
+		result1 uint64
+		result2 error
+	}
+	freeSpaceReturnsOnCall map[int]struct {
+		result1 uint64
+		result2 error
+	}
 	KillCommandStub        func(*exec.Cmd, os.Signal) error
 	killCommandMutex       sync.RWMutex
 	killCommandArgsForCall []struct {
@@ -34,6 +61,31 @@ type FakeOsHelper struct {
 	killCommandReturnsOnCall map[int]struct {
 		result1 error
 	}
+	MkdirAllStub        func(string, os.FileMode) error
+	mkdirAllMutex       sync.RWMutex
+	mkdirAllArgsForCall []struct {
+		arg1 string
+		arg2 os.FileMode
+	}
+	mkdirAllReturns struct {
+		result1 error
+	}
+	mkdirAllReturnsOnCall map[int]struct {
+		result1 error
+	}
+	ReadDirStub        func(string) ([]os.FileInfo, error)
+	readDirMutex       sync.RWMutex
+	readDirArgsForCall []struct {
+		arg1 string
+	}
+	readDirReturns struct {
+		result1 []os.FileInfo
+		result2 error
+	}
+	readDirReturnsOnCall map[int]struct {
+		result1 []os.FileInfo
+		result2 error
+	}
 	ReadFileStub        func(string) (string, error)
 	readFileMutex       sync.RWMutex
 	readFileArgsForCall []struct {
@@ -47,6 +99,28 @@ type FakeOsHelper struct {
 		result1 string
 		result2 error
 	}
+	RemoveAllStub        func(string) error
+	removeAllMutex       sync.RWMutex
+	removeAllArgsForCall []struct {
+		arg1 string
+	}
+	removeAllReturns struct {
+		result1 error
+	}
+	removeAllReturnsOnCall map[int]struct {
+		result1 error
+	}
+	RemoveFileStub        func(string) error
+	removeFileMutex       sync.RWMutex
+	removeFileArgsForCall []struct {
+		arg1 string
+	}
+	removeFileReturns struct {
+		result1 error
+	}
+	removeFileReturnsOnCall map[int]struct {
+		result1 error
+	}
 	RunCommandStub        func(string, ...string) (string, error)
 	runCommandMutex       sync.RWMutex
 	runCommandArgsForCall []struct {
@@ -61,10 +135,32 @@ type FakeOsHelper struct {
 		result1 string
 		result2 error
 	}
-	SleepStub        func(time.Duration)
+	RunCommandContextStub        func(context.Context, string, ...string) (string, error)
+	runCommandContextMutex       sync.RWMutex
+	runCommandContextArgsForCall []struct {
+		arg1 context.Context
+		arg2 string
+		arg3 []string
+	}
+	runCommandContextReturns struct {
+		result1 string
+		result2 error
+	}
+	runCommandContextReturnsOnCall map[int]struct {
+		result1 string
+		result2 error
+	}
+	SleepStub        func(context.Context, time.Duration) error
 	sleepMutex       sync.RWMutex
 	sleepArgsForCall []struct {
-		arg1 time.Duration
+		arg1 context.Context
+		arg2 time.Duration
+	}
+	sleepReturns struct {
+		result1 error
+	}
+	sleepReturnsOnCall map[int]struct {
+		result1 error
 	}
 	StartCommandStub        func(string, string, ...string) (*exec.Cmd, error)
 	startCommandMutex       sync.RWMutex
@@ -108,6 +204,69 @@ type FakeOsHelper struct {
 	invocationsMutex sync.RWMutex
 }
 
+func (fake *FakeOsHelper) DirectorySize(arg1 string) (uint64, error) {
+	fake.directorySizeMutex.Lock()
+	ret, specificReturn := fake.directorySizeReturnsOnCall[len(fake.directorySizeArgsForCall)]
+	fake.directorySizeArgsForCall = append(fake.directorySizeArgsForCall, struct {
+		arg1 string
+	}{arg1})
+	fake.recordInvocation("DirectorySize", []interface{}{arg1})
+	fake.directorySizeMutex.Unlock()
+	if fake.DirectorySizeStub != nil {
+		return fake.DirectorySizeStub(arg1)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	fakeReturns := fake.directorySizeReturns
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeOsHelper) DirectorySizeCallCount() int {
+	fake.directorySizeMutex.RLock()
+	defer fake.directorySizeMutex.RUnlock()
+	return len(fake.directorySizeArgsForCall)
+}
+
+func (fake *FakeOsHelper) DirectorySizeCalls(stub func(string) (uint64, error)) {
+	fake.directorySizeMutex.Lock()
+	defer fake.directorySizeMutex.Unlock()
+	fake.DirectorySizeStub = stub
+}
+
+func (fake *FakeOsHelper) DirectorySizeArgsForCall(i int) string {
+	fake.directorySizeMutex.RLock()
+	defer fake.directorySizeMutex.RUnlock()
+	argsForCall := fake.directorySizeArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeOsHelper) DirectorySizeReturns(result1 uint64, result2 error) {
+	fake.directorySizeMutex.Lock()
+	defer fake.directorySizeMutex.Unlock()
+	fake.DirectorySizeStub = nil
+	fake.directorySizeReturns = struct {
+		result1 uint64
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeOsHelper) DirectorySizeReturnsOnCall(i int, result1 uint64, result2 error) {
+	fake.directorySizeMutex.Lock()
+	defer fake.directorySizeMutex.Unlock()
+	fake.DirectorySizeStub = nil
+	if fake.directorySizeReturnsOnCall == nil {
+		fake.directorySizeReturnsOnCall = make(map[int]struct {
+			result1 uint64
+			result2 error
+		})
+	}
+	fake.directorySizeReturnsOnCall[i] = struct {
+		result1 uint64
+		result2 error
+	}{result1, result2}
+}
+
 func (fake *FakeOsHelper) FileExists(arg1 string) bool {
 	fake.fileExistsMutex.Lock()
 	ret, specificReturn := fake.fileExistsReturnsOnCall[len(fake.fileExistsArgsForCall)]
@@ -168,6 +327,69 @@ func (fake *FakeOsHelper) FileExistsReturnsOnCall(i int, result1 bool) {
 	}{result1}
 }
 
+func (fake *FakeOsHelper) FreeSpace(arg1 string) (uint64, error) {
+	fake.freeSpaceMutex.Lock()
+	ret, specificReturn := fake.freeSpaceReturnsOnCall[len(fake.freeSpaceArgsForCall)]
+	fake.freeSpaceArgsForCall = append(fake.freeSpaceArgsForCall, struct {
+		arg1 string
+	}{arg1})
+	fake.recordInvocation("FreeSpace", []interface{}{arg1})
+	fake.freeSpaceMutex.Unlock()
+	if fake.FreeSpaceStub != nil {
+		return fake.FreeSpaceStub(arg1)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	fakeReturns := fake.freeSpaceReturns
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeOsHelper) FreeSpaceCallCount() int {
+	fake.freeSpaceMutex.RLock()
+	defer fake.freeSpaceMutex.RUnlock()
+	return len(fake.freeSpaceArgsForCall)
+}
+
+func (fake *FakeOsHelper) FreeSpaceCalls(stub func(string) (uint64, error)) {
+	fake.freeSpaceMutex.Lock()
+	defer fake.freeSpaceMutex.Unlock()
+	fake.FreeSpaceStub = stub
+}
+
+func (fake *FakeOsHelper) FreeSpaceArgsForCall(i int) string {
+	fake.freeSpaceMutex.RLock()
+	defer fake.freeSpaceMutex.RUnlock()
+	argsForCall := fake.freeSpaceArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeOsHelper) FreeSpaceReturns(result1 uint64, result2 error) {
+	fake.freeSpaceMutex.Lock()
+	defer fake.freeSpaceMutex.Unlock()
+	fake.FreeSpaceStub = nil
+	fake.freeSpaceReturns = struct {
+		result1 uint64
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeOsHelper) FreeSpaceReturnsOnCall(i int, result1 uint64, result2 error) {
+	fake.freeSpaceMutex.Lock()
+	defer fake.freeSpaceMutex.Unlock()
+	fake.FreeSpaceStub = nil
+	if fake.freeSpaceReturnsOnCall == nil {
+		fake.freeSpaceReturnsOnCall = make(map[int]struct {
+			result1 uint64
+			result2 error
+		})
+	}
+	fake.freeSpaceReturnsOnCall[i] = struct {
+		result1 uint64
+		result2 error
+	}{result1, result2}
+}
+
 func (fake *FakeOsHelper) KillCommand(arg1 *exec.Cmd, arg2 os.Signal) error {
 	fake.killCommandMutex.Lock()
 	ret, specificReturn := fake.killCommandReturnsOnCall[len(fake.killCommandArgsForCall)]
@@ -229,6 +451,130 @@ func (fake *FakeOsHelper) KillCommandReturnsOnCall(i int, result1 error) {
 	}{result1}
 }
 
+func (fake *FakeOsHelper) MkdirAll(arg1 string, arg2 os.FileMode) error {
+	fake.mkdirAllMutex.Lock()
+	ret, specificReturn := fake.mkdirAllReturnsOnCall[len(fake.mkdirAllArgsForCall)]
+	fake.mkdirAllArgsForCall = append(fake.mkdirAllArgsForCall, struct {
+		arg1 string
+		arg2 os.FileMode
+	}{arg1, arg2})
+	fake.recordInvocation("MkdirAll", []interface{}{arg1, arg2})
+	fake.mkdirAllMutex.Unlock()
+	if fake.MkdirAllStub != nil {
+		return fake.MkdirAllStub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	fakeReturns := fake.mkdirAllReturns
+	return fakeReturns.result1
+}
+
+func (fake *FakeOsHelper) MkdirAllCallCount() int {
+	fake.mkdirAllMutex.RLock()
+	defer fake.mkdirAllMutex.RUnlock()
+	return len(fake.mkdirAllArgsForCall)
+}
+
+func (fake *FakeOsHelper) MkdirAllCalls(stub func(string, os.FileMode) error) {
+	fake.mkdirAllMutex.Lock()
+	defer fake.mkdirAllMutex.Unlock()
+	fake.MkdirAllStub = stub
+}
+
+func (fake *FakeOsHelper) MkdirAllArgsForCall(i int) (string, os.FileMode) {
+	fake.mkdirAllMutex.RLock()
+	defer fake.mkdirAllMutex.RUnlock()
+	argsForCall := fake.mkdirAllArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeOsHelper) MkdirAllReturns(result1 error) {
+	fake.mkdirAllMutex.Lock()
+	defer fake.mkdirAllMutex.Unlock()
+	fake.MkdirAllStub = nil
+	fake.mkdirAllReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeOsHelper) MkdirAllReturnsOnCall(i int, result1 error) {
+	fake.mkdirAllMutex.Lock()
+	defer fake.mkdirAllMutex.Unlock()
+	fake.MkdirAllStub = nil
+	if fake.mkdirAllReturnsOnCall == nil {
+		fake.mkdirAllReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.mkdirAllReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeOsHelper) ReadDir(arg1 string) ([]os.FileInfo, error) {
+	fake.readDirMutex.Lock()
+	ret, specificReturn := fake.readDirReturnsOnCall[len(fake.readDirArgsForCall)]
+	fake.readDirArgsForCall = append(fake.readDirArgsForCall, struct {
+		arg1 string
+	}{arg1})
+	fake.recordInvocation("ReadDir", []interface{}{arg1})
+	fake.readDirMutex.Unlock()
+	if fake.ReadDirStub != nil {
+		return fake.ReadDirStub(arg1)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	fakeReturns := fake.readDirReturns
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeOsHelper) ReadDirCallCount() int {
+	fake.readDirMutex.RLock()
+	defer fake.readDirMutex.RUnlock()
+	return len(fake.readDirArgsForCall)
+}
+
+func (fake *FakeOsHelper) ReadDirCalls(stub func(string) ([]os.FileInfo, error)) {
+	fake.readDirMutex.Lock()
+	defer fake.readDirMutex.Unlock()
+	fake.ReadDirStub = stub
+}
+
+func (fake *FakeOsHelper) ReadDirArgsForCall(i int) string {
+	fake.readDirMutex.RLock()
+	defer fake.readDirMutex.RUnlock()
+	argsForCall := fake.readDirArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeOsHelper) ReadDirReturns(result1 []os.FileInfo, result2 error) {
+	fake.readDirMutex.Lock()
+	defer fake.readDirMutex.Unlock()
+	fake.ReadDirStub = nil
+	fake.readDirReturns = struct {
+		result1 []os.FileInfo
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeOsHelper) ReadDirReturnsOnCall(i int, result1 []os.FileInfo, result2 error) {
+	fake.readDirMutex.Lock()
+	defer fake.readDirMutex.Unlock()
+	fake.ReadDirStub = nil
+	if fake.readDirReturnsOnCall == nil {
+		fake.readDirReturnsOnCall = make(map[int]struct {
+			result1 []os.FileInfo
+			result2 error
+		})
+	}
+	fake.readDirReturnsOnCall[i] = struct {
+		result1 []os.FileInfo
+		result2 error
+	}{result1, result2}
+}
+
 func (fake *FakeOsHelper) ReadFile(arg1 string) (string, error) {
 	fake.readFileMutex.Lock()
 	ret, specificReturn := fake.readFileReturnsOnCall[len(fake.readFileArgsForCall)]
@@ -292,6 +638,126 @@ func (fake *FakeOsHelper) ReadFileReturnsOnCall(i int, result1 string, result2 e
 	}{result1, result2}
 }
 
+func (fake *FakeOsHelper) RemoveAll(arg1 string) error {
+	fake.removeAllMutex.Lock()
+	ret, specificReturn := fake.removeAllReturnsOnCall[len(fake.removeAllArgsForCall)]
+	fake.removeAllArgsForCall = append(fake.removeAllArgsForCall, struct {
+		arg1 string
+	}{arg1})
+	fake.recordInvocation("RemoveAll", []interface{}{arg1})
+	fake.removeAllMutex.Unlock()
+	if fake.RemoveAllStub != nil {
+		return fake.RemoveAllStub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	fakeReturns := fake.removeAllReturns
+	return fakeReturns.result1
+}
+
+func (fake *FakeOsHelper) RemoveAllCallCount() int {
+	fake.removeAllMutex.RLock()
+	defer fake.removeAllMutex.RUnlock()
+	return len(fake.removeAllArgsForCall)
+}
+
+func (fake *FakeOsHelper) RemoveAllCalls(stub func(string) error) {
+	fake.removeAllMutex.Lock()
+	defer fake.removeAllMutex.Unlock()
+	fake.RemoveAllStub = stub
+}
+
+func (fake *FakeOsHelper) RemoveAllArgsForCall(i int) string {
+	fake.removeAllMutex.RLock()
+	defer fake.removeAllMutex.RUnlock()
+	argsForCall := fake.removeAllArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeOsHelper) RemoveAllReturns(result1 error) {
+	fake.removeAllMutex.Lock()
+	defer fake.removeAllMutex.Unlock()
+	fake.RemoveAllStub = nil
+	fake.removeAllReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeOsHelper) RemoveAllReturnsOnCall(i int, result1 error) {
+	fake.removeAllMutex.Lock()
+	defer fake.removeAllMutex.Unlock()
+	fake.RemoveAllStub = nil
+	if fake.removeAllReturnsOnCall == nil {
+		fake.removeAllReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.removeAllReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeOsHelper) RemoveFile(arg1 string) error {
+	fake.removeFileMutex.Lock()
+	ret, specificReturn := fake.removeFileReturnsOnCall[len(fake.removeFileArgsForCall)]
+	fake.removeFileArgsForCall = append(fake.removeFileArgsForCall, struct {
+		arg1 string
+	}{arg1})
+	fake.recordInvocation("RemoveFile", []interface{}{arg1})
+	fake.removeFileMutex.Unlock()
+	if fake.RemoveFileStub != nil {
+		return fake.RemoveFileStub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	fakeReturns := fake.removeFileReturns
+	return fakeReturns.result1
+}
+
+func (fake *FakeOsHelper) RemoveFileCallCount() int {
+	fake.removeFileMutex.RLock()
+	defer fake.removeFileMutex.RUnlock()
+	return len(fake.removeFileArgsForCall)
+}
+
+func (fake *FakeOsHelper) RemoveFileCalls(stub func(string) error) {
+	fake.removeFileMutex.Lock()
+	defer fake.removeFileMutex.Unlock()
+	fake.RemoveFileStub = stub
+}
+
+func (fake *FakeOsHelper) RemoveFileArgsForCall(i int) string {
+	fake.removeFileMutex.RLock()
+	defer fake.removeFileMutex.RUnlock()
+	argsForCall := fake.removeFileArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeOsHelper) RemoveFileReturns(result1 error) {
+	fake.removeFileMutex.Lock()
+	defer fake.removeFileMutex.Unlock()
+	fake.RemoveFileStub = nil
+	fake.removeFileReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeOsHelper) RemoveFileReturnsOnCall(i int, result1 error) {
+	fake.removeFileMutex.Lock()
+	defer fake.removeFileMutex.Unlock()
+	fake.RemoveFileStub = nil
+	if fake.removeFileReturnsOnCall == nil {
+		fake.removeFileReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.removeFileReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
 func (fake *FakeOsHelper) RunCommand(arg1 string, arg2 ...string) (string, error) {
 	fake.runCommandMutex.Lock()
 	ret, specificReturn := fake.runCommandReturnsOnCall[len(fake.runCommandArgsForCall)]
@@ -356,16 +822,88 @@ func (fake *FakeOsHelper) RunCommandReturnsOnCall(i int, result1 string, result2
 	}{result1, result2}
 }
 
-func (fake *FakeOsHelper) Sleep(arg1 time.Duration) {
+func (fake *FakeOsHelper) RunCommandContext(arg1 context.Context, arg2 string, arg3 ...string) (string, error) {
+	fake.runCommandContextMutex.Lock()
+	ret, specificReturn := fake.runCommandContextReturnsOnCall[len(fake.runCommandContextArgsForCall)]
+	fake.runCommandContextArgsForCall = append(fake.runCommandContextArgsForCall, struct {
+		arg1 context.Context
+		arg2 string
+		arg3 []string
+	}{arg1, arg2, arg3})
+	fake.recordInvocation("RunCommandContext", []interface{}{arg1, arg2, arg3})
+	fake.runCommandContextMutex.Unlock()
+	if fake.RunCommandContextStub != nil {
+		return fake.RunCommandContextStub(arg1, arg2, arg3...)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	fakeReturns := fake.runCommandContextReturns
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeOsHelper) RunCommandContextCallCount() int {
+	fake.runCommandContextMutex.RLock()
+	defer fake.runCommandContextMutex.RUnlock()
+	return len(fake.runCommandContextArgsForCall)
+}
+
+func (fake *FakeOsHelper) RunCommandContextCalls(stub func(context.Context, string, ...string) (string, error)) {
+	fake.runCommandContextMutex.Lock()
+	defer fake.runCommandContextMutex.Unlock()
+	fake.RunCommandContextStub = stub
+}
+
+func (fake *FakeOsHelper) RunCommandContextArgsForCall(i int) (context.Context, string, []string) {
+	fake.runCommandContextMutex.RLock()
+	defer fake.runCommandContextMutex.RUnlock()
+	argsForCall := fake.runCommandContextArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
+}
+
+func (fake *FakeOsHelper) RunCommandContextReturns(result1 string, result2 error) {
+	fake.runCommandContextMutex.Lock()
+	defer fake.runCommandContextMutex.Unlock()
+	fake.RunCommandContextStub = nil
+	fake.runCommandContextReturns = struct {
+		result1 string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeOsHelper) RunCommandContextReturnsOnCall(i int, result1 string, result2 error) {
+	fake.runCommandContextMutex.Lock()
+	defer fake.runCommandContextMutex.Unlock()
+	fake.RunCommandContextStub = nil
+	if fake.runCommandContextReturnsOnCall == nil {
+		fake.runCommandContextReturnsOnCall = make(map[int]struct {
+			result1 string
+			result2 error
+		})
+	}
+	fake.runCommandContextReturnsOnCall[i] = struct {
+		result1 string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeOsHelper) Sleep(arg1 context.Context, arg2 time.Duration) error {
 	fake.sleepMutex.Lock()
+	ret, specificReturn := fake.sleepReturnsOnCall[len(fake.sleepArgsForCall)]
 	fake.sleepArgsForCall = append(fake.sleepArgsForCall, struct {
-		arg1 time.Duration
-	}{arg1})
-	fake.recordInvocation("Sleep", []interface{}{arg1})
+		arg1 context.Context
+		arg2 time.Duration
+	}{arg1, arg2})
+	fake.recordInvocation("Sleep", []interface{}{arg1, arg2})
 	fake.sleepMutex.Unlock()
 	if fake.SleepStub != nil {
-		fake.SleepStub(arg1)
+		return fake.SleepStub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1
 	}
+	fakeReturns := fake.sleepReturns
+	return fakeReturns.result1
 }
 
 func (fake *FakeOsHelper) SleepCallCount() int {
@@ -374,17 +912,40 @@ func (fake *FakeOsHelper) SleepCallCount() int {
 	return len(fake.sleepArgsForCall)
 }
 
-func (fake *FakeOsHelper) SleepCalls(stub func(time.Duration)) {
+func (fake *FakeOsHelper) SleepCalls(stub func(context.Context, time.Duration) error) {
 	fake.sleepMutex.Lock()
 	defer fake.sleepMutex.Unlock()
 	fake.SleepStub = stub
 }
 
-func (fake *FakeOsHelper) SleepArgsForCall(i int) time.Duration {
+func (fake *FakeOsHelper) SleepArgsForCall(i int) (context.Context, time.Duration) {
 	fake.sleepMutex.RLock()
 	defer fake.sleepMutex.RUnlock()
 	argsForCall := fake.sleepArgsForCall[i]
-	return argsForCall.arg1
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeOsHelper) SleepReturns(result1 error) {
+	fake.sleepMutex.Lock()
+	defer fake.sleepMutex.Unlock()
+	fake.SleepStub = nil
+	fake.sleepReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeOsHelper) SleepReturnsOnCall(i int, result1 error) {
+	fake.sleepMutex.Lock()
+	defer fake.sleepMutex.Unlock()
+	fake.SleepStub = nil
+	if fake.sleepReturnsOnCall == nil {
+		fake.sleepReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.sleepReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
 }
 
 func (fake *FakeOsHelper) StartCommand(arg1 string, arg2 string, arg3 ...string) (*exec.Cmd, error) {
@@ -576,14 +1137,28 @@ func (fake *FakeOsHelper) WriteStringToFileReturnsOnCall(i int, result1 error) {
 func (fake *FakeOsHelper) Invocations() map[string][][]interface{} {
 	fake.invocationsMutex.RLock()
 	defer fake.invocationsMutex.RUnlock()
+	fake.directorySizeMutex.RLock()
+	defer fake.directorySizeMutex.RUnlock()
 	fake.fileExistsMutex.RLock()
 	defer fake.fileExistsMutex.RUnlock()
+	fake.freeSpaceMutex.RLock()
+	defer fake.freeSpaceMutex.RUnlock()
 	fake.killCommandMutex.RLock()
 	defer fake.killCommandMutex.RUnlock()
+	fake.mkdirAllMutex.RLock()
+	defer fake.mkdirAllMutex.RUnlock()
+	fake.readDirMutex.RLock()
+	defer fake.readDirMutex.RUnlock()
 	fake.readFileMutex.RLock()
 	defer fake.readFileMutex.RUnlock()
+	fake.removeAllMutex.RLock()
+	defer fake.removeAllMutex.RUnlock()
+	fake.removeFileMutex.RLock()
+	defer fake.removeFileMutex.RUnlock()
 	fake.runCommandMutex.RLock()
 	defer fake.runCommandMutex.RUnlock()
+	fake.runCommandContextMutex.RLock()
+	defer fake.runCommandContextMutex.RUnlock()
 	fake.sleepMutex.RLock()
 	defer fake.sleepMutex.RUnlock()
 	fake.startCommandMutex.RLock()
@@ -0,0 +1,75 @@
+// Code generated by counterfeiter. DO NOT EDIT.
+package node_starterfakes
+
+import (
+	"sync"
+
+	"github.com/cloudfoundry/galera-init/start_manager/node_starter"
+)
+
+type FakePhaseReporter struct {
+	SetPhaseStub        func(string)
+	setPhaseMutex       sync.RWMutex
+	setPhaseArgsForCall []struct {
+		arg1 string
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *FakePhaseReporter) SetPhase(arg1 string) {
+	fake.setPhaseMutex.Lock()
+	fake.setPhaseArgsForCall = append(fake.setPhaseArgsForCall, struct {
+		arg1 string
+	}{arg1})
+	fake.recordInvocation("SetPhase", []interface{}{arg1})
+	fake.setPhaseMutex.Unlock()
+	if fake.SetPhaseStub != nil {
+		fake.SetPhaseStub(arg1)
+	}
+}
+
+func (fake *FakePhaseReporter) SetPhaseCallCount() int {
+	fake.setPhaseMutex.RLock()
+	defer fake.setPhaseMutex.RUnlock()
+	return len(fake.setPhaseArgsForCall)
+}
+
+func (fake *FakePhaseReporter) SetPhaseCalls(stub func(string)) {
+	fake.setPhaseMutex.Lock()
+	defer fake.setPhaseMutex.Unlock()
+	fake.SetPhaseStub = stub
+}
+
+func (fake *FakePhaseReporter) SetPhaseArgsForCall(i int) string {
+	fake.setPhaseMutex.RLock()
+	defer fake.setPhaseMutex.RUnlock()
+	argsForCall := fake.setPhaseArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakePhaseReporter) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.setPhaseMutex.RLock()
+	defer fake.setPhaseMutex.RUnlock()
+	copiedInvocations := map[string][][]interface{}{}
+	for key, value := range fake.invocations {
+		copiedInvocations[key] = value
+	}
+	return copiedInvocations
+}
+
+func (fake *FakePhaseReporter) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ node_starter.PhaseReporter = new(FakePhaseReporter)
@@ -2,6 +2,7 @@
 package node_starterfakes
 
 import (
+	"context"
 	"os/exec"
 	"sync"
 
@@ -19,10 +20,21 @@ type FakeStarter struct {
 	getMysqlCmdReturnsOnCall map[int]struct {
 		result1 *exec.Cmd
 	}
-	StartNodeFromStateStub        func(string) (string, <-chan error, error)
+	GetStartModeStub        func() string
+	getStartModeMutex       sync.RWMutex
+	getStartModeArgsForCall []struct {
+	}
+	getStartModeReturns struct {
+		result1 string
+	}
+	getStartModeReturnsOnCall map[int]struct {
+		result1 string
+	}
+	StartNodeFromStateStub        func(context.Context, string) (string, <-chan error, error)
 	startNodeFromStateMutex       sync.RWMutex
 	startNodeFromStateArgsForCall []struct {
-		arg1 string
+		arg1 context.Context
+		arg2 string
 	}
 	startNodeFromStateReturns struct {
 		result1 string
@@ -90,16 +102,69 @@ func (fake *FakeStarter) GetMysqlCmdReturnsOnCall(i int, result1 *exec.Cmd) {
 	}{result1}
 }
 
-func (fake *FakeStarter) StartNodeFromState(arg1 string) (string, <-chan error, error) {
+func (fake *FakeStarter) GetStartMode() string {
+	fake.getStartModeMutex.Lock()
+	ret, specificReturn := fake.getStartModeReturnsOnCall[len(fake.getStartModeArgsForCall)]
+	fake.getStartModeArgsForCall = append(fake.getStartModeArgsForCall, struct {
+	}{})
+	fake.recordInvocation("GetStartMode", []interface{}{})
+	fake.getStartModeMutex.Unlock()
+	if fake.GetStartModeStub != nil {
+		return fake.GetStartModeStub()
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	fakeReturns := fake.getStartModeReturns
+	return fakeReturns.result1
+}
+
+func (fake *FakeStarter) GetStartModeCallCount() int {
+	fake.getStartModeMutex.RLock()
+	defer fake.getStartModeMutex.RUnlock()
+	return len(fake.getStartModeArgsForCall)
+}
+
+func (fake *FakeStarter) GetStartModeCalls(stub func() string) {
+	fake.getStartModeMutex.Lock()
+	defer fake.getStartModeMutex.Unlock()
+	fake.GetStartModeStub = stub
+}
+
+func (fake *FakeStarter) GetStartModeReturns(result1 string) {
+	fake.getStartModeMutex.Lock()
+	defer fake.getStartModeMutex.Unlock()
+	fake.GetStartModeStub = nil
+	fake.getStartModeReturns = struct {
+		result1 string
+	}{result1}
+}
+
+func (fake *FakeStarter) GetStartModeReturnsOnCall(i int, result1 string) {
+	fake.getStartModeMutex.Lock()
+	defer fake.getStartModeMutex.Unlock()
+	fake.GetStartModeStub = nil
+	if fake.getStartModeReturnsOnCall == nil {
+		fake.getStartModeReturnsOnCall = make(map[int]struct {
+			result1 string
+		})
+	}
+	fake.getStartModeReturnsOnCall[i] = struct {
+		result1 string
+	}{result1}
+}
+
+func (fake *FakeStarter) StartNodeFromState(arg1 context.Context, arg2 string) (string, <-chan error, error) {
 	fake.startNodeFromStateMutex.Lock()
 	ret, specificReturn := fake.startNodeFromStateReturnsOnCall[len(fake.startNodeFromStateArgsForCall)]
 	fake.startNodeFromStateArgsForCall = append(fake.startNodeFromStateArgsForCall, struct {
-		arg1 string
-	}{arg1})
-	fake.recordInvocation("StartNodeFromState", []interface{}{arg1})
+		arg1 context.Context
+		arg2 string
+	}{arg1, arg2})
+	fake.recordInvocation("StartNodeFromState", []interface{}{arg1, arg2})
 	fake.startNodeFromStateMutex.Unlock()
 	if fake.StartNodeFromStateStub != nil {
-		return fake.StartNodeFromStateStub(arg1)
+		return fake.StartNodeFromStateStub(arg1, arg2)
 	}
 	if specificReturn {
 		return ret.result1, ret.result2, ret.result3
@@ -114,17 +179,17 @@ func (fake *FakeStarter) StartNodeFromStateCallCount() int {
 	return len(fake.startNodeFromStateArgsForCall)
 }
 
-func (fake *FakeStarter) StartNodeFromStateCalls(stub func(string) (string, <-chan error, error)) {
+func (fake *FakeStarter) StartNodeFromStateCalls(stub func(context.Context, string) (string, <-chan error, error)) {
 	fake.startNodeFromStateMutex.Lock()
 	defer fake.startNodeFromStateMutex.Unlock()
 	fake.StartNodeFromStateStub = stub
 }
 
-func (fake *FakeStarter) StartNodeFromStateArgsForCall(i int) string {
+func (fake *FakeStarter) StartNodeFromStateArgsForCall(i int) (context.Context, string) {
 	fake.startNodeFromStateMutex.RLock()
 	defer fake.startNodeFromStateMutex.RUnlock()
 	argsForCall := fake.startNodeFromStateArgsForCall[i]
-	return argsForCall.arg1
+	return argsForCall.arg1, argsForCall.arg2
 }
 
 func (fake *FakeStarter) StartNodeFromStateReturns(result1 string, result2 <-chan error, result3 error) {
@@ -161,6 +226,8 @@ func (fake *FakeStarter) Invocations() map[string][][]interface{} {
 	defer fake.invocationsMutex.RUnlock()
 	fake.getMysqlCmdMutex.RLock()
 	defer fake.getMysqlCmdMutex.RUnlock()
+	fake.getStartModeMutex.RLock()
+	defer fake.getStartModeMutex.RUnlock()
 	fake.startNodeFromStateMutex.RLock()
 	defer fake.startNodeFromStateMutex.RUnlock()
 	copiedInvocations := map[string][][]interface{}{}
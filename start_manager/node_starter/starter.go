@@ -1,41 +1,61 @@
 package node_starter
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"os/exec"
 	"strings"
 	"time"
 
 	"code.cloudfoundry.org/lager"
 
+	"github.com/cloudfoundry/galera-init/bootstrap_elector"
 	"github.com/cloudfoundry/galera-init/cluster_health_checker"
 	"github.com/cloudfoundry/galera-init/config"
 	"github.com/cloudfoundry/galera-init/db_helper"
+	"github.com/cloudfoundry/galera-init/grastate"
 	"github.com/cloudfoundry/galera-init/os_helper"
 )
 
 const (
-	Clustered                        = "CLUSTERED"
-	NeedsBootstrap                   = "NEEDS_BOOTSTRAP"
-	SingleNode                       = "SINGLE_NODE"
-	StartupPollingFrequencyInSeconds = 5
+	Clustered      = "CLUSTERED"
+	NeedsBootstrap = "NEEDS_BOOTSTRAP"
+	SingleNode     = "SINGLE_NODE"
+	BootstrapMode  = "bootstrap"
+	JoinMode       = "join"
 )
 
+// Now measures how long mysqld takes to start; tests replace it
+var Now = time.Now
+
 //go:generate go run github.com/maxbrunsfeld/counterfeiter/v6 . Starter
 type Starter interface {
-	StartNodeFromState(string) (string, <-chan error, error)
+	// StartNodeFromState starts mysqld and waits until it is ready. When a
+	// later step fails while mysqld is still running, its exit channel is
+	// returned together with the error so the caller can stop it.
+	StartNodeFromState(ctx context.Context, state string) (string, <-chan error, error)
 	GetMysqlCmd() *exec.Cmd
+	GetStartMode() string
+}
+
+//go:generate go run github.com/maxbrunsfeld/counterfeiter/v6 . PhaseReporter
+type PhaseReporter interface {
+	// SetPhase publishes the phase galera-init is in, so peers electing a
+	// bootstrap node know this node already started mysqld
+	SetPhase(phase string)
 }
 
 type starter struct {
 	dbHelper             db_helper.DBHelper
 	osHelper             os_helper.OsHelper
 	clusterHealthChecker cluster_health_checker.ClusterHealthChecker
+	bootstrapElector     bootstrap_elector.BootstrapElector
+	phaseReporter        PhaseReporter
 	config               config.StartManager
 	logger               lager.Logger
 	mysqlCmd             *exec.Cmd
+	startMode            string
 }
 
 func NewStarter(
@@ -44,6 +64,8 @@ func NewStarter(
 	config config.StartManager,
 	logger lager.Logger,
 	healthChecker cluster_health_checker.ClusterHealthChecker,
+	bootstrapElector bootstrap_elector.BootstrapElector,
+	phaseReporter PhaseReporter,
 ) Starter {
 	return &starter{
 		dbHelper:             dbHelper,
@@ -51,27 +73,39 @@ func NewStarter(
 		config:               config,
 		logger:               logger,
 		clusterHealthChecker: healthChecker,
+		bootstrapElector:     bootstrapElector,
+		phaseReporter:        phaseReporter,
 	}
 }
 
-func (s *starter) StartNodeFromState(state string) (string, <-chan error, error) {
+func (s *starter) StartNodeFromState(ctx context.Context, state string) (string, <-chan error, error) {
 	var newNodeState string
 	var err error
 	var mysqldChan chan error
 
+	if err := s.dbHelper.ReloadPasswords(); err != nil {
+		return "", nil, err
+	}
+
 	switch state {
 	case SingleNode:
-		mysqldChan, err = s.bootstrapNode()
+		mysqldChan, err = s.bootstrapNode(ctx)
 		newNodeState = SingleNode
 	case NeedsBootstrap:
 		if s.clusterHealthChecker.HealthyCluster() {
-			mysqldChan, err = s.joinCluster()
+			mysqldChan, err = s.joinCluster(ctx)
+		} else if s.config.SeqnoAwareBootstrap {
+			mysqldChan, err = s.startElected(ctx, true)
 		} else {
-			mysqldChan, err = s.bootstrapNode()
+			mysqldChan, err = s.bootstrapNode(ctx)
 		}
 		newNodeState = Clustered
 	case Clustered:
-		mysqldChan, err = s.joinCluster()
+		if s.config.SeqnoAwareBootstrap && !s.clusterHealthChecker.HealthyCluster() {
+			mysqldChan, err = s.startElected(ctx, false)
+		} else {
+			mysqldChan, err = s.joinCluster(ctx)
+		}
 		newNodeState = Clustered
 	default:
 		err = fmt.Errorf("Unsupported state file contents: %s", state)
@@ -83,24 +117,32 @@ func (s *starter) StartNodeFromState(state string) (string, <-chan error, error)
 		return "", nil, errors.New("Starting mysql failed, no channel created - exiting")
 	}
 
-	err = s.waitForDatabaseToAcceptConnections(mysqldChan)
+	exited, err := s.waitForDatabaseToAcceptConnections(ctx, mysqldChan)
 	if err != nil {
-		return "", nil, err
+		if exited {
+			return "", nil, err
+		}
+		return "", mysqldChan, err
 	}
 
-	err = s.seedDatabases()
+	err = s.seedDatabases(ctx)
 	if err != nil {
-		return "", nil, err
+		return "", mysqldChan, err
 	}
 
-	err = s.seedUsers()
+	err = s.seedUsers(ctx)
 	if err != nil {
-		return "", nil, err
+		return "", mysqldChan, err
 	}
 
-	err = s.runPostStartSQL()
+	err = s.reconcileAccounts(ctx)
 	if err != nil {
-		return "", nil, err
+		return "", mysqldChan, err
+	}
+
+	err = s.runPostStartSQL(ctx)
+	if err != nil {
+		return "", mysqldChan, err
 	}
 
 	return newNodeState, mysqldChan, nil
@@ -110,30 +152,142 @@ func (s *starter) GetMysqlCmd() *exec.Cmd {
 	return s.mysqlCmd
 }
 
-func (s *starter) bootstrapNode() (chan error, error) {
+// GetStartMode reports whether mysqld was last started to bootstrap or to join the cluster
+func (s *starter) GetStartMode() string {
+	return s.startMode
+}
+
+// startElected bootstraps when the peers elect this node and joins
+// otherwise. The position is recovered first, so the election compares the
+// last committed seqno after a crash. Without local data a new cluster is only bootstrapped when
+// bootstrapNewCluster is set. Starting mysqld without knowing the seqno of
+// every peer could bootstrap older data, so an undecided election fails.
+func (s *starter) startElected(ctx context.Context, bootstrapNewCluster bool) (chan error, error) {
+	s.recoverPosition(ctx)
+
+	switch s.bootstrapElector.Elect(ctx) {
+	case bootstrap_elector.Elected:
+		return s.bootstrapNode(ctx)
+	case bootstrap_elector.NoLocalData:
+		if bootstrapNewCluster {
+			return s.bootstrapNode(ctx)
+		}
+		return s.joinCluster(ctx)
+	case bootstrap_elector.Undecided:
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return nil, errors.New("Bootstrap election undecided: the seqno of a peer is still unknown; review the galera-init logs of the peers")
+	default:
+		return s.joinCluster(ctx)
+	}
+}
+
+// recoverPosition replaces the seqno -1 left behind by a crash with the last
+// committed seqno, so that the bootstrap election compares real positions. Failing
+// to recover is not fatal; the node then starts with an unknown position.
+func (s *starter) recoverPosition(ctx context.Context) {
+	if !s.osHelper.FileExists(s.config.GrastateFileLocation) {
+		return
+	}
+
+	contents, err := s.osHelper.ReadFile(s.config.GrastateFileLocation)
+	if err != nil {
+		s.logger.Error("wsrep-recover-read-grastate-failed", err)
+		return
+	}
+
+	state, err := grastate.Parse(contents)
+	if err != nil {
+		s.logger.Error("wsrep-recover-parse-grastate-failed", err)
+		return
+	}
+
+	if !state.HasData() || state.HasKnownPosition() {
+		return
+	}
+
+	s.logger.Info("wsrep-recover-starting", lager.Data{
+		"uuid": state.UUID,
+	})
+	log, err := s.dbHelper.RecoverPosition(ctx)
+	if err != nil {
+		s.logger.Error("wsrep-recover-failed", err, lager.Data{
+			"output": log,
+		})
+		return
+	}
+
+	recovered, found := grastate.RecoveredPosition(log)
+	if !found || !recovered.HasKnownPosition() {
+		s.logger.Info("wsrep-recover-no-position-found", lager.Data{
+			"output": log,
+		})
+		return
+	}
+
+	if recovered.UUID != state.UUID {
+		s.logger.Info("wsrep-recover-uuid-mismatch", lager.Data{
+			"grastateUUID":  state.UUID,
+			"recoveredUUID": recovered.UUID,
+		})
+		return
+	}
+
+	err = s.osHelper.WriteStringToFile(
+		s.config.GrastateFileLocation,
+		grastate.SetPosition(contents, recovered.UUID, recovered.Seqno),
+	)
+	if err != nil {
+		s.logger.Error("wsrep-recover-write-grastate-failed", err)
+		return
+	}
+
+	s.logger.Info("wsrep-recover-complete", lager.Data{
+		"uuid":  recovered.UUID,
+		"seqno": recovered.Seqno,
+	})
+}
+
+func (s *starter) bootstrapNode(ctx context.Context) (chan error, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	s.logger.Info("Updating safe_to_bootstrap flag")
-	read, err := ioutil.ReadFile(s.config.GrastateFileLocation)
-	if err == nil {
-		subbed := strings.Replace(string(read), "safe_to_bootstrap: 0", "safe_to_bootstrap: 1", -1)
-		err = ioutil.WriteFile(s.config.GrastateFileLocation, []byte(subbed), 0777)
+	if s.osHelper.FileExists(s.config.GrastateFileLocation) {
+		read, err := s.osHelper.ReadFile(s.config.GrastateFileLocation)
+		if err != nil {
+			return nil, err
+		}
+
+		subbed := strings.Replace(read, "safe_to_bootstrap: 0", "safe_to_bootstrap: 1", -1)
+		err = s.osHelper.WriteStringToFile(s.config.GrastateFileLocation, subbed)
 		if err != nil {
 			return nil, err
 		}
 	}
 
 	s.logger.Info("Bootstrapping node")
+	s.phaseReporter.SetPhase(bootstrap_elector.PhaseBootstrapping)
 	cmd, err := s.dbHelper.StartMysqldInBootstrap()
 	if err != nil {
 		return nil, err
 	}
 	s.mysqlCmd = cmd
+	s.startMode = BootstrapMode
 	s.logger.Info("Issusing a non-blocking Wait for mysqld in bootstrapping mode")
 	errorChan := s.osHelper.WaitForCommand(cmd)
 	return errorChan, nil
 }
 
-func (s *starter) joinCluster() (chan error, error) {
+func (s *starter) joinCluster(ctx context.Context) (chan error, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	s.logger.Info("Joining a multi-node cluster")
+	s.phaseReporter.SetPhase(bootstrap_elector.PhaseJoining)
 	cmd, err := s.dbHelper.StartMysqldInJoin()
 
 	if err != nil {
@@ -141,37 +295,91 @@ func (s *starter) joinCluster() (chan error, error) {
 	}
 
 	s.mysqlCmd = cmd
+	s.startMode = JoinMode
 	s.logger.Info("Issueing a non-blocking Wait for mysqld in join cluster mode")
 	mysqldChan := s.osHelper.WaitForCommand(cmd)
 
 	return mysqldChan, nil
 }
 
-func (s *starter) waitForDatabaseToAcceptConnections(mysqldChan chan error) error {
+// waitForDatabaseToAcceptConnections polls until the database is Synced.
+// Once StartupTimeout has elapsed it gives up, unless the node is still
+// receiving a state transfer, which may take up to StartupSSTGracePeriod longer.
+// exited reports whether mysqld exited while waiting.
+func (s *starter) waitForDatabaseToAcceptConnections(ctx context.Context, mysqldChan chan error) (exited bool, err error) {
 	s.logger.Info(fmt.Sprintf("Attempting to reach database."))
-	numTries := 0
 
-	for {
-		numTries++
+	pollInterval := time.Duration(s.config.StartupPollInterval) * time.Second
+	timeout := time.Duration(s.config.StartupTimeout) * time.Second
+	sstGracePeriod := time.Duration(s.config.StartupSSTGracePeriod) * time.Second
+
+	started := Now()
+	var lastState string
+	reachable := false
 
+	for {
 		select {
 		case <-mysqldChan:
 			s.logger.Info("Database process exited, stop trying to connect to database")
-			return errors.New("Mysqld exited with error; aborting. Review the mysqld error logs for more information.")
+			return true, errors.New("Mysqld exited with error; aborting. Review the mysqld error logs for more information.")
 		default:
-			if s.dbHelper.IsDatabaseReachable() {
-				s.logger.Info(fmt.Sprintf("Database became reachable after %d seconds", numTries*StartupPollingFrequencyInSeconds))
-				return nil
-			} else {
-				s.logger.Info("Database not reachable, retrying...")
-				s.osHelper.Sleep(StartupPollingFrequencyInSeconds * time.Second)
+		}
+
+		if s.dbHelper.IsDatabaseReachable(ctx) {
+			s.logger.Info(fmt.Sprintf("Database became reachable after %s", Now().Sub(started)))
+			return false, nil
+		}
+
+		state, err := s.dbHelper.GaleraState(ctx)
+		if err == nil {
+			reachable = true
+			lastState = state
+		}
+
+		if waited := Now().Sub(started); timeout > 0 && waited >= timeout {
+			inStateTransfer := (err == nil && isStateTransfer(state)) || s.dbHelper.IsReceivingStateTransfer()
+			if !inStateTransfer || waited >= timeout+sstGracePeriod {
+				return false, s.startupTimeoutError(waited, reachable, lastState)
 			}
+			s.logger.Info("startup-timeout-extended-for-state-transfer", lager.Data{
+				"waited":      waited.String(),
+				"galeraState": lastState,
+			})
+		}
+
+		s.logger.Info("Database not reachable, retrying...", lager.Data{
+			"galeraState": lastState,
+		})
+		if err := s.osHelper.Sleep(ctx, pollInterval); err != nil {
+			s.logger.Info("Stopped waiting for database", lager.Data{"reason": err.Error()})
+			return false, err
 		}
 	}
 }
 
-func (s *starter) seedDatabases() error {
-	err := s.dbHelper.Seed()
+func (s *starter) startupTimeoutError(waited time.Duration, reachable bool, lastState string) error {
+	var err error
+	if reachable {
+		err = fmt.Errorf("Database was reachable but not Synced after %s, last galera state was %q. Review the mysqld error logs for more information.", waited, lastState)
+	} else {
+		err = fmt.Errorf("Database was never reachable after %s. Review the mysqld error logs for more information.", waited)
+	}
+
+	s.logger.Error("startup-timed-out", err, lager.Data{
+		"reachable":   reachable,
+		"galeraState": lastState,
+	})
+	return err
+}
+
+// isStateTransfer reports whether a wsrep_local_state_comment belongs to a
+// joiner that is still receiving or applying a state transfer
+func isStateTransfer(state string) bool {
+	return strings.HasPrefix(state, "Joining") || state == "Joined"
+}
+
+func (s *starter) seedDatabases(ctx context.Context) error {
+	err := s.dbHelper.Seed(ctx)
 	if err != nil {
 		s.logger.Info(fmt.Sprintf("There was a problem seeding the database: '%s'", err.Error()))
 		return err
@@ -181,8 +389,8 @@ func (s *starter) seedDatabases() error {
 	return nil
 }
 
-func (s *starter) seedUsers() error {
-	err := s.dbHelper.SeedUsers()
+func (s *starter) seedUsers(ctx context.Context) error {
+	err := s.dbHelper.SeedUsers(ctx)
 	if err != nil {
 		s.logger.Info(fmt.Sprintf("There was a problem seeding the users: '%s'", err.Error()))
 		return err
@@ -192,8 +400,19 @@ func (s *starter) seedUsers() error {
 	return nil
 }
 
-func (s *starter) runPostStartSQL() error {
-	err := s.dbHelper.RunPostStartSQL()
+func (s *starter) reconcileAccounts(ctx context.Context) error {
+	err := s.dbHelper.ReconcileAccounts(ctx)
+	if err != nil {
+		s.logger.Info(fmt.Sprintf("There was a problem reconciling seeded accounts: '%s'", err.Error()))
+		return err
+	}
+
+	s.logger.Info("Reconciling seeded accounts succeeded.")
+	return nil
+}
+
+func (s *starter) runPostStartSQL(ctx context.Context) error {
+	err := s.dbHelper.RunPostStartSQL(ctx)
 	if err != nil {
 		s.logger.Info(fmt.Sprintf("There was a problem running post start sql: '%s'", err.Error()))
 		return err
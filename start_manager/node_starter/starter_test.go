@@ -1,18 +1,23 @@
 package node_starter_test
 
 import (
+	"context"
 	"errors"
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"time"
 
 	"code.cloudfoundry.org/lager/lagertest"
 
+	"github.com/cloudfoundry/galera-init/bootstrap_elector"
+	"github.com/cloudfoundry/galera-init/bootstrap_elector/bootstrap_electorfakes"
 	"github.com/cloudfoundry/galera-init/cluster_health_checker/cluster_health_checkerfakes"
 	"github.com/cloudfoundry/galera-init/config"
 	"github.com/cloudfoundry/galera-init/db_helper/db_helperfakes"
 	"github.com/cloudfoundry/galera-init/os_helper/os_helperfakes"
 	"github.com/cloudfoundry/galera-init/start_manager/node_starter"
+	"github.com/cloudfoundry/galera-init/start_manager/node_starter/node_starterfakes"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -24,6 +29,9 @@ var _ = Describe("Starter", func() {
 	var testLogger *lagertest.TestLogger
 	var fakeOs *os_helperfakes.FakeOsHelper
 	var fakeClusterHealthChecker *cluster_health_checkerfakes.FakeClusterHealthChecker
+	var fakeBootstrapElector *bootstrap_electorfakes.FakeBootstrapElector
+	var fakePhaseReporter *node_starterfakes.FakePhaseReporter
+	var starterConfig config.StartManager
 	var fakeDBHelper *db_helperfakes.FakeDBHelper
 	var fakeCommandBootstrapStr string
 	var fakeCommandBootstrap *exec.Cmd
@@ -31,6 +39,7 @@ var _ = Describe("Starter", func() {
 	var fakeCommandJoin *exec.Cmd
 	var errorChan chan error
 	var grastateFile *os.File
+	var now time.Time
 
 	ensureSeedDatabases := func() {
 		Expect(fakeDBHelper.SeedCallCount()).To(BeNumerically(">=", 1))
@@ -38,14 +47,19 @@ var _ = Describe("Starter", func() {
 
 	ensureSeedUsers := func() {
 		Expect(fakeDBHelper.SeedUsersCallCount()).To(BeNumerically(">=", 1))
+		Expect(fakeDBHelper.ReconcileAccountsCallCount()).To(BeNumerically(">=", 1))
 	}
 
 	ensureBootstrap := func() {
 		Expect(fakeDBHelper.StartMysqldInBootstrapCallCount()).To(Equal(1))
+		Expect(starter.GetStartMode()).To(Equal(node_starter.BootstrapMode))
+		Expect(fakePhaseReporter.SetPhaseArgsForCall(fakePhaseReporter.SetPhaseCallCount() - 1)).To(Equal(bootstrap_elector.PhaseBootstrapping))
 	}
 
 	ensureJoin := func() {
 		Expect(fakeDBHelper.StartMysqldInJoinCallCount()).To(Equal(1))
+		Expect(starter.GetStartMode()).To(Equal(node_starter.JoinMode))
+		Expect(fakePhaseReporter.SetPhaseArgsForCall(fakePhaseReporter.SetPhaseCallCount() - 1)).To(Equal(bootstrap_elector.PhaseJoining))
 	}
 
 	ensureMysqlCmdMatches := func(cmd string) {
@@ -65,20 +79,38 @@ var _ = Describe("Starter", func() {
 		fakeClusterHealthChecker = new(cluster_health_checkerfakes.FakeClusterHealthChecker)
 		fakeDBHelper = new(db_helperfakes.FakeDBHelper)
 		fakeDBHelper.IsDatabaseReachableReturns(true)
+		fakeBootstrapElector = new(bootstrap_electorfakes.FakeBootstrapElector)
+		fakePhaseReporter = new(node_starterfakes.FakePhaseReporter)
+
+		now = time.Date(2020, 10, 18, 12, 0, 0, 0, time.UTC)
+		node_starter.Now = func() time.Time {
+			return now
+		}
+		fakeOs.SleepStub = func(_ context.Context, duration time.Duration) error {
+			now = now.Add(duration)
+			return nil
+		}
 
 		grastateFile, _ = ioutil.TempFile(os.TempDir(), "grastateFile")
+		starterConfig = config.StartManager{
+			GrastateFileLocation: grastateFile.Name(),
+		}
+	})
+
+	JustBeforeEach(func() {
 		starter = node_starter.NewStarter(
 			fakeDBHelper,
 			fakeOs,
-			config.StartManager{
-				GrastateFileLocation: grastateFile.Name(),
-			},
+			starterConfig,
 			testLogger,
 			fakeClusterHealthChecker,
+			fakeBootstrapElector,
+			fakePhaseReporter,
 		)
 	})
 
 	AfterEach(func() {
+		node_starter.Now = time.Now
 		os.Remove(grastateFile.Name())
 	})
 
@@ -98,10 +130,11 @@ var _ = Describe("Starter", func() {
 			})
 
 			It("bootstraps, seeds databases and sets read only user", func() {
-				newNodeState, mysqlErrChan, err := starter.StartNodeFromState("SINGLE_NODE")
+				newNodeState, mysqlErrChan, err := starter.StartNodeFromState(context.TODO(), "SINGLE_NODE")
 				Expect(err).ToNot(HaveOccurred())
 				Expect(newNodeState).To(Equal("SINGLE_NODE"))
 				Expect(mysqlErrChan).NotTo(BeNil())
+				Expect(fakeDBHelper.ReloadPasswordsCallCount()).To(Equal(1))
 				ensureBootstrap()
 				ensureSeedDatabases()
 				ensureSeedUsers()
@@ -111,28 +144,29 @@ var _ = Describe("Starter", func() {
 
 			Describe("grastate file", func() {
 				BeforeEach(func() {
-					grastateFile.Chmod(0777)
-					err := ioutil.WriteFile(grastateFile.Name(), []byte("IMPORTANT OTHER STUFF\nsafe_to_bootstrap: 0\nLESS IMPORTANT STUFF"), 0777)
-					Expect(err).ToNot(HaveOccurred())
+					fakeOs.FileExistsReturns(true)
+					fakeOs.ReadFileReturns("IMPORTANT OTHER STUFF\nsafe_to_bootstrap: 0\nLESS IMPORTANT STUFF", nil)
 				})
 
 				It("updates the grastate file's safe_to_bootstrap", func() {
-					_, _, err := starter.StartNodeFromState("SINGLE_NODE")
+					_, _, err := starter.StartNodeFromState(context.TODO(), "SINGLE_NODE")
 					Expect(err).ToNot(HaveOccurred())
 
-					grastateFileOutput, _ := ioutil.ReadFile(grastateFile.Name())
-					Expect(string(grastateFileOutput)).To(Equal("IMPORTANT OTHER STUFF\nsafe_to_bootstrap: 1\nLESS IMPORTANT STUFF"))
+					Expect(fakeOs.WriteStringToFileCallCount()).To(Equal(1))
+					filename, contents := fakeOs.WriteStringToFileArgsForCall(0)
+					Expect(filename).To(Equal(grastateFile.Name()))
+					Expect(contents).To(Equal("IMPORTANT OTHER STUFF\nsafe_to_bootstrap: 1\nLESS IMPORTANT STUFF"))
 				})
 
 				Describe("when it is not present", func() {
 					BeforeEach(func() {
-						os.Remove(grastateFile.Name())
+						fakeOs.FileExistsReturns(false)
 					})
 
 					It("does not create the file", func() {
-						_, _, err := starter.StartNodeFromState("SINGLE_NODE")
+						_, _, err := starter.StartNodeFromState(context.TODO(), "SINGLE_NODE")
 						Expect(err).ToNot(HaveOccurred())
-						Expect(grastateFile.Name()).ShouldNot(BeAnExistingFile())
+						Expect(fakeOs.WriteStringToFileCallCount()).To(Equal(0))
 					})
 				})
 			})
@@ -145,7 +179,7 @@ var _ = Describe("Starter", func() {
 				})
 
 				It("bootstraps, seeds databases and sets read only user", func() {
-					newNodeState, _, err := starter.StartNodeFromState("NEEDS_BOOTSTRAP")
+					newNodeState, _, err := starter.StartNodeFromState(context.TODO(), "NEEDS_BOOTSTRAP")
 					Expect(err).ToNot(HaveOccurred())
 					Expect(newNodeState).To(Equal("CLUSTERED"))
 					ensureBootstrap()
@@ -157,28 +191,29 @@ var _ = Describe("Starter", func() {
 
 				Describe("grastate file", func() {
 					BeforeEach(func() {
-						grastateFile.Chmod(0777)
-						err := ioutil.WriteFile(grastateFile.Name(), []byte("IMPORTANT OTHER STUFF\nsafe_to_bootstrap: 0\nLESS IMPORTANT STUFF"), 0777)
-						Expect(err).ToNot(HaveOccurred())
+						fakeOs.FileExistsReturns(true)
+						fakeOs.ReadFileReturns("IMPORTANT OTHER STUFF\nsafe_to_bootstrap: 0\nLESS IMPORTANT STUFF", nil)
 					})
 
 					It("updates the grastate file's safe_to_bootstrap", func() {
-						_, _, err := starter.StartNodeFromState("NEEDS_BOOTSTRAP")
+						_, _, err := starter.StartNodeFromState(context.TODO(), "NEEDS_BOOTSTRAP")
 						Expect(err).ToNot(HaveOccurred())
 
-						grastateFileOutput, _ := ioutil.ReadFile(grastateFile.Name())
-						Expect(string(grastateFileOutput)).To(Equal("IMPORTANT OTHER STUFF\nsafe_to_bootstrap: 1\nLESS IMPORTANT STUFF"))
+						Expect(fakeOs.WriteStringToFileCallCount()).To(Equal(1))
+						filename, contents := fakeOs.WriteStringToFileArgsForCall(0)
+						Expect(filename).To(Equal(grastateFile.Name()))
+						Expect(contents).To(Equal("IMPORTANT OTHER STUFF\nsafe_to_bootstrap: 1\nLESS IMPORTANT STUFF"))
 					})
 
 					Describe("when it is not present", func() {
 						BeforeEach(func() {
-							os.Remove(grastateFile.Name())
+							fakeOs.FileExistsReturns(false)
 						})
 
 						It("does not create the file", func() {
-							_, _, err := starter.StartNodeFromState("NEEDS_BOOTSTRAP")
+							_, _, err := starter.StartNodeFromState(context.TODO(), "NEEDS_BOOTSTRAP")
 							Expect(err).ToNot(HaveOccurred())
-							Expect(grastateFile.Name()).ShouldNot(BeAnExistingFile())
+							Expect(fakeOs.WriteStringToFileCallCount()).To(Equal(0))
 						})
 					})
 				})
@@ -190,7 +225,7 @@ var _ = Describe("Starter", func() {
 				})
 
 				It("joins the cluster", func() {
-					newNodeState, _, err := starter.StartNodeFromState("NEEDS_BOOTSTRAP")
+					newNodeState, _, err := starter.StartNodeFromState(context.TODO(), "NEEDS_BOOTSTRAP")
 					Expect(err).ToNot(HaveOccurred())
 					Expect(newNodeState).To(Equal("CLUSTERED"))
 					ensureJoin()
@@ -208,7 +243,7 @@ var _ = Describe("Starter", func() {
 			})
 
 			It("joins the cluster", func() {
-				newNodeState, _, err := starter.StartNodeFromState("CLUSTERED")
+				newNodeState, _, err := starter.StartNodeFromState(context.TODO(), "CLUSTERED")
 				Expect(err).ToNot(HaveOccurred())
 				Expect(newNodeState).To(Equal("CLUSTERED"))
 				ensureJoin()
@@ -219,10 +254,189 @@ var _ = Describe("Starter", func() {
 			})
 		})
 
+		Context("when grastate.dat has seqno -1 after a crash", func() {
+			BeforeEach(func() {
+				starterConfig.SeqnoAwareBootstrap = true
+				fakeClusterHealthChecker.HealthyClusterReturns(false)
+				fakeBootstrapElector.ElectReturns(bootstrap_elector.NotElected)
+				fakeOs.FileExistsReturns(true)
+				fakeOs.ReadFileReturns("version: 2.1\nuuid:    8bd3bf94-3b65-11ea-a4ea-8bd1cbb0c6b8\nseqno:   -1\nsafe_to_bootstrap: 0\n", nil)
+				fakeDBHelper.RecoverPositionReturns("WSREP: Recovered position: 8bd3bf94-3b65-11ea-a4ea-8bd1cbb0c6b8:1234\n", nil)
+			})
+
+			It("recovers the position before the bootstrap election", func() {
+				fakeBootstrapElector.ElectStub = func(context.Context) bootstrap_elector.Result {
+					Expect(fakeOs.WriteStringToFileCallCount()).To(Equal(1))
+					return bootstrap_elector.NotElected
+				}
+
+				_, _, err := starter.StartNodeFromState(context.TODO(), "CLUSTERED")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(fakeDBHelper.RecoverPositionCallCount()).To(Equal(1))
+				Expect(fakeBootstrapElector.ElectCallCount()).To(Equal(1))
+
+				Expect(fakeOs.WriteStringToFileCallCount()).To(Equal(1))
+				filename, contents := fakeOs.WriteStringToFileArgsForCall(0)
+				Expect(filename).To(Equal(grastateFile.Name()))
+				Expect(contents).To(Equal("version: 2.1\nuuid:    8bd3bf94-3b65-11ea-a4ea-8bd1cbb0c6b8\nseqno:   1234\nsafe_to_bootstrap: 0\n"))
+			})
+
+			It("does not run recovery for a single node", func() {
+				_, _, err := starter.StartNodeFromState(context.TODO(), "SINGLE_NODE")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(fakeDBHelper.RecoverPositionCallCount()).To(Equal(0))
+			})
+
+			It("does not run recovery when the cluster is healthy", func() {
+				fakeClusterHealthChecker.HealthyClusterReturns(true)
+
+				for _, state := range []string{"CLUSTERED", "NEEDS_BOOTSTRAP"} {
+					_, _, err := starter.StartNodeFromState(context.TODO(), state)
+					Expect(err).ToNot(HaveOccurred())
+				}
+				Expect(fakeDBHelper.RecoverPositionCallCount()).To(Equal(0))
+			})
+
+			Context("when seqno aware bootstrap is disabled", func() {
+				BeforeEach(func() {
+					starterConfig.SeqnoAwareBootstrap = false
+				})
+
+				It("does not run recovery", func() {
+					_, _, err := starter.StartNodeFromState(context.TODO(), "CLUSTERED")
+					Expect(err).ToNot(HaveOccurred())
+					Expect(fakeDBHelper.RecoverPositionCallCount()).To(Equal(0))
+				})
+			})
+
+			It("leaves grastate.dat alone when recovery fails", func() {
+				fakeDBHelper.RecoverPositionReturns("", errors.New("mysqld failed"))
+
+				_, _, err := starter.StartNodeFromState(context.TODO(), "CLUSTERED")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(fakeOs.WriteStringToFileCallCount()).To(Equal(0))
+				ensureJoin()
+			})
+
+			It("leaves grastate.dat alone when the recovered position belongs to another cluster", func() {
+				fakeDBHelper.RecoverPositionReturns("WSREP: Recovered position: 11111111-3b65-11ea-a4ea-8bd1cbb0c6b8:1234\n", nil)
+
+				_, _, err := starter.StartNodeFromState(context.TODO(), "CLUSTERED")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(fakeOs.WriteStringToFileCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when grastate.dat records a known seqno", func() {
+			BeforeEach(func() {
+				starterConfig.SeqnoAwareBootstrap = true
+				fakeClusterHealthChecker.HealthyClusterReturns(false)
+				fakeOs.FileExistsReturns(true)
+				fakeOs.ReadFileReturns("uuid:    8bd3bf94-3b65-11ea-a4ea-8bd1cbb0c6b8\nseqno:   1234\n", nil)
+			})
+
+			It("does not run recovery", func() {
+				_, _, err := starter.StartNodeFromState(context.TODO(), "CLUSTERED")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(fakeDBHelper.RecoverPositionCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when seqno aware bootstrap is enabled", func() {
+			BeforeEach(func() {
+				starterConfig.SeqnoAwareBootstrap = true
+				fakeClusterHealthChecker.HealthyClusterReturns(false)
+			})
+
+			Context("starting with state CLUSTERED", func() {
+				It("bootstraps when this node wins the election", func() {
+					fakeBootstrapElector.ElectReturns(bootstrap_elector.Elected)
+
+					newNodeState, _, err := starter.StartNodeFromState(context.TODO(), "CLUSTERED")
+					Expect(err).ToNot(HaveOccurred())
+					Expect(newNodeState).To(Equal("CLUSTERED"))
+					ensureBootstrap()
+					ensureMysqlCmdMatches(fakeCommandBootstrapStr)
+				})
+
+				It("joins when another node wins the election", func() {
+					fakeBootstrapElector.ElectReturns(bootstrap_elector.NotElected)
+
+					_, _, err := starter.StartNodeFromState(context.TODO(), "CLUSTERED")
+					Expect(err).ToNot(HaveOccurred())
+					ensureJoin()
+				})
+
+				It("joins without an election when the cluster is healthy", func() {
+					fakeClusterHealthChecker.HealthyClusterReturns(true)
+
+					_, _, err := starter.StartNodeFromState(context.TODO(), "CLUSTERED")
+					Expect(err).ToNot(HaveOccurred())
+					ensureJoin()
+					Expect(fakeBootstrapElector.ElectCallCount()).To(Equal(0))
+				})
+			})
+
+			Context("starting with state NEEDS_BOOTSTRAP", func() {
+				It("joins when another node holds a higher seqno", func() {
+					fakeBootstrapElector.ElectReturns(bootstrap_elector.NotElected)
+
+					_, _, err := starter.StartNodeFromState(context.TODO(), "NEEDS_BOOTSTRAP")
+					Expect(err).ToNot(HaveOccurred())
+					ensureJoin()
+				})
+
+				It("bootstraps a new cluster when there is no local data", func() {
+					fakeBootstrapElector.ElectReturns(bootstrap_elector.NoLocalData)
+
+					_, _, err := starter.StartNodeFromState(context.TODO(), "NEEDS_BOOTSTRAP")
+					Expect(err).ToNot(HaveOccurred())
+					ensureBootstrap()
+				})
+			})
+
+			Context("when the election is undecided", func() {
+				BeforeEach(func() {
+					fakeBootstrapElector.ElectReturns(bootstrap_elector.Undecided)
+				})
+
+				It("fails without starting mysqld", func() {
+					for _, state := range []string{"CLUSTERED", "NEEDS_BOOTSTRAP"} {
+						_, _, err := starter.StartNodeFromState(context.TODO(), state)
+						Expect(err).To(MatchError(ContainSubstring("Bootstrap election undecided")))
+					}
+					Expect(fakeDBHelper.StartMysqldInBootstrapCallCount()).To(Equal(0))
+					Expect(fakeDBHelper.StartMysqldInJoinCallCount()).To(Equal(0))
+				})
+
+				It("forwards the cancellation when the context is done", func() {
+					ctx, cancel := context.WithCancel(context.Background())
+					cancel()
+
+					_, _, err := starter.StartNodeFromState(ctx, "CLUSTERED")
+					Expect(err).To(MatchError(context.Canceled))
+					Expect(fakeDBHelper.StartMysqldInJoinCallCount()).To(Equal(0))
+				})
+			})
+		})
+
 		Context("error handling", func() {
+			Context("when reloading passwords fails", func() {
+				BeforeEach(func() {
+					fakeDBHelper.ReloadPasswordsReturns(errors.New("Db.PasswordEnv : MYSQL_PASSWORD is not set"))
+				})
+
+				It("forwards the error and does not start mysqld", func() {
+					_, _, err := starter.StartNodeFromState(context.TODO(), "SINGLE_NODE")
+					Expect(err).To(MatchError("Db.PasswordEnv : MYSQL_PASSWORD is not set"))
+					Expect(fakeDBHelper.RecoverPositionCallCount()).To(Equal(0))
+					Expect(fakeDBHelper.StartMysqldInBootstrapCallCount()).To(Equal(0))
+				})
+			})
+
 			Context("when passed a an invalid state", func() {
 				It("forwards the error", func() {
-					_, _, err := starter.StartNodeFromState("INVALID_STATE")
+					_, _, err := starter.StartNodeFromState(context.TODO(), "INVALID_STATE")
 					Expect(err).To(HaveOccurred())
 					Expect(err.Error()).To(ContainSubstring("Unsupported state file contents"))
 				})
@@ -235,7 +449,7 @@ var _ = Describe("Starter", func() {
 					fakeDBHelper.IsDatabaseReachableReturns(false)
 
 					var err error
-					_, _, err = starter.StartNodeFromState("CLUSTERED")
+					_, _, err = starter.StartNodeFromState(context.TODO(), "CLUSTERED")
 					Expect(err).Should(HaveOccurred())
 					Expect(err.Error()).To(ContainSubstring(expectedErr))
 				})
@@ -245,12 +459,122 @@ var _ = Describe("Starter", func() {
 					fakeDBHelper.IsDatabaseReachableReturns(false)
 
 					var err error
-					_, _, err = starter.StartNodeFromState("CLUSTERED")
+					_, _, err = starter.StartNodeFromState(context.TODO(), "CLUSTERED")
 					Expect(err).Should(HaveOccurred())
 					Expect(err.Error()).To(ContainSubstring(expectedErr))
 				})
 			})
 
+			Context("when the database does not become Synced before the startup timeout", func() {
+				BeforeEach(func() {
+					starterConfig.StartupPollInterval = 5
+					starterConfig.StartupTimeout = 20
+					starterConfig.StartupSSTGracePeriod = 30
+					fakeDBHelper.IsDatabaseReachableReturns(false)
+				})
+
+				It("reports that the database was never reachable", func() {
+					fakeDBHelper.GaleraStateReturns("", errors.New("connection refused"))
+
+					_, _, err := starter.StartNodeFromState(context.TODO(), "CLUSTERED")
+					Expect(err).To(MatchError(ContainSubstring("Database was never reachable after 20s")))
+					Expect(fakeOs.SleepCallCount()).To(Equal(4))
+					_, pollInterval := fakeOs.SleepArgsForCall(0)
+					Expect(pollInterval).To(Equal(5 * time.Second))
+					Expect(fakeDBHelper.SeedCallCount()).To(Equal(0))
+				})
+
+				It("reports the last galera state when the database was reachable but not Synced", func() {
+					fakeDBHelper.GaleraStateReturns("Initialized", nil)
+
+					_, _, err := starter.StartNodeFromState(context.TODO(), "CLUSTERED")
+					Expect(err).To(MatchError(ContainSubstring(`Database was reachable but not Synced after 20s, last galera state was "Initialized"`)))
+					Expect(fakeOs.SleepCallCount()).To(Equal(4))
+				})
+
+				It("extends the deadline by the grace period while a state transfer is in progress", func() {
+					fakeDBHelper.GaleraStateReturns("Joining: receiving State Transfer", nil)
+
+					_, _, err := starter.StartNodeFromState(context.TODO(), "CLUSTERED")
+					Expect(err).To(MatchError(ContainSubstring(`Database was reachable but not Synced after 50s, last galera state was "Joining: receiving State Transfer"`)))
+					Expect(fakeOs.SleepCallCount()).To(Equal(10))
+				})
+
+				It("extends the deadline while an SST script receives a state transfer", func() {
+					fakeDBHelper.GaleraStateReturns("", errors.New("connection refused"))
+					fakeDBHelper.IsReceivingStateTransferReturns(true)
+
+					_, _, err := starter.StartNodeFromState(context.TODO(), "CLUSTERED")
+					Expect(err).To(MatchError(ContainSubstring("Database was never reachable after 50s")))
+					Expect(fakeOs.SleepCallCount()).To(Equal(10))
+				})
+
+				It("measures the time waited with the clock rather than the poll interval", func() {
+					fakeDBHelper.GaleraStateStub = func(context.Context) (string, error) {
+						now = now.Add(25 * time.Second)
+						return "", errors.New("connection refused")
+					}
+
+					_, _, err := starter.StartNodeFromState(context.TODO(), "CLUSTERED")
+					Expect(err).To(MatchError(ContainSubstring("Database was never reachable after 25s")))
+					Expect(fakeOs.SleepCallCount()).To(Equal(0))
+				})
+
+				It("succeeds when the state transfer completes within the grace period", func() {
+					fakeDBHelper.GaleraStateReturns("Joining: receiving State Transfer", nil)
+					fakeDBHelper.IsDatabaseReachableStub = func(context.Context) bool {
+						return fakeDBHelper.IsDatabaseReachableCallCount() > 7
+					}
+
+					_, _, err := starter.StartNodeFromState(context.TODO(), "CLUSTERED")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(fakeDBHelper.SeedCallCount()).To(Equal(1))
+				})
+			})
+
+			Context("when the context is cancelled", func() {
+				var (
+					ctx    context.Context
+					cancel context.CancelFunc
+				)
+
+				BeforeEach(func() {
+					ctx, cancel = context.WithCancel(context.Background())
+				})
+
+				It("does not start mysqld", func() {
+					cancel()
+
+					_, mysqldChan, err := starter.StartNodeFromState(ctx, "CLUSTERED")
+					Expect(err).To(Equal(context.Canceled))
+					Expect(mysqldChan).To(BeNil())
+					Expect(fakeDBHelper.StartMysqldInJoinCallCount()).To(Equal(0))
+				})
+
+				It("stops waiting for the database and returns the running mysqld", func() {
+					fakeDBHelper.IsDatabaseReachableReturns(false)
+					fakeOs.SleepStub = func(context.Context, time.Duration) error {
+						cancel()
+						return context.Canceled
+					}
+
+					_, mysqldChan, err := starter.StartNodeFromState(ctx, "CLUSTERED")
+					Expect(err).To(Equal(context.Canceled))
+					Expect(mysqldChan).NotTo(BeNil())
+					Expect(fakeOs.SleepCallCount()).To(Equal(1))
+					Expect(fakeDBHelper.SeedCallCount()).To(Equal(0))
+				})
+
+				It("passes the context to seeding", func() {
+					_, _, err := starter.StartNodeFromState(ctx, "CLUSTERED")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(fakeDBHelper.SeedArgsForCall(0)).To(Equal(ctx))
+					Expect(fakeDBHelper.SeedUsersArgsForCall(0)).To(Equal(ctx))
+					Expect(fakeDBHelper.ReconcileAccountsArgsForCall(0)).To(Equal(ctx))
+					Expect(fakeDBHelper.RunPostStartSQLArgsForCall(0)).To(Equal(ctx))
+				})
+			})
+
 			Context("starting cluster returns an error", func() {
 				BeforeEach(func() {
 					fakeDBHelper.StartMysqldInBootstrapReturns(nil, errors.New("some errors"))
@@ -259,7 +583,7 @@ var _ = Describe("Starter", func() {
 
 				Context("SINGLE_NODE", func() {
 					It("forwards the error", func() {
-						_, _, err := starter.StartNodeFromState("SINGLE_NODE")
+						_, _, err := starter.StartNodeFromState(context.TODO(), "SINGLE_NODE")
 						Expect(err).To(HaveOccurred())
 						Expect(err.Error()).To(ContainSubstring("some errors"))
 					})
@@ -267,7 +591,7 @@ var _ = Describe("Starter", func() {
 
 				Context("NEEDS_BOOTSTRAP", func() {
 					It("forwards the error", func() {
-						_, _, err := starter.StartNodeFromState("NEEDS_BOOTSTRAP")
+						_, _, err := starter.StartNodeFromState(context.TODO(), "NEEDS_BOOTSTRAP")
 						Expect(err).To(HaveOccurred())
 						Expect(err.Error()).To(ContainSubstring("some errors"))
 					})
@@ -275,13 +599,27 @@ var _ = Describe("Starter", func() {
 
 				Context("CLUSTERED", func() {
 					It("forwards the error", func() {
-						_, _, err := starter.StartNodeFromState("CLUSTERED")
+						_, _, err := starter.StartNodeFromState(context.TODO(), "CLUSTERED")
 						Expect(err).To(HaveOccurred())
 						Expect(err.Error()).To(ContainSubstring("some errors"))
 					})
 				})
 			})
 
+			Context("when updating safe_to_bootstrap fails", func() {
+				BeforeEach(func() {
+					fakeOs.FileExistsReturns(true)
+					fakeOs.ReadFileReturns("safe_to_bootstrap: 0", nil)
+					fakeOs.WriteStringToFileReturns(errors.New("disk full"))
+				})
+
+				It("does not bootstrap", func() {
+					_, _, err := starter.StartNodeFromState(context.TODO(), "SINGLE_NODE")
+					Expect(err).To(MatchError("disk full"))
+					Expect(fakeDBHelper.StartMysqldInBootstrapCallCount()).To(Equal(0))
+				})
+			})
+
 			Context("when database seeding fails", func() {
 				var expectedErr error
 				BeforeEach(func() {
@@ -290,19 +628,31 @@ var _ = Describe("Starter", func() {
 				})
 
 				It("forwards the error", func() {
-					_, _, err := starter.StartNodeFromState("SINGLE_NODE")
+					_, _, err := starter.StartNodeFromState(context.TODO(), "SINGLE_NODE")
 					Expect(err).To(HaveOccurred())
 					Expect(err).To(Equal(expectedErr))
 				})
 			})
 
+			Context("when reconciling seeded accounts fails", func() {
+				BeforeEach(func() {
+					fakeDBHelper.ReconcileAccountsReturns(errors.New("reconciling accounts failed"))
+				})
+
+				It("forwards the error and does not run post start sql", func() {
+					_, _, err := starter.StartNodeFromState(context.TODO(), "SINGLE_NODE")
+					Expect(err).To(MatchError("reconciling accounts failed"))
+					Expect(fakeDBHelper.RunPostStartSQLCallCount()).To(Equal(0))
+				})
+			})
+
 			Context("when running post start sql fails", func() {
 				BeforeEach(func() {
 					fakeDBHelper.RunPostStartSQLReturns(errors.New("post start sql failed"))
 				})
 
 				It("forwards the error", func() {
-					_, _, err := starter.StartNodeFromState("SINGLE_NODE")
+					_, _, err := starter.StartNodeFromState(context.TODO(), "SINGLE_NODE")
 					Expect(err).To(HaveOccurred())
 					Expect(err.Error()).To(ContainSubstring("post start sql failed"))
 				})
@@ -0,0 +1,84 @@
+package node_state
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	FormatVersion = 1
+	MaxHistory    = 20
+)
+
+// Record describes the outcome of a single galera-init start
+type Record struct {
+	State             string    `json:"state"`
+	PreviousState     string    `json:"previous_state,omitempty"`
+	StartMode         string    `json:"start_mode,omitempty"`
+	Timestamp         time.Time `json:"timestamp"`
+	GaleraInitVersion string    `json:"galera_init_version,omitempty"`
+	ClusterUUID       string    `json:"cluster_uuid,omitempty"`
+	ClusterIps        []string  `json:"cluster_ips,omitempty"`
+}
+
+// StateFile is the document persisted at StateFileLocation. The embedded
+// Record is the latest transition; older ones are kept in History, newest first.
+type StateFile struct {
+	Version int `json:"version"`
+	Record
+	History []Record `json:"history,omitempty"`
+}
+
+// Parse reads a state file. Files written before the JSON format, which only
+// contain the bare state, are migrated into a StateFile without history.
+func Parse(contents string) (StateFile, error) {
+	trimmed := strings.TrimSpace(contents)
+
+	if !strings.HasPrefix(trimmed, "{") {
+		return StateFile{
+			Version: FormatVersion,
+			Record:  Record{State: trimmed},
+		}, nil
+	}
+
+	var stateFile StateFile
+	if err := json.Unmarshal([]byte(trimmed), &stateFile); err != nil {
+		return StateFile{}, errors.Wrap(err, "invalid state file")
+	}
+
+	if stateFile.Version > FormatVersion {
+		return StateFile{}, fmt.Errorf("unsupported state file version %d", stateFile.Version)
+	}
+
+	return stateFile, nil
+}
+
+// Transition returns a copy of the state file with record as the latest state
+// and the previous latest state pushed onto the bounded history.
+func (s StateFile) Transition(record Record) StateFile {
+	history := s.History
+	if s.State != "" {
+		history = append([]Record{s.Record}, history...)
+	}
+	if len(history) > MaxHistory {
+		history = history[:MaxHistory]
+	}
+
+	return StateFile{
+		Version: FormatVersion,
+		Record:  record,
+		History: history,
+	}
+}
+
+func (s StateFile) Marshal() (string, error) {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(b) + "\n", nil
+}
@@ -0,0 +1,13 @@
+package node_state_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestNodeState(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "NodeState Suite")
+}
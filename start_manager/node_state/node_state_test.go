@@ -0,0 +1,70 @@
+package node_state_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/cloudfoundry/galera-init/start_manager/node_state"
+)
+
+var _ = Describe("NodeState", func() {
+	Describe("Parse", func() {
+		It("migrates a legacy plain text state", func() {
+			stateFile, err := node_state.Parse("\n  CLUSTERED \n")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stateFile).To(Equal(node_state.StateFile{
+				Version: node_state.FormatVersion,
+				Record:  node_state.Record{State: "CLUSTERED"},
+			}))
+		})
+
+		It("round-trips a marshalled state file", func() {
+			original := node_state.StateFile{}.Transition(node_state.Record{
+				State:             "CLUSTERED",
+				StartMode:         "bootstrap",
+				Timestamp:         time.Date(2020, 1, 20, 12, 0, 0, 0, time.UTC),
+				GaleraInitVersion: "1.2.3",
+				ClusterUUID:       "8bd3bf94-3b65-11ea-a4ea-8bd1cbb0c6b8",
+				ClusterIps:        []string{"10.0.0.1", "10.0.0.2"},
+			})
+
+			contents, err := original.Marshal()
+			Expect(err).NotTo(HaveOccurred())
+
+			parsed, err := node_state.Parse(contents)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(parsed).To(Equal(original))
+		})
+
+		It("rejects state files written by a newer galera-init", func() {
+			_, err := node_state.Parse(`{"version": 99, "state": "CLUSTERED"}`)
+			Expect(err).To(MatchError("unsupported state file version 99"))
+		})
+	})
+
+	Describe("Transition", func() {
+		It("moves the latest record into the history, newest first", func() {
+			stateFile := node_state.StateFile{}.
+				Transition(node_state.Record{State: "NEEDS_BOOTSTRAP"}).
+				Transition(node_state.Record{State: "CLUSTERED"}).
+				Transition(node_state.Record{State: "SINGLE_NODE"})
+
+			Expect(stateFile.State).To(Equal("SINGLE_NODE"))
+			Expect(stateFile.History).To(Equal([]node_state.Record{
+				{State: "CLUSTERED"},
+				{State: "NEEDS_BOOTSTRAP"},
+			}))
+		})
+
+		It("drops the oldest records beyond MaxHistory", func() {
+			stateFile := node_state.StateFile{}
+			for i := 0; i < node_state.MaxHistory+5; i++ {
+				stateFile = stateFile.Transition(node_state.Record{State: "CLUSTERED"})
+			}
+
+			Expect(stateFile.History).To(HaveLen(node_state.MaxHistory))
+		})
+	})
+})
@@ -4,16 +4,20 @@ import (
 	"context"
 	"fmt"
 	"os/exec"
-	"strings"
 	"syscall"
+	"time"
 
 	"code.cloudfoundry.org/lager"
+	"github.com/pkg/errors"
 
 	"github.com/cloudfoundry/galera-init/cluster_health_checker"
 	"github.com/cloudfoundry/galera-init/config"
 	"github.com/cloudfoundry/galera-init/db_helper"
+	"github.com/cloudfoundry/galera-init/grastate"
 	"github.com/cloudfoundry/galera-init/os_helper"
 	"github.com/cloudfoundry/galera-init/start_manager/node_starter"
+	"github.com/cloudfoundry/galera-init/start_manager/node_state"
+	"github.com/cloudfoundry/galera-init/upgrade_coordinator"
 	"github.com/cloudfoundry/galera-init/upgrader"
 )
 
@@ -23,9 +27,23 @@ type StartManager interface {
 	Shutdown()
 }
 
+const (
+	PhaseUpgradePending = upgrade_coordinator.PhaseUpgradePending
+	PhaseUpgrading      = upgrade_coordinator.PhaseUpgrading
+	PhaseStartingMysqld = "starting-mysqld"
+	PhaseRunning        = upgrade_coordinator.PhaseRunning
+	PhaseStopping       = "stopping"
+	PhaseMysqldExited   = "mysqld-exited"
+	PhaseRestarting     = "restarting-mysqld"
+)
+
+// A crash after mysqld has been up for this long no longer counts towards the supervisor's crash-loop budget
+var SupervisorStablePeriod = 10 * time.Minute
+
 //go:generate go run github.com/maxbrunsfeld/counterfeiter/v6 . ServiceStatus
 type ServiceStatus interface {
 	Start() error
+	SetPhase(phase string)
 }
 
 type startManager struct {
@@ -33,12 +51,16 @@ type startManager struct {
 	config                 config.StartManager
 	dbHelper               db_helper.DBHelper
 	upgrader               upgrader.Upgrader
+	upgradeCoordinator     upgrade_coordinator.UpgradeCoordinator
 	startCaller            node_starter.Starter
 	logger                 lager.Logger
 	healthChecker          cluster_health_checker.ClusterHealthChecker
 	mysqlCmd               *exec.Cmd
 	mysqldPid              int
 	galeraInitStatusServer ServiceStatus
+	galeraInitVersion      string
+	lastStart              time.Time
+	consecutiveCrashes     int
 }
 
 func New(
@@ -46,10 +68,12 @@ func New(
 	config config.StartManager,
 	dbHelper db_helper.DBHelper,
 	upgrader upgrader.Upgrader,
+	upgradeCoordinator upgrade_coordinator.UpgradeCoordinator,
 	startCaller node_starter.Starter,
 	logger lager.Logger,
 	healthChecker cluster_health_checker.ClusterHealthChecker,
 	galeraInitStatusServer ServiceStatus,
+	galeraInitVersion string,
 ) StartManager {
 	return &startManager{
 		osHelper:               osHelper,
@@ -57,16 +81,15 @@ func New(
 		logger:                 logger,
 		dbHelper:               dbHelper,
 		upgrader:               upgrader,
+		upgradeCoordinator:     upgradeCoordinator,
 		startCaller:            startCaller,
 		healthChecker:          healthChecker,
 		galeraInitStatusServer: galeraInitStatusServer,
+		galeraInitVersion:      galeraInitVersion,
 	}
 }
 
 func (m *startManager) Execute(ctx context.Context) error {
-	var newNodeState string
-	var err error
-
 	if m.dbHelper.IsProcessRunning() {
 		m.logger.Info("mysqld-already-running")
 		m.logger.Info("shutdown-old-mysql")
@@ -79,69 +102,223 @@ func (m *startManager) Execute(ctx context.Context) error {
 		return err
 	}
 	if needsUpgrade {
-		err = m.upgrader.Upgrade()
+		m.galeraInitStatusServer.SetPhase(PhaseUpgradePending)
+		err = m.upgradeCoordinator.WaitForTurn(ctx)
+		if err != nil && err == ctx.Err() {
+			m.logger.Info("shutdown-while-waiting-to-upgrade")
+			return nil
+		}
+		if err != nil {
+			m.logger.Error("upgrade-coordination-failed", err)
+			return err
+		}
+
+		m.galeraInitStatusServer.SetPhase(PhaseUpgrading)
+		err = m.upgrader.Upgrade(ctx)
+		if err != nil && err == ctx.Err() {
+			m.logger.Info("shutdown-during-upgrade")
+			return nil
+		}
 		if err != nil {
 			m.logger.Error("mysql-upgrade-failed", err)
 			return err
 		}
 	}
 
-	m.logger.Info("determining-bootstrap-procedure", lager.Data{
-		"ClusterIps":    m.config.ClusterIps,
-		"BootstrapNode": m.config.BootstrapNode,
-	})
-
-	currentState, err := m.getCurrentNodeState()
-	if err != nil {
+	mysqldChan, err := m.startMysqld(ctx)
+	if err != nil || mysqldChan == nil {
 		return err
 	}
 
-	var mysqldChan <-chan error
+	m.logger.Info("bootstrap-complete")
+	m.logger.Info("waiting-for-mysqld")
 
-	newNodeState, mysqldChan, err = m.startCaller.StartNodeFromState(currentState)
-	if err != nil {
-		return err
+	m.logger.Info("status-server-starting")
+	m.galeraInitStatusServer.Start()
+	m.galeraInitStatusServer.SetPhase(PhaseRunning)
+	m.logger.Info("status-server-started")
+
+	for {
+		select {
+		case err := <-mysqldChan:
+			m.galeraInitStatusServer.SetPhase(PhaseMysqldExited)
+			m.logger.Info("mysqld-exited", lager.Data{
+				"error": err,
+			})
+			if err == nil || !m.config.Supervise {
+				return err
+			}
+
+			mysqldChan, err = m.restartMysqld(ctx, err)
+			if err != nil || mysqldChan == nil {
+				return err
+			}
+		case <-ctx.Done():
+			return m.stopMysqld(mysqldChan)
+		}
 	}
+}
+
+// stopMysqld asks mysqld to shut down with SIGTERM and escalates to SIGKILL
+// when it has not exited within ShutdownGracePeriod seconds
+func (m *startManager) stopMysqld(mysqldChan <-chan error) error {
+	m.galeraInitStatusServer.SetPhase(PhaseStopping)
+	m.logger.Info("shutdown-detected")
 
-	err = m.writeStringToFile(newNodeState)
+	mysqlCmd := m.startCaller.GetMysqlCmd()
+
+	err := m.osHelper.KillCommand(mysqlCmd, syscall.SIGTERM)
 	if err != nil {
+		m.logger.Error("sigterm-mysqld-failed", err)
 		return err
 	}
+	m.logger.Info("sigterm-mysqld-ok")
 
-	m.logger.Info("bootstrap-complete")
-	m.logger.Info("waiting-for-mysqld")
+	gracePeriod := time.Duration(m.config.ShutdownGracePeriod) * time.Second
+	m.logger.Info("mysqld-shutdown-started", lager.Data{
+		"gracePeriod": gracePeriod.String(),
+	})
 
-	m.logger.Info("status-server-starting")
-	m.galeraInitStatusServer.Start()
-	m.logger.Info("status-server-started")
+	var gracePeriodExpired <-chan time.Time
+	if gracePeriod > 0 {
+		gracePeriodExpired = time.After(gracePeriod)
+	}
 
 	select {
-	case err := <-mysqldChan:
-		m.logger.Info("mysqld-exited", lager.Data{
-			"error": err,
+	case err = <-mysqldChan:
+	case <-gracePeriodExpired:
+		m.logger.Info("mysqld-shutdown-grace-period-expired", lager.Data{
+			"gracePeriod": gracePeriod.String(),
 		})
-		return err
-	case <-ctx.Done():
-		m.logger.Info("shutdown-detected")
 
-		err := m.osHelper.KillCommand(m.startCaller.GetMysqlCmd(), syscall.SIGTERM)
+		err = m.osHelper.KillCommand(mysqlCmd, syscall.SIGKILL)
 		if err != nil {
-			m.logger.Error("sigterm-mysqld-failed", err)
+			m.logger.Error("sigkill-mysqld-failed", err)
 			return err
 		}
-		m.logger.Info("sigterm-mysqld-ok")
-		m.logger.Info("mysqld-shutdown-started")
+		m.logger.Info("sigkill-mysqld-ok")
 
 		err = <-mysqldChan
+	}
+
+	m.logger.Info("mysqld-shutdown-complete", lager.Data{
+		"error": err,
+	})
+
+	return err
+}
+
+// startMysqld returns a nil channel without an error when a shutdown was
+// requested before mysqld became ready and mysqld was stopped cleanly
+func (m *startManager) startMysqld(ctx context.Context) (<-chan error, error) {
+	m.logger.Info("determining-bootstrap-procedure", lager.Data{
+		"ClusterIps":    m.config.ClusterIps,
+		"BootstrapNode": m.config.BootstrapNode,
+	})
+
+	currentState, err := m.getCurrentNodeState()
+	if err != nil {
+		return nil, err
+	}
+
+	m.galeraInitStatusServer.SetPhase(PhaseStartingMysqld)
+	newNodeState, mysqldChan, err := m.startCaller.StartNodeFromState(ctx, currentState)
+	if err == nil {
+		err = m.writeStateFile(currentState, newNodeState)
+	}
+	if err != nil {
+		return nil, m.abortStartup(ctx, mysqldChan, err)
+	}
 
-		m.logger.Info("mysqld-shutdown-complete", lager.Data{
-			"error": err,
+	m.lastStart = time.Now()
+	return mysqldChan, nil
+}
+
+// abortStartup stops the mysqld a failed start left running, so galera-init
+// never exits with mysqld still up, and returns err. A start that failed
+// because a shutdown was requested is not an error once mysqld stopped.
+func (m *startManager) abortStartup(ctx context.Context, mysqldChan <-chan error, err error) error {
+	shutdown := ctx.Err() != nil
+	if shutdown {
+		m.logger.Info("shutdown-during-startup", lager.Data{
+			"error": err.Error(),
 		})
+	} else {
+		m.logger.Error("startup-failed", err)
+	}
 
-		return err
+	if mysqldChan != nil {
+		if stopErr := m.stopMysqld(mysqldChan); stopErr != nil && shutdown {
+			return stopErr
+		}
+	}
+
+	if shutdown {
+		return nil
+	}
+	return err
+}
+
+// restartMysqld re-runs the state decision and starts mysqld again after it
+// exited unexpectedly, backing off exponentially between attempts. It gives up
+// once more than SupervisorMaxCrashes consecutive crashes have happened.
+func (m *startManager) restartMysqld(ctx context.Context, exitErr error) (<-chan error, error) {
+	if time.Since(m.lastStart) >= SupervisorStablePeriod {
+		m.consecutiveCrashes = 0
+	}
+
+	for {
+		m.consecutiveCrashes++
+		if m.consecutiveCrashes > m.config.SupervisorMaxCrashes {
+			m.logger.Error("supervisor-crash-loop-detected", exitErr, lager.Data{
+				"consecutiveCrashes": m.consecutiveCrashes - 1,
+			})
+			return nil, errors.Wrapf(exitErr, "mysqld crashed %d consecutive times", m.consecutiveCrashes-1)
+		}
+
+		backoff := m.supervisorBackoff()
+		m.galeraInitStatusServer.SetPhase(PhaseRestarting)
+		m.logger.Info("supervisor-restarting-mysqld", lager.Data{
+			"attempt": m.consecutiveCrashes,
+			"backoff": backoff.String(),
+			"error":   exitErr.Error(),
+		})
+		if err := m.osHelper.Sleep(ctx, backoff); err != nil {
+			m.logger.Info("supervisor-shutdown-detected")
+			return nil, nil
+		}
+
+		if m.dbHelper.IsProcessRunning() {
+			m.logger.Info("shutdown-old-mysql")
+			m.Shutdown()
+		}
+
+		mysqldChan, err := m.startMysqld(ctx)
+		if err == nil {
+			m.galeraInitStatusServer.SetPhase(PhaseRunning)
+			m.logger.Info("supervisor-restarted-mysqld")
+			return mysqldChan, nil
+		}
+
+		m.logger.Error("supervisor-restart-failed", err)
+		exitErr = err
 	}
 }
 
+func (m *startManager) supervisorBackoff() time.Duration {
+	backoff := time.Duration(m.config.SupervisorInitialBackoff) * time.Second
+	maxBackoff := time.Duration(m.config.SupervisorMaxBackoff) * time.Second
+
+	for i := 1; i < m.consecutiveCrashes && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+
+	if backoff > maxBackoff {
+		return maxBackoff
+	}
+	return backoff
+}
+
 func (m *startManager) getCurrentNodeState() (string, error) {
 
 	// Single-node deploy always requires bootstrapping of new cluster
@@ -173,13 +350,28 @@ func (m *startManager) getCurrentNodeState() (string, error) {
 }
 
 func (m *startManager) readStateFromFile() (string, error) {
-	state, err := m.osHelper.ReadFile(m.config.StateFileLocation)
+	stateFile, err := m.readStateFile()
 	if err != nil {
 		return "", err
 	}
-	state = strings.TrimSpace(state)
+
+	state := stateFile.State
 	m.logger.Info(fmt.Sprintf("state file exists and contains: '%s'", state))
-	return state, nil
+
+	switch state {
+	case node_starter.Clustered, node_starter.NeedsBootstrap, node_starter.SingleNode:
+		return state, nil
+	default:
+		return "", fmt.Errorf("Unsupported state file contents: %s", state)
+	}
+}
+
+func (m *startManager) readStateFile() (node_state.StateFile, error) {
+	contents, err := m.osHelper.ReadFile(m.config.StateFileLocation)
+	if err != nil {
+		return node_state.StateFile{}, err
+	}
+	return node_state.Parse(contents)
 }
 
 func (m *startManager) firstTimeDeploy() bool {
@@ -191,7 +383,55 @@ func (m *startManager) Shutdown() {
 	m.dbHelper.StopMysqld()
 }
 
-func (m *startManager) writeStringToFile(contents string) error {
-	m.logger.Info(fmt.Sprintf("updating file with contents: '%s'", contents))
+func (m *startManager) writeStateFile(previousState string, newState string) error {
+	var stateFile node_state.StateFile
+
+	if !m.firstTimeDeploy() {
+		existing, err := m.readStateFile()
+		if err != nil {
+			m.logger.Info("state-file-history-discarded", lager.Data{"err": err.Error()})
+		} else {
+			stateFile = existing
+		}
+	}
+
+	record := node_state.Record{
+		State:             newState,
+		PreviousState:     previousState,
+		StartMode:         m.startCaller.GetStartMode(),
+		Timestamp:         time.Now().UTC(),
+		GaleraInitVersion: m.galeraInitVersion,
+		ClusterUUID:       m.clusterUUID(),
+		ClusterIps:        m.config.ClusterIps,
+	}
+
+	contents, err := stateFile.Transition(record).Marshal()
+	if err != nil {
+		return err
+	}
+
+	m.logger.Info("updating-state-file", lager.Data{
+		"state":         record.State,
+		"previousState": record.PreviousState,
+		"startMode":     record.StartMode,
+		"clusterUUID":   record.ClusterUUID,
+	})
 	return m.osHelper.WriteStringToFile(m.config.StateFileLocation, contents)
 }
+
+func (m *startManager) clusterUUID() string {
+	if !m.osHelper.FileExists(m.config.GrastateFileLocation) {
+		return ""
+	}
+
+	contents, err := m.osHelper.ReadFile(m.config.GrastateFileLocation)
+	if err != nil {
+		return ""
+	}
+
+	state, err := grastate.Parse(contents)
+	if err != nil || !state.HasData() {
+		return ""
+	}
+	return state.UUID
+}
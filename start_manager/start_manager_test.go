@@ -20,7 +20,9 @@ import (
 	. "github.com/cloudfoundry/galera-init/start_manager"
 	"github.com/cloudfoundry/galera-init/start_manager/node_starter"
 	"github.com/cloudfoundry/galera-init/start_manager/node_starter/node_starterfakes"
+	"github.com/cloudfoundry/galera-init/start_manager/node_state"
 	"github.com/cloudfoundry/galera-init/start_manager/start_managerfakes"
+	"github.com/cloudfoundry/galera-init/upgrade_coordinator/upgrade_coordinatorfakes"
 	"github.com/cloudfoundry/galera-init/upgrader/upgraderfakes"
 )
 
@@ -31,6 +33,7 @@ var _ = Describe("StartManager", func() {
 	var testLogger *lagertest.TestLogger
 	var fakeOs *os_helperfakes.FakeOsHelper
 	var fakeUpgrader *upgraderfakes.FakeUpgrader
+	var fakeUpgradeCoordinator *upgrade_coordinatorfakes.FakeUpgradeCoordinator
 	var fakeDBHelper *db_helperfakes.FakeDBHelper
 	var fakeStarter *node_starterfakes.FakeStarter
 	var fakeHealthChecker *cluster_health_checkerfakes.FakeClusterHealthChecker
@@ -42,15 +45,25 @@ var _ = Describe("StartManager", func() {
 	const stateFileLocation = "/stateFileLocation"
 
 	type managerArgs struct {
-		BootstrapNode bool
-		NodeCount     int
+		BootstrapNode        bool
+		NodeCount            int
+		Supervise            bool
+		SupervisorMaxCrashes int
+		ShutdownGracePeriod  int
 	}
 
-	ensureStateFileContentIs := func(expected string) {
+	writtenStateFile := func() node_state.StateFile {
 		count := fakeOs.WriteStringToFileCallCount()
 		filename, contents := fakeOs.WriteStringToFileArgsForCall(count - 1)
 		Expect(filename).To(Equal(stateFileLocation))
-		Expect(contents).To(Equal(expected))
+
+		stateFile, err := node_state.Parse(contents)
+		Expect(err).NotTo(HaveOccurred())
+		return stateFile
+	}
+
+	ensureStateFileContentIs := func(expected string) {
+		Expect(writtenStateFile().State).To(Equal(expected))
 	}
 
 	ensureNoWriteToStateFile := func() {
@@ -58,9 +71,15 @@ var _ = Describe("StartManager", func() {
 		Expect(count).To(Equal(0))
 	}
 
+	sleepDuration := func(i int) time.Duration {
+		_, duration := fakeOs.SleepArgsForCall(i)
+		return duration
+	}
+
 	ensureStartNodeWithMode := func(state string) {
 		Expect(fakeStarter.StartNodeFromStateCallCount()).To(Equal(1))
-		Expect(fakeStarter.StartNodeFromStateArgsForCall(0)).To(Equal(state))
+		_, startState := fakeStarter.StartNodeFromStateArgsForCall(0)
+		Expect(startState).To(Equal(state))
 	}
 
 	createManager := func(args managerArgs) StartManager {
@@ -73,16 +92,23 @@ var _ = Describe("StartManager", func() {
 		return New(
 			fakeOs,
 			config.StartManager{
-				StateFileLocation: stateFileLocation,
-				BootstrapNode:     args.BootstrapNode,
-				ClusterIps:        clusterIps,
+				StateFileLocation:        stateFileLocation,
+				BootstrapNode:            args.BootstrapNode,
+				ClusterIps:               clusterIps,
+				Supervise:                args.Supervise,
+				SupervisorMaxCrashes:     args.SupervisorMaxCrashes,
+				SupervisorInitialBackoff: 5,
+				SupervisorMaxBackoff:     12,
+				ShutdownGracePeriod:      args.ShutdownGracePeriod,
 			},
 			fakeDBHelper,
 			fakeUpgrader,
+			fakeUpgradeCoordinator,
 			fakeStarter,
 			testLogger,
 			fakeHealthChecker,
 			fakeserviceStatusServer,
+			"some-galera-init-version",
 		)
 	}
 
@@ -90,6 +116,7 @@ var _ = Describe("StartManager", func() {
 		testLogger = lagertest.NewTestLogger("start_manager")
 		fakeOs = new(os_helperfakes.FakeOsHelper)
 		fakeUpgrader = new(upgraderfakes.FakeUpgrader)
+		fakeUpgradeCoordinator = new(upgrade_coordinatorfakes.FakeUpgradeCoordinator)
 		fakeStarter = new(node_starterfakes.FakeStarter)
 		fakeDBHelper = new(db_helperfakes.FakeDBHelper)
 		fakeHealthChecker = new(cluster_health_checkerfakes.FakeClusterHealthChecker)
@@ -103,7 +130,7 @@ var _ = Describe("StartManager", func() {
 	})
 
 	JustBeforeEach(func() {
-		fakeStarter.StartNodeFromStateStub = func(state string) (newState string, mysqlErrCh <-chan error, e error) {
+		fakeStarter.StartNodeFromStateStub = func(ctx context.Context, state string) (newState string, mysqlErrCh <-chan error, e error) {
 			mysqldErrChan <- nil
 			return startNodeReturn, mysqldErrChan, startNodeReturnError
 		}
@@ -115,7 +142,7 @@ var _ = Describe("StartManager", func() {
 				NodeCount: 3,
 			})
 
-			fakeStarter.StartNodeFromStateStub = func(state string) (newState string, mysqlErrCh <-chan error, e error) {
+			fakeStarter.StartNodeFromStateStub = func(ctx context.Context, state string) (newState string, mysqlErrCh <-chan error, e error) {
 				mysqldErrChan <- errors.New("some mysql error")
 				return startNodeReturn, mysqldErrChan, startNodeReturnError
 			}
@@ -124,6 +151,115 @@ var _ = Describe("StartManager", func() {
 			err := mgr.Execute(context.TODO())
 			Expect(err).To(MatchError(`some mysql error`))
 		})
+
+		Context("and the supervisor is enabled", func() {
+			var crashes int
+
+			BeforeEach(func() {
+				crashes = 1
+			})
+
+			JustBeforeEach(func() {
+				mgr = createManager(managerArgs{
+					NodeCount:            3,
+					Supervise:            true,
+					SupervisorMaxCrashes: 3,
+				})
+
+				fakeOs.FileExistsReturns(true)
+				fakeOs.ReadFileReturns(node_starter.Clustered, nil)
+
+				fakeStarter.StartNodeFromStateStub = func(ctx context.Context, state string) (newState string, mysqlErrCh <-chan error, e error) {
+					if fakeStarter.StartNodeFromStateCallCount() <= crashes {
+						mysqldErrChan <- errors.New("some mysql error")
+					} else {
+						mysqldErrChan <- nil
+					}
+					return startNodeReturn, mysqldErrChan, startNodeReturnError
+				}
+			})
+
+			It("restarts mysqld after backing off", func() {
+				err := mgr.Execute(context.TODO())
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(fakeStarter.StartNodeFromStateCallCount()).To(Equal(2))
+				_, restartState := fakeStarter.StartNodeFromStateArgsForCall(1)
+				Expect(restartState).To(Equal(node_starter.Clustered))
+				Expect(fakeOs.SleepCallCount()).To(Equal(1))
+				Expect(sleepDuration(0)).To(Equal(5 * time.Second))
+				Expect(fakeOs.WriteStringToFileCallCount()).To(Equal(2))
+			})
+
+			It("reports the restart to the status server", func() {
+				Expect(mgr.Execute(context.TODO())).To(Succeed())
+
+				var phases []string
+				for i := 0; i < fakeserviceStatusServer.SetPhaseCallCount(); i++ {
+					phases = append(phases, fakeserviceStatusServer.SetPhaseArgsForCall(i))
+				}
+				Expect(phases).To(Equal([]string{
+					PhaseStartingMysqld,
+					PhaseRunning,
+					PhaseMysqldExited,
+					PhaseRestarting,
+					PhaseStartingMysqld,
+					PhaseRunning,
+					PhaseMysqldExited,
+				}))
+			})
+
+			Context("when mysqld keeps crashing", func() {
+				BeforeEach(func() {
+					crashes = 10
+				})
+
+				It("backs off exponentially and gives up once the crash budget is spent", func() {
+					err := mgr.Execute(context.TODO())
+					Expect(err).To(MatchError("mysqld crashed 3 consecutive times: some mysql error"))
+
+					Expect(fakeStarter.StartNodeFromStateCallCount()).To(Equal(4))
+					Expect(fakeOs.SleepCallCount()).To(Equal(3))
+					Expect(sleepDuration(0)).To(Equal(5 * time.Second))
+					Expect(sleepDuration(1)).To(Equal(10 * time.Second))
+					Expect(sleepDuration(2)).To(Equal(12 * time.Second))
+				})
+			})
+
+			Context("when restarting mysqld fails", func() {
+				BeforeEach(func() {
+					crashes = 10
+				})
+
+				JustBeforeEach(func() {
+					fakeStarter.StartNodeFromStateStub = func(ctx context.Context, state string) (newState string, mysqlErrCh <-chan error, e error) {
+						if fakeStarter.StartNodeFromStateCallCount() == 1 {
+							mysqldErrChan <- errors.New("some mysql error")
+							return startNodeReturn, mysqldErrChan, nil
+						}
+						return "", nil, errors.New("some start error")
+					}
+				})
+
+				It("counts the failure as a crash", func() {
+					err := mgr.Execute(context.TODO())
+					Expect(err).To(MatchError("mysqld crashed 3 consecutive times: some start error"))
+					Expect(fakeStarter.StartNodeFromStateCallCount()).To(Equal(4))
+				})
+			})
+
+			Context("when mysqld exits cleanly", func() {
+				BeforeEach(func() {
+					crashes = 0
+				})
+
+				It("does not restart it", func() {
+					Expect(mgr.Execute(context.TODO())).To(Succeed())
+					Expect(fakeStarter.StartNodeFromStateCallCount()).To(Equal(1))
+					Expect(fakeOs.SleepCallCount()).To(Equal(0))
+				})
+			})
+		})
 	})
 
 	Context("When a mysql process is already running", func() {
@@ -147,7 +283,7 @@ var _ = Describe("StartManager", func() {
 				NodeCount: 3,
 			})
 
-			fakeStarter.StartNodeFromStateStub = func(state string) (newState string, mysqlErrCh <-chan error, e error) {
+			fakeStarter.StartNodeFromStateStub = func(ctx context.Context, state string) (newState string, mysqlErrCh <-chan error, e error) {
 				return startNodeReturn, mysqldErrChan, startNodeReturnError
 			}
 
@@ -158,8 +294,9 @@ var _ = Describe("StartManager", func() {
 		})
 
 		ensureTimeoutOfMySQLIfExecuteHangs := func() {
+			errChan := mysqldErrChan
 			time.Sleep(2 * time.Second)
-			mysqldErrChan <- errors.New("failed-to-cancel")
+			errChan <- errors.New("failed-to-cancel")
 		}
 
 		It("should gracefully stop mysqld", func() {
@@ -185,6 +322,138 @@ var _ = Describe("StartManager", func() {
 			err := mgr.Execute(ctx)
 			Expect(err).To(MatchError(`mysqld process does not exist`))
 		})
+
+		Context("and a shutdown grace period is configured", func() {
+			JustBeforeEach(func() {
+				mgr = createManager(managerArgs{
+					NodeCount:           3,
+					ShutdownGracePeriod: 1,
+				})
+			})
+
+			It("does not escalate when mysqld exits within the grace period", func() {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+
+				err := mgr.Execute(ctx)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(fakeOs.KillCommandCallCount()).To(Equal(1))
+			})
+
+			It("sends SIGKILL when mysqld does not exit within the grace period", func() {
+				fakeOs.KillCommandStub = func(cmd *exec.Cmd, signal os.Signal) error {
+					if signal == syscall.SIGKILL {
+						mysqldErrChan <- errors.New("signal: killed")
+					}
+					return nil
+				}
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+
+				err := mgr.Execute(ctx)
+				Expect(err).To(MatchError("signal: killed"))
+				Expect(fakeOs.KillCommandCallCount()).To(Equal(2))
+				_, signal := fakeOs.KillCommandArgsForCall(0)
+				Expect(signal).To(Equal(syscall.SIGTERM))
+				_, signal = fakeOs.KillCommandArgsForCall(1)
+				Expect(signal).To(Equal(syscall.SIGKILL))
+			})
+
+			It("returns an error if sending SIGKILL fails", func() {
+				fakeOs.KillCommandStub = func(cmd *exec.Cmd, signal os.Signal) error {
+					if signal == syscall.SIGKILL {
+						return errors.New("unable-to-kill-process")
+					}
+					return nil
+				}
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+
+				err := mgr.Execute(ctx)
+				Expect(err).To(MatchError("unable-to-kill-process"))
+			})
+		})
+	})
+
+	Context("when a shutdown is requested before mysqld is ready", func() {
+		BeforeEach(func() {
+			mgr = createManager(managerArgs{
+				NodeCount: 3,
+			})
+		})
+
+		It("stops the mysqld that was started and exits cleanly", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			fakeStarter.StartNodeFromStateStub = func(context.Context, string) (string, <-chan error, error) {
+				cancel()
+				return "", mysqldErrChan, context.Canceled
+			}
+			fakeOs.KillCommandStub = func(cmd *exec.Cmd, signal os.Signal) error {
+				mysqldErrChan <- nil
+				return nil
+			}
+
+			err := mgr.Execute(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeOs.KillCommandCallCount()).To(Equal(1))
+			_, signal := fakeOs.KillCommandArgsForCall(0)
+			Expect(signal).To(Equal(syscall.SIGTERM))
+			ensureNoWriteToStateFile()
+			Expect(fakeserviceStatusServer.StartCallCount()).To(Equal(0))
+		})
+
+		It("exits cleanly when the upgrade is cancelled", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			fakeUpgrader.NeedsUpgradeReturns(true, nil)
+			fakeUpgrader.UpgradeStub = func(context.Context) error {
+				cancel()
+				return context.Canceled
+			}
+
+			err := mgr.Execute(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeStarter.StartNodeFromStateCallCount()).To(Equal(0))
+		})
+	})
+
+	Context("when starting mysqld fails while it is still running", func() {
+		BeforeEach(func() {
+			mgr = createManager(managerArgs{
+				NodeCount:           3,
+				ShutdownGracePeriod: 1,
+			})
+		})
+
+		It("stops mysqld, escalating to SIGKILL, and returns the error", func() {
+			fakeStarter.StartNodeFromStateStub = func(context.Context, string) (string, <-chan error, error) {
+				return "", mysqldErrChan, errors.New("Database was never reachable")
+			}
+			fakeOs.KillCommandStub = func(cmd *exec.Cmd, signal os.Signal) error {
+				if signal == syscall.SIGKILL {
+					mysqldErrChan <- errors.New("signal: killed")
+				}
+				return nil
+			}
+
+			err := mgr.Execute(context.TODO())
+			Expect(err).To(MatchError("Database was never reachable"))
+			Expect(fakeOs.KillCommandCallCount()).To(Equal(2))
+			_, signal := fakeOs.KillCommandArgsForCall(0)
+			Expect(signal).To(Equal(syscall.SIGTERM))
+			_, signal = fakeOs.KillCommandArgsForCall(1)
+			Expect(signal).To(Equal(syscall.SIGKILL))
+			ensureNoWriteToStateFile()
+		})
+
+		It("does not try to stop mysqld when it already exited", func() {
+			fakeStarter.StartNodeFromStateStub = func(context.Context, string) (string, <-chan error, error) {
+				return "", nil, errors.New("Mysqld exited with error")
+			}
+
+			err := mgr.Execute(context.TODO())
+			Expect(err).To(MatchError("Mysqld exited with error"))
+			Expect(fakeOs.KillCommandCallCount()).To(Equal(0))
+		})
 	})
 
 	Describe("Upgrading the cluster", func() {
@@ -220,6 +489,54 @@ var _ = Describe("StartManager", func() {
 					Expect(err).To(HaveOccurred())
 					Expect(fakeserviceStatusServer.StartCallCount()).To(Equal(0))
 				})
+
+				It("reports the upgrading phase once it is the node's turn", func() {
+					mgr.Execute(context.TODO())
+					Expect(fakeserviceStatusServer.SetPhaseCallCount()).To(Equal(2))
+					Expect(fakeserviceStatusServer.SetPhaseArgsForCall(0)).To(Equal(PhaseUpgradePending))
+					Expect(fakeserviceStatusServer.SetPhaseArgsForCall(1)).To(Equal(PhaseUpgrading))
+				})
+			})
+
+			Context("And the node waits for its turn to upgrade", func() {
+				BeforeEach(func() {
+					mgr = createManager(managerArgs{
+						NodeCount: 3,
+					})
+
+					fakeUpgrader.NeedsUpgradeReturns(true, nil)
+				})
+
+				It("waits for its turn before upgrading", func() {
+					fakeUpgradeCoordinator.WaitForTurnStub = func(context.Context) error {
+						Expect(fakeUpgrader.UpgradeCallCount()).To(Equal(0))
+						return nil
+					}
+
+					Expect(mgr.Execute(context.TODO())).To(Succeed())
+					Expect(fakeUpgradeCoordinator.WaitForTurnCallCount()).To(Equal(1))
+					Expect(fakeUpgrader.UpgradeCallCount()).To(Equal(1))
+				})
+
+				It("does not upgrade when waiting fails", func() {
+					fakeUpgradeCoordinator.WaitForTurnReturns(errors.New("timed out after 1h0m0s waiting for a turn to upgrade"))
+
+					err := mgr.Execute(context.TODO())
+					Expect(err).To(MatchError("timed out after 1h0m0s waiting for a turn to upgrade"))
+					Expect(fakeUpgrader.UpgradeCallCount()).To(Equal(0))
+					Expect(fakeStarter.StartNodeFromStateCallCount()).To(Equal(0))
+				})
+
+				It("exits cleanly when shut down while waiting", func() {
+					ctx, cancel := context.WithCancel(context.Background())
+					fakeUpgradeCoordinator.WaitForTurnStub = func(context.Context) error {
+						cancel()
+						return context.Canceled
+					}
+
+					Expect(mgr.Execute(ctx)).To(Succeed())
+					Expect(fakeUpgrader.UpgradeCallCount()).To(Equal(0))
+				})
 			})
 		})
 	})
@@ -244,6 +561,15 @@ var _ = Describe("StartManager", func() {
 				ensureStateFileContentIs("SINGLE_NODE")
 				Expect(fakeserviceStatusServer.StartCallCount()).To(Equal(1))
 			})
+
+			It("reports each startup phase to the status server", func() {
+				err := mgr.Execute(context.TODO())
+				Expect(err).ToNot(HaveOccurred())
+				Expect(fakeserviceStatusServer.SetPhaseCallCount()).To(Equal(3))
+				Expect(fakeserviceStatusServer.SetPhaseArgsForCall(0)).To(Equal(PhaseStartingMysqld))
+				Expect(fakeserviceStatusServer.SetPhaseArgsForCall(1)).To(Equal(PhaseRunning))
+				Expect(fakeserviceStatusServer.SetPhaseArgsForCall(2)).To(Equal(PhaseMysqldExited))
+			})
 		})
 
 		Context("And it's a redeploy", func() {
@@ -374,14 +700,79 @@ var _ = Describe("StartManager", func() {
 						fakeOs.WriteStringToFileReturns(errors.New("writing failed"))
 					})
 
-					It("returns the error", func() {
+					It("returns the error after stopping mysqld", func() {
 						actualErr := mgr.Execute(context.TODO())
-						Expect(actualErr).To(HaveOccurred())
+						Expect(actualErr).To(MatchError("writing failed"))
 						Expect(fakeserviceStatusServer.StartCallCount()).To(Equal(0))
+						Expect(fakeOs.KillCommandCallCount()).To(Equal(1))
 					})
 				})
 			})
 
+			Context("And contains a JSON state file with history", func() {
+				BeforeEach(func() {
+					previous := node_state.StateFile{Version: node_state.FormatVersion}
+					for i := 0; i < node_state.MaxHistory+1; i++ {
+						previous = previous.Transition(node_state.Record{State: node_starter.Clustered})
+					}
+					contents, err := previous.Marshal()
+					Expect(err).NotTo(HaveOccurred())
+					fakeOs.ReadFileStub = func(filename string) (string, error) {
+						if filename == stateFileLocation {
+							return contents, nil
+						}
+						return "uuid: 8bd3bf94-3b65-11ea-a4ea-8bd1cbb0c6b8\nseqno: -1\n", nil
+					}
+					fakeStarter.GetStartModeReturns(node_starter.JoinMode)
+				})
+
+				It("records the transition and keeps a bounded history", func() {
+					err := mgr.Execute(context.TODO())
+					Expect(err).ToNot(HaveOccurred())
+					ensureStartNodeWithMode("CLUSTERED")
+
+					stateFile := writtenStateFile()
+					Expect(stateFile.Version).To(Equal(node_state.FormatVersion))
+					Expect(stateFile.State).To(Equal(node_starter.Clustered))
+					Expect(stateFile.PreviousState).To(Equal(node_starter.Clustered))
+					Expect(stateFile.StartMode).To(Equal(node_starter.JoinMode))
+					Expect(stateFile.GaleraInitVersion).To(Equal("some-galera-init-version"))
+					Expect(stateFile.ClusterUUID).To(Equal("8bd3bf94-3b65-11ea-a4ea-8bd1cbb0c6b8"))
+					Expect(stateFile.ClusterIps).To(Equal([]string{"0.0.0.1", "0.0.0.2", "0.0.0.3"}))
+					Expect(stateFile.Timestamp).NotTo(BeZero())
+					Expect(stateFile.History).To(HaveLen(node_state.MaxHistory))
+				})
+			})
+
+			Context("And contains a legacy plain text state", func() {
+				BeforeEach(func() {
+					fakeOs.ReadFileReturns(node_starter.NeedsBootstrap, nil)
+				})
+
+				It("migrates it into the JSON state file", func() {
+					err := mgr.Execute(context.TODO())
+					Expect(err).ToNot(HaveOccurred())
+
+					stateFile := writtenStateFile()
+					Expect(stateFile.State).To(Equal(node_starter.Clustered))
+					Expect(stateFile.PreviousState).To(Equal(node_starter.NeedsBootstrap))
+					Expect(stateFile.History).To(HaveLen(1))
+					Expect(stateFile.History[0].State).To(Equal(node_starter.NeedsBootstrap))
+				})
+			})
+
+			Context("And contains an unparseable JSON state file", func() {
+				BeforeEach(func() {
+					fakeOs.ReadFileReturns(`{"state": `, nil)
+				})
+
+				It("returns an error without starting the node", func() {
+					err := mgr.Execute(context.TODO())
+					Expect(err).To(MatchError(ContainSubstring("invalid state file")))
+					Expect(fakeStarter.StartNodeFromStateCallCount()).To(Equal(0))
+				})
+			})
+
 			Context("And contains an invalid state", func() {
 				BeforeEach(func() {
 					fakeOs.ReadFileReturns("INVALID_STATE", nil)
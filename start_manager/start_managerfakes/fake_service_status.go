@@ -8,6 +8,11 @@ import (
 )
 
 type FakeServiceStatus struct {
+	SetPhaseStub        func(string)
+	setPhaseMutex       sync.RWMutex
+	setPhaseArgsForCall []struct {
+		arg1 string
+	}
 	StartStub        func() error
 	startMutex       sync.RWMutex
 	startArgsForCall []struct {
@@ -22,6 +27,37 @@ type FakeServiceStatus struct {
 	invocationsMutex sync.RWMutex
 }
 
+func (fake *FakeServiceStatus) SetPhase(arg1 string) {
+	fake.setPhaseMutex.Lock()
+	fake.setPhaseArgsForCall = append(fake.setPhaseArgsForCall, struct {
+		arg1 string
+	}{arg1})
+	fake.recordInvocation("SetPhase", []interface{}{arg1})
+	fake.setPhaseMutex.Unlock()
+	if fake.SetPhaseStub != nil {
+		fake.SetPhaseStub(arg1)
+	}
+}
+
+func (fake *FakeServiceStatus) SetPhaseCallCount() int {
+	fake.setPhaseMutex.RLock()
+	defer fake.setPhaseMutex.RUnlock()
+	return len(fake.setPhaseArgsForCall)
+}
+
+func (fake *FakeServiceStatus) SetPhaseCalls(stub func(string)) {
+	fake.setPhaseMutex.Lock()
+	defer fake.setPhaseMutex.Unlock()
+	fake.SetPhaseStub = stub
+}
+
+func (fake *FakeServiceStatus) SetPhaseArgsForCall(i int) string {
+	fake.setPhaseMutex.RLock()
+	defer fake.setPhaseMutex.RUnlock()
+	argsForCall := fake.setPhaseArgsForCall[i]
+	return argsForCall.arg1
+}
+
 func (fake *FakeServiceStatus) Start() error {
 	fake.startMutex.Lock()
 	ret, specificReturn := fake.startReturnsOnCall[len(fake.startArgsForCall)]
@@ -77,6 +113,8 @@ func (fake *FakeServiceStatus) StartReturnsOnCall(i int, result1 error) {
 func (fake *FakeServiceStatus) Invocations() map[string][][]interface{} {
 	fake.invocationsMutex.RLock()
 	defer fake.invocationsMutex.RUnlock()
+	fake.setPhaseMutex.RLock()
+	defer fake.setPhaseMutex.RUnlock()
 	fake.startMutex.RLock()
 	defer fake.startMutex.RUnlock()
 	copiedInvocations := map[string][][]interface{}{}
@@ -0,0 +1,224 @@
+package upgrade_coordinator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/pkg/errors"
+
+	"github.com/cloudfoundry/galera-init/config"
+	"github.com/cloudfoundry/galera-init/os_helper"
+)
+
+// Phases peers report on /state that decide whose turn it is to upgrade
+const (
+	PhaseUpgradePending = "upgrade-pending"
+	PhaseUpgrading      = "upgrading"
+	PhaseRunning        = "running"
+)
+
+var MakeRequest = func(url string, client http.Client) (*http.Response, error) {
+	return client.Get(url)
+}
+
+//go:generate go run github.com/maxbrunsfeld/counterfeiter/v6 . UpgradeCoordinator
+type UpgradeCoordinator interface {
+	WaitForTurn(ctx context.Context) error
+}
+
+// PeerState is the subset of a peer's galera-init /state response used to take turns
+type PeerState struct {
+	NodeID string `json:"node_id"`
+	Phase  string `json:"phase"`
+}
+
+type httpUpgradeCoordinator struct {
+	nodeID         string
+	managerConfig  config.StartManager
+	upgraderConfig config.Upgrader
+	osHelper       os_helper.OsHelper
+	logger         lager.Logger
+}
+
+func NewUpgradeCoordinator(
+	nodeID string,
+	managerConfig config.StartManager,
+	upgraderConfig config.Upgrader,
+	osHelper os_helper.OsHelper,
+	logger lager.Logger,
+) UpgradeCoordinator {
+	return httpUpgradeCoordinator{
+		nodeID:         nodeID,
+		managerConfig:  managerConfig,
+		upgraderConfig: upgraderConfig,
+		osHelper:       osHelper,
+		logger:         logger,
+	}
+}
+
+// WaitForTurn returns once this node may upgrade: no peer is upgrading, no
+// peer listed before it in ClusterIps is waiting to upgrade, and the running
+// peers keep quorum without this node. A cluster without any running peer
+// has no quorum to keep. Peers that do not answer count as down, but one
+// has to answer: a node that reaches none of them cannot tell a stopped
+// cluster from a status server address peers cannot reach, and waits.
+// Peers still on a galera-init release without /state count as running.
+//
+// A peer later in line that was granted its turn just before this node
+// reported upgrade-pending is not seen as upgrading yet, so both may go
+// ahead. The quorum requirement still keeps a three node cluster from losing
+// a second node that way.
+func (c httpUpgradeCoordinator) WaitForTurn(ctx context.Context) error {
+	if !c.upgraderConfig.CoordinateWithPeers {
+		return nil
+	}
+
+	_, port, err := net.SplitHostPort(c.managerConfig.GaleraInitStatusServerAddress)
+	if err != nil {
+		return errors.Wrap(err, "invalid galera-init status server address")
+	}
+
+	pollInterval := time.Duration(c.upgraderConfig.CoordinationPollInterval) * time.Second
+	timeout := time.Duration(c.upgraderConfig.CoordinationTimeout) * time.Second
+
+	var waited time.Duration
+	for {
+		peers := c.fetchPeerStates(port)
+		reason := c.waitReason(peers)
+		if reason == "" && !c.anyPeerAnswered(peers) {
+			reason = fmt.Sprintf("no peer answered on port %s", port)
+			c.logger.Error("no-peer-answered", errors.New(reason), lager.Data{"peers": c.managerConfig.ClusterIps})
+		}
+		if reason == "" {
+			c.logger.Info("upgrade-turn-granted", lager.Data{"waited": waited.String()})
+			return nil
+		}
+
+		if timeout > 0 && waited >= timeout {
+			c.logger.Info("upgrade-turn-timeout", lager.Data{"reason": reason})
+			return fmt.Errorf("timed out after %s waiting for a turn to upgrade: %s", timeout, reason)
+		}
+
+		c.logger.Info("waiting-for-upgrade-turn", lager.Data{
+			"reason": reason,
+			"waited": waited.String(),
+		})
+		if err := c.osHelper.Sleep(ctx, pollInterval); err != nil {
+			return err
+		}
+		waited += pollInterval
+	}
+}
+
+// fetchPeerStates asks every node, this one included, for its state. Nodes
+// that do not answer are left nil.
+func (c httpUpgradeCoordinator) fetchPeerStates(port string) []*PeerState {
+	client := http.Client{
+		Timeout: time.Duration(c.managerConfig.ClusterProbeTimeout) * time.Second,
+	}
+
+	peers := make([]*PeerState, len(c.managerConfig.ClusterIps))
+	for i, ip := range c.managerConfig.ClusterIps {
+		peer, err := c.fetchPeerState(client, "http://"+net.JoinHostPort(ip, port)+"/state")
+		if err != nil {
+			c.logger.Debug("peer-state-unavailable", lager.Data{
+				"peer":  ip,
+				"error": err.Error(),
+			})
+			continue
+		}
+		peers[i] = peer
+	}
+
+	return peers
+}
+
+func (c httpUpgradeCoordinator) fetchPeerState(client http.Client, url string) (*PeerState, error) {
+	resp, err := MakeRequest(url, client)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("responded with status %d", resp.StatusCode)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read state")
+	}
+
+	// galera-init releases without /state start their status server once
+	// mysqld runs and answer every path with plain text
+	var peer PeerState
+	if err := json.Unmarshal(body, &peer); err != nil {
+		return &PeerState{Phase: PhaseRunning}, nil
+	}
+
+	return &peer, nil
+}
+
+// anyPeerAnswered reports whether a node other than this one answered. A
+// node alone in the cluster has no peer to ask.
+func (c httpUpgradeCoordinator) anyPeerAnswered(peers []*PeerState) bool {
+	if len(peers) < 2 {
+		return true
+	}
+
+	for _, peer := range peers {
+		if peer != nil && peer.NodeID != c.nodeID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// waitReason explains why this node has to keep waiting, or returns "" when it may upgrade
+func (c httpUpgradeCoordinator) waitReason(peers []*PeerState) string {
+	// A node that cannot find itself queues behind every waiting peer
+	self := len(peers)
+	for i, peer := range peers {
+		if peer != nil && peer.NodeID == c.nodeID {
+			self = i
+		}
+	}
+
+	running := 0
+	for i, peer := range peers {
+		if i == self || peer == nil {
+			continue
+		}
+
+		ip := c.managerConfig.ClusterIps[i]
+		switch peer.Phase {
+		case PhaseUpgrading:
+			return fmt.Sprintf("peer %s is upgrading", ip)
+		case PhaseUpgradePending:
+			if i < self {
+				return fmt.Sprintf("peer %s is ahead in line to upgrade", ip)
+			}
+		case PhaseRunning:
+			running++
+		}
+	}
+
+	if running == 0 {
+		return ""
+	}
+
+	quorum := len(c.managerConfig.ClusterIps)/2 + 1
+	if running < quorum {
+		return fmt.Sprintf("only %d of %d nodes are running, the cluster needs %d to keep quorum while this node upgrades",
+			running, len(c.managerConfig.ClusterIps), quorum)
+	}
+
+	return ""
+}
@@ -0,0 +1,13 @@
+package upgrade_coordinator_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestUpgradeCoordinator(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "UpgradeCoordinator Suite")
+}
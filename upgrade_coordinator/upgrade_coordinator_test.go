@@ -0,0 +1,272 @@
+package upgrade_coordinator_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/lager/lagertest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+
+	"github.com/cloudfoundry/galera-init/config"
+	"github.com/cloudfoundry/galera-init/os_helper/os_helperfakes"
+	. "github.com/cloudfoundry/galera-init/upgrade_coordinator"
+)
+
+var _ = Describe("UpgradeCoordinator", func() {
+	var (
+		coordinator    UpgradeCoordinator
+		fakeOs         *os_helperfakes.FakeOsHelper
+		testLogger     *lagertest.TestLogger
+		upgraderConfig config.Upgrader
+		clusterIps     []string
+		peerPhases     map[string]string
+		requestURLs    []string
+	)
+
+	peerResponse := func(nodeID, phase string) string {
+		return fmt.Sprintf(`{"node_id":%q,"phase":%q}`, nodeID, phase)
+	}
+
+	BeforeEach(func() {
+		fakeOs = new(os_helperfakes.FakeOsHelper)
+		testLogger = lagertest.NewTestLogger("upgrade_coordinator")
+
+		upgraderConfig = config.Upgrader{
+			CoordinateWithPeers:      true,
+			CoordinationPollInterval: 10,
+			CoordinationTimeout:      30,
+		}
+		clusterIps = []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}
+
+		requestURLs = []string{}
+		peerPhases = map[string]string{
+			"10.0.0.1": peerResponse("other-node-1", PhaseRunning),
+			"10.0.0.2": peerResponse("this-node", PhaseUpgradePending),
+			"10.0.0.3": peerResponse("other-node-3", PhaseRunning),
+		}
+		MakeRequest = func(url string, client http.Client) (*http.Response, error) {
+			requestURLs = append(requestURLs, url)
+			for ip, body := range peerPhases {
+				if strings.Contains(url, ip) {
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Body:       ioutil.NopCloser(strings.NewReader(body)),
+					}, nil
+				}
+			}
+			return nil, errors.New("connection refused")
+		}
+	})
+
+	JustBeforeEach(func() {
+		coordinator = NewUpgradeCoordinator(
+			"this-node",
+			config.StartManager{
+				ClusterIps:                    clusterIps,
+				ClusterProbeTimeout:           10,
+				GaleraInitStatusServerAddress: "0.0.0.0:8114",
+			},
+			upgraderConfig,
+			fakeOs,
+			testLogger,
+		)
+	})
+
+	It("asks every node's galera-init status server for its state", func() {
+		Expect(coordinator.WaitForTurn(context.TODO())).To(Succeed())
+		Expect(requestURLs).To(Equal([]string{
+			"http://10.0.0.1:8114/state",
+			"http://10.0.0.2:8114/state",
+			"http://10.0.0.3:8114/state",
+		}))
+	})
+
+	It("upgrades right away when the other nodes keep quorum", func() {
+		Expect(coordinator.WaitForTurn(context.TODO())).To(Succeed())
+		Expect(fakeOs.SleepCallCount()).To(Equal(0))
+	})
+
+	Context("when coordination is disabled", func() {
+		BeforeEach(func() {
+			upgraderConfig.CoordinateWithPeers = false
+		})
+
+		It("does not ask the peers", func() {
+			Expect(coordinator.WaitForTurn(context.TODO())).To(Succeed())
+			Expect(requestURLs).To(BeEmpty())
+		})
+	})
+
+	Context("when a peer is upgrading", func() {
+		BeforeEach(func() {
+			peerPhases["10.0.0.3"] = peerResponse("other-node-3", PhaseUpgrading)
+			fakeOs.SleepStub = func(context.Context, time.Duration) error {
+				peerPhases["10.0.0.3"] = peerResponse("other-node-3", PhaseRunning)
+				return nil
+			}
+		})
+
+		It("waits until the peer finished", func() {
+			Expect(coordinator.WaitForTurn(context.TODO())).To(Succeed())
+
+			Expect(fakeOs.SleepCallCount()).To(Equal(1))
+			_, interval := fakeOs.SleepArgsForCall(0)
+			Expect(interval).To(Equal(10 * time.Second))
+			Expect(testLogger.Buffer()).To(gbytes.Say(`waiting-for-upgrade-turn.*peer 10.0.0.3 is upgrading`))
+		})
+	})
+
+	Context("when a peer earlier in ClusterIps waits to upgrade too", func() {
+		BeforeEach(func() {
+			peerPhases["10.0.0.1"] = peerResponse("other-node-1", PhaseUpgradePending)
+			fakeOs.SleepStub = func(context.Context, time.Duration) error {
+				peerPhases["10.0.0.1"] = peerResponse("other-node-1", PhaseRunning)
+				return nil
+			}
+		})
+
+		It("lets the peer go first", func() {
+			Expect(coordinator.WaitForTurn(context.TODO())).To(Succeed())
+			Expect(fakeOs.SleepCallCount()).To(Equal(1))
+			Expect(testLogger.Buffer()).To(gbytes.Say(`peer 10.0.0.1 is ahead in line to upgrade`))
+		})
+	})
+
+	Context("when a peer later in ClusterIps waits to upgrade too", func() {
+		BeforeEach(func() {
+			clusterIps = append(clusterIps, "10.0.0.4", "10.0.0.5")
+			peerPhases["10.0.0.3"] = peerResponse("other-node-3", PhaseUpgradePending)
+			peerPhases["10.0.0.4"] = peerResponse("other-node-4", PhaseRunning)
+			peerPhases["10.0.0.5"] = peerResponse("other-node-5", PhaseRunning)
+		})
+
+		It("goes first", func() {
+			Expect(coordinator.WaitForTurn(context.TODO())).To(Succeed())
+			Expect(fakeOs.SleepCallCount()).To(Equal(0))
+		})
+	})
+
+	Context("when the cluster would lose quorum", func() {
+		BeforeEach(func() {
+			delete(peerPhases, "10.0.0.3")
+		})
+
+		It("gives up after the coordination timeout", func() {
+			err := coordinator.WaitForTurn(context.TODO())
+			Expect(err).To(MatchError("timed out after 30s waiting for a turn to upgrade: only 1 of 3 nodes are running, the cluster needs 2 to keep quorum while this node upgrades"))
+			Expect(fakeOs.SleepCallCount()).To(Equal(3))
+		})
+
+		Context("and the coordination timeout is disabled", func() {
+			BeforeEach(func() {
+				upgraderConfig.CoordinationTimeout = 0
+				fakeOs.SleepStub = func(context.Context, time.Duration) error {
+					if fakeOs.SleepCallCount() == 5 {
+						peerPhases["10.0.0.3"] = peerResponse("other-node-3", PhaseRunning)
+					}
+					return nil
+				}
+			})
+
+			It("keeps waiting", func() {
+				Expect(coordinator.WaitForTurn(context.TODO())).To(Succeed())
+				Expect(fakeOs.SleepCallCount()).To(Equal(5))
+			})
+		})
+	})
+
+	Context("when no peer is running", func() {
+		BeforeEach(func() {
+			peerPhases["10.0.0.1"] = peerResponse("other-node-1", "initializing")
+			delete(peerPhases, "10.0.0.3")
+		})
+
+		It("upgrades as there is no quorum to keep", func() {
+			Expect(coordinator.WaitForTurn(context.TODO())).To(Succeed())
+		})
+	})
+
+	Context("when no peer answers", func() {
+		BeforeEach(func() {
+			delete(peerPhases, "10.0.0.1")
+			delete(peerPhases, "10.0.0.3")
+		})
+
+		It("logs an error and gives up after the coordination timeout", func() {
+			err := coordinator.WaitForTurn(context.TODO())
+			Expect(err).To(MatchError("timed out after 30s waiting for a turn to upgrade: no peer answered on port 8114"))
+			Expect(fakeOs.SleepCallCount()).To(Equal(3))
+			Expect(testLogger.Buffer()).To(gbytes.Say(`no-peer-answered.*"log_level":2`))
+		})
+
+		Context("and a peer answers later", func() {
+			BeforeEach(func() {
+				fakeOs.SleepStub = func(context.Context, time.Duration) error {
+					peerPhases["10.0.0.1"] = peerResponse("other-node-1", "initializing")
+					return nil
+				}
+			})
+
+			It("upgrades once it does", func() {
+				Expect(coordinator.WaitForTurn(context.TODO())).To(Succeed())
+				Expect(fakeOs.SleepCallCount()).To(Equal(1))
+			})
+		})
+	})
+
+	Context("when peers run a galera-init release without /state", func() {
+		BeforeEach(func() {
+			peerPhases["10.0.0.1"] = "galera init done"
+			peerPhases["10.0.0.3"] = "galera init done"
+		})
+
+		It("counts them as running", func() {
+			Expect(coordinator.WaitForTurn(context.TODO())).To(Succeed())
+			Expect(fakeOs.SleepCallCount()).To(Equal(0))
+		})
+
+		Context("and the cluster would lose quorum", func() {
+			BeforeEach(func() {
+				delete(peerPhases, "10.0.0.3")
+			})
+
+			It("waits", func() {
+				err := coordinator.WaitForTurn(context.TODO())
+				Expect(err).To(MatchError(ContainSubstring("only 1 of 3 nodes are running")))
+			})
+		})
+	})
+
+	Context("when the node is the only one in the cluster", func() {
+		BeforeEach(func() {
+			clusterIps = []string{"10.0.0.2"}
+		})
+
+		It("upgrades right away", func() {
+			Expect(coordinator.WaitForTurn(context.TODO())).To(Succeed())
+		})
+	})
+
+	Context("when the context is cancelled while waiting", func() {
+		BeforeEach(func() {
+			peerPhases["10.0.0.3"] = peerResponse("other-node-3", PhaseUpgrading)
+			fakeOs.SleepStub = func(ctx context.Context, _ time.Duration) error {
+				return ctx.Err()
+			}
+		})
+
+		It("returns the context error", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			Expect(coordinator.WaitForTurn(ctx)).To(Equal(context.Canceled))
+		})
+	})
+})
@@ -0,0 +1,111 @@
+// Code generated by counterfeiter. DO NOT EDIT.
+package upgrade_coordinatorfakes
+
+import (
+	"context"
+	"sync"
+
+	"github.com/cloudfoundry/galera-init/upgrade_coordinator"
+)
+
+type FakeUpgradeCoordinator struct {
+	WaitForTurnStub        func(context.Context) error
+	waitForTurnMutex       sync.RWMutex
+	waitForTurnArgsForCall []struct {
+		arg1 context.Context
+	}
+	waitForTurnReturns struct {
+		result1 error
+	}
+	waitForTurnReturnsOnCall map[int]struct {
+		result1 error
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *FakeUpgradeCoordinator) WaitForTurn(arg1 context.Context) error {
+	fake.waitForTurnMutex.Lock()
+	ret, specificReturn := fake.waitForTurnReturnsOnCall[len(fake.waitForTurnArgsForCall)]
+	fake.waitForTurnArgsForCall = append(fake.waitForTurnArgsForCall, struct {
+		arg1 context.Context
+	}{arg1})
+	fake.recordInvocation("WaitForTurn", []interface{}{arg1})
+	fake.waitForTurnMutex.Unlock()
+	if fake.WaitForTurnStub != nil {
+		return fake.WaitForTurnStub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	fakeReturns := fake.waitForTurnReturns
+	return fakeReturns.result1
+}
+
+func (fake *FakeUpgradeCoordinator) WaitForTurnCallCount() int {
+	fake.waitForTurnMutex.RLock()
+	defer fake.waitForTurnMutex.RUnlock()
+	return len(fake.waitForTurnArgsForCall)
+}
+
+func (fake *FakeUpgradeCoordinator) WaitForTurnCalls(stub func(context.Context) error) {
+	fake.waitForTurnMutex.Lock()
+	defer fake.waitForTurnMutex.Unlock()
+	fake.WaitForTurnStub = stub
+}
+
+func (fake *FakeUpgradeCoordinator) WaitForTurnArgsForCall(i int) context.Context {
+	fake.waitForTurnMutex.RLock()
+	defer fake.waitForTurnMutex.RUnlock()
+	argsForCall := fake.waitForTurnArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeUpgradeCoordinator) WaitForTurnReturns(result1 error) {
+	fake.waitForTurnMutex.Lock()
+	defer fake.waitForTurnMutex.Unlock()
+	fake.WaitForTurnStub = nil
+	fake.waitForTurnReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeUpgradeCoordinator) WaitForTurnReturnsOnCall(i int, result1 error) {
+	fake.waitForTurnMutex.Lock()
+	defer fake.waitForTurnMutex.Unlock()
+	fake.WaitForTurnStub = nil
+	if fake.waitForTurnReturnsOnCall == nil {
+		fake.waitForTurnReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.waitForTurnReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeUpgradeCoordinator) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.waitForTurnMutex.RLock()
+	defer fake.waitForTurnMutex.RUnlock()
+	copiedInvocations := map[string][][]interface{}{}
+	for key, value := range fake.invocations {
+		copiedInvocations[key] = value
+	}
+	return copiedInvocations
+}
+
+func (fake *FakeUpgradeCoordinator) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ upgrade_coordinator.UpgradeCoordinator = new(FakeUpgradeCoordinator)
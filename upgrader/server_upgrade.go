@@ -0,0 +1,250 @@
+package upgrader
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/pkg/errors"
+
+	"github.com/cloudfoundry/galera-init/config"
+)
+
+// ErrorLogEntry is one line of the MySQL 8.0 error log, e.g.
+// 2020-05-01T12:00:00.000000Z 1 [System] [MY-013381] [Server] Server upgrade from '80019' to '80020' completed.
+type ErrorLogEntry struct {
+	Priority  string
+	Code      string
+	Subsystem string
+	Message   string
+}
+
+var errorLogEntryPattern = regexp.MustCompile(`\[(System|ERROR|Warning|Note)\] \[(MY-\d+)\] \[(\w+)\] (.*)$`)
+
+// Error log codes of the entries mysqld logs about the upgrade. The codes
+// are stable across versions, while the messages follow lc_messages.
+const (
+	errorCodeServerUpgradeStatus         = "MY-013381"
+	errorCodeServerUpgradeFailed         = "MY-013380"
+	errorCodeDataDictionaryUpgradeStatus = "MY-013413"
+	errorCodeDataDictionaryInitFailed    = "MY-010020"
+)
+
+// upgradeStatus reads the versions and the untranslated started or completed
+// from an upgrade status entry, e.g.
+// Server upgrade from '80019' to '80020' completed.
+var upgradeStatus = regexp.MustCompile(`'(\d+)'.*'(\d+)'.*\b(started|completed)\b`)
+
+// Codes of the entries mysqld logs when it gives up on upgrading the data directory
+var serverUpgradeFailures = []string{
+	errorCodeServerUpgradeFailed,
+	errorCodeDataDictionaryInitFailed,
+}
+
+// ServerUpgradeReport is what a mysqld started with --upgrade logged about
+// upgrading the data directory
+type ServerUpgradeReport struct {
+	FromVersion               string
+	ToVersion                 string
+	Started                   bool
+	Completed                 bool
+	DataDictionaryFromVersion string
+	DataDictionaryToVersion   string
+	DataDictionaryStarted     bool
+	DataDictionaryCompleted   bool
+	Failures                  []string
+	Errors                    []string
+}
+
+// ParseServerUpgradeLog collects the upgrade status entries of an error log.
+// Lines that are not error log entries are ignored.
+func ParseServerUpgradeLog(log string) ServerUpgradeReport {
+	var report ServerUpgradeReport
+
+	scanner := bufio.NewScanner(strings.NewReader(log))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		entry, ok := parseErrorLogEntry(scanner.Text())
+		if !ok {
+			continue
+		}
+
+		switch entry.Code {
+		case errorCodeServerUpgradeStatus:
+			if m := upgradeStatus.FindStringSubmatch(entry.Message); m != nil {
+				report.FromVersion, report.ToVersion = m[1], m[2]
+				if m[3] == "started" {
+					report.Started = true
+				} else {
+					report.Completed = true
+				}
+			}
+		case errorCodeDataDictionaryUpgradeStatus:
+			if m := upgradeStatus.FindStringSubmatch(entry.Message); m != nil {
+				report.DataDictionaryFromVersion, report.DataDictionaryToVersion = m[1], m[2]
+				if m[3] == "started" {
+					report.DataDictionaryStarted = true
+				} else {
+					report.DataDictionaryCompleted = true
+				}
+			}
+		}
+
+		if entry.Priority != "ERROR" {
+			continue
+		}
+		report.Errors = append(report.Errors, entry.Message)
+		for _, failure := range serverUpgradeFailures {
+			if entry.Code == failure {
+				report.Failures = append(report.Failures, entry.Message)
+			}
+		}
+	}
+
+	return report
+}
+
+func parseErrorLogEntry(line string) (ErrorLogEntry, bool) {
+	m := errorLogEntryPattern.FindStringSubmatch(line)
+	if m == nil {
+		return ErrorLogEntry{}, false
+	}
+
+	return ErrorLogEntry{
+		Priority:  m[1],
+		Code:      m[2],
+		Subsystem: m[3],
+		Message:   strings.TrimSpace(m[4]),
+	}, true
+}
+
+// Err explains why the upgrade did not succeed, or returns nil when every
+// upgrade mysqld started was also completed
+func (r ServerUpgradeReport) Err() error {
+	if len(r.Failures) > 0 {
+		return fmt.Errorf("server upgrade failed: %s", strings.Join(r.Failures, "; "))
+	}
+
+	if r.DataDictionaryStarted && !r.DataDictionaryCompleted {
+		return fmt.Errorf("data dictionary upgrade from version %s to %s did not complete",
+			r.DataDictionaryFromVersion, r.DataDictionaryToVersion)
+	}
+
+	if r.Started && !r.Completed {
+		return fmt.Errorf("server upgrade from %s to %s did not complete", r.FromVersion, r.ToVersion)
+	}
+
+	return nil
+}
+
+func (r ServerUpgradeReport) logData() lager.Data {
+	return lager.Data{
+		"fromVersion":               r.FromVersion,
+		"toVersion":                 r.ToVersion,
+		"dataDictionaryFromVersion": r.DataDictionaryFromVersion,
+		"dataDictionaryToVersion":   r.DataDictionaryToVersion,
+	}
+}
+
+// serverUpgrade lets mysqld upgrade the data directory while it starts, as
+// MySQL 8.0.16+ does with --upgrade. The outcome is read from the error log
+// of the upgrade mysqld instead of from client output. force overrides the
+// configured mode with FORCE.
+func (u upgrader) serverUpgrade(ctx context.Context, force bool) error {
+	mode := u.config.ServerUpgradeMode
+	if mode == "" {
+		mode = config.ServerUpgradeModeAuto
+	}
+	if force {
+		mode = config.ServerUpgradeModeForce
+	}
+
+	u.logger.Info("starting-mysqld-for-server-upgrade", lager.Data{"mode": mode})
+	cmd, errorLog, err := u.dbHelper.StartMysqldForServerUpgrade(mode)
+	if err != nil {
+		return err
+	}
+
+	mysqldExitChan := u.osHelper.WaitForCommand(cmd)
+
+	if err := u.waitUntilMySQLReachable(ctx, mysqldExitChan); err != nil {
+		if exited, ok := err.(mysqldExitedError); ok {
+			return u.serverUpgradeExitedError(errorLog, exited)
+		}
+		if ctx.Err() != nil {
+			return u.terminateStandaloneDatabase(cmd, mysqldExitChan, ctx.Err())
+		}
+		return u.terminateStandaloneDatabase(cmd, mysqldExitChan, err)
+	}
+
+	log, err := u.osHelper.ReadFile(errorLog)
+	if err != nil {
+		err = errors.Wrap(err, "failed to read server upgrade log")
+	}
+	report := ParseServerUpgradeLog(log)
+
+	u.logger.Info("stopping-upgrade-mysqld")
+	if stopErr := u.stopStandaloneDatabase(cmd, mysqldExitChan); stopErr != nil {
+		return stopErr
+	}
+
+	u.logger.Info("mysqld-stopped")
+
+	if err != nil {
+		return err
+	}
+
+	if err := report.Err(); err != nil {
+		u.logger.Error("server-upgrade-failed", err, report.logData())
+		return err
+	}
+
+	if !report.Completed {
+		u.logger.Info("server-upgrade-not-required", report.logData())
+	} else {
+		u.logger.Info("server-upgrade-complete", report.logData())
+	}
+
+	return u.recordUpgradedVersion()
+}
+
+func (u upgrader) serverUpgradeExitedError(errorLog string, exited mysqldExitedError) error {
+	log, err := u.osHelper.ReadFile(errorLog)
+	if err != nil {
+		u.logger.Error("failed-to-read-server-upgrade-log", err)
+		return exited
+	}
+
+	report := ParseServerUpgradeLog(log)
+	u.logger.Error("server-upgrade-failed", exited, lager.Data{
+		"fromVersion": report.FromVersion,
+		"toVersion":   report.ToVersion,
+		"errors":      report.Errors,
+	})
+
+	if err := report.Err(); err != nil {
+		return errors.Wrap(err, exited.Error())
+	}
+	if len(report.Errors) > 0 {
+		return errors.Wrap(errors.New(strings.Join(report.Errors, "; ")), exited.Error())
+	}
+	return exited
+}
+
+// recordUpgradedVersion does what mysql_upgrade does after a successful run,
+// so NeedsUpgrade reports the data directory as current
+func (u upgrader) recordUpgradedVersion() error {
+	packageVersion, err := u.osHelper.ReadFile(u.config.PackageVersionFile)
+	if err != nil {
+		return errors.Wrap(err, "failed to read package version file")
+	}
+
+	if err := u.osHelper.WriteStringToFile(u.config.LastUpgradedVersionFile, packageVersion); err != nil {
+		return errors.Wrap(err, "failed to record upgraded version")
+	}
+
+	return nil
+}
@@ -0,0 +1,71 @@
+package upgrader_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/cloudfoundry/galera-init/upgrader"
+)
+
+var _ = Describe("ParseServerUpgradeLog", func() {
+	It("reports the server and data dictionary versions of a completed upgrade", func() {
+		report := ParseServerUpgradeLog(`2020-05-01T12:00:02.000000Z 1 [System] [MY-013413] [Server] Data dictionary upgrade from version '80017' to '80019' started.
+2020-05-01T12:00:03.000000Z 1 [System] [MY-013413] [Server] Data dictionary upgrade from version '80017' to '80019' completed.
+2020-05-01T12:00:04.000000Z 4 [System] [MY-013381] [Server] Server upgrade from '80019' to '80020' started.
+2020-05-01T12:00:09.000000Z 4 [System] [MY-013381] [Server] Server upgrade from '80019' to '80020' completed.
+`)
+
+		Expect(report.FromVersion).To(Equal("80019"))
+		Expect(report.ToVersion).To(Equal("80020"))
+		Expect(report.Completed).To(BeTrue())
+		Expect(report.DataDictionaryFromVersion).To(Equal("80017"))
+		Expect(report.DataDictionaryToVersion).To(Equal("80019"))
+		Expect(report.DataDictionaryCompleted).To(BeTrue())
+		Expect(report.Err()).ToNot(HaveOccurred())
+	})
+
+	It("ignores lines that are not error log entries", func() {
+		report := ParseServerUpgradeLog("Server upgrade from '80019' to '80020' started.\nmysqld: [ERROR] Failed to upgrade server.\n")
+
+		Expect(report.Started).To(BeFalse())
+		Expect(report.Errors).To(BeEmpty())
+		Expect(report.Err()).ToNot(HaveOccurred())
+	})
+
+	It("does not treat unrelated errors as a failed upgrade", func() {
+		report := ParseServerUpgradeLog("2020-05-01T12:00:01.000000Z 0 [ERROR] [MY-000000] [Galera] wsrep_provider is none\n")
+
+		Expect(report.Errors).To(ConsistOf("wsrep_provider is none"))
+		Expect(report.Err()).ToNot(HaveOccurred())
+	})
+
+	It("fails when mysqld logs that the upgrade failed", func() {
+		report := ParseServerUpgradeLog("2020-05-01T12:00:05.000000Z 0 [ERROR] [MY-013380] [Server] Failed to upgrade server.\n")
+
+		Expect(report.Err()).To(MatchError("server upgrade failed: Failed to upgrade server."))
+	})
+
+	It("recognises the entries by their code rather than their message", func() {
+		report := ParseServerUpgradeLog(`2020-05-01T12:00:04.000000Z 4 [System] [MY-013381] [Server] Actualización del servidor de '80019' a '80020' started.
+2020-05-01T12:00:05.000000Z 0 [ERROR] [MY-010020] [Server] Falló la inicialización del diccionario de datos.
+`)
+
+		Expect(report.Started).To(BeTrue())
+		Expect(report.FromVersion).To(Equal("80019"))
+		Expect(report.ToVersion).To(Equal("80020"))
+		Expect(report.Err()).To(MatchError("server upgrade failed: Falló la inicialización del diccionario de datos."))
+	})
+
+	It("does not take messages with other codes for the upgrade status", func() {
+		report := ParseServerUpgradeLog("2020-05-01T12:00:01.000000Z 0 [ERROR] [MY-000000] [Server] Failed to upgrade server.\n")
+
+		Expect(report.Failures).To(BeEmpty())
+		Expect(report.Err()).ToNot(HaveOccurred())
+	})
+
+	It("fails when the data dictionary upgrade did not complete", func() {
+		report := ParseServerUpgradeLog("2020-05-01T12:00:02.000000Z 1 [System] [MY-013413] [Server] Data dictionary upgrade from version '80017' to '80019' started.\n")
+
+		Expect(report.Err()).To(MatchError("data dictionary upgrade from version 80017 to 80019 did not complete"))
+	})
+})
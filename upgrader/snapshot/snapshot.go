@@ -0,0 +1,198 @@
+package snapshot
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/pkg/errors"
+
+	"github.com/cloudfoundry/galera-init/config"
+	"github.com/cloudfoundry/galera-init/os_helper"
+)
+
+const namePrefix = "upgrade-"
+
+// Now names new snapshots; tests replace it to control ordering
+var Now = time.Now
+
+//go:generate go run github.com/maxbrunsfeld/counterfeiter/v6 . Snapshotter
+type Snapshotter interface {
+	// Take copies the data directory and returns the snapshot path
+	Take(ctx context.Context) (string, error)
+	// Restore replaces the data directory with the snapshot. mysqld must not be running.
+	Restore(snapshot string) error
+	// Prune removes all but the newest Retain snapshots
+	Prune() error
+}
+
+type snapshotter struct {
+	osHelper os_helper.OsHelper
+	config   config.UpgradeSnapshot
+	logger   lager.Logger
+}
+
+func NewSnapshotter(osHelper os_helper.OsHelper, config config.UpgradeSnapshot, logger lager.Logger) Snapshotter {
+	return snapshotter{
+		osHelper: osHelper,
+		config:   config,
+		logger:   logger,
+	}
+}
+
+func (s snapshotter) Take(ctx context.Context) (string, error) {
+	snapshot := filepath.Join(s.config.Directory, namePrefix+Now().UTC().Format("20060102T150405Z"))
+
+	s.logger.Info("taking-snapshot", lager.Data{
+		"dataDirectory": s.config.DataDirectory,
+		"snapshot":      snapshot,
+		"method":        s.config.Method,
+	})
+
+	if err := s.osHelper.MkdirAll(snapshot, 0700); err != nil {
+		return "", errors.Wrap(err, "failed to create snapshot directory")
+	}
+
+	if s.config.Method != config.SnapshotMethodCommand {
+		if err := s.checkFreeSpace(); err != nil {
+			s.removeSnapshot(snapshot)
+			return "", err
+		}
+	}
+
+	var (
+		output string
+		err    error
+	)
+	if s.config.Method == config.SnapshotMethodCommand {
+		output, err = s.runCommand(ctx, s.config.BackupCommand, s.config.DataDirectory, snapshot)
+	} else {
+		output, err = s.osHelper.RunCommandContext(ctx, "cp", "-a", "--reflink=auto", s.config.DataDirectory+"/.", snapshot)
+	}
+
+	if err != nil {
+		s.logger.Error("take-snapshot-failed", err, lager.Data{"output": output})
+		s.removeSnapshot(snapshot)
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		return "", errors.Wrapf(err, "failed to snapshot %s: %s", s.config.DataDirectory, strings.TrimSpace(output))
+	}
+
+	s.logger.Info("snapshot-taken", lager.Data{"snapshot": snapshot})
+	return snapshot, nil
+}
+
+// checkFreeSpace refuses a snapshot that would fill the file system. cp
+// falls back to a full copy where extents cannot be shared, so the whole
+// data directory has to fit.
+func (s snapshotter) checkFreeSpace() error {
+	needed, err := s.osHelper.DirectorySize(s.config.DataDirectory)
+	if err != nil {
+		return errors.Wrap(err, "failed to measure data directory")
+	}
+
+	available, err := s.osHelper.FreeSpace(s.config.Directory)
+	if err != nil {
+		return errors.Wrap(err, "failed to read free space")
+	}
+
+	if available < needed {
+		s.logger.Info("not-enough-space-for-snapshot", lager.Data{
+			"needed":    needed,
+			"available": available,
+		})
+		return errors.Errorf("not enough free space in %s to snapshot %s: %d bytes needed, %d available",
+			s.config.Directory, s.config.DataDirectory, needed, available)
+	}
+
+	return nil
+}
+
+func (s snapshotter) removeSnapshot(snapshot string) {
+	if err := s.osHelper.RemoveAll(snapshot); err != nil {
+		s.logger.Error("remove-incomplete-snapshot-failed", err)
+	}
+}
+
+func (s snapshotter) Restore(snapshot string) error {
+	s.logger.Info("restoring-snapshot", lager.Data{
+		"dataDirectory": s.config.DataDirectory,
+		"snapshot":      snapshot,
+	})
+
+	var (
+		output string
+		err    error
+	)
+	if s.config.Method == config.SnapshotMethodCommand {
+		output, err = s.runCommand(context.Background(), s.config.RestoreCommand, snapshot, s.config.DataDirectory)
+	} else {
+		if err := s.emptyDirectory(s.config.DataDirectory); err != nil {
+			return errors.Wrap(err, "failed to clear data directory")
+		}
+		output, err = s.osHelper.RunCommand("cp", "-a", "--reflink=auto", snapshot+"/.", s.config.DataDirectory)
+	}
+
+	if err != nil {
+		s.logger.Error("restore-snapshot-failed", err, lager.Data{"output": output})
+		return errors.Wrapf(err, "failed to restore %s from %s: %s", s.config.DataDirectory, snapshot, strings.TrimSpace(output))
+	}
+
+	s.logger.Info("snapshot-restored", lager.Data{"snapshot": snapshot})
+	return nil
+}
+
+func (s snapshotter) Prune() error {
+	entries, err := s.osHelper.ReadDir(s.config.Directory)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.Wrap(err, "failed to list snapshots")
+	}
+
+	var snapshots []string
+	for _, entry := range entries {
+		if entry.IsDir() && strings.HasPrefix(entry.Name(), namePrefix) {
+			snapshots = append(snapshots, entry.Name())
+		}
+	}
+
+	// Names embed the UTC time they were taken at, so they sort oldest first
+	sort.Strings(snapshots)
+
+	for len(snapshots) > s.config.Retain {
+		snapshot := filepath.Join(s.config.Directory, snapshots[0])
+		s.logger.Info("removing-snapshot", lager.Data{"snapshot": snapshot})
+		if err := s.osHelper.RemoveAll(snapshot); err != nil {
+			return errors.Wrapf(err, "failed to remove snapshot %s", snapshot)
+		}
+		snapshots = snapshots[1:]
+	}
+
+	return nil
+}
+
+func (s snapshotter) runCommand(ctx context.Context, command []string, args ...string) (string, error) {
+	return s.osHelper.RunCommandContext(ctx, command[0], append(command[1:len(command):len(command)], args...)...)
+}
+
+func (s snapshotter) emptyDirectory(dir string) error {
+	entries, err := s.osHelper.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if err := s.osHelper.RemoveAll(filepath.Join(dir, entry.Name())); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,264 @@
+package snapshot_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"code.cloudfoundry.org/lager/lagertest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/cloudfoundry/galera-init/config"
+	"github.com/cloudfoundry/galera-init/os_helper"
+	"github.com/cloudfoundry/galera-init/os_helper/os_helperfakes"
+	. "github.com/cloudfoundry/galera-init/upgrader/snapshot"
+)
+
+var _ = Describe("Snapshotter", func() {
+	var (
+		tempDir        string
+		dataDirectory  string
+		snapshotConfig config.UpgradeSnapshot
+		testLogger     *lagertest.TestLogger
+	)
+
+	BeforeEach(func() {
+		var err error
+		tempDir, err = ioutil.TempDir("", "snapshot")
+		Expect(err).NotTo(HaveOccurred())
+
+		dataDirectory = filepath.Join(tempDir, "data")
+		Expect(os.MkdirAll(filepath.Join(dataDirectory, "mysql"), 0700)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(dataDirectory, "ibdata1"), []byte("before upgrade"), 0600)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(dataDirectory, "mysql", "user.ibd"), []byte("users"), 0600)).To(Succeed())
+
+		snapshotConfig = config.UpgradeSnapshot{
+			Enabled:       true,
+			DataDirectory: dataDirectory,
+			Directory:     filepath.Join(tempDir, "snapshots"),
+			Method:        config.SnapshotMethodReflink,
+			Retain:        1,
+		}
+		testLogger = lagertest.NewTestLogger("snapshot")
+
+		Now = func() time.Time {
+			return time.Date(2020, 10, 18, 12, 0, 0, 0, time.UTC)
+		}
+	})
+
+	AfterEach(func() {
+		Now = time.Now
+		Expect(os.RemoveAll(tempDir)).To(Succeed())
+	})
+
+	readFile := func(path string) string {
+		contents, err := ioutil.ReadFile(path)
+		Expect(err).NotTo(HaveOccurred())
+		return string(contents)
+	}
+
+	Context("with the reflink method", func() {
+		var snapshotter Snapshotter
+
+		BeforeEach(func() {
+			snapshotter = NewSnapshotter(os_helper.NewImpl(), snapshotConfig, testLogger)
+		})
+
+		It("copies the data directory and restores it", func() {
+			snapshot, err := snapshotter.Take(context.TODO())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(snapshot).To(Equal(filepath.Join(tempDir, "snapshots", "upgrade-20201018T120000Z")))
+			Expect(readFile(filepath.Join(snapshot, "mysql", "user.ibd"))).To(Equal("users"))
+
+			Expect(ioutil.WriteFile(filepath.Join(dataDirectory, "ibdata1"), []byte("half upgraded"), 0600)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(dataDirectory, "mysql.ibd"), []byte("new dictionary"), 0600)).To(Succeed())
+
+			Expect(snapshotter.Restore(snapshot)).To(Succeed())
+
+			Expect(readFile(filepath.Join(dataDirectory, "ibdata1"))).To(Equal("before upgrade"))
+			Expect(filepath.Join(dataDirectory, "mysql.ibd")).NotTo(BeAnExistingFile())
+			Expect(readFile(filepath.Join(snapshot, "ibdata1"))).To(Equal("before upgrade"))
+		})
+
+		Context("when the data directory is missing", func() {
+			BeforeEach(func() {
+				snapshotConfig.DataDirectory = filepath.Join(tempDir, "missing")
+				snapshotter = NewSnapshotter(os_helper.NewImpl(), snapshotConfig, testLogger)
+			})
+
+			It("returns an error and removes the incomplete snapshot", func() {
+				_, err := snapshotter.Take(context.TODO())
+				Expect(err).To(MatchError(ContainSubstring("failed to measure data directory")))
+
+				entries, err := ioutil.ReadDir(snapshotConfig.Directory)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(entries).To(BeEmpty())
+			})
+		})
+	})
+
+	Context("with the reflink method on a faked file system", func() {
+		var (
+			fakeOs      *os_helperfakes.FakeOsHelper
+			snapshotter Snapshotter
+		)
+
+		BeforeEach(func() {
+			fakeOs = new(os_helperfakes.FakeOsHelper)
+			fakeOs.DirectorySizeReturns(100, nil)
+			fakeOs.FreeSpaceReturns(100, nil)
+			snapshotter = NewSnapshotter(fakeOs, snapshotConfig, testLogger)
+		})
+
+		It("checks the free space next to the snapshots before copying", func() {
+			snapshot, err := snapshotter.Take(context.TODO())
+			Expect(err).NotTo(HaveOccurred())
+
+			path, _ := fakeOs.MkdirAllArgsForCall(0)
+			Expect(path).To(Equal(snapshot))
+			Expect(fakeOs.DirectorySizeArgsForCall(0)).To(Equal(dataDirectory))
+			Expect(fakeOs.FreeSpaceArgsForCall(0)).To(Equal(snapshotConfig.Directory))
+			Expect(fakeOs.RunCommandContextCallCount()).To(Equal(1))
+		})
+
+		Context("when the data directory does not fit", func() {
+			BeforeEach(func() {
+				fakeOs.FreeSpaceReturns(99, nil)
+			})
+
+			It("returns an error without copying and removes the snapshot directory", func() {
+				snapshot, err := snapshotter.Take(context.TODO())
+				Expect(err).To(MatchError(ContainSubstring("not enough free space in " + snapshotConfig.Directory + " to snapshot " + dataDirectory + ": 100 bytes needed, 99 available")))
+				Expect(snapshot).To(BeEmpty())
+				Expect(fakeOs.RunCommandContextCallCount()).To(Equal(0))
+
+				path, _ := fakeOs.MkdirAllArgsForCall(0)
+				Expect(fakeOs.RemoveAllArgsForCall(0)).To(Equal(path))
+			})
+		})
+
+		Context("when copying fails", func() {
+			BeforeEach(func() {
+				fakeOs.RunCommandContextReturns("cp: No space left on device\n", errors.New("exit status 1"))
+			})
+
+			It("removes the incomplete snapshot", func() {
+				_, err := snapshotter.Take(context.TODO())
+				Expect(err).To(MatchError(ContainSubstring("cp: No space left on device")))
+
+				path, _ := fakeOs.MkdirAllArgsForCall(0)
+				Expect(fakeOs.RemoveAllCallCount()).To(Equal(1))
+				Expect(fakeOs.RemoveAllArgsForCall(0)).To(Equal(path))
+			})
+		})
+	})
+
+	Context("with the command method", func() {
+		var (
+			fakeOs      *os_helperfakes.FakeOsHelper
+			snapshotter Snapshotter
+		)
+
+		BeforeEach(func() {
+			fakeOs = new(os_helperfakes.FakeOsHelper)
+			snapshotConfig.Method = config.SnapshotMethodCommand
+			snapshotConfig.BackupCommand = []string{"/usr/local/bin/backup", "--compress"}
+			snapshotConfig.RestoreCommand = []string{"/usr/local/bin/restore"}
+			snapshotter = NewSnapshotter(fakeOs, snapshotConfig, testLogger)
+		})
+
+		It("runs the backup command with the data directory and the snapshot", func() {
+			snapshot, err := snapshotter.Take(context.TODO())
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fakeOs.RunCommandContextCallCount()).To(Equal(1))
+			_, executable, args := fakeOs.RunCommandContextArgsForCall(0)
+			Expect(executable).To(Equal("/usr/local/bin/backup"))
+			Expect(args).To(Equal([]string{"--compress", dataDirectory, snapshot}))
+
+			path, perm := fakeOs.MkdirAllArgsForCall(0)
+			Expect(path).To(Equal(snapshot))
+			Expect(perm).To(Equal(os.FileMode(0700)))
+			Expect(fakeOs.FreeSpaceCallCount()).To(Equal(0))
+		})
+
+		It("runs the restore command with the snapshot and the data directory", func() {
+			Expect(snapshotter.Restore("/snapshots/upgrade-20201018T120000Z")).To(Succeed())
+
+			_, executable, args := fakeOs.RunCommandContextArgsForCall(0)
+			Expect(executable).To(Equal("/usr/local/bin/restore"))
+			Expect(args).To(Equal([]string{"/snapshots/upgrade-20201018T120000Z", dataDirectory}))
+			Expect(readFile(filepath.Join(dataDirectory, "ibdata1"))).To(Equal("before upgrade"))
+		})
+
+		Context("when the backup command fails", func() {
+			BeforeEach(func() {
+				fakeOs.RunCommandContextReturns("disk full\n", errors.New("exit status 2"))
+			})
+
+			It("returns the command output", func() {
+				_, err := snapshotter.Take(context.TODO())
+				Expect(err).To(MatchError("failed to snapshot " + dataDirectory + ": disk full: exit status 2"))
+			})
+		})
+
+		Context("when the context is cancelled while the backup command runs", func() {
+			It("returns the context error", func() {
+				ctx, cancel := context.WithCancel(context.Background())
+				fakeOs.RunCommandContextStub = func(context.Context, string, ...string) (string, error) {
+					cancel()
+					return "", errors.New("signal: killed")
+				}
+
+				_, err := snapshotter.Take(ctx)
+				Expect(err).To(Equal(context.Canceled))
+			})
+		})
+	})
+
+	Describe("Prune", func() {
+		BeforeEach(func() {
+			for _, name := range []string{"upgrade-20190101T000000Z", "upgrade-20200101T000000Z", "upgrade-20201018T120000Z", "manual-backup"} {
+				Expect(os.MkdirAll(filepath.Join(snapshotConfig.Directory, name), 0700)).To(Succeed())
+			}
+		})
+
+		snapshotNames := func() []string {
+			entries, err := ioutil.ReadDir(snapshotConfig.Directory)
+			Expect(err).NotTo(HaveOccurred())
+
+			var names []string
+			for _, entry := range entries {
+				names = append(names, entry.Name())
+			}
+			return names
+		}
+
+		It("keeps the newest snapshots and leaves other directories alone", func() {
+			snapshotConfig.Retain = 2
+			snapshotter := NewSnapshotter(os_helper.NewImpl(), snapshotConfig, testLogger)
+
+			Expect(snapshotter.Prune()).To(Succeed())
+			Expect(snapshotNames()).To(ConsistOf("manual-backup", "upgrade-20200101T000000Z", "upgrade-20201018T120000Z"))
+		})
+
+		It("removes every snapshot when Retain is 0", func() {
+			snapshotConfig.Retain = 0
+			snapshotter := NewSnapshotter(os_helper.NewImpl(), snapshotConfig, testLogger)
+
+			Expect(snapshotter.Prune()).To(Succeed())
+			Expect(snapshotNames()).To(ConsistOf("manual-backup"))
+		})
+
+		It("succeeds when no snapshot was ever taken", func() {
+			snapshotConfig.Directory = filepath.Join(tempDir, "never-created")
+			snapshotter := NewSnapshotter(os_helper.NewImpl(), snapshotConfig, testLogger)
+
+			Expect(snapshotter.Prune()).To(Succeed())
+		})
+	})
+})
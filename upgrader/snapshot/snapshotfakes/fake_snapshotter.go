@@ -0,0 +1,253 @@
+// Code generated by counterfeiter. DO NOT EDIT.
+package snapshotfakes
+
+import (
+	"context"
+	"sync"
+
+	"github.com/cloudfoundry/galera-init/upgrader/snapshot"
+)
+
+type FakeSnapshotter struct {
+	PruneStub        func() error
+	pruneMutex       sync.RWMutex
+	pruneArgsForCall []struct {
+	}
+	pruneReturns struct {
+		result1 error
+	}
+	pruneReturnsOnCall map[int]struct {
+		result1 error
+	}
+	RestoreStub        func(string) error
+	restoreMutex       sync.RWMutex
+	restoreArgsForCall []struct {
+		arg1 string
+	}
+	restoreReturns struct {
+		result1 error
+	}
+	restoreReturnsOnCall map[int]struct {
+		result1 error
+	}
+	TakeStub        func(context.Context) (string, error)
+	takeMutex       sync.RWMutex
+	takeArgsForCall []struct {
+		arg1 context.Context
+	}
+	takeReturns struct {
+		result1 string
+		result2 error
+	}
+	takeReturnsOnCall map[int]struct {
+		result1 string
+		result2 error
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *FakeSnapshotter) Prune() error {
+	fake.pruneMutex.Lock()
+	ret, specificReturn := fake.pruneReturnsOnCall[len(fake.pruneArgsForCall)]
+	fake.pruneArgsForCall = append(fake.pruneArgsForCall, struct {
+	}{})
+	fake.recordInvocation("Prune", []interface{}{})
+	fake.pruneMutex.Unlock()
+	if fake.PruneStub != nil {
+		return fake.PruneStub()
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	fakeReturns := fake.pruneReturns
+	return fakeReturns.result1
+}
+
+func (fake *FakeSnapshotter) PruneCallCount() int {
+	fake.pruneMutex.RLock()
+	defer fake.pruneMutex.RUnlock()
+	return len(fake.pruneArgsForCall)
+}
+
+func (fake *FakeSnapshotter) PruneCalls(stub func() error) {
+	fake.pruneMutex.Lock()
+	defer fake.pruneMutex.Unlock()
+	fake.PruneStub = stub
+}
+
+func (fake *FakeSnapshotter) PruneReturns(result1 error) {
+	fake.pruneMutex.Lock()
+	defer fake.pruneMutex.Unlock()
+	fake.PruneStub = nil
+	fake.pruneReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeSnapshotter) PruneReturnsOnCall(i int, result1 error) {
+	fake.pruneMutex.Lock()
+	defer fake.pruneMutex.Unlock()
+	fake.PruneStub = nil
+	if fake.pruneReturnsOnCall == nil {
+		fake.pruneReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.pruneReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeSnapshotter) Restore(arg1 string) error {
+	fake.restoreMutex.Lock()
+	ret, specificReturn := fake.restoreReturnsOnCall[len(fake.restoreArgsForCall)]
+	fake.restoreArgsForCall = append(fake.restoreArgsForCall, struct {
+		arg1 string
+	}{arg1})
+	fake.recordInvocation("Restore", []interface{}{arg1})
+	fake.restoreMutex.Unlock()
+	if fake.RestoreStub != nil {
+		return fake.RestoreStub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	fakeReturns := fake.restoreReturns
+	return fakeReturns.result1
+}
+
+func (fake *FakeSnapshotter) RestoreCallCount() int {
+	fake.restoreMutex.RLock()
+	defer fake.restoreMutex.RUnlock()
+	return len(fake.restoreArgsForCall)
+}
+
+func (fake *FakeSnapshotter) RestoreCalls(stub func(string) error) {
+	fake.restoreMutex.Lock()
+	defer fake.restoreMutex.Unlock()
+	fake.RestoreStub = stub
+}
+
+func (fake *FakeSnapshotter) RestoreArgsForCall(i int) string {
+	fake.restoreMutex.RLock()
+	defer fake.restoreMutex.RUnlock()
+	argsForCall := fake.restoreArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeSnapshotter) RestoreReturns(result1 error) {
+	fake.restoreMutex.Lock()
+	defer fake.restoreMutex.Unlock()
+	fake.RestoreStub = nil
+	fake.restoreReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeSnapshotter) RestoreReturnsOnCall(i int, result1 error) {
+	fake.restoreMutex.Lock()
+	defer fake.restoreMutex.Unlock()
+	fake.RestoreStub = nil
+	if fake.restoreReturnsOnCall == nil {
+		fake.restoreReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.restoreReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeSnapshotter) Take(arg1 context.Context) (string, error) {
+	fake.takeMutex.Lock()
+	ret, specificReturn := fake.takeReturnsOnCall[len(fake.takeArgsForCall)]
+	fake.takeArgsForCall = append(fake.takeArgsForCall, struct {
+		arg1 context.Context
+	}{arg1})
+	fake.recordInvocation("Take", []interface{}{arg1})
+	fake.takeMutex.Unlock()
+	if fake.TakeStub != nil {
+		return fake.TakeStub(arg1)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	fakeReturns := fake.takeReturns
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeSnapshotter) TakeCallCount() int {
+	fake.takeMutex.RLock()
+	defer fake.takeMutex.RUnlock()
+	return len(fake.takeArgsForCall)
+}
+
+func (fake *FakeSnapshotter) TakeCalls(stub func(context.Context) (string, error)) {
+	fake.takeMutex.Lock()
+	defer fake.takeMutex.Unlock()
+	fake.TakeStub = stub
+}
+
+func (fake *FakeSnapshotter) TakeArgsForCall(i int) context.Context {
+	fake.takeMutex.RLock()
+	defer fake.takeMutex.RUnlock()
+	argsForCall := fake.takeArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeSnapshotter) TakeReturns(result1 string, result2 error) {
+	fake.takeMutex.Lock()
+	defer fake.takeMutex.Unlock()
+	fake.TakeStub = nil
+	fake.takeReturns = struct {
+		result1 string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeSnapshotter) TakeReturnsOnCall(i int, result1 string, result2 error) {
+	fake.takeMutex.Lock()
+	defer fake.takeMutex.Unlock()
+	fake.TakeStub = nil
+	if fake.takeReturnsOnCall == nil {
+		fake.takeReturnsOnCall = make(map[int]struct {
+			result1 string
+			result2 error
+		})
+	}
+	fake.takeReturnsOnCall[i] = struct {
+		result1 string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeSnapshotter) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.pruneMutex.RLock()
+	defer fake.pruneMutex.RUnlock()
+	fake.restoreMutex.RLock()
+	defer fake.restoreMutex.RUnlock()
+	fake.takeMutex.RLock()
+	defer fake.takeMutex.RUnlock()
+	copiedInvocations := map[string][][]interface{}{}
+	for key, value := range fake.invocations {
+		copiedInvocations[key] = value
+	}
+	return copiedInvocations
+}
+
+func (fake *FakeSnapshotter) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ snapshot.Snapshotter = new(FakeSnapshotter)
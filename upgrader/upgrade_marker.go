@@ -0,0 +1,115 @@
+package upgrader
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/pkg/errors"
+
+	"github.com/cloudfoundry/galera-init/config"
+)
+
+// UpgradeMarkerFileName is kept next to LastUpgradedVersionFile while an
+// upgrade runs. Finding it on start means the previous upgrade was interrupted.
+const UpgradeMarkerFileName = "galera-init-upgrade-in-progress.json"
+
+// UpgradeMarker records the upgrade that is in progress
+type UpgradeMarker struct {
+	FromVersion string    `json:"from_version"`
+	ToVersion   string    `json:"to_version"`
+	Strategy    string    `json:"strategy"`
+	StartedAt   time.Time `json:"started_at"`
+	Attempts    int       `json:"attempts"`
+	Snapshot    string    `json:"snapshot,omitempty"`
+}
+
+// UpgradeMarkerPath is where the upgrade marker for the given config is kept
+func UpgradeMarkerPath(cfg config.Upgrader) string {
+	return filepath.Join(filepath.Dir(cfg.LastUpgradedVersionFile), UpgradeMarkerFileName)
+}
+
+func (u upgrader) upgradeMarkerPath() string {
+	return UpgradeMarkerPath(u.config)
+}
+
+// readUpgradeMarker returns nil when no upgrade was interrupted. A marker that
+// cannot be parsed, e.g. because it was written by a newer galera-init, still
+// counts as an interrupted upgrade whose versions are unknown.
+func (u upgrader) readUpgradeMarker() (*UpgradeMarker, error) {
+	path := u.upgradeMarkerPath()
+	if !u.osHelper.FileExists(path) {
+		return nil, nil
+	}
+
+	contents, err := u.osHelper.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read upgrade marker")
+	}
+
+	var marker UpgradeMarker
+	if err := json.Unmarshal([]byte(contents), &marker); err != nil {
+		u.logger.Error("upgrade-marker-unreadable", err, lager.Data{"path": path})
+		return &UpgradeMarker{}, nil
+	}
+
+	return &marker, nil
+}
+
+func (u upgrader) writeUpgradeMarker(marker UpgradeMarker) error {
+	contents, err := json.MarshalIndent(marker, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := u.osHelper.WriteStringToFile(u.upgradeMarkerPath(), string(contents)+"\n"); err != nil {
+		return errors.Wrap(err, "failed to write upgrade marker")
+	}
+
+	return nil
+}
+
+func (u upgrader) clearUpgradeMarker() error {
+	return errors.Wrap(u.osHelper.RemoveFile(u.upgradeMarkerPath()), "failed to clear upgrade marker")
+}
+
+// startUpgradeMarker writes the marker for a new upgrade, or counts another
+// attempt at an interrupted one, along with the snapshot taken before it
+func (u upgrader) startUpgradeMarker(interrupted *UpgradeMarker, snapshot string) (UpgradeMarker, error) {
+	var marker UpgradeMarker
+	if interrupted != nil {
+		marker = *interrupted
+	} else {
+		marker = UpgradeMarker{
+			FromVersion: u.readOptionalVersion(u.config.LastUpgradedVersionFile),
+			ToVersion:   u.readOptionalVersion(u.config.PackageVersionFile),
+			Strategy:    u.strategy(),
+			StartedAt:   time.Now().UTC(),
+		}
+	}
+	marker.Attempts++
+	marker.Snapshot = snapshot
+
+	return marker, u.writeUpgradeMarker(marker)
+}
+
+func (u upgrader) readOptionalVersion(filename string) string {
+	if !u.osHelper.FileExists(filename) {
+		return ""
+	}
+
+	contents, err := u.osHelper.ReadFile(filename)
+	if err != nil {
+		return ""
+	}
+
+	return cleanVersion(contents)
+}
+
+func (u upgrader) strategy() string {
+	if u.config.Strategy == "" {
+		return config.UpgradeStrategyMysqlUpgrade
+	}
+	return u.config.Strategy
+}
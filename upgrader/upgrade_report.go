@@ -0,0 +1,236 @@
+package upgrader
+
+import (
+	"bufio"
+	"encoding/json"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// UpgradeReportFileName is written next to LastUpgradedVersionFile after every mysql_upgrade run
+const UpgradeReportFileName = "galera-init-upgrade-report.json"
+
+// UpgradeReport summarizes a mysql_upgrade run
+type UpgradeReport struct {
+	Succeeded      bool           `json:"succeeded"`
+	Completed      bool           `json:"completed"`
+	ExitError      string         `json:"exit_error,omitempty"`
+	TablesChecked  []string       `json:"tables_checked"`
+	TablesRepaired []string       `json:"tables_repaired"`
+	TablesFailed   []TableFailure `json:"tables_failed"`
+	// Errors are the error messages mysql_upgrade printed, whether for a
+	// table or for the whole run
+	Errors    []string `json:"errors"`
+	Tolerated []string `json:"tolerated,omitempty"`
+	Fatal     []string `json:"fatal,omitempty"`
+}
+
+// TableFailure is a table mysql_upgrade reported an error for and could not repair
+type TableFailure struct {
+	Table    string   `json:"table"`
+	Messages []string `json:"messages"`
+}
+
+var (
+	tableStatusLine  = regexp.MustCompile(`^([^\s.]+\.\S+)(?:\s+(.*))?$`)
+	tableMessageLine = regexp.MustCompile(`^(error|warning|note|status)\s*:\s*(.*)$`)
+)
+
+// Progress lines mysql_upgrade prints between the table checks
+var upgradeProgressPrefixes = []string{
+	"Checking ",
+	"Running queries",
+	"Upgrading ",
+	"Repairing ",
+	"Processing databases",
+	"Phase ",
+	"The sys schema is already up to date",
+	"Found ",
+	"mysql_upgrade: [Warning]",
+}
+
+const upgradeCompletedLine = "Upgrade process completed successfully."
+
+type tableResult struct {
+	errors   []string
+	repaired bool
+}
+
+// ParseUpgradeOutput collects the per-table results and the error messages of
+// mysql_upgrade output
+func ParseUpgradeOutput(output string) UpgradeReport {
+	report := UpgradeReport{
+		TablesChecked:  []string{},
+		TablesRepaired: []string{},
+		TablesFailed:   []TableFailure{},
+		Errors:         []string{},
+	}
+
+	var (
+		order     []string
+		tables    = map[string]*tableResult{}
+		current   string
+		repairing bool
+	)
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		switch {
+		case line == "":
+			continue
+		case line == upgradeCompletedLine:
+			report.Completed = true
+			current = ""
+			continue
+		case line == "Repairing tables":
+			repairing = true
+			current = ""
+			continue
+		case isUpgradeProgress(line):
+			current = ""
+			continue
+		}
+
+		if m := tableMessageLine.FindStringSubmatch(line); m != nil && current != "" {
+			if m[1] == "error" {
+				tables[current].errors = append(tables[current].errors, m[2])
+				report.Errors = append(report.Errors, m[2])
+			}
+			continue
+		}
+
+		if m := tableStatusLine.FindStringSubmatch(line); m != nil {
+			current = m[1]
+			result, seen := tables[current]
+			if !seen {
+				result = &tableResult{}
+				tables[current] = result
+				order = append(order, current)
+			}
+			if repairing && strings.HasPrefix(m[2], "OK") {
+				result.repaired = true
+			}
+			continue
+		}
+
+		current = ""
+		report.Errors = append(report.Errors, line)
+	}
+
+	for _, table := range order {
+		result := tables[table]
+		report.TablesChecked = append(report.TablesChecked, table)
+
+		switch {
+		case result.repaired:
+			report.TablesRepaired = append(report.TablesRepaired, table)
+		case len(result.errors) > 0:
+			report.TablesFailed = append(report.TablesFailed, TableFailure{
+				Table:    table,
+				Messages: result.errors,
+			})
+		}
+	}
+
+	return report
+}
+
+func isUpgradeProgress(line string) bool {
+	for _, prefix := range upgradeProgressPrefixes {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// UpgradeErrorRules decide which mysql_upgrade errors stop galera-init
+type UpgradeErrorRules struct {
+	Tolerated []*regexp.Regexp
+	Fatal     []*regexp.Regexp
+}
+
+func NewUpgradeErrorRules(tolerated, fatal []string) (UpgradeErrorRules, error) {
+	var rules UpgradeErrorRules
+
+	for _, pattern := range tolerated {
+		r, err := regexp.Compile(pattern)
+		if err != nil {
+			return UpgradeErrorRules{}, errors.Wrapf(err, "invalid tolerated upgrade error pattern %q", pattern)
+		}
+		rules.Tolerated = append(rules.Tolerated, r)
+	}
+
+	for _, pattern := range fatal {
+		r, err := regexp.Compile(pattern)
+		if err != nil {
+			return UpgradeErrorRules{}, errors.Wrapf(err, "invalid fatal upgrade error pattern %q", pattern)
+		}
+		rules.Fatal = append(rules.Fatal, r)
+	}
+
+	return rules, nil
+}
+
+// Apply decides whether the run succeeded. Errors matching a fatal pattern
+// always fail the upgrade. When mysql_upgrade itself failed, every error has
+// to match a tolerated pattern; a failure without any error message is only
+// tolerated when the exit error matches.
+func (r UpgradeErrorRules) Apply(report UpgradeReport, exitErr error) UpgradeReport {
+	messages := report.Errors
+	if exitErr != nil {
+		report.ExitError = exitErr.Error()
+		if len(messages) == 0 {
+			messages = []string{exitErr.Error()}
+		}
+	}
+
+	for _, message := range messages {
+		switch {
+		case matchesAny(r.Fatal, message):
+			report.Fatal = append(report.Fatal, message)
+		case matchesAny(r.Tolerated, message):
+			report.Tolerated = append(report.Tolerated, message)
+		case exitErr != nil:
+			report.Fatal = append(report.Fatal, message)
+		}
+	}
+
+	report.Succeeded = len(report.Fatal) == 0
+	return report
+}
+
+func matchesAny(patterns []*regexp.Regexp, message string) bool {
+	for _, pattern := range patterns {
+		if pattern.MatchString(message) {
+			return true
+		}
+	}
+	return false
+}
+
+// Err describes why the upgrade failed, or returns nil when it succeeded
+func (r UpgradeReport) Err() error {
+	if r.Succeeded {
+		return nil
+	}
+	return errors.Errorf("mysql_upgrade failed: %s", strings.Join(r.Fatal, "; "))
+}
+
+func (r UpgradeReport) Marshal() (string, error) {
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(b) + "\n", nil
+}
+
+func upgradeReportPath(lastUpgradedVersionFile string) string {
+	return filepath.Join(filepath.Dir(lastUpgradedVersionFile), UpgradeReportFileName)
+}
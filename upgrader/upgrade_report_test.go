@@ -0,0 +1,103 @@
+package upgrader_test
+
+import (
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/cloudfoundry/galera-init/upgrader"
+)
+
+var _ = Describe("UpgradeReport", func() {
+	Describe("ParseUpgradeOutput", func() {
+		It("tracks checked, repaired and failed tables", func() {
+			report := ParseUpgradeOutput(`Checking if update is needed.
+Checking server version.
+Running queries to upgrade MySQL server.
+Checking system database.
+mysql.db                                           OK
+Upgrading the sys schema.
+Checking databases.
+app.orders
+error    : Table rebuild required. Please do "ALTER TABLE ` + "`orders`" + ` FORCE" or dump/reload to fix it!
+app.events
+warning  : Table uses deprecated features
+error    : Incorrect information in file: './app/events.frm'
+app.users                                          OK
+Repairing tables
+app.orders                                         OK
+app.events
+error    : Corrupt
+Upgrade process completed successfully.
+Checking if update is needed.
+`)
+
+			Expect(report.Completed).To(BeTrue())
+			Expect(report.TablesChecked).To(Equal([]string{"mysql.db", "app.orders", "app.events", "app.users"}))
+			Expect(report.TablesRepaired).To(Equal([]string{"app.orders"}))
+			Expect(report.TablesFailed).To(Equal([]TableFailure{{
+				Table:    "app.events",
+				Messages: []string{"Incorrect information in file: './app/events.frm'", "Corrupt"},
+			}}))
+			Expect(report.Errors).To(HaveLen(3))
+		})
+
+		It("collects messages that are not about a table", func() {
+			report := ParseUpgradeOutput(`This installation of MySQL is already upgraded to 5.7.28, use --force if you still need to run mysql_upgrade
+`)
+
+			Expect(report.TablesChecked).To(BeEmpty())
+			Expect(report.Errors).To(Equal([]string{
+				"This installation of MySQL is already upgraded to 5.7.28, use --force if you still need to run mysql_upgrade",
+			}))
+		})
+	})
+
+	Describe("UpgradeErrorRules", func() {
+		var rules UpgradeErrorRules
+
+		BeforeEach(func() {
+			var err error
+			rules, err = NewUpgradeErrorRules([]string{"already upgraded", "rebuild required"}, []string{"Corrupt"})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("succeeds when mysql_upgrade succeeded without fatal errors", func() {
+			report := rules.Apply(UpgradeReport{Errors: []string{"Table uses something odd"}}, nil)
+			Expect(report.Err()).NotTo(HaveOccurred())
+		})
+
+		It("tolerates a failed run when every error is tolerated", func() {
+			report := rules.Apply(UpgradeReport{Errors: []string{"MySQL is already upgraded to 5.7.28"}}, errors.New("exit status 1"))
+
+			Expect(report.Err()).NotTo(HaveOccurred())
+			Expect(report.ExitError).To(Equal("exit status 1"))
+			Expect(report.Tolerated).To(Equal([]string{"MySQL is already upgraded to 5.7.28"}))
+		})
+
+		It("fails a failed run with an error that is not tolerated", func() {
+			report := rules.Apply(UpgradeReport{Errors: []string{"Table rebuild required", "Access denied"}}, errors.New("exit status 1"))
+
+			Expect(report.Err()).To(MatchError("mysql_upgrade failed: Access denied"))
+		})
+
+		It("fails a failed run without any message on its exit error", func() {
+			report := rules.Apply(UpgradeReport{}, errors.New("signal: killed"))
+
+			Expect(report.Err()).To(MatchError("mysql_upgrade failed: signal: killed"))
+		})
+
+		It("lets fatal patterns win over tolerated ones", func() {
+			report := rules.Apply(UpgradeReport{Errors: []string{"Corrupt, rebuild required"}}, nil)
+
+			Expect(report.Fatal).To(Equal([]string{"Corrupt, rebuild required"}))
+			Expect(report.Err()).To(HaveOccurred())
+		})
+
+		It("rejects invalid patterns", func() {
+			_, err := NewUpgradeErrorRules(nil, []string{"("})
+			Expect(err).To(MatchError(ContainSubstring(`invalid fatal upgrade error pattern "("`)))
+		})
+	})
+})
@@ -1,8 +1,11 @@
 package upgrader
 
 import (
-	"regexp"
+	"context"
+	"fmt"
+	"os/exec"
 	"strings"
+	"syscall"
 	"time"
 
 	"code.cloudfoundry.org/lager"
@@ -11,100 +14,305 @@ import (
 	"github.com/cloudfoundry/galera-init/config"
 	"github.com/cloudfoundry/galera-init/db_helper"
 	"github.com/cloudfoundry/galera-init/os_helper"
+	"github.com/cloudfoundry/galera-init/upgrader/snapshot"
 )
 
 //go:generate go run github.com/maxbrunsfeld/counterfeiter/v6 . Upgrader
 type Upgrader interface {
-	Upgrade() error
+	Upgrade(ctx context.Context) error
 	NeedsUpgrade() (bool, error)
 }
 
 type upgrader struct {
-	osHelper os_helper.OsHelper
-	config   config.Upgrader
-	logger   lager.Logger
-	dbHelper db_helper.DBHelper
+	osHelper    os_helper.OsHelper
+	config      config.Upgrader
+	logger      lager.Logger
+	dbHelper    db_helper.DBHelper
+	snapshotter snapshot.Snapshotter
 }
 
-var (
-	DBReachablePollingAttempts = 30
-	DBReachablePollingDelay    = 10 * time.Second
-)
-
 func NewUpgrader(
 	osHelper os_helper.OsHelper,
 	config config.Upgrader,
 	logger lager.Logger,
-	dbHelper db_helper.DBHelper) Upgrader {
+	dbHelper db_helper.DBHelper,
+	snapshotter snapshot.Snapshotter) Upgrader {
 
 	return upgrader{
-		osHelper: osHelper,
-		config:   config,
-		logger:   logger,
-		dbHelper: dbHelper,
+		osHelper:    osHelper,
+		config:      config,
+		logger:      logger,
+		dbHelper:    dbHelper,
+		snapshotter: snapshotter,
 	}
 }
 
-func (u upgrader) Upgrade() error {
+// Upgrade upgrades the data directory with the configured strategy. When ctx
+// is cancelled the stand-alone mysqld is stopped and ctx.Err() is returned.
+//
+// Upgrades to a new release series are checked first, see checkMajorUpgrade.
+// With snapshots enabled the data directory is copied next and restored
+// when the upgrade fails for any reason other than ctx being cancelled.
+func (u upgrader) Upgrade(ctx context.Context) error {
+	if err := u.checkMajorUpgrade(ctx); err != nil {
+		return err
+	}
+
+	report, err := u.upgradeWithSnapshot(ctx)
+	if report != nil {
+		u.writeUpgradeReport(*report)
+	}
+
+	return err
+}
+
+func (u upgrader) upgradeWithSnapshot(ctx context.Context) (*UpgradeReport, error) {
+	interrupted, err := u.readUpgradeMarker()
+	if err != nil {
+		return nil, err
+	}
+
+	if !u.config.Snapshot.Enabled {
+		return u.upgrade(ctx, interrupted, "")
+	}
+
+	snapshot, err := u.takeSnapshot(ctx, interrupted)
+	if err != nil {
+		return nil, err
+	}
+
+	report, err := u.upgrade(ctx, interrupted, snapshot)
+	if err == nil {
+		u.pruneSnapshots()
+		return report, nil
+	}
+
+	if ctx.Err() != nil {
+		u.logger.Info("upgrade-cancelled-keeping-snapshot", lager.Data{"snapshot": snapshot})
+		return report, err
+	}
+
+	u.logger.Error("upgrade-failed-restoring-snapshot", err, lager.Data{"snapshot": snapshot})
+	if restoreErr := u.snapshotter.Restore(snapshot); restoreErr != nil {
+		return report, errors.Wrapf(restoreErr, "upgrade failed (%s) and the data directory could not be restored", err)
+	}
+
+	// The data directory matches the snapshot again, so older snapshots can
+	// go as after a successful upgrade
+	u.pruneSnapshots()
+
+	return report, errors.Wrapf(err, "upgrade failed, data directory restored from snapshot %s", snapshot)
+}
+
+// takeSnapshot reuses the snapshot an interrupted upgrade took before it
+// started, so retrying an upgrade does not copy the data directory again
+func (u upgrader) takeSnapshot(ctx context.Context, interrupted *UpgradeMarker) (string, error) {
+	if interrupted != nil && interrupted.Snapshot != "" && u.osHelper.FileExists(interrupted.Snapshot) {
+		u.logger.Info("reusing-snapshot", lager.Data{"snapshot": interrupted.Snapshot})
+		return interrupted.Snapshot, nil
+	}
+
+	return u.snapshotter.Take(ctx)
+}
+
+func (u upgrader) pruneSnapshots() {
+	if err := u.snapshotter.Prune(); err != nil {
+		u.logger.Error("prune-snapshots-failed", err)
+	}
+}
+
+// upgrade keeps the upgrade marker in place until the upgrade succeeded and
+// returns a report when mysql_upgrade ran. An interrupted upgrade is resumed
+// with a forced upgrade, which verifies tables already upgraded as well.
+func (u upgrader) upgrade(ctx context.Context, interrupted *UpgradeMarker, snapshot string) (*UpgradeReport, error) {
+	marker, err := u.startUpgradeMarker(interrupted, snapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	upgradeCtx, cancel := u.upgradeContext(ctx)
+	defer cancel()
+
+	resume := interrupted != nil
+	if resume {
+		u.logger.Info("resuming-interrupted-upgrade", lager.Data{
+			"fromVersion": marker.FromVersion,
+			"toVersion":   marker.ToVersion,
+			"startedAt":   marker.StartedAt,
+			"attempt":     marker.Attempts,
+		})
+	}
+
+	var report *UpgradeReport
+	if u.config.Strategy == config.UpgradeStrategyServer {
+		err = u.serverUpgrade(upgradeCtx, resume)
+	} else {
+		report, err = u.mysqlUpgrade(upgradeCtx, resume)
+	}
+
+	if err != nil {
+		if ctx.Err() == nil && upgradeCtx.Err() == context.DeadlineExceeded {
+			u.logger.Info("upgrade-timeout", lager.Data{"timeout": u.upgradeTimeout().String()})
+			return report, errors.Wrapf(err, "upgrade did not finish within %s", u.upgradeTimeout())
+		}
+		return report, err
+	}
+
+	return report, u.clearUpgradeMarker()
+}
+
+// upgradeContext applies UpgradeTimeout to ctx. Stopping mysqld after the
+// upgrade is bounded by StopMysqldTimeout instead.
+func (u upgrader) upgradeContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if timeout := u.upgradeTimeout(); timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+func (u upgrader) upgradeTimeout() time.Duration {
+	return time.Duration(u.config.UpgradeTimeout) * time.Second
+}
+
+// mysqlUpgrade runs mysql_upgrade against a stand-alone mysqld
+func (u upgrader) mysqlUpgrade(ctx context.Context, force bool) (*UpgradeReport, error) {
+	rules, err := NewUpgradeErrorRules(u.config.ToleratedUpgradeErrors, u.config.FatalUpgradeErrors)
+	if err != nil {
+		return nil, err
+	}
+
 	u.logger.Info("starting-mysqld-for-upgrade")
 	cmd, err := u.dbHelper.StartMysqldForUpgrade()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	mysqldExitChan := u.osHelper.WaitForCommand(cmd)
 
-	if err := u.waitUntilMySQLReachable(); err != nil {
-		return err
+	if err := u.waitUntilMySQLReachable(ctx, mysqldExitChan); err != nil {
+		if exited, ok := err.(mysqldExitedError); ok {
+			u.logger.Error("mysql-upgrade-failed", exited)
+			return nil, exited
+		}
+		if ctx.Err() != nil {
+			return nil, u.terminateStandaloneDatabase(cmd, mysqldExitChan, ctx.Err())
+		}
+		return nil, u.terminateStandaloneDatabase(cmd, mysqldExitChan, err)
 	}
 
 	u.logger.Info("mysql-upgrade-starting")
-	output, upgrade_err := u.dbHelper.Upgrade()
-
-	if upgrade_err != nil {
-		acceptableErrorsCompiled, _ := regexp.Compile(
-			"already upgraded|Unknown command|WSREP has not yet prepared node")
-
-		if acceptableErrorsCompiled.MatchString(output) {
-			u.logger.Info(
-				"output string matches acceptable errors - continuing startup.",
-				lager.Data{"upgradeErr": upgrade_err, "upgradeOutput": output},
-			)
-		} else {
-			u.logger.Info(
-				"output string does not match acceptable errors - aborting startup.",
-				lager.Data{"upgradeErr": upgrade_err, "upgradeOutput": output},
-			)
-			err = upgrade_err
-		}
-	} else {
-		u.logger.Info("mysql-upgrade-complete", lager.Data{
-			"upgradeOutput": output,
+	output, upgradeErr := u.dbHelper.Upgrade(ctx, force)
+	u.logger.Debug("mysql-upgrade-output", lager.Data{"output": output})
+
+	report := rules.Apply(ParseUpgradeOutput(output), upgradeErr)
+	u.logUpgradeReport(report)
+
+	u.logger.Info("stopping-upgrade-mysqld")
+	if err := u.stopStandaloneDatabase(cmd, mysqldExitChan); err != nil {
+		return &report, err
+	}
+
+	u.logger.Info("mysqld-stopped")
+
+	if ctx.Err() != nil {
+		return &report, ctx.Err()
+	}
+
+	return &report, report.Err()
+}
+
+func (u upgrader) logUpgradeReport(report UpgradeReport) {
+	for _, failure := range report.TablesFailed {
+		u.logger.Info("mysql-upgrade-table-failed", lager.Data{
+			"table":    failure.Table,
+			"messages": failure.Messages,
 		})
 	}
 
-	u.logger.Info("stopping-upgrade-mysqld")
-	u.stopStandaloneDatabaseSynchronously()
+	data := lager.Data{
+		"tablesChecked":  len(report.TablesChecked),
+		"tablesRepaired": report.TablesRepaired,
+		"tolerated":      report.Tolerated,
+	}
 
-	if mysqldErr := <-mysqldExitChan; mysqldErr != nil {
-		return errors.Wrap(mysqldErr, `mysqld failed during upgrade`)
+	if err := report.Err(); err != nil {
+		data["fatal"] = report.Fatal
+		u.logger.Error("mysql-upgrade-failed", err, data)
+		return
 	}
 
-	u.logger.Info("mysqld-stopped")
+	u.logger.Info("mysql-upgrade-complete", data)
+}
 
+// writeUpgradeReport persists the report next to LastUpgradedVersionFile.
+// A report that cannot be written does not fail the upgrade.
+func (u upgrader) writeUpgradeReport(report UpgradeReport) {
+	contents, err := report.Marshal()
 	if err != nil {
+		u.logger.Error("marshal-upgrade-report-failed", err)
+		return
+	}
+
+	path := upgradeReportPath(u.config.LastUpgradedVersionFile)
+	if err := u.osHelper.WriteStringToFile(path, contents); err != nil {
+		u.logger.Error("write-upgrade-report-failed", err, lager.Data{"path": path})
+	}
+}
+
+// terminateStandaloneDatabase stops the upgrade mysqld when it may not accept
+// connections yet, so mysqladmin shutdown cannot be relied on. The upgrade
+// mysqld must be gone before a snapshot can be restored.
+func (u upgrader) terminateStandaloneDatabase(cmd *exec.Cmd, mysqldExitChan chan error, reason error) error {
+	u.logger.Info("terminating-upgrade-mysqld", lager.Data{
+		"reason": reason.Error(),
+	})
+
+	if err := u.osHelper.KillCommand(cmd, syscall.SIGTERM); err != nil {
+		u.logger.Error("sigterm-upgrade-mysqld-failed", err)
 		return err
 	}
 
-	return nil
+	mysqldErr := <-mysqldExitChan
+	u.logger.Info("mysqld-stopped", lager.Data{
+		"error": mysqldErr,
+	})
+
+	return reason
+}
+
+// mysqldExitedError reports that the upgrade mysqld exited before it became reachable
+type mysqldExitedError struct {
+	err error
 }
 
-func (u upgrader) waitUntilMySQLReachable() error {
+func (e mysqldExitedError) Error() string {
+	if e.err == nil {
+		return "mysqld exited during upgrade"
+	}
+	return "mysqld exited during upgrade: " + e.err.Error()
+}
+
+// waitUntilMySQLReachable polls the upgrade mysqld. A non-nil mysqldExitChan
+// stops the wait with a mysqldExitedError once mysqld exits; the exit is
+// consumed in that case.
+func (u upgrader) waitUntilMySQLReachable(ctx context.Context, mysqldExitChan chan error) error {
 	u.logger.Info("wait-for-upgrade-mysqld", lager.Data{
 		"state": "starting",
 	})
-	for tries := 0; tries < DBReachablePollingAttempts; tries++ {
-		if u.dbHelper.IsDatabaseReachable() {
+	attempts := u.config.DBReachablePollingAttempts
+	delay := time.Duration(u.config.DBReachablePollingDelay) * time.Second
+
+	for tries := 0; tries < attempts; tries++ {
+		select {
+		case exitErr := <-mysqldExitChan:
+			u.logger.Info("wait-for-upgrade-mysqld", lager.Data{
+				"state": "exited",
+			})
+			return mysqldExitedError{err: exitErr}
+		default:
+		}
+
+		if u.dbHelper.IsDatabaseReachable(ctx) {
 			u.logger.Info("wait-for-upgrade-mysqld", lager.Data{
 				"state": "ready",
 			})
@@ -115,20 +323,63 @@ func (u upgrader) waitUntilMySQLReachable() error {
 		u.logger.Info("wait-for-upgrade-mysqld", lager.Data{
 			"state": "polling",
 		})
-		u.osHelper.Sleep(DBReachablePollingDelay)
+		if err := u.osHelper.Sleep(ctx, delay); err != nil {
+			return err
+		}
 	}
 
 	u.logger.Info("wait-for-upgrade-mysqld", lager.Data{
 		"state": "timeout",
 	})
-	return errors.New("Database is not reachable after 30 tries.")
+	return fmt.Errorf("Database is not reachable after %d tries.", attempts)
 }
 
-func (u upgrader) stopStandaloneDatabaseSynchronously() {
-	u.dbHelper.StopMysqld()
+// stopStandaloneDatabase shuts the upgrade mysqld down and waits for it to
+// exit. mysqld is killed when it has not exited within StopMysqldTimeout.
+func (u upgrader) stopStandaloneDatabase(cmd *exec.Cmd, mysqldExitChan chan error) error {
+	timeout := time.Duration(u.config.StopMysqldTimeout) * time.Second
+
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	if err := u.dbHelper.StopMysqldContext(ctx); err != nil && ctx.Err() == nil {
+		u.logger.Error("shutdown-upgrade-mysqld-failed", err)
+		if err := u.osHelper.KillCommand(cmd, syscall.SIGTERM); err != nil {
+			u.logger.Error("sigterm-upgrade-mysqld-failed", err)
+			return err
+		}
+	}
+
+	select {
+	case mysqldErr := <-mysqldExitChan:
+		return errors.Wrap(mysqldErr, `mysqld failed during upgrade`)
+	case <-ctx.Done():
+	}
+
+	u.logger.Info("upgrade-mysqld-stop-timeout", lager.Data{"timeout": timeout.String()})
+	if err := u.osHelper.KillCommand(cmd, syscall.SIGKILL); err != nil {
+		u.logger.Error("sigkill-upgrade-mysqld-failed", err)
+		return err
+	}
+	<-mysqldExitChan
+
+	return fmt.Errorf("mysqld did not stop within %s after the upgrade", timeout)
 }
 
 func (u upgrader) NeedsUpgrade() (bool, error) {
+	marker, err := u.readUpgradeMarker()
+	if err != nil {
+		return false, err
+	}
+
+	if marker != nil {
+		return u.resumeInterruptedUpgrade(*marker)
+	}
+
 	if !u.osHelper.FileExists(u.config.LastUpgradedVersionFile) {
 		u.logger.Info(
 			"Upgrade required",
@@ -173,10 +424,138 @@ func (u upgrader) NeedsUpgrade() (bool, error) {
 		return false, errors.New("DB package is invalid because the version file is not readable.")
 	}
 
-	if strings.TrimSpace(existingVersion) != strings.TrimSpace(packageVersion) {
+	existing, err := ParseVersion(existingVersion)
+	if err != nil {
+		return u.versionsDiffer(existingVersion, packageVersion, err), nil
+	}
+
+	pkg, err := ParseVersion(packageVersion)
+	if err != nil {
+		return u.versionsDiffer(existingVersion, packageVersion, err), nil
+	}
+
+	versions := lager.Data{
+		"lastUpgradedVersion": existing.String(),
+		"packageVersion":      pkg.String(),
+	}
+
+	switch pkg.Compare(existing) {
+	case 0:
+		u.logger.Info("Already upgraded to latest version, starting normally.", versions)
+		return false, nil
+	case -1:
+		if u.config.AllowDowngrade {
+			u.logger.Info("downgrade-allowed-skipping-upgrade", versions)
+			return false, nil
+		}
+		u.logger.Info("downgrade-refused", versions)
+		return false, fmt.Errorf(
+			"DB package version %s is older than the data directory, which was upgraded to %s. Set Upgrader.AllowDowngrade to start anyway.",
+			pkg, existing)
+	}
+
+	if pkg.Series() != existing.Series() {
+		u.logger.Info("major-version-upgrade", versions)
+	}
+	u.logger.Info("Need to upgrade to latest version.", versions)
+	return true, nil
+}
+
+// resumeInterruptedUpgrade requires the upgrade to be finished with the DB
+// package it was started with, as the data directory may be partly upgraded
+func (u upgrader) resumeInterruptedUpgrade(marker UpgradeMarker) (bool, error) {
+	data := lager.Data{
+		"fromVersion": marker.FromVersion,
+		"toVersion":   marker.ToVersion,
+		"startedAt":   marker.StartedAt,
+		"attempts":    marker.Attempts,
+	}
+
+	packageVersion := u.readOptionalVersion(u.config.PackageVersionFile)
+	if marker.ToVersion != "" && packageVersion != marker.ToVersion {
+		u.logger.Info("interrupted-upgrade-package-changed", data)
+		return false, fmt.Errorf(
+			"an upgrade from %q to %q was interrupted, but the DB package version is now %q. Deploy %q again to finish the upgrade, or restore the data directory and remove %s.",
+			marker.FromVersion, marker.ToVersion, packageVersion, marker.ToVersion, u.upgradeMarkerPath())
+	}
+
+	u.logger.Info("interrupted-upgrade-detected", data)
+	return true, nil
+}
+
+// versionsDiffer compares versions that cannot be parsed the way galera-init
+// always has: any difference requires an upgrade
+func (u upgrader) versionsDiffer(existingVersion, packageVersion string, parseErr error) bool {
+	u.logger.Info("cannot-order-versions", lager.Data{
+		"lastUpgradedVersion": cleanVersion(existingVersion),
+		"packageVersion":      cleanVersion(packageVersion),
+		"err":                 parseErr.Error(),
+	})
+
+	if cleanVersion(existingVersion) != cleanVersion(packageVersion) {
 		u.logger.Info("Need to upgrade to latest version.")
-		return true, nil
+		return true
 	}
 	u.logger.Info("Already upgraded to latest version, starting normally.")
-	return false, nil
+	return false
+}
+
+// checkMajorUpgrade refuses upgrades that skip a release series and runs
+// MajorUpgradeCheckCommand when the upgrade moves to a new release series
+func (u upgrader) checkMajorUpgrade(ctx context.Context) error {
+	if !u.osHelper.FileExists(u.config.LastUpgradedVersionFile) || !u.osHelper.FileExists(u.config.PackageVersionFile) {
+		return nil
+	}
+
+	existingVersion, err := u.osHelper.ReadFile(u.config.LastUpgradedVersionFile)
+	if err != nil {
+		return errors.Wrap(err, "Could not read last upgraded version file in the data dir")
+	}
+	packageVersion, err := u.osHelper.ReadFile(u.config.PackageVersionFile)
+	if err != nil {
+		return errors.Wrap(err, "DB package is invalid because the version file is not readable")
+	}
+
+	existing, err := ParseVersion(existingVersion)
+	if err != nil {
+		return nil
+	}
+	pkg, err := ParseVersion(packageVersion)
+	if err != nil {
+		return nil
+	}
+
+	if pkg.Compare(existing) <= 0 || pkg.Series() == existing.Series() {
+		return nil
+	}
+
+	if skipped := existing.skippedSeries(pkg); len(skipped) > 0 {
+		return fmt.Errorf(
+			"upgrading from %s to %s skips release series %s; upgrade through each release series in turn",
+			existing.Series(), pkg.Series(), strings.Join(skipped, ", "))
+	}
+
+	if len(u.config.MajorUpgradeCheckCommand) == 0 {
+		return nil
+	}
+
+	command := u.config.MajorUpgradeCheckCommand
+	u.logger.Info("running-major-upgrade-check", lager.Data{
+		"command":             command,
+		"lastUpgradedVersion": existing.String(),
+		"packageVersion":      pkg.String(),
+	})
+
+	args := append(command[1:len(command):len(command)], existing.String(), pkg.String())
+	output, err := u.osHelper.RunCommandContext(ctx, command[0], args...)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		u.logger.Error("major-upgrade-check-failed", err, lager.Data{"output": output})
+		return errors.Wrapf(err, "major upgrade check from %s to %s failed: %s", existing, pkg, strings.TrimSpace(output))
+	}
+
+	u.logger.Info("major-upgrade-check-passed", lager.Data{"output": output})
+	return nil
 }
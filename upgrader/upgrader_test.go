@@ -1,17 +1,24 @@
 package upgrader_test
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"os"
 	"os/exec"
+	"syscall"
+	"time"
 
 	"code.cloudfoundry.org/lager/lagertest"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
 
 	"github.com/cloudfoundry/galera-init/config"
 	"github.com/cloudfoundry/galera-init/db_helper/db_helperfakes"
 	"github.com/cloudfoundry/galera-init/os_helper/os_helperfakes"
 	. "github.com/cloudfoundry/galera-init/upgrader"
+	"github.com/cloudfoundry/galera-init/upgrader/snapshot/snapshotfakes"
 )
 
 var _ = Describe("Upgrader", func() {
@@ -19,38 +26,76 @@ var _ = Describe("Upgrader", func() {
 	var fakeOs *os_helperfakes.FakeOsHelper
 	var fakeDbHelper *db_helperfakes.FakeDBHelper
 	var testLogger *lagertest.TestLogger
+	var fakeSnapshotter *snapshotfakes.FakeSnapshotter
 
 	lastUpgradedVersionFile := "/var/vcap/store/pxc-mysql/mysql_upgrade_info"
 	packageVersionFile := "/var/vcap/package/db_package/VERSION"
+	upgradeMarkerFile := "/var/vcap/store/pxc-mysql/galera-init-upgrade-in-progress.json"
+	upgradeReportFile := "/var/vcap/store/pxc-mysql/galera-init-upgrade-report.json"
+
+	// existsWithoutUpgradeMarker reports every file but the upgrade marker as existing
+	existsWithoutUpgradeMarker := func(filename string) bool {
+		return filename != upgradeMarkerFile
+	}
+
+	// writtenFiles returns the last contents written to each file
+	writtenFiles := func() map[string]string {
+		files := map[string]string{}
+		for i := 0; i < fakeOs.WriteStringToFileCallCount(); i++ {
+			filename, contents := fakeOs.WriteStringToFileArgsForCall(i)
+			files[filename] = contents
+		}
+		return files
+	}
 
 	BeforeEach(func() {
 		fakeOs = new(os_helperfakes.FakeOsHelper)
 		fakeDbHelper = new(db_helperfakes.FakeDBHelper)
 		testLogger = lagertest.NewTestLogger("upgrader")
+		fakeSnapshotter = new(snapshotfakes.FakeSnapshotter)
 
 		upgrader = NewUpgrader(
 			fakeOs,
 			config.Upgrader{
-				PackageVersionFile:      packageVersionFile,
-				LastUpgradedVersionFile: lastUpgradedVersionFile,
+				PackageVersionFile:         packageVersionFile,
+				LastUpgradedVersionFile:    lastUpgradedVersionFile,
+				DBReachablePollingAttempts: 30,
+				DBReachablePollingDelay:    10,
+				ToleratedUpgradeErrors:     config.DefaultToleratedUpgradeErrors,
 			},
 			testLogger,
 			fakeDbHelper,
+			fakeSnapshotter,
 		)
 
+		// mysqld exits once it is stopped or signalled
+		var mysqldExitChan chan error
+		exitMysqld := func() {
+			select {
+			case mysqldExitChan <- nil:
+			default:
+			}
+		}
 		fakeOs.WaitForCommandStub = func(cmd *exec.Cmd) chan error {
-			mysqldExitChan := make(chan error, 1)
-			mysqldExitChan <- nil
+			mysqldExitChan = make(chan error, 1)
 			return mysqldExitChan
 		}
+		fakeDbHelper.StopMysqldContextStub = func(context.Context) error {
+			exitMysqld()
+			return nil
+		}
+		fakeOs.KillCommandStub = func(*exec.Cmd, os.Signal) error {
+			exitMysqld()
+			return nil
+		}
 	})
 
 	Describe("Upgrade", func() {
 		BeforeEach(func() {
 			numTries := 0
-			fakeDbHelper.IsDatabaseReachableStub = func() bool {
+			fakeDbHelper.IsDatabaseReachableStub = func(context.Context) bool {
 				numTries += 1
-				if numTries == DBReachablePollingAttempts {
+				if numTries == 30 {
 					return true
 				}
 				return false
@@ -58,12 +103,12 @@ var _ = Describe("Upgrader", func() {
 		})
 
 		It("starts mysqld for upgrade, runs the upgrade script, then stops the node", func() {
-			expectedPollingCounts := DBReachablePollingAttempts
-			err := upgrader.Upgrade()
+			expectedPollingCounts := 30
+			err := upgrader.Upgrade(context.TODO())
 			Expect(fakeDbHelper.StartMysqldForUpgradeCallCount()).To(Equal(1))
 			Expect(fakeDbHelper.IsDatabaseReachableCallCount()).To(Equal(expectedPollingCounts))
 			Expect(fakeDbHelper.UpgradeCallCount()).To(Equal(1))
-			Expect(fakeDbHelper.StopMysqldCallCount()).To(Equal(1))
+			Expect(fakeDbHelper.StopMysqldContextCallCount()).To(Equal(1))
 			Expect(err).ToNot(HaveOccurred())
 		})
 
@@ -73,7 +118,7 @@ var _ = Describe("Upgrader", func() {
 			})
 
 			It("returns an error", func() {
-				err := upgrader.Upgrade()
+				err := upgrader.Upgrade(context.TODO())
 				Expect(err).To(MatchError(`mysqld not found on path error`))
 			})
 		})
@@ -83,21 +128,142 @@ var _ = Describe("Upgrader", func() {
 				fakeDbHelper.IsDatabaseReachableReturns(false)
 			})
 
-			It("returns an error", func() {
-				err := upgrader.Upgrade()
+			It("terminates mysqld and returns an error", func() {
+				err := upgrader.Upgrade(context.TODO())
 				Expect(err).To(MatchError(`Database is not reachable after 30 tries.`))
+				Expect(fakeOs.KillCommandCallCount()).To(Equal(1))
+			})
+		})
+
+		Context("when the polling is configured", func() {
+			BeforeEach(func() {
+				upgrader = NewUpgrader(
+					fakeOs,
+					config.Upgrader{
+						PackageVersionFile:         packageVersionFile,
+						LastUpgradedVersionFile:    lastUpgradedVersionFile,
+						DBReachablePollingAttempts: 5,
+						DBReachablePollingDelay:    3,
+					},
+					testLogger,
+					fakeDbHelper,
+					fakeSnapshotter,
+				)
+				fakeDbHelper.IsDatabaseReachableReturns(false)
+			})
+
+			It("polls mysqld as configured", func() {
+				err := upgrader.Upgrade(context.TODO())
+				Expect(err).To(MatchError(`Database is not reachable after 5 tries.`))
+
+				Expect(fakeDbHelper.IsDatabaseReachableCallCount()).To(Equal(5))
+				Expect(fakeOs.SleepCallCount()).To(Equal(5))
+				_, delay := fakeOs.SleepArgsForCall(0)
+				Expect(delay).To(Equal(3 * time.Second))
+			})
+		})
+
+		Context("when the upgrade does not finish within UpgradeTimeout", func() {
+			BeforeEach(func() {
+				upgrader = NewUpgrader(
+					fakeOs,
+					config.Upgrader{
+						PackageVersionFile:         packageVersionFile,
+						LastUpgradedVersionFile:    lastUpgradedVersionFile,
+						DBReachablePollingAttempts: 30,
+						DBReachablePollingDelay:    10,
+						UpgradeTimeout:             1,
+					},
+					testLogger,
+					fakeDbHelper,
+					fakeSnapshotter,
+				)
+				fakeOs.FileExistsStub = existsWithoutUpgradeMarker
+				fakeDbHelper.UpgradeStub = func(ctx context.Context, _ bool) (string, error) {
+					<-ctx.Done()
+					return "", errors.New("signal: killed")
+				}
+			})
+
+			It("stops mysqld and returns a timeout error", func() {
+				err := upgrader.Upgrade(context.TODO())
+				Expect(err).To(MatchError("upgrade did not finish within 1s: context deadline exceeded"))
+				Expect(fakeDbHelper.StopMysqldContextCallCount()).To(Equal(1))
+				Expect(writtenFiles()).To(HaveKey(upgradeMarkerFile))
+				Expect(fakeOs.RemoveFileCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when stopping mysqld after the upgrade", func() {
+			var mysqldExitChan chan error
+
+			BeforeEach(func() {
+				mysqldExitChan = make(chan error, 1)
+				fakeOs.WaitForCommandStub = func(cmd *exec.Cmd) chan error {
+					return mysqldExitChan
+				}
+				fakeOs.KillCommandStub = func(*exec.Cmd, os.Signal) error {
+					mysqldExitChan <- errors.New("signal: killed")
+					return nil
+				}
+			})
+
+			Context("and mysqladmin shutdown fails", func() {
+				BeforeEach(func() {
+					fakeDbHelper.StopMysqldContextReturns(errors.New("Error stopping mysqld: exit status 1"))
+				})
+
+				It("terminates mysqld", func() {
+					err := upgrader.Upgrade(context.TODO())
+					Expect(err).To(MatchError("mysqld failed during upgrade: signal: killed"))
+
+					Expect(fakeOs.KillCommandCallCount()).To(Equal(1))
+					_, signal := fakeOs.KillCommandArgsForCall(0)
+					Expect(signal).To(Equal(os.Signal(syscall.SIGTERM)))
+				})
+			})
+
+			Context("and mysqld does not stop within StopMysqldTimeout", func() {
+				BeforeEach(func() {
+					upgrader = NewUpgrader(
+						fakeOs,
+						config.Upgrader{
+							PackageVersionFile:         packageVersionFile,
+							LastUpgradedVersionFile:    lastUpgradedVersionFile,
+							DBReachablePollingAttempts: 30,
+							DBReachablePollingDelay:    10,
+							StopMysqldTimeout:          1,
+						},
+						testLogger,
+						fakeDbHelper,
+						fakeSnapshotter,
+					)
+					fakeDbHelper.StopMysqldContextStub = func(ctx context.Context) error {
+						<-ctx.Done()
+						return errors.New("signal: killed")
+					}
+				})
+
+				It("kills mysqld and returns an error", func() {
+					err := upgrader.Upgrade(context.TODO())
+					Expect(err).To(MatchError("mysqld did not stop within 1s after the upgrade"))
+
+					Expect(fakeOs.KillCommandCallCount()).To(Equal(1))
+					_, signal := fakeOs.KillCommandArgsForCall(0)
+					Expect(signal).To(Equal(os.Signal(syscall.SIGKILL)))
+				})
 			})
 		})
 
 		Context("when the upgrade script returns an acceptable error", func() {
 			BeforeEach(func() {
-				fakeDbHelper.UpgradeStub = func() (string, error) {
+				fakeDbHelper.UpgradeStub = func(context.Context, bool) (string, error) {
 					return "already upgraded", errors.New("exited 1")
 				}
 			})
 
 			It("considers the upgrade a success", func() {
-				err := upgrader.Upgrade()
+				err := upgrader.Upgrade(context.TODO())
 				Expect(err).ToNot(HaveOccurred())
 			})
 
@@ -105,31 +271,724 @@ var _ = Describe("Upgrader", func() {
 
 		Context("when the upgrade script returns an unacceptable error", func() {
 			BeforeEach(func() {
-				fakeDbHelper.UpgradeStub = func() (string, error) {
+				fakeDbHelper.UpgradeStub = func(context.Context, bool) (string, error) {
 					return "unacceptable error", errors.New("exited 1")
 				}
 			})
 
 			It("considers the upgrade a failure", func() {
-				err := upgrader.Upgrade()
-				Expect(err).To(HaveOccurred())
+				err := upgrader.Upgrade(context.TODO())
+				Expect(err).To(MatchError("mysql_upgrade failed: unacceptable error"))
+			})
+		})
+
+		Context("when mysql_upgrade reports on tables", func() {
+			BeforeEach(func() {
+				fakeDbHelper.UpgradeReturns(`Checking if update is needed.
+Checking server version.
+Running queries to upgrade MySQL server.
+Checking system database.
+mysql.db                                           OK
+mysql.user                                         OK
+Checking databases.
+app.orders
+error    : Table rebuild required. Please do "ALTER TABLE `+"`orders`"+` FORCE" or dump/reload to fix it!
+app.users                                          OK
+Repairing tables
+app.orders                                         OK
+Upgrade process completed successfully.
+Checking if update is needed.
+`, nil)
+			})
+
+			It("persists a report next to the last upgraded version file", func() {
+				Expect(upgrader.Upgrade(context.TODO())).To(Succeed())
+
+				Expect(writtenFiles()).To(HaveKey(upgradeReportFile))
+
+				var report UpgradeReport
+				Expect(json.Unmarshal([]byte(writtenFiles()[upgradeReportFile]), &report)).To(Succeed())
+				Expect(report.Succeeded).To(BeTrue())
+				Expect(report.TablesChecked).To(Equal([]string{"mysql.db", "mysql.user", "app.orders", "app.users"}))
+				Expect(report.TablesRepaired).To(Equal([]string{"app.orders"}))
+				Expect(report.TablesFailed).To(BeEmpty())
+			})
+		})
+
+		Context("when an error matches a fatal pattern", func() {
+			BeforeEach(func() {
+				upgrader = NewUpgrader(
+					fakeOs,
+					config.Upgrader{
+						PackageVersionFile:         packageVersionFile,
+						LastUpgradedVersionFile:    lastUpgradedVersionFile,
+						DBReachablePollingAttempts: 30,
+						DBReachablePollingDelay:    10,
+						ToleratedUpgradeErrors:     []string{"already upgraded", "rebuild required"},
+						FatalUpgradeErrors:         []string{"Corrupt"},
+					},
+					testLogger,
+					fakeDbHelper,
+					fakeSnapshotter,
+				)
+
+				fakeDbHelper.UpgradeReturns(`Checking databases.
+app.orders
+error    : Corrupt
+app.users
+error    : Table rebuild required.
+Upgrade process completed successfully.
+`, nil)
+			})
+
+			It("fails the upgrade even though mysql_upgrade succeeded", func() {
+				err := upgrader.Upgrade(context.TODO())
+				Expect(err).To(MatchError("mysql_upgrade failed: Corrupt"))
+
+				var report UpgradeReport
+				Expect(json.Unmarshal([]byte(writtenFiles()[upgradeReportFile]), &report)).To(Succeed())
+				Expect(report.Succeeded).To(BeFalse())
+				Expect(report.Fatal).To(Equal([]string{"Corrupt"}))
+				Expect(report.Tolerated).To(Equal([]string{"Table rebuild required."}))
+			})
+		})
+
+		Context("when an upgrade error pattern is invalid", func() {
+			BeforeEach(func() {
+				upgrader = NewUpgrader(
+					fakeOs,
+					config.Upgrader{
+						PackageVersionFile:      packageVersionFile,
+						LastUpgradedVersionFile: lastUpgradedVersionFile,
+						ToleratedUpgradeErrors:  []string{"already (upgraded"},
+					},
+					testLogger,
+					fakeDbHelper,
+					fakeSnapshotter,
+				)
+			})
+
+			It("returns an error without starting mysqld", func() {
+				err := upgrader.Upgrade(context.TODO())
+				Expect(err).To(MatchError(ContainSubstring(`invalid tolerated upgrade error pattern "already (upgraded"`)))
+				Expect(fakeDbHelper.StartMysqldForUpgradeCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when the context is cancelled while waiting for mysqld", func() {
+			var ctx context.Context
+
+			BeforeEach(func() {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithCancel(context.Background())
+				cancel()
+
+				fakeDbHelper.IsDatabaseReachableReturns(false)
+				fakeDbHelper.IsDatabaseReachableStub = nil
+				fakeOs.SleepStub = func(ctx context.Context, _ time.Duration) error {
+					return ctx.Err()
+				}
+			})
+
+			It("terminates mysqld without running the upgrade script", func() {
+				err := upgrader.Upgrade(ctx)
+				Expect(err).To(Equal(context.Canceled))
+
+				Expect(fakeOs.SleepCallCount()).To(Equal(1))
+				Expect(fakeDbHelper.UpgradeCallCount()).To(Equal(0))
+				Expect(fakeDbHelper.StopMysqldContextCallCount()).To(Equal(0))
+				Expect(fakeOs.KillCommandCallCount()).To(Equal(1))
+				_, signal := fakeOs.KillCommandArgsForCall(0)
+				Expect(signal).To(Equal(os.Signal(syscall.SIGTERM)))
+			})
+		})
+
+		Context("when the context is cancelled while the upgrade script runs", func() {
+			It("stops mysqld and reports the cancellation", func() {
+				ctx, cancel := context.WithCancel(context.Background())
+				fakeDbHelper.UpgradeStub = func(context.Context, bool) (string, error) {
+					cancel()
+					return "", errors.New("signal: killed")
+				}
+
+				err := upgrader.Upgrade(ctx)
+				Expect(err).To(Equal(context.Canceled))
+				Expect(fakeDbHelper.StopMysqldContextCallCount()).To(Equal(1))
 			})
 		})
 
+		It("does not take a snapshot unless snapshots are enabled", func() {
+			Expect(upgrader.Upgrade(context.TODO())).To(Succeed())
+			Expect(fakeSnapshotter.TakeCallCount()).To(Equal(0))
+		})
+
 		Context("when mysqld fails on shutdown", func() {
 			BeforeEach(func() {
+				mysqlErrorCh := make(chan error, 1)
 				fakeOs.WaitForCommandStub = func(cmd *exec.Cmd) chan error {
-					mysqlErrorCh := make(chan error, 1)
-					mysqlErrorCh <- errors.New(`mysqld failed`)
 					return mysqlErrorCh
 				}
+				fakeDbHelper.StopMysqldContextStub = func(context.Context) error {
+					mysqlErrorCh <- errors.New(`mysqld failed`)
+					return nil
+				}
 			})
 
 			It("returns an error", func() {
-				err := upgrader.Upgrade()
+				err := upgrader.Upgrade(context.TODO())
 				Expect(err).To(MatchError(`mysqld failed during upgrade: mysqld failed`))
 			})
 		})
+
+		Context("when mysqld exits before it accepts connections", func() {
+			BeforeEach(func() {
+				fakeOs.WaitForCommandStub = func(cmd *exec.Cmd) chan error {
+					mysqlErrorCh := make(chan error, 1)
+					mysqlErrorCh <- errors.New(`exit status 1`)
+					return mysqlErrorCh
+				}
+			})
+
+			It("returns an error without waiting any longer or running the upgrade", func() {
+				err := upgrader.Upgrade(context.TODO())
+				Expect(err).To(MatchError(`mysqld exited during upgrade: exit status 1`))
+
+				Expect(fakeDbHelper.IsDatabaseReachableCallCount()).To(Equal(0))
+				Expect(fakeDbHelper.UpgradeCallCount()).To(Equal(0))
+				Expect(fakeOs.KillCommandCallCount()).To(Equal(0))
+				Expect(testLogger.Buffer()).To(gbytes.Say(`mysql-upgrade-failed`))
+			})
+		})
+	})
+
+	Describe("Upgrade marker", func() {
+		var markerContents string
+
+		BeforeEach(func() {
+			markerContents = ""
+			fakeDbHelper.IsDatabaseReachableReturns(true)
+			fakeOs.FileExistsStub = func(filename string) bool {
+				return filename != upgradeMarkerFile || markerContents != ""
+			}
+			fakeOs.ReadFileStub = func(filename string) (string, error) {
+				switch filename {
+				case lastUpgradedVersionFile:
+					return "8.0.19-10", nil
+				case packageVersionFile:
+					return "8.0.20-11\n", nil
+				case upgradeMarkerFile:
+					return markerContents, nil
+				}
+				return "", errors.New("unhandled case!")
+			}
+		})
+
+		readMarker := func() UpgradeMarker {
+			var marker UpgradeMarker
+			Expect(json.Unmarshal([]byte(writtenFiles()[upgradeMarkerFile]), &marker)).To(Succeed())
+			return marker
+		}
+
+		It("records the upgrade before starting mysqld and clears it once the upgrade succeeded", func() {
+			fakeDbHelper.StartMysqldForUpgradeStub = func() (*exec.Cmd, error) {
+				Expect(writtenFiles()).To(HaveKey(upgradeMarkerFile))
+				Expect(fakeOs.RemoveFileCallCount()).To(Equal(0))
+				return nil, nil
+			}
+
+			Expect(upgrader.Upgrade(context.TODO())).To(Succeed())
+
+			marker := readMarker()
+			Expect(marker.FromVersion).To(Equal("8.0.19-10"))
+			Expect(marker.ToVersion).To(Equal("8.0.20-11"))
+			Expect(marker.Strategy).To(Equal("mysql_upgrade"))
+			Expect(marker.Attempts).To(Equal(1))
+			Expect(marker.StartedAt).NotTo(BeZero())
+
+			Expect(fakeOs.RemoveFileCallCount()).To(Equal(1))
+			Expect(fakeOs.RemoveFileArgsForCall(0)).To(Equal(upgradeMarkerFile))
+
+			_, force := fakeDbHelper.UpgradeArgsForCall(0)
+			Expect(force).To(BeFalse())
+		})
+
+		Context("when the upgrade fails", func() {
+			BeforeEach(func() {
+				fakeDbHelper.UpgradeReturns("unacceptable error", errors.New("exited 1"))
+			})
+
+			It("keeps the marker for the next start", func() {
+				Expect(upgrader.Upgrade(context.TODO())).NotTo(Succeed())
+				Expect(fakeOs.RemoveFileCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when a previous upgrade was interrupted", func() {
+			BeforeEach(func() {
+				markerContents = `{"from_version":"8.0.18-9","to_version":"8.0.20-11","strategy":"mysql_upgrade","started_at":"2020-10-18T12:00:00Z","attempts":1}`
+			})
+
+			It("requires an upgrade even though the data directory looks upgraded", func() {
+				fakeOs.ReadFileStub = func(filename string) (string, error) {
+					switch filename {
+					case upgradeMarkerFile:
+						return markerContents, nil
+					}
+					return "8.0.20-11", nil
+				}
+
+				needsUpgrade, err := upgrader.NeedsUpgrade()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(needsUpgrade).To(BeTrue())
+				Expect(testLogger.Buffer()).To(gbytes.Say("interrupted-upgrade-detected"))
+			})
+
+			It("resumes it with a forced upgrade", func() {
+				Expect(upgrader.Upgrade(context.TODO())).To(Succeed())
+
+				_, force := fakeDbHelper.UpgradeArgsForCall(0)
+				Expect(force).To(BeTrue())
+
+				marker := readMarker()
+				Expect(marker.FromVersion).To(Equal("8.0.18-9"))
+				Expect(marker.Attempts).To(Equal(2))
+				Expect(fakeOs.RemoveFileCallCount()).To(Equal(1))
+			})
+
+			Context("with the server strategy", func() {
+				BeforeEach(func() {
+					upgrader = NewUpgrader(
+						fakeOs,
+						config.Upgrader{
+							PackageVersionFile:         packageVersionFile,
+							LastUpgradedVersionFile:    lastUpgradedVersionFile,
+							DBReachablePollingAttempts: 30,
+							DBReachablePollingDelay:    10,
+							Strategy:                   config.UpgradeStrategyServer,
+							ServerUpgradeMode:          config.ServerUpgradeModeAuto,
+						},
+						testLogger,
+						fakeDbHelper,
+						fakeSnapshotter,
+					)
+					fakeDbHelper.StartMysqldForServerUpgradeReturns(nil, "/var/vcap/sys/log/pxc-mysql/server-upgrade.log", nil)
+				})
+
+				It("forces the server upgrade", func() {
+					upgrader.Upgrade(context.TODO())
+					Expect(fakeDbHelper.StartMysqldForServerUpgradeArgsForCall(0)).To(Equal("FORCE"))
+				})
+			})
+
+			Context("and the DB package changed since", func() {
+				BeforeEach(func() {
+					markerContents = `{"from_version":"8.0.18-9","to_version":"8.0.21-12","attempts":1}`
+				})
+
+				It("refuses to start", func() {
+					_, err := upgrader.NeedsUpgrade()
+					Expect(err).To(MatchError(ContainSubstring(`an upgrade from "8.0.18-9" to "8.0.21-12" was interrupted, but the DB package version is now "8.0.20-11"`)))
+				})
+			})
+
+			Context("and the marker cannot be parsed", func() {
+				BeforeEach(func() {
+					markerContents = `{"from_version":`
+				})
+
+				It("still requires an upgrade", func() {
+					needsUpgrade, err := upgrader.NeedsUpgrade()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(needsUpgrade).To(BeTrue())
+				})
+			})
+		})
+	})
+
+	Describe("Upgrade to a new release series", func() {
+		var lastUpgradedVersion string
+
+		BeforeEach(func() {
+			upgrader = NewUpgrader(
+				fakeOs,
+				config.Upgrader{
+					PackageVersionFile:         packageVersionFile,
+					LastUpgradedVersionFile:    lastUpgradedVersionFile,
+					DBReachablePollingAttempts: 30,
+					DBReachablePollingDelay:    10,
+					MajorUpgradeCheckCommand:   []string{"/var/vcap/packages/mysql-shell/bin/check-upgrade", "--strict"},
+				},
+				testLogger,
+				fakeDbHelper,
+				fakeSnapshotter,
+			)
+
+			lastUpgradedVersion = "5.7.30-33-57"
+			fakeOs.FileExistsStub = existsWithoutUpgradeMarker
+			fakeOs.ReadFileStub = func(filename string) (string, error) {
+				switch filename {
+				case lastUpgradedVersionFile:
+					return lastUpgradedVersion, nil
+				case packageVersionFile:
+					return "8.0.20-11", nil
+				}
+				return "", errors.New("unhandled case!")
+			}
+			fakeDbHelper.IsDatabaseReachableReturns(true)
+		})
+
+		It("runs the major upgrade check before starting mysqld", func() {
+			Expect(upgrader.Upgrade(context.TODO())).To(Succeed())
+
+			Expect(fakeOs.RunCommandContextCallCount()).To(Equal(1))
+			_, executable, args := fakeOs.RunCommandContextArgsForCall(0)
+			Expect(executable).To(Equal("/var/vcap/packages/mysql-shell/bin/check-upgrade"))
+			Expect(args).To(Equal([]string{"--strict", "5.7.30-33-57", "8.0.20-11"}))
+			Expect(fakeDbHelper.StartMysqldForUpgradeCallCount()).To(Equal(1))
+		})
+
+		Context("when the major upgrade check fails", func() {
+			BeforeEach(func() {
+				fakeOs.RunCommandContextReturns("tables use removed features\n", errors.New("exit status 1"))
+			})
+
+			It("refuses to upgrade", func() {
+				err := upgrader.Upgrade(context.TODO())
+				Expect(err).To(MatchError("major upgrade check from 5.7.30-33-57 to 8.0.20-11 failed: tables use removed features: exit status 1"))
+				Expect(fakeDbHelper.StartMysqldForUpgradeCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when the upgrade skips a release series", func() {
+			BeforeEach(func() {
+				lastUpgradedVersion = "5.6.48-88.0"
+			})
+
+			It("refuses to upgrade without running the check", func() {
+				err := upgrader.Upgrade(context.TODO())
+				Expect(err).To(MatchError("upgrading from 5.6 to 8.0 skips release series 5.7; upgrade through each release series in turn"))
+				Expect(fakeOs.RunCommandContextCallCount()).To(Equal(0))
+				Expect(fakeDbHelper.StartMysqldForUpgradeCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when the upgrade stays within a release series", func() {
+			BeforeEach(func() {
+				lastUpgradedVersion = "8.0.19-10"
+			})
+
+			It("does not run the major upgrade check", func() {
+				Expect(upgrader.Upgrade(context.TODO())).To(Succeed())
+				Expect(fakeOs.RunCommandContextCallCount()).To(Equal(0))
+			})
+		})
+	})
+
+	Describe("Upgrade with snapshots enabled", func() {
+		BeforeEach(func() {
+			upgrader = NewUpgrader(
+				fakeOs,
+				config.Upgrader{
+					PackageVersionFile:         packageVersionFile,
+					LastUpgradedVersionFile:    lastUpgradedVersionFile,
+					DBReachablePollingAttempts: 30,
+					DBReachablePollingDelay:    10,
+					Snapshot: config.UpgradeSnapshot{
+						Enabled: true,
+					},
+				},
+				testLogger,
+				fakeDbHelper,
+				fakeSnapshotter,
+			)
+
+			fakeDbHelper.IsDatabaseReachableReturns(true)
+			fakeSnapshotter.TakeReturns("/snapshots/upgrade-20201018T120000Z", nil)
+		})
+
+		It("takes a snapshot before starting mysqld and prunes old snapshots after the upgrade", func() {
+			fakeSnapshotter.TakeStub = func(context.Context) (string, error) {
+				Expect(fakeDbHelper.StartMysqldForUpgradeCallCount()).To(Equal(0))
+				return "/snapshots/upgrade-20201018T120000Z", nil
+			}
+
+			Expect(upgrader.Upgrade(context.TODO())).To(Succeed())
+
+			Expect(fakeSnapshotter.TakeCallCount()).To(Equal(1))
+			Expect(fakeDbHelper.StartMysqldForUpgradeCallCount()).To(Equal(1))
+			Expect(fakeSnapshotter.PruneCallCount()).To(Equal(1))
+			Expect(fakeSnapshotter.RestoreCallCount()).To(Equal(0))
+		})
+
+		It("records the snapshot in the upgrade marker", func() {
+			Expect(upgrader.Upgrade(context.TODO())).To(Succeed())
+
+			var marker UpgradeMarker
+			Expect(json.Unmarshal([]byte(writtenFiles()[upgradeMarkerFile]), &marker)).To(Succeed())
+			Expect(marker.Snapshot).To(Equal("/snapshots/upgrade-20201018T120000Z"))
+		})
+
+		Context("when a previous upgrade was interrupted after taking a snapshot", func() {
+			var snapshotExists bool
+
+			BeforeEach(func() {
+				snapshotExists = true
+				fakeOs.FileExistsStub = func(filename string) bool {
+					switch filename {
+					case "/snapshots/upgrade-20201017T120000Z":
+						return snapshotExists
+					}
+					return true
+				}
+				fakeOs.ReadFileStub = func(filename string) (string, error) {
+					switch filename {
+					case upgradeMarkerFile:
+						return `{"from_version":"8.0.18-9","to_version":"8.0.20-11","strategy":"mysql_upgrade","attempts":1,"snapshot":"/snapshots/upgrade-20201017T120000Z"}`, nil
+					}
+					return "8.0.20-11", nil
+				}
+			})
+
+			It("reuses that snapshot instead of copying the data directory again", func() {
+				Expect(upgrader.Upgrade(context.TODO())).To(Succeed())
+				Expect(fakeSnapshotter.TakeCallCount()).To(Equal(0))
+				Expect(testLogger.Buffer()).To(gbytes.Say(`reusing-snapshot`))
+			})
+
+			It("restores that snapshot when the upgrade fails again", func() {
+				fakeDbHelper.UpgradeReturns("unacceptable error", errors.New("exited 1"))
+
+				Expect(upgrader.Upgrade(context.TODO())).NotTo(Succeed())
+				Expect(fakeSnapshotter.RestoreArgsForCall(0)).To(Equal("/snapshots/upgrade-20201017T120000Z"))
+			})
+
+			Context("and the snapshot is gone", func() {
+				BeforeEach(func() {
+					snapshotExists = false
+				})
+
+				It("takes a new one", func() {
+					Expect(upgrader.Upgrade(context.TODO())).To(Succeed())
+					Expect(fakeSnapshotter.TakeCallCount()).To(Equal(1))
+				})
+			})
+		})
+
+		Context("when taking the snapshot fails", func() {
+			BeforeEach(func() {
+				fakeSnapshotter.TakeReturns("", errors.New("no space left on device"))
+			})
+
+			It("does not upgrade", func() {
+				err := upgrader.Upgrade(context.TODO())
+				Expect(err).To(MatchError("no space left on device"))
+				Expect(fakeDbHelper.StartMysqldForUpgradeCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when pruning old snapshots fails", func() {
+			BeforeEach(func() {
+				fakeSnapshotter.PruneReturns(errors.New("permission denied"))
+			})
+
+			It("still considers the upgrade a success", func() {
+				Expect(upgrader.Upgrade(context.TODO())).To(Succeed())
+				Expect(testLogger.Buffer()).To(gbytes.Say(`prune-snapshots-failed`))
+			})
+		})
+
+		Context("when the upgrade fails", func() {
+			BeforeEach(func() {
+				fakeDbHelper.UpgradeReturns("unacceptable error", errors.New("exited 1"))
+			})
+
+			It("restores the snapshot after mysqld stopped", func() {
+				fakeSnapshotter.RestoreStub = func(string) error {
+					Expect(fakeDbHelper.StopMysqldContextCallCount()).To(Equal(1))
+					return nil
+				}
+
+				err := upgrader.Upgrade(context.TODO())
+				Expect(err).To(MatchError("upgrade failed, data directory restored from snapshot /snapshots/upgrade-20201018T120000Z: mysql_upgrade failed: unacceptable error"))
+
+				Expect(fakeSnapshotter.RestoreCallCount()).To(Equal(1))
+				Expect(fakeSnapshotter.RestoreArgsForCall(0)).To(Equal("/snapshots/upgrade-20201018T120000Z"))
+			})
+
+			It("prunes older snapshots once the data directory is restored", func() {
+				fakeSnapshotter.PruneStub = func() error {
+					Expect(fakeSnapshotter.RestoreCallCount()).To(Equal(1))
+					return nil
+				}
+
+				Expect(upgrader.Upgrade(context.TODO())).NotTo(Succeed())
+				Expect(fakeSnapshotter.PruneCallCount()).To(Equal(1))
+			})
+
+			Context("and restoring the snapshot fails", func() {
+				BeforeEach(func() {
+					fakeSnapshotter.RestoreReturns(errors.New("cp failed"))
+				})
+
+				It("reports both failures and keeps every snapshot", func() {
+					err := upgrader.Upgrade(context.TODO())
+					Expect(err).To(MatchError("upgrade failed (mysql_upgrade failed: unacceptable error) and the data directory could not be restored: cp failed"))
+					Expect(fakeSnapshotter.PruneCallCount()).To(Equal(0))
+				})
+			})
+		})
+
+		Context("when the context is cancelled during the upgrade", func() {
+			It("keeps the snapshot without restoring it", func() {
+				ctx, cancel := context.WithCancel(context.Background())
+				fakeDbHelper.UpgradeStub = func(context.Context, bool) (string, error) {
+					cancel()
+					return "", errors.New("signal: killed")
+				}
+
+				err := upgrader.Upgrade(ctx)
+				Expect(err).To(Equal(context.Canceled))
+				Expect(fakeSnapshotter.RestoreCallCount()).To(Equal(0))
+				Expect(fakeSnapshotter.PruneCallCount()).To(Equal(0))
+			})
+		})
+	})
+
+	Describe("Upgrade with the server strategy", func() {
+		var (
+			mysqldExitChan chan error
+			upgradeLog     string
+		)
+
+		const completedUpgradeLog = `2020-05-01T12:00:00.000000Z 0 [System] [MY-010116] [Server] /usr/sbin/mysqld (mysqld 8.0.20) starting as process 42
+2020-05-01T12:00:01.000000Z 1 [System] [MY-013576] [InnoDB] InnoDB initialization has started.
+2020-05-01T12:00:02.000000Z 1 [System] [MY-013413] [Server] Data dictionary upgrade from version '80017' to '80019' started.
+2020-05-01T12:00:03.000000Z 1 [System] [MY-013413] [Server] Data dictionary upgrade from version '80017' to '80019' completed.
+2020-05-01T12:00:04.000000Z 4 [System] [MY-013381] [Server] Server upgrade from '80019' to '80020' started.
+2020-05-01T12:00:09.000000Z 4 [System] [MY-013381] [Server] Server upgrade from '80019' to '80020' completed.
+2020-05-01T12:00:10.000000Z 0 [System] [MY-010931] [Server] /usr/sbin/mysqld: ready for connections. Version: '8.0.20'
+`
+
+		BeforeEach(func() {
+			upgrader = NewUpgrader(
+				fakeOs,
+				config.Upgrader{
+					PackageVersionFile:         packageVersionFile,
+					LastUpgradedVersionFile:    lastUpgradedVersionFile,
+					DBReachablePollingAttempts: 30,
+					DBReachablePollingDelay:    10,
+					Strategy:                   config.UpgradeStrategyServer,
+					ServerUpgradeMode:          config.ServerUpgradeModeForce,
+				},
+				testLogger,
+				fakeDbHelper,
+				fakeSnapshotter,
+			)
+
+			upgradeLog = completedUpgradeLog
+			mysqldExitChan = make(chan error, 1)
+			fakeOs.WaitForCommandStub = func(cmd *exec.Cmd) chan error {
+				return mysqldExitChan
+			}
+			fakeDbHelper.StopMysqldContextStub = func(context.Context) error {
+				mysqldExitChan <- nil
+				return nil
+			}
+			fakeDbHelper.StartMysqldForServerUpgradeReturns(nil, "/var/vcap/sys/log/pxc-mysql/server-upgrade.log", nil)
+			fakeDbHelper.IsDatabaseReachableReturns(true)
+			fakeOs.ReadFileStub = func(filename string) (string, error) {
+				switch filename {
+				case "/var/vcap/sys/log/pxc-mysql/server-upgrade.log":
+					return upgradeLog, nil
+				case packageVersionFile:
+					return "8.0.20-11\n", nil
+				}
+				return "", errors.New("unhandled case!")
+			}
+		})
+
+		It("lets mysqld upgrade itself without running the upgrade script", func() {
+			err := upgrader.Upgrade(context.TODO())
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(fakeDbHelper.StartMysqldForUpgradeCallCount()).To(Equal(0))
+			Expect(fakeDbHelper.UpgradeCallCount()).To(Equal(0))
+			Expect(fakeDbHelper.StartMysqldForServerUpgradeCallCount()).To(Equal(1))
+			Expect(fakeDbHelper.StartMysqldForServerUpgradeArgsForCall(0)).To(Equal("FORCE"))
+			Expect(fakeDbHelper.StopMysqldContextCallCount()).To(Equal(1))
+		})
+
+		It("records the package version as upgraded", func() {
+			Expect(upgrader.Upgrade(context.TODO())).To(Succeed())
+
+			Expect(writtenFiles()).To(HaveKeyWithValue(lastUpgradedVersionFile, "8.0.20-11\n"))
+		})
+
+		It("reports the upgraded versions", func() {
+			Expect(upgrader.Upgrade(context.TODO())).To(Succeed())
+
+			Expect(testLogger.Buffer()).To(gbytes.Say(`server-upgrade-complete.*"dataDictionaryFromVersion":"80017","dataDictionaryToVersion":"80019","fromVersion":"80019","toVersion":"80020"`))
+		})
+
+		Context("when the data directory is already current", func() {
+			BeforeEach(func() {
+				upgradeLog = "2020-05-01T12:00:10.000000Z 0 [System] [MY-010931] [Server] /usr/sbin/mysqld: ready for connections.\n"
+			})
+
+			It("succeeds without an upgrade being reported", func() {
+				Expect(upgrader.Upgrade(context.TODO())).To(Succeed())
+				Expect(testLogger.Buffer()).To(gbytes.Say(`server-upgrade-not-required`))
+			})
+		})
+
+		Context("when the server upgrade started but never completed", func() {
+			BeforeEach(func() {
+				upgradeLog = "2020-05-01T12:00:04.000000Z 4 [System] [MY-013381] [Server] Server upgrade from '80019' to '80020' started.\n"
+			})
+
+			It("returns an error and does not record the version", func() {
+				err := upgrader.Upgrade(context.TODO())
+				Expect(err).To(MatchError("server upgrade from 80019 to 80020 did not complete"))
+				Expect(fakeDbHelper.StopMysqldContextCallCount()).To(Equal(1))
+				Expect(writtenFiles()).NotTo(HaveKey(lastUpgradedVersionFile))
+			})
+		})
+
+		Context("when mysqld exits because the upgrade failed", func() {
+			BeforeEach(func() {
+				upgradeLog = `2020-05-01T12:00:04.000000Z 4 [System] [MY-013381] [Server] Server upgrade from '80019' to '80020' started.
+2020-05-01T12:00:05.000000Z 4 [ERROR] [MY-013178] [Server] Execution of server-side SQL statement failed.
+2020-05-01T12:00:05.000000Z 0 [ERROR] [MY-013380] [Server] Failed to upgrade server.
+2020-05-01T12:00:05.000000Z 0 [ERROR] [MY-010119] [Server] Aborting
+`
+				fakeDbHelper.IsDatabaseReachableReturns(false)
+				mysqldExitChan <- errors.New("exit status 1")
+			})
+
+			It("returns the failure from the error log without waiting for mysqld", func() {
+				err := upgrader.Upgrade(context.TODO())
+				Expect(err).To(MatchError("mysqld exited during upgrade: exit status 1: server upgrade failed: Failed to upgrade server."))
+				Expect(fakeOs.SleepCallCount()).To(Equal(0))
+				Expect(fakeDbHelper.StopMysqldContextCallCount()).To(Equal(0))
+				Expect(writtenFiles()).NotTo(HaveKey(lastUpgradedVersionFile))
+			})
+		})
+
+		Context("when mysqld does not become reachable", func() {
+			BeforeEach(func() {
+				fakeDbHelper.IsDatabaseReachableReturns(false)
+				fakeOs.KillCommandStub = func(*exec.Cmd, os.Signal) error {
+					mysqldExitChan <- errors.New("signal: terminated")
+					return nil
+				}
+			})
+
+			It("terminates mysqld and returns an error", func() {
+				err := upgrader.Upgrade(context.TODO())
+				Expect(err).To(MatchError(`Database is not reachable after 30 tries.`))
+				Expect(fakeOs.KillCommandCallCount()).To(Equal(1))
+			})
+		})
 	})
 
 	Describe("NeedsUpgrade", func() {
@@ -168,7 +1027,7 @@ var _ = Describe("Upgrader", func() {
 
 		Context("when we fail to read the last upgraded version file in the mysqld datadir", func() {
 			BeforeEach(func() {
-				fakeOs.FileExistsReturns(true)
+				fakeOs.FileExistsStub = existsWithoutUpgradeMarker
 
 				fakeOs.ReadFileStub = func(filename string) (string, error) {
 					switch filename {
@@ -189,7 +1048,7 @@ var _ = Describe("Upgrader", func() {
 
 		Context("when we fail to read the package version file in the DB package", func() {
 			BeforeEach(func() {
-				fakeOs.FileExistsReturns(true)
+				fakeOs.FileExistsStub = existsWithoutUpgradeMarker
 
 				fakeOs.ReadFileStub = func(filename string) (string, error) {
 					switch filename {
@@ -210,7 +1069,7 @@ var _ = Describe("Upgrader", func() {
 
 		Context("when the last upgraded version in the mysqld datadir matches the DB package version", func() {
 			BeforeEach(func() {
-				fakeOs.FileExistsReturns(true)
+				fakeOs.FileExistsStub = existsWithoutUpgradeMarker
 
 				fakeOs.ReadFileStub = func(filename string) (string, error) {
 					switch filename {
@@ -230,9 +1089,120 @@ var _ = Describe("Upgrader", func() {
 			})
 		})
 
+		Context("when the DB package is a newer version", func() {
+			BeforeEach(func() {
+				fakeOs.FileExistsStub = existsWithoutUpgradeMarker
+
+				fakeOs.ReadFileStub = func(filename string) (string, error) {
+					switch filename {
+					case lastUpgradedVersionFile:
+						return "8.0.19-10", nil
+					case packageVersionFile:
+						return "8.0.20-11\n", nil
+					}
+					return "", errors.New("unhandled case!")
+				}
+			})
+
+			It("returns true", func() {
+				needsUpgrade, err := upgrader.NeedsUpgrade()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(needsUpgrade).To(BeTrue())
+			})
+		})
+
+		Context("when the versions differ only in how they are written", func() {
+			BeforeEach(func() {
+				fakeOs.FileExistsStub = existsWithoutUpgradeMarker
+
+				fakeOs.ReadFileStub = func(filename string) (string, error) {
+					switch filename {
+					case lastUpgradedVersionFile:
+						return "8.0.20", nil
+					case packageVersionFile:
+						return "8.0.20-0", nil
+					}
+					return "", errors.New("unhandled case!")
+				}
+			})
+
+			It("returns false", func() {
+				needsUpgrade, err := upgrader.NeedsUpgrade()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(needsUpgrade).To(BeFalse())
+			})
+		})
+
+		Context("when the DB package is older than the data directory", func() {
+			BeforeEach(func() {
+				fakeOs.FileExistsStub = existsWithoutUpgradeMarker
+
+				fakeOs.ReadFileStub = func(filename string) (string, error) {
+					switch filename {
+					case lastUpgradedVersionFile:
+						return "8.0.20-11", nil
+					case packageVersionFile:
+						return "8.0.19-10", nil
+					}
+					return "", errors.New("unhandled case!")
+				}
+			})
+
+			It("refuses to start", func() {
+				_, err := upgrader.NeedsUpgrade()
+				Expect(err).To(MatchError(ContainSubstring("DB package version 8.0.19-10 is older than the data directory, which was upgraded to 8.0.20-11")))
+			})
+
+			Context("and downgrades are allowed", func() {
+				BeforeEach(func() {
+					upgrader = NewUpgrader(
+						fakeOs,
+						config.Upgrader{
+							PackageVersionFile:      packageVersionFile,
+							LastUpgradedVersionFile: lastUpgradedVersionFile,
+							AllowDowngrade:          true,
+						},
+						testLogger,
+						fakeDbHelper,
+						fakeSnapshotter,
+					)
+				})
+
+				It("starts without upgrading", func() {
+					needsUpgrade, err := upgrader.NeedsUpgrade()
+					Expect(err).ToNot(HaveOccurred())
+					Expect(needsUpgrade).To(BeFalse())
+					Expect(testLogger.Buffer()).To(gbytes.Say("downgrade-allowed-skipping-upgrade"))
+				})
+			})
+		})
+
+		Context("when the DB package moves to a new release series", func() {
+			BeforeEach(func() {
+				fakeOs.FileExistsStub = existsWithoutUpgradeMarker
+
+				fakeOs.ReadFileStub = func(filename string) (string, error) {
+					switch filename {
+					case lastUpgradedVersionFile:
+						return "5.7.30-33-57", nil
+					case packageVersionFile:
+						return "8.0.20-11", nil
+					}
+					return "", errors.New("unhandled case!")
+				}
+			})
+
+			It("reports a major version upgrade", func() {
+				needsUpgrade, err := upgrader.NeedsUpgrade()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(needsUpgrade).To(BeTrue())
+				Expect(testLogger.Buffer()).To(gbytes.Say("major-version-upgrade"))
+			})
+		})
+
 		Context("when the version in the mysqld datadir does not match the DB package version", func() {
 			BeforeEach(func() {
-				fakeOs.FileExistsReturns(true)
+				fakeOs.FileExistsStub = existsWithoutUpgradeMarker
 
 				fakeOs.ReadFileStub = func(filename string) (string, error) {
 					switch filename {
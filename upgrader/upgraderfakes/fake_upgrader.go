@@ -2,6 +2,7 @@
 package upgraderfakes
 
 import (
+	"context"
 	"sync"
 
 	"github.com/cloudfoundry/galera-init/upgrader"
@@ -20,9 +21,10 @@ type FakeUpgrader struct {
 		result1 bool
 		result2 error
 	}
-	UpgradeStub        func() error
+	UpgradeStub        func(context.Context) error
 	upgradeMutex       sync.RWMutex
 	upgradeArgsForCall []struct {
+		arg1 context.Context
 	}
 	upgradeReturns struct {
 		result1 error
@@ -89,15 +91,16 @@ func (fake *FakeUpgrader) NeedsUpgradeReturnsOnCall(i int, result1 bool, result2
 	}{result1, result2}
 }
 
-func (fake *FakeUpgrader) Upgrade() error {
+func (fake *FakeUpgrader) Upgrade(arg1 context.Context) error {
 	fake.upgradeMutex.Lock()
 	ret, specificReturn := fake.upgradeReturnsOnCall[len(fake.upgradeArgsForCall)]
 	fake.upgradeArgsForCall = append(fake.upgradeArgsForCall, struct {
-	}{})
-	fake.recordInvocation("Upgrade", []interface{}{})
+		arg1 context.Context
+	}{arg1})
+	fake.recordInvocation("Upgrade", []interface{}{arg1})
 	fake.upgradeMutex.Unlock()
 	if fake.UpgradeStub != nil {
-		return fake.UpgradeStub()
+		return fake.UpgradeStub(arg1)
 	}
 	if specificReturn {
 		return ret.result1
@@ -112,12 +115,19 @@ func (fake *FakeUpgrader) UpgradeCallCount() int {
 	return len(fake.upgradeArgsForCall)
 }
 
-func (fake *FakeUpgrader) UpgradeCalls(stub func() error) {
+func (fake *FakeUpgrader) UpgradeCalls(stub func(context.Context) error) {
 	fake.upgradeMutex.Lock()
 	defer fake.upgradeMutex.Unlock()
 	fake.UpgradeStub = stub
 }
 
+func (fake *FakeUpgrader) UpgradeArgsForCall(i int) context.Context {
+	fake.upgradeMutex.RLock()
+	defer fake.upgradeMutex.RUnlock()
+	argsForCall := fake.upgradeArgsForCall[i]
+	return argsForCall.arg1
+}
+
 func (fake *FakeUpgrader) UpgradeReturns(result1 error) {
 	fake.upgradeMutex.Lock()
 	defer fake.upgradeMutex.Unlock()
@@ -0,0 +1,108 @@
+package upgrader
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Version is a MySQL server version as written to the package version file
+// and mysql_upgrade_info, e.g. 8.0.20-11 or 5.7.28-31-57
+type Version struct {
+	Major int
+	Minor int
+	Patch int
+	// Build holds the numeric distribution suffix, e.g. 31 and 57 in 5.7.28-31-57
+	Build []int
+	Raw   string
+}
+
+var versionPattern = regexp.MustCompile(`^(\d+)\.(\d+)\.(\d+)((?:[-.]\d+)*)`)
+
+// Release series in the order MySQL supports upgrading between them. An
+// upgrade may only move to the next series.
+var releaseSeries = []string{"5.5", "5.6", "5.7", "8.0"}
+
+// ParseVersion reads the leading numeric components of a version; anything
+// after them, such as -log, is ignored
+func ParseVersion(version string) (Version, error) {
+	raw := cleanVersion(version)
+
+	m := versionPattern.FindStringSubmatch(raw)
+	if m == nil {
+		return Version{}, fmt.Errorf("invalid version %q", raw)
+	}
+
+	v := Version{Raw: raw}
+	v.Major, _ = strconv.Atoi(m[1])
+	v.Minor, _ = strconv.Atoi(m[2])
+	v.Patch, _ = strconv.Atoi(m[3])
+
+	for _, component := range strings.FieldsFunc(m[4], func(r rune) bool { return r == '-' || r == '.' }) {
+		n, _ := strconv.Atoi(component)
+		v.Build = append(v.Build, n)
+	}
+
+	return v, nil
+}
+
+// cleanVersion strips the whitespace and NUL padding some tools leave
+// around versions
+func cleanVersion(version string) string {
+	return strings.Trim(version, " \t\r\n\x00")
+}
+
+// Compare returns -1, 0 or 1 when v is older than, the same as or newer than other
+func (v Version) Compare(other Version) int {
+	a := append([]int{v.Major, v.Minor, v.Patch}, v.Build...)
+	b := append([]int{other.Major, other.Minor, other.Patch}, other.Build...)
+
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+
+	return 0
+}
+
+// Series is the release series, e.g. 8.0
+func (v Version) Series() string {
+	return fmt.Sprintf("%d.%d", v.Major, v.Minor)
+}
+
+func (v Version) String() string {
+	return v.Raw
+}
+
+// skippedSeries returns the release series an upgrade from v to newer would
+// skip. Series galera-init does not know about are not checked.
+func (v Version) skippedSeries(newer Version) []string {
+	from, to := -1, -1
+	for i, series := range releaseSeries {
+		if series == v.Series() {
+			from = i
+		}
+		if series == newer.Series() {
+			to = i
+		}
+	}
+
+	if from == -1 || to == -1 || to <= from+1 {
+		return nil
+	}
+
+	return releaseSeries[from+1 : to]
+}
@@ -0,0 +1,53 @@
+package upgrader_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/cloudfoundry/galera-init/upgrader"
+)
+
+var _ = Describe("Version", func() {
+	Describe("ParseVersion", func() {
+		It("parses the distribution build components", func() {
+			v, err := ParseVersion("5.7.28-31-57\n")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(v).To(Equal(Version{Major: 5, Minor: 7, Patch: 28, Build: []int{31, 57}, Raw: "5.7.28-31-57"}))
+			Expect(v.Series()).To(Equal("5.7"))
+		})
+
+		It("ignores NUL padding and non-numeric suffixes", func() {
+			v, err := ParseVersion("8.0.20-11-log\x00")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(v.Build).To(Equal([]int{11}))
+			Expect(v.Raw).To(Equal("8.0.20-11-log"))
+		})
+
+		It("rejects versions without major, minor and patch", func() {
+			_, err := ParseVersion("new version")
+			Expect(err).To(MatchError(`invalid version "new version"`))
+		})
+	})
+
+	Describe("Compare", func() {
+		compare := func(a, b string) int {
+			va, err := ParseVersion(a)
+			Expect(err).NotTo(HaveOccurred())
+			vb, err := ParseVersion(b)
+			Expect(err).NotTo(HaveOccurred())
+
+			return va.Compare(vb)
+		}
+
+		It("orders versions by their numeric components", func() {
+			Expect(compare("8.0.20-11", "8.0.20-11")).To(Equal(0))
+			Expect(compare("8.0.9", "8.0.20")).To(Equal(-1))
+			Expect(compare("8.0.20-11.2", "8.0.20-11.1")).To(Equal(1))
+			Expect(compare("8.0.19", "5.7.30-33-57")).To(Equal(1))
+		})
+
+		It("treats missing build components as 0", func() {
+			Expect(compare("8.0.20", "8.0.20-0")).To(Equal(0))
+		})
+	})
+})